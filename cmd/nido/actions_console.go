@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	clijson "github.com/Josepavese/nido/internal/cli"
+	"github.com/Josepavese/nido/internal/provider"
+	"github.com/Josepavese/nido/internal/serial"
+	"github.com/Josepavese/nido/internal/ui"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+func actionVMConsole(app *appContext) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		name := args[0]
+		socket, err := app.Provider.ConsoleSocket(name)
+		if err != nil {
+			ui.Error("Failed to open console: %v", err)
+			os.Exit(1)
+		}
+		ui.Info("Connected to %s serial console. Press Ctrl-] to detach.", name)
+		fd := int(os.Stdin.Fd())
+		if term.IsTerminal(fd) {
+			old, err := term.MakeRaw(fd)
+			if err != nil {
+				ui.Error("Failed to switch the terminal to raw mode: %v", err)
+				os.Exit(1)
+			}
+			defer func() { _ = term.Restore(fd, old) }()
+		}
+		if err := serial.Attach(socket, os.Stdin, os.Stdout); err != nil {
+			ui.Error("Console disconnected: %v", err)
+		}
+		// Raw mode suppresses the carriage return; start a clean line.
+		fmt.Print("\r\n")
+	}
+}
+
+func actionVMLogs(app *appContext) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		jsonOut := jsonEnabled(cmd)
+		name := args[0]
+		follow, _ := cmd.Flags().GetBool("follow")
+		tail, _ := cmd.Flags().GetInt("tail")
+		since, err := sinceFlag(cmd, time.Now())
+		if err == nil && follow && jsonOut {
+			err = fmt.Errorf("--follow cannot be combined with --json")
+		}
+		if err == nil && tail < 0 {
+			err = fmt.Errorf("--tail must not be negative")
+		}
+		if err != nil {
+			if jsonOut {
+				_ = clijson.PrintJSON(clijson.NewResponseError("logs", "ERR_INVALID_ARGS", "Invalid logs options", err.Error(), "Example: nido logs <vm> --since 10m --tail 50", nil))
+			} else {
+				ui.Error("%v", err)
+			}
+			os.Exit(1)
+		}
+
+		opts := provider.LogOptions{Since: since, Tail: tail, Follow: follow}
+		lines := []provider.LogLine{}
+		emit := func(l provider.LogLine) {
+			if jsonOut {
+				lines = append(lines, l)
+				return
+			}
+			if l.Time.IsZero() {
+				fmt.Println(l.Text)
+				return
+			}
+			fmt.Printf("%s%s%s %s\n", ui.Dim, l.Time.Local().Format("2006-01-02 15:04:05"), ui.Reset, l.Text)
+		}
+		if err := app.Provider.Logs(name, opts, emit); err != nil {
+			if jsonOut {
+				_ = clijson.PrintJSON(clijson.NewResponseError("logs", providerErrorCode(err), "Logs failed", err.Error(), "Check the VM name with 'nido ls'.", nil))
+			} else {
+				ui.Error("Failed to read logs: %v", err)
+			}
+			os.Exit(1)
+		}
+		if jsonOut {
+			_ = clijson.PrintJSON(clijson.NewResponseOK("logs", map[string]interface{}{
+				"vm":    name,
+				"lines": lines,
+			}))
+		}
+	}
+}
+
+func actionVMSerialRelay(app *appContext) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		if err := app.Qemu.RunSerialRelay(args[0]); err != nil {
+			fmt.Fprintf(os.Stderr, "serial relay for %s: %v\n", args[0], err)
+			os.Exit(1)
+		}
+	}
+}
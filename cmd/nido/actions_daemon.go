@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	clijson "github.com/Josepavese/nido/internal/cli"
+	"github.com/Josepavese/nido/internal/provider"
+	"github.com/Josepavese/nido/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+func actionDaemon(app *appContext) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		jsonOut := jsonEnabled(cmd)
+		detach, _ := cmd.Flags().GetBool("detach")
+		if !detach {
+			if jsonOut {
+				_ = clijson.PrintJSON(clijson.NewResponseError("daemon", "ERR_INVALID_ARGS", "Invalid daemon options", "--json needs --detach; the foreground supervisor writes a log", "Use 'nido daemon --detach --json'.", nil))
+				os.Exit(1)
+			}
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			err := app.Qemu.Supervise(ctx, func(ev provider.SupervisorEvent) {
+				if ev.VM != "" {
+					fmt.Printf("%s %s: %s\n", ev.Time.Local().Format("2006-01-02 15:04:05"), ev.VM, ev.Message)
+					return
+				}
+				fmt.Printf("%s %s\n", ev.Time.Local().Format("2006-01-02 15:04:05"), ev.Message)
+			})
+			if err != nil {
+				ui.Error("Supervisor failed: %v", err)
+				os.Exit(1)
+			}
+			return
+		}
+
+		pid, err := app.Qemu.StartSupervisor()
+		if err != nil {
+			if jsonOut {
+				_ = clijson.PrintJSON(clijson.NewResponseError("daemon", "ERR_IO", "Daemon start failed", err.Error(), "", nil))
+			} else {
+				ui.Error("Failed to start the supervisor: %v", err)
+			}
+			os.Exit(1)
+		}
+		logPath := filepath.Join(app.Qemu.RootDir, "daemon.log")
+		if jsonOut {
+			_ = clijson.PrintJSON(clijson.NewResponseOK("daemon", map[string]interface{}{
+				"action": map[string]interface{}{"pid": pid, "log": logPath, "result": "started"},
+			}))
+			return
+		}
+		ui.Success("Supervisor started (pid %d). Log: %s", pid, logPath)
+	}
+}
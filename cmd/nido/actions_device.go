@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+
+	clijson "github.com/Josepavese/nido/internal/cli"
+	"github.com/Josepavese/nido/internal/provider"
+	"github.com/Josepavese/nido/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+func actionDeviceAdd(app *appContext) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		jsonOut := jsonEnabled(cmd)
+		id, _ := cmd.Flags().GetString("id")
+		readOnly, _ := cmd.Flags().GetBool("ro")
+		dev := provider.Device{ID: id, Type: args[1], ReadOnly: readOnly}
+		if len(args) > 2 {
+			dev.Source = args[2]
+		}
+		dev, applied, err := app.Provider.DeviceAdd(args[0], dev)
+		if err != nil {
+			if jsonOut {
+				_ = clijson.PrintJSON(clijson.NewResponseError("device add", providerErrorCode(err), "Device add failed", err.Error(), "Use disk or usb-storage with an existing image file, or nic without one.", nil))
+			} else {
+				ui.Error("Failed to add device: %v", err)
+			}
+			os.Exit(1)
+		}
+		if jsonOut {
+			_ = clijson.PrintJSON(clijson.NewResponseOK("device add", map[string]interface{}{
+				"action": map[string]interface{}{"vm": args[0], "device": dev, "applied": applied, "result": "added"},
+			}))
+			return
+		}
+		if applied == provider.AppliedLive {
+			ui.Success("Device %s (%s) plugged into %s.", dev.ID, dev.Type, args[0])
+		} else {
+			ui.Success("Device %s (%s) will be plugged into %s on next boot.", dev.ID, dev.Type, args[0])
+		}
+	}
+}
+
+func actionDeviceRemove(app *appContext) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		jsonOut := jsonEnabled(cmd)
+		applied, err := app.Provider.DeviceRemove(args[0], args[1])
+		if err != nil {
+			if jsonOut {
+				_ = clijson.PrintJSON(clijson.NewResponseError("device remove", providerErrorCode(err), "Device remove failed", err.Error(), "Check the device ID with 'nido info'.", nil))
+			} else {
+				ui.Error("Failed to remove device: %v", err)
+			}
+			os.Exit(1)
+		}
+		if jsonOut {
+			_ = clijson.PrintJSON(clijson.NewResponseOK("device remove", map[string]interface{}{
+				"action": map[string]interface{}{"vm": args[0], "id": args[1], "applied": applied, "result": "removed"},
+			}))
+			return
+		}
+		if applied == provider.AppliedLive {
+			ui.Success("Device %s unplugged from %s.", args[1], args[0])
+		} else {
+			ui.Success("Device %s removed from %s; it disappears on next boot.", args[1], args[0])
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+
+	clijson "github.com/Josepavese/nido/internal/cli"
+	"github.com/Josepavese/nido/internal/provider"
+	"github.com/Josepavese/nido/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+func actionDiskResize(app *appContext) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		jsonOut := jsonEnabled(cmd)
+		name, size := args[0], args[1]
+		if err := provider.ValidateDiskSize(size); err != nil {
+			if jsonOut {
+				_ = clijson.PrintJSON(clijson.NewResponseError("disk resize", "ERR_INVALID_ARGS", "Invalid disk size", err.Error(), "Use a size like +20G or 60G.", nil))
+			} else {
+				ui.Error("Invalid disk size: %v", err)
+			}
+			os.Exit(1)
+		}
+		if !jsonOut {
+			ui.Step("Resizing disk of %s (%s)...", name, size)
+		}
+		applied, err := app.Provider.UpdateConfig(name, provider.VMConfigUpdates{DiskSize: &size})
+		if err != nil {
+			if jsonOut {
+				_ = clijson.PrintJSON(clijson.NewResponseError("disk resize", providerErrorCode(err), "Disk resize failed", err.Error(), "Check the VM name; disks can only grow.", nil))
+			} else {
+				ui.Error("Failed to resize disk: %v", err)
+			}
+			os.Exit(1)
+		}
+		info, _ := app.Provider.Info(name)
+		if jsonOut {
+			_ = clijson.PrintJSON(clijson.NewResponseOK("disk resize", map[string]interface{}{
+				"action": map[string]interface{}{"vm": name, "size": size, "disk_size_bytes": info.DiskSizeBytes, "applied": applied, "result": "resized"},
+			}))
+			return
+		}
+		ui.Success("Disk of %s is now %s. The guest filesystem grows on next boot.", name, ui.HumanSize(info.DiskSizeBytes))
+	}
+}
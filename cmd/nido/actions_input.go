@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	clijson "github.com/Josepavese/nido/internal/cli"
+	"github.com/Josepavese/nido/internal/provider"
+	"github.com/Josepavese/nido/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+// parseInputArgs turns 'nido input <vm> <action> [args...]' into an
+// InputAction.
+func parseInputArgs(action string, rest []string, button string) (provider.InputAction, error) {
+	in := provider.InputAction{Action: action}
+	switch action {
+	case provider.InputType:
+		in.Text = strings.Join(rest, " ")
+	case provider.InputKey:
+		in.Keys = rest
+	case provider.InputClick, provider.InputMove:
+		if len(rest) != 2 {
+			return in, fmt.Errorf("%s takes x and y display coordinates", action)
+		}
+		x, errX := strconv.Atoi(rest[0])
+		y, errY := strconv.Atoi(rest[1])
+		if errX != nil || errY != nil {
+			return in, fmt.Errorf("invalid coordinates %q %q", rest[0], rest[1])
+		}
+		in.X, in.Y = x, y
+		if action == provider.InputClick {
+			in.Button = button
+		}
+	}
+	return in, provider.ValidateInput(in)
+}
+
+func actionVMInput(app *appContext) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		jsonOut := jsonEnabled(cmd)
+		name := args[0]
+		button, _ := cmd.Flags().GetString("button")
+		in, err := parseInputArgs(args[1], args[2:], button)
+		if err != nil {
+			if jsonOut {
+				_ = clijson.PrintJSON(clijson.NewResponseError("input", "ERR_INVALID_ARGS", "Invalid input", err.Error(), "Examples: nido input <vm> type \"text\", key ctrl+alt+t, click 100 200", nil))
+			} else {
+				ui.Error("%v", err)
+			}
+			os.Exit(1)
+		}
+		if err := app.Provider.SendInput(name, in); err != nil {
+			if jsonOut {
+				_ = clijson.PrintJSON(clijson.NewResponseError("input", providerErrorCode(err), "Input failed", err.Error(), "The VM must be running; pointer input needs a GUI VM.", nil))
+			} else {
+				ui.Error("Failed to send input: %v", err)
+			}
+			os.Exit(1)
+		}
+		if jsonOut {
+			_ = clijson.PrintJSON(clijson.NewResponseOK("input", map[string]interface{}{
+				"action": map[string]interface{}{"vm": name, "input": in, "result": "sent"},
+			}))
+			return
+		}
+		ui.Success("Sent %s input to %s.", in.Action, name)
+	}
+}
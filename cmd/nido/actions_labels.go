@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	clijson "github.com/Josepavese/nido/internal/cli"
+	"github.com/Josepavese/nido/internal/provider"
+	"github.com/Josepavese/nido/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+func actionVMLabel(app *appContext) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		jsonOut := jsonEnabled(cmd)
+		name := args[0]
+		fail := func(code, title string, err error, hint string) {
+			if jsonOut {
+				_ = clijson.PrintJSON(clijson.NewResponseError("label", code, title, err.Error(), hint, nil))
+			} else {
+				ui.Error("%s: %v", title, err)
+			}
+			os.Exit(1)
+		}
+
+		if len(args) == 1 {
+			info, err := app.Provider.Info(name)
+			if err != nil {
+				fail(providerErrorCode(err), "Label lookup failed", err, "Check the VM name and try again.")
+			}
+			labels := info.Labels
+			if labels == nil {
+				labels = map[string]string{}
+			}
+			if jsonOut {
+				_ = clijson.PrintJSON(clijson.NewResponseOK("label", map[string]interface{}{
+					"action": map[string]interface{}{"vm": name, "labels": labels, "result": "shown"},
+				}))
+				return
+			}
+			if len(labels) == 0 {
+				ui.Info("%s has no labels.", name)
+				return
+			}
+			for _, pair := range strings.Split(provider.FormatLabels(labels), ",") {
+				fmt.Println(pair)
+			}
+			return
+		}
+
+		var specs, remove []string
+		for _, arg := range args[1:] {
+			if key, ok := strings.CutSuffix(arg, "-"); ok && !strings.Contains(arg, "=") {
+				remove = append(remove, key)
+				continue
+			}
+			specs = append(specs, arg)
+		}
+		set, err := provider.ParseLabels(specs)
+		if err != nil {
+			fail("ERR_INVALID_ARGS", "Invalid label", err, "Usage: nido label <vm> key=value... key-...")
+		}
+		labels, err := app.Provider.SetLabels(name, set, remove)
+		if err != nil {
+			fail(providerErrorCode(err), "Label update failed", err, "Check the VM name and try again.")
+		}
+		if jsonOut {
+			_ = clijson.PrintJSON(clijson.NewResponseOK("label", map[string]interface{}{
+				"action": map[string]interface{}{"vm": name, "labels": labels, "result": "updated"},
+			}))
+			return
+		}
+		ui.Success("Labels of %s: %s", name, ternaryString(len(labels) > 0, provider.FormatLabels(labels), "none"))
+	}
+}
+
+// selectorFlag parses -l; ok is false when it was not given.
+func selectorFlag(cmd *cobra.Command) (sel provider.Selector, raw string, ok bool, err error) {
+	raw, _ = cmd.Flags().GetString("selector")
+	if raw == "" {
+		return nil, "", false, nil
+	}
+	sel, err = provider.ParseSelector(raw)
+	return sel, raw, true, err
+}
+
+// bulkResult is the outcome of a bulk operation on one VM.
+type bulkResult struct {
+	Name   string `json:"name"`
+	Result string `json:"result"`
+	Error  string `json:"error,omitempty"`
+}
+
+// bulkVMAction runs op on every VM matching -l for which want returns
+// true, reporting each outcome. It returns false when no selector was
+// given and the command should act on its VM argument instead.
+func bulkVMAction(app *appContext, cmd *cobra.Command, args []string, command, done string, want func(provider.VMStatus) bool, op func(name string) error) bool {
+	jsonOut := jsonEnabled(cmd)
+	sel, raw, ok, err := selectorFlag(cmd)
+	switch {
+	case err == nil && ok && len(args) > 0:
+		err = fmt.Errorf("give either a VM name or -l, not both")
+	case err == nil && !ok && len(args) == 0 && command != "prune":
+		err = fmt.Errorf("give a VM name or a -l selector")
+	}
+	if err != nil {
+		if jsonOut {
+			_ = clijson.PrintJSON(clijson.NewResponseError(command, "ERR_INVALID_ARGS", "Invalid selector", err.Error(), fmt.Sprintf("Usage: nido %s <name> or nido %s -l key=value", command, command), nil))
+		} else {
+			ui.Error("Invalid selector: %v", err)
+		}
+		os.Exit(1)
+	}
+	if !ok {
+		return false
+	}
+
+	vms, err := app.Provider.List()
+	if err != nil {
+		if jsonOut {
+			_ = clijson.PrintJSON(clijson.NewResponseError(command, "ERR_INTERNAL", "List failed", err.Error(), "Try again or run nido doctor for diagnostics.", nil))
+		} else {
+			ui.Error("List failed: %v", err)
+		}
+		os.Exit(1)
+	}
+	results := []bulkResult{}
+	failed := 0
+	for _, vm := range provider.FilterVMs(vms, sel) {
+		if !want(vm) {
+			continue
+		}
+		r := bulkResult{Name: vm.Name, Result: done}
+		if err := op(vm.Name); err != nil {
+			r.Result, r.Error = "failed", err.Error()
+			failed++
+		}
+		results = append(results, r)
+		if !jsonOut {
+			if r.Error != "" {
+				ui.Error("%s: %s", r.Name, r.Error)
+			} else {
+				ui.Success("VM %s %s.", r.Name, done)
+			}
+		}
+	}
+
+	if failed > 0 {
+		if jsonOut {
+			_ = clijson.PrintJSON(clijson.NewResponseError(command, "ERR_INTERNAL", "Bulk "+command+" failed", fmt.Sprintf("%d of %d VMs failed", failed, len(results)), "See details.results for each VM.", map[string]interface{}{"selector": raw, "results": results}))
+		}
+		os.Exit(1)
+	}
+	if jsonOut {
+		_ = clijson.PrintJSON(clijson.NewResponseOK(command, map[string]interface{}{
+			"action": map[string]interface{}{"selector": raw, "results": results},
+		}))
+		return true
+	}
+	if len(results) == 0 {
+		ui.Info("No VMs match %s.", raw)
+	}
+	return true
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+
+	clijson "github.com/Josepavese/nido/internal/cli"
+	"github.com/Josepavese/nido/internal/provider"
+	"github.com/Josepavese/nido/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+func actionMountAdd(app *appContext) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		jsonOut := jsonEnabled(cmd)
+		m, err := provider.ParseMount(args[1])
+		if err != nil {
+			if jsonOut {
+				_ = clijson.PrintJSON(clijson.NewResponseError("mount add", "ERR_INVALID_ARGS", "Invalid mount", err.Error(), "Use <host-dir>:<guest-path>[:ro] with an existing host directory.", nil))
+			} else {
+				ui.Error("Invalid mount: %v", err)
+			}
+			os.Exit(1)
+		}
+		if err := app.Provider.MountAdd(args[0], m); err != nil {
+			if jsonOut {
+				_ = clijson.PrintJSON(clijson.NewResponseError("mount add", providerErrorCode(err), "Mount add failed", err.Error(), "Stop the VM first and pick a guest path that is not already mounted.", nil))
+			} else {
+				ui.Error("Failed to add mount: %v", err)
+			}
+			os.Exit(1)
+		}
+		if jsonOut {
+			_ = clijson.PrintJSON(clijson.NewResponseOK("mount add", map[string]interface{}{
+				"action": map[string]interface{}{"vm": args[0], "mount": m, "result": "added"},
+			}))
+			return
+		}
+		ui.Success("%s will appear at %s on the next boot of %s.", m.HostPath, m.GuestPath, args[0])
+	}
+}
+
+func actionMountRemove(app *appContext) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		jsonOut := jsonEnabled(cmd)
+		if err := app.Provider.MountRemove(args[0], args[1]); err != nil {
+			if jsonOut {
+				_ = clijson.PrintJSON(clijson.NewResponseError("mount remove", providerErrorCode(err), "Mount remove failed", err.Error(), "Stop the VM first and check the guest path with 'nido info'.", nil))
+			} else {
+				ui.Error("Failed to remove mount: %v", err)
+			}
+			os.Exit(1)
+		}
+		if jsonOut {
+			_ = clijson.PrintJSON(clijson.NewResponseOK("mount remove", map[string]interface{}{
+				"action": map[string]interface{}{"vm": args[0], "guest_path": args[1], "result": "removed"},
+			}))
+			return
+		}
+		ui.Success("Mount %s removed from %s.", args[1], args[0])
+	}
+}
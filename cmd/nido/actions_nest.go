@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	clijson "github.com/Josepavese/nido/internal/cli"
+	"github.com/Josepavese/nido/internal/nest"
+	"github.com/Josepavese/nido/internal/provider"
+	"github.com/Josepavese/nido/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+func actionNestPlan(app *appContext) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		jsonOut := jsonEnabled(cmd)
+		f := loadNestFile(app, cmd, "plan")
+		changes := planNest(app, f, "plan", jsonOut)
+		if jsonOut {
+			_ = clijson.PrintJSON(clijson.NewResponseOK("plan", map[string]interface{}{"file": f.Path, "changes": changes}))
+			return
+		}
+
+		var create, update, start int
+		for _, c := range changes {
+			line := c.VM + ": " + ternaryString(len(c.Actions) > 0, strings.Join(c.Actions, ", "), "up to date")
+			if len(c.Drift) > 0 {
+				line += " (drift: " + strings.Join(c.Drift, ", ") + ")"
+			}
+			fmt.Println(line)
+			for _, note := range c.Notes {
+				ui.Warn("%s: %s", c.VM, note)
+			}
+			for _, action := range c.Actions {
+				switch action {
+				case nest.ActionCreate:
+					create++
+				case nest.ActionUpdate:
+					update++
+				case nest.ActionStart:
+					start++
+				}
+			}
+		}
+		ui.Info("Plan: %d to create, %d to update, %d to start.", create, update, start)
+	}
+}
+
+func actionNestUp(app *appContext) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		jsonOut := jsonEnabled(cmd)
+		f := loadNestFile(app, cmd, "up")
+		changes := planNest(app, f, "up", jsonOut)
+		results := nest.Up(f, app.Provider, changes, func(tag string) (provider.VMOptions, error) {
+			return resolveSpawnImage(app, tag, jsonOut)
+		})
+		reportNestResults("up", f, results, jsonOut)
+	}
+}
+
+func actionNestDown(app *appContext) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		jsonOut := jsonEnabled(cmd)
+		f := loadNestFile(app, cmd, "down")
+		results, err := nest.Down(f, app.Provider)
+		if err != nil {
+			if jsonOut {
+				_ = clijson.PrintJSON(clijson.NewResponseError("down", "ERR_INTERNAL", "List failed", err.Error(), "Try again or run nido doctor for diagnostics.", nil))
+			} else {
+				ui.Error("List failed: %v", err)
+			}
+			os.Exit(1)
+		}
+		reportNestResults("down", f, results, jsonOut)
+	}
+}
+
+// loadNestFile reads --file, or nido.yaml in the working directory.
+func loadNestFile(app *appContext, cmd *cobra.Command, command string) *nest.File {
+	path, _ := cmd.Flags().GetString("file")
+	if path == "" {
+		path = nest.DefaultFile
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(app.Cwd, path)
+	}
+	f, err := nest.Load(path)
+	if err != nil {
+		code, hint := "ERR_INVALID_ARGS", "Fix the nest file and try again."
+		if os.IsNotExist(err) {
+			code, hint = "ERR_NOT_FOUND", "Create nido.yaml next to your code or pass --file."
+		}
+		if jsonEnabled(cmd) {
+			_ = clijson.PrintJSON(clijson.NewResponseError(command, code, "Invalid nest file", err.Error(), hint, nil))
+		} else {
+			ui.Error("Invalid nest file: %v", err)
+		}
+		os.Exit(1)
+	}
+	return f
+}
+
+func planNest(app *appContext, f *nest.File, command string, jsonOut bool) []nest.Change {
+	changes, err := nest.Plan(f, app.Provider)
+	if err != nil {
+		if jsonOut {
+			_ = clijson.PrintJSON(clijson.NewResponseError(command, "ERR_INTERNAL", "Plan failed", err.Error(), "Try again or run nido doctor for diagnostics.", nil))
+		} else {
+			ui.Error("Plan failed: %v", err)
+		}
+		os.Exit(1)
+	}
+	return changes
+}
+
+// reportNestResults prints the per-VM outcome of up or down and exits
+// non-zero when any VM failed.
+func reportNestResults(command string, f *nest.File, results []nest.Result, jsonOut bool) {
+	failed := 0
+	for _, r := range results {
+		if r.Error != "" {
+			failed++
+		}
+		if jsonOut {
+			continue
+		}
+		switch {
+		case r.Error != "":
+			ui.Error("%s: %s", r.VM, r.Error)
+		case len(r.Actions) == 0:
+			ui.Info("%s: %s", r.VM, ternaryString(command == "up", "up to date", "not found"))
+		case r.Applied == provider.AppliedNextBoot && len(r.Actions) == 1 && r.Actions[0] == nest.ActionUpdate:
+			ui.Success("%s: updated (applies on next boot).", r.VM)
+		default:
+			done := make([]string, len(r.Actions))
+			for i, action := range r.Actions {
+				done[i] = strings.TrimSuffix(action, "e") + "ed"
+			}
+			ui.Success("%s: %s.", r.VM, strings.Join(done, ", "))
+		}
+	}
+
+	if failed > 0 {
+		if jsonOut {
+			_ = clijson.PrintJSON(clijson.NewResponseError(command, "ERR_INTERNAL", "nido "+command+" failed", fmt.Sprintf("%d of %d VMs failed", failed, len(results)), "See details.results for each VM.", map[string]interface{}{"file": f.Path, "results": results}))
+		}
+		os.Exit(1)
+	}
+	if jsonOut {
+		_ = clijson.PrintJSON(clijson.NewResponseOK(command, map[string]interface{}{"file": f.Path, "results": results}))
+	}
+}
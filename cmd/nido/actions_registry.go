@@ -15,7 +15,38 @@ func buildActionRegistry(app *appContext) map[string]climeta.ActionFunc {
 		"vm.ssh":                       actionVMSSH(app),
 		"vm.delete":                    actionVMDelete(app),
 		"vm.prune":                     actionVMPrune(app),
+		"vm.ttl":                       actionVMTTL(app),
+		"vm.label":                     actionVMLabel(app),
+		"nest.plan":                    actionNestPlan(app),
+		"nest.up":                      actionNestUp(app),
+		"nest.down":                    actionNestDown(app),
+		"snapshot.create":              actionSnapshotCreate(app),
+		"snapshot.list":                actionSnapshotList(app),
+		"snapshot.restore":             actionSnapshotRestore(app),
+		"snapshot.delete":              actionSnapshotDelete(app),
+		"mount.add":                    actionMountAdd(app),
+		"mount.remove":                 actionMountRemove(app),
+		"device.add":                   actionDeviceAdd(app),
+		"device.remove":                actionDeviceRemove(app),
+		"disk.resize":                  actionDiskResize(app),
+		"vm.checkpoint":                actionVMCheckpoint(app),
+		"vm.fork":                      actionVMFork(app),
+		"vm.exec":                      actionVMExec(app),
+		"vm.cp":                        actionVMCopy(app),
+		"vm.wait":                      actionVMWait(app),
+		"vm.resize":                    actionVMResize(app),
+		"vm.console":                   actionVMConsole(app),
+		"vm.logs":                      actionVMLogs(app),
+		"vm.serial_relay":              actionVMSerialRelay(app),
+		"vm.screenshot":                actionVMScreenshot(app),
+		"vm.input":                     actionVMInput(app),
+		"vm.resume":                    actionVMResume(app),
 		"ui.gui":                       func(cmd *cobra.Command, args []string) { cmdGUI(app.Provider, app.Config) },
+		"volume.create":                actionVolumeCreate(app),
+		"volume.list":                  actionVolumeList(app),
+		"volume.attach":                actionVolumeAttach(app),
+		"volume.detach":                actionVolumeDetach(app),
+		"volume.delete":                actionVolumeDelete(app),
 		"template.list":                actionTemplateList(app),
 		"template.create":              actionTemplateCreate(app),
 		"template.delete":              actionTemplateDelete(app),
@@ -36,6 +67,8 @@ func buildActionRegistry(app *appContext) map[string]climeta.ActionFunc {
 		"system.accel.list":            actionAccelList(app),
 		"system.config":                actionConfig(app),
 		"system.config.set":            actionConfigSet(app),
+		"system.daemon":                actionDaemon(app),
+		"state.migrate":                actionStateMigrate(app),
 		"system.register":              actionRegister(app),
 		"system.version":               actionVersion(app),
 		"system.update":                actionUpdate(app),
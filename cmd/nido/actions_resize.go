@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	clijson "github.com/Josepavese/nido/internal/cli"
+	"github.com/Josepavese/nido/internal/provider"
+	"github.com/Josepavese/nido/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+func actionVMResize(app *appContext) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		jsonOut := jsonEnabled(cmd)
+		name := args[0]
+		live, _ := cmd.Flags().GetBool("live")
+		updates := provider.VMConfigUpdates{Live: live}
+		var changes []string
+		if cmd.Flags().Changed("memory") {
+			val, _ := cmd.Flags().GetInt("memory")
+			updates.MemoryMB = &val
+			changes = append(changes, fmt.Sprintf("%d MB", val))
+		}
+		if cmd.Flags().Changed("cpus") {
+			val, _ := cmd.Flags().GetInt("cpus")
+			updates.VCPUs = &val
+			changes = append(changes, fmt.Sprintf("%d vCPUs", val))
+		}
+		if len(changes) == 0 {
+			if jsonOut {
+				_ = clijson.PrintJSON(clijson.NewResponseError("resize", "ERR_INVALID_ARGS", "Nothing to resize", "pass --memory and/or --cpus", "Example: nido resize <vm> --memory 1024 --live", nil))
+			} else {
+				ui.Error("Nothing to resize: pass --memory and/or --cpus.")
+			}
+			os.Exit(1)
+		}
+		if !jsonOut {
+			ui.Step("Resizing %s to %s...", name, strings.Join(changes, ", "))
+		}
+		applied, err := app.Provider.UpdateConfig(name, updates)
+		if err != nil {
+			if jsonOut {
+				_ = clijson.PrintJSON(clijson.NewResponseError("resize", providerErrorCode(err), "Resize failed", err.Error(), "Live changes stay within the --max-memory/--max-cpus ceilings the VM booted with.", nil))
+			} else {
+				ui.Error("Failed to resize: %v", err)
+			}
+			os.Exit(1)
+		}
+		if jsonOut {
+			action := map[string]interface{}{"vm": name, "applied": applied, "result": "resized"}
+			if updates.MemoryMB != nil {
+				action["memory_mb"] = *updates.MemoryMB
+			}
+			if updates.VCPUs != nil {
+				action["vcpus"] = *updates.VCPUs
+			}
+			_ = clijson.PrintJSON(clijson.NewResponseOK("resize", map[string]interface{}{"action": action}))
+			return
+		}
+		if applied == provider.AppliedLive {
+			ui.Success("%s now runs with %s.", name, strings.Join(changes, ", "))
+			return
+		}
+		ui.Success("%s will use %s on next boot.", name, strings.Join(changes, ", "))
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"image/png"
+	"os"
+
+	clijson "github.com/Josepavese/nido/internal/cli"
+	"github.com/Josepavese/nido/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+func actionVMScreenshot(app *appContext) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		jsonOut := jsonEnabled(cmd)
+		name := args[0]
+		out, _ := cmd.Flags().GetString("output")
+		if out == "" {
+			out = name + ".png"
+		}
+		data, err := app.Provider.Screenshot(name)
+		if err == nil {
+			err = os.WriteFile(out, data, 0644)
+		}
+		if err != nil {
+			if jsonOut {
+				_ = clijson.PrintJSON(clijson.NewResponseError("screenshot", providerErrorCode(err), "Screenshot failed", err.Error(), "The VM must be running; start it with 'nido start'.", nil))
+			} else {
+				ui.Error("Failed to take screenshot: %v", err)
+			}
+			os.Exit(1)
+		}
+		cfg, _ := png.DecodeConfig(bytes.NewReader(data))
+		if jsonOut {
+			_ = clijson.PrintJSON(clijson.NewResponseOK("screenshot", map[string]interface{}{
+				"action": map[string]interface{}{"vm": name, "path": out, "width": cfg.Width, "height": cfg.Height, "bytes": len(data), "result": "captured"},
+			}))
+			return
+		}
+		ui.Success("Saved %dx%d screenshot of %s to %s.", cfg.Width, cfg.Height, name, out)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	clijson "github.com/Josepavese/nido/internal/cli"
+	"github.com/Josepavese/nido/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+func actionSnapshotCreate(app *appContext) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		jsonOut := jsonEnabled(cmd)
+		if !jsonOut {
+			ui.Step("Snapshotting %s...", args[0])
+		}
+		if err := app.Provider.SnapshotCreate(args[0], args[1]); err != nil {
+			if jsonOut {
+				_ = clijson.PrintJSON(clijson.NewResponseError("snapshot create", providerErrorCode(err), "Snapshot create failed", err.Error(), "Check the VM and snapshot names and try again.", nil))
+			} else {
+				ui.Error("Failed to create snapshot: %v", err)
+			}
+			os.Exit(1)
+		}
+		if jsonOut {
+			_ = clijson.PrintJSON(clijson.NewResponseOK("snapshot create", map[string]interface{}{
+				"action": map[string]interface{}{"vm": args[0], "snapshot": args[1], "result": "created"},
+			}))
+			return
+		}
+		ui.Success("Snapshot %s created for %s.", args[1], args[0])
+	}
+}
+
+func actionSnapshotList(app *appContext) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		jsonOut := jsonEnabled(cmd)
+		snapshots, err := app.Provider.SnapshotList(args[0])
+		if err != nil {
+			if jsonOut {
+				_ = clijson.PrintJSON(clijson.NewResponseError("snapshot list", providerErrorCode(err), "Snapshot list failed", err.Error(), "Check the VM name and try again.", nil))
+			} else {
+				ui.Error("Failed to list snapshots: %v", err)
+			}
+			os.Exit(1)
+		}
+
+		if jsonOut {
+			_ = clijson.PrintJSON(clijson.NewResponseOK("snapshot list", map[string]interface{}{
+				"vm":        args[0],
+				"snapshots": snapshots,
+			}))
+			return
+		}
+		if len(snapshots) == 0 {
+			ui.Info("No snapshots for %s yet.", args[0])
+			return
+		}
+
+		ui.Header(fmt.Sprintf("Snapshots · %s", args[0]))
+		fmt.Printf("\n %s%-24s %-20s %s%s\n", ui.Bold, "NAME", "CREATED", "MEMORY", ui.Reset)
+		for _, s := range snapshots {
+			memory := "-"
+			if s.VMStateSize > 0 {
+				memory = ui.HumanSize(s.VMStateSize)
+			}
+			fmt.Printf(" %s%-24s%s %-20s %s\n", ui.Cyan, s.Name, ui.Reset, s.CreatedAt.Format("2006-01-02 15:04:05"), memory)
+		}
+		fmt.Println("")
+	}
+}
+
+func actionSnapshotRestore(app *appContext) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		jsonOut := jsonEnabled(cmd)
+		if !jsonOut {
+			ui.Step("Rewinding %s to %s...", args[0], args[1])
+		}
+		if err := app.Provider.SnapshotRestore(args[0], args[1]); err != nil {
+			if jsonOut {
+				_ = clijson.PrintJSON(clijson.NewResponseError("snapshot restore", providerErrorCode(err), "Snapshot restore failed", err.Error(), "Stop the VM first and check the snapshot name.", nil))
+			} else {
+				ui.Error("Failed to restore snapshot: %v", err)
+			}
+			os.Exit(1)
+		}
+		if jsonOut {
+			_ = clijson.PrintJSON(clijson.NewResponseOK("snapshot restore", map[string]interface{}{
+				"action": map[string]interface{}{"vm": args[0], "snapshot": args[1], "result": "restored"},
+			}))
+			return
+		}
+		ui.Success("VM %s restored to snapshot %s.", args[0], args[1])
+	}
+}
+
+func actionSnapshotDelete(app *appContext) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		jsonOut := jsonEnabled(cmd)
+		if !jsonOut {
+			ui.Step("Deleting snapshot...")
+		}
+		if err := app.Provider.SnapshotDelete(args[0], args[1]); err != nil {
+			if isNotFoundErr(err) {
+				if jsonOut {
+					_ = clijson.PrintJSON(clijson.NewResponseOK("snapshot delete", map[string]interface{}{
+						"action": map[string]interface{}{"vm": args[0], "snapshot": args[1], "result": "not_found"},
+					}))
+				} else {
+					ui.Info("Snapshot '%s' is already gone.", args[1])
+				}
+				return
+			}
+			if jsonOut {
+				_ = clijson.PrintJSON(clijson.NewResponseError("snapshot delete", providerErrorCode(err), "Snapshot delete failed", err.Error(), "Check the VM and snapshot names and try again.", nil))
+			} else {
+				ui.Error("Failed to delete snapshot: %v", err)
+			}
+			os.Exit(1)
+		}
+		if jsonOut {
+			_ = clijson.PrintJSON(clijson.NewResponseOK("snapshot delete", map[string]interface{}{
+				"action": map[string]interface{}{"vm": args[0], "snapshot": args[1], "result": "deleted"},
+			}))
+			return
+		}
+		ui.Success("Snapshot %s deleted.", args[1])
+	}
+}
+
+func actionVMCheckpoint(app *appContext) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		jsonOut := jsonEnabled(cmd)
+		name := ""
+		if len(args) > 1 {
+			name = args[1]
+		}
+		if !jsonOut {
+			ui.Step("Freezing %s in time...", args[0])
+		}
+		snap, err := app.Provider.Checkpoint(args[0], name)
+		if err != nil {
+			if jsonOut {
+				_ = clijson.PrintJSON(clijson.NewResponseError("checkpoint", providerErrorCode(err), "Checkpoint failed", err.Error(), "The VM must be running and must not use passthrough devices.", nil))
+			} else {
+				ui.Error("Failed to checkpoint VM %s: %v", args[0], err)
+			}
+			os.Exit(1)
+		}
+		if jsonOut {
+			_ = clijson.PrintJSON(clijson.NewResponseOK("checkpoint", map[string]interface{}{
+				"action":   map[string]interface{}{"vm": args[0], "checkpoint": snap.Name, "result": "checkpointed"},
+				"snapshot": snap,
+			}))
+			return
+		}
+		ui.Success("Checkpoint %s saved for %s (%s of memory).", snap.Name, args[0], ui.HumanSize(snap.VMStateSize))
+		ui.Info("Resume it with: nido resume %s --from %s", args[0], snap.Name)
+	}
+}
+
+func actionVMResume(app *appContext) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		jsonOut := jsonEnabled(cmd)
+		from, _ := cmd.Flags().GetString("from")
+		if !jsonOut {
+			ui.Step("Resuming %s...", args[0])
+		}
+		start := time.Now()
+		snap, err := app.Provider.Resume(args[0], from)
+		if err != nil {
+			if jsonOut {
+				_ = clijson.PrintJSON(clijson.NewResponseError("resume", providerErrorCode(err), "Resume failed", err.Error(), "List checkpoints with 'nido snapshot list' and try again.", nil))
+			} else {
+				ui.Error("Failed to resume VM %s: %v", args[0], err)
+			}
+			os.Exit(1)
+		}
+		elapsed := time.Since(start)
+		if jsonOut {
+			_ = clijson.PrintJSON(clijson.NewResponseOK("resume", map[string]interface{}{
+				"action": map[string]interface{}{
+					"vm":          args[0],
+					"checkpoint":  snap.Name,
+					"result":      "resumed",
+					"duration_ms": elapsed.Milliseconds(),
+				},
+			}))
+			return
+		}
+		ui.Success("VM %s resumed from %s in %s.", args[0], snap.Name, elapsed.Round(time.Millisecond))
+	}
+}
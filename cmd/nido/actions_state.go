@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	clijson "github.com/Josepavese/nido/internal/cli"
+	"github.com/Josepavese/nido/internal/provider"
+	"github.com/Josepavese/nido/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+func actionStateMigrate(app *appContext) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		jsonOut := jsonEnabled(cmd)
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		migrations, err := app.Provider.MigrateStates(dryRun)
+		if err != nil {
+			if jsonOut {
+				_ = clijson.PrintJSON(clijson.NewResponseError("state migrate", "ERR_INTERNAL", "State migration failed", err.Error(), "Try again or run nido doctor for diagnostics.", nil))
+			} else {
+				ui.Error("State migration failed: %v", err)
+			}
+			os.Exit(1)
+		}
+
+		failed := 0
+		for _, m := range migrations {
+			if m.Error != "" {
+				failed++
+			}
+		}
+		data := map[string]interface{}{"dry_run": dryRun, "schema_version": provider.StateSchemaVersion, "migrations": migrations}
+		if jsonOut {
+			if failed > 0 {
+				_ = clijson.PrintJSON(clijson.NewResponseError("state migrate", "ERR_INTERNAL", "State migration failed", fmt.Sprintf("%d of %d VMs failed", failed, len(migrations)), "See details.migrations for each VM.", data))
+				os.Exit(1)
+			}
+			_ = clijson.PrintJSON(clijson.NewResponseOK("state migrate", data))
+			return
+		}
+
+		if len(migrations) == 0 {
+			ui.Info("Every VM state file is up to date (schema version %d).", provider.StateSchemaVersion)
+			return
+		}
+		for _, m := range migrations {
+			switch {
+			case m.Error != "":
+				ui.Error("%s: %s", m.Name, m.Error)
+				continue
+			case dryRun:
+				ui.Info("%s: would upgrade from schema version %d to %d.", m.Name, m.From, m.To)
+			default:
+				ui.Success("%s: upgraded from schema version %d to %d (backup: %s).", m.Name, m.From, m.To, ternaryString(m.Backup != "", m.Backup, "none"))
+			}
+			if len(m.Changes) > 0 {
+				fmt.Println("  " + strings.Join(m.Changes, "\n  "))
+			}
+		}
+		if failed > 0 {
+			os.Exit(1)
+		}
+	}
+}
@@ -487,6 +487,42 @@ func updateVMConfig(cmd *cobra.Command, prov provider.VMProvider, name string, j
 		updates.VCPUs = &val
 		hasUpdates = true
 	}
+	if cmd.Flags().Changed("max-memory") {
+		val, _ := cmd.Flags().GetInt("max-memory")
+		updates.MaxMemoryMB = &val
+		hasUpdates = true
+	}
+	if cmd.Flags().Changed("max-cpus") {
+		val, _ := cmd.Flags().GetInt("max-cpus")
+		updates.MaxVCPUs = &val
+		hasUpdates = true
+	}
+	limits, limitsChanged, err := limitUpdates(cmd)
+	if err != nil {
+		if jsonOut {
+			_ = clijson.PrintJSON(clijson.NewResponseError("config", "ERR_INVALID_ARGS", "Invalid resource limit", err.Error(), "", nil))
+		} else {
+			ui.Error("Invalid resource limit: %v", err)
+		}
+		os.Exit(1)
+	}
+	if limitsChanged {
+		updates.CPULimit = limits.CPULimit
+		updates.MemoryLimitMB = limits.MemoryLimitMB
+		updates.IOWeight = limits.IOWeight
+		updates.PidsLimit = limits.PidsLimit
+		hasUpdates = true
+	}
+	if cmd.Flags().Changed("restart") {
+		val, _ := cmd.Flags().GetString("restart")
+		updates.RestartPolicy = &val
+		hasUpdates = true
+	}
+	if cmd.Flags().Changed("on-expiry") {
+		val, _ := cmd.Flags().GetString("on-expiry")
+		updates.OnExpiry = &val
+		hasUpdates = true
+	}
 	if cmd.Flags().Changed("ssh-port") {
 		val, _ := cmd.Flags().GetInt("ssh-port")
 		updates.SSHPort = &val
@@ -540,6 +576,19 @@ func updateVMConfig(cmd *cobra.Command, prov provider.VMProvider, name string, j
 		updates.Accelerators = &val
 		hasUpdates = true
 	}
+	if cmd.Flags().Changed("disk") {
+		val, _ := cmd.Flags().GetString("disk")
+		if err := provider.ValidateDiskSize(val); err != nil {
+			if jsonOut {
+				_ = clijson.PrintJSON(clijson.NewResponseError("config", "ERR_INVALID_ARGS", "Invalid disk size", err.Error(), "Use a size like +20G or 60G.", nil))
+			} else {
+				ui.Error("Invalid disk size: %v", err)
+			}
+			os.Exit(1)
+		}
+		updates.DiskSize = &val
+		hasUpdates = true
+	}
 
 	if _, err := prov.Info(name); err != nil {
 		if jsonOut {
@@ -565,7 +614,8 @@ func updateVMConfig(cmd *cobra.Command, prov provider.VMProvider, name string, j
 	if !jsonOut {
 		ui.Ironic(fmt.Sprintf("Rewriting genetic sequence for %s...", name))
 	}
-	if err := prov.UpdateConfig(name, updates); err != nil {
+	applied, err := prov.UpdateConfig(name, updates)
+	if err != nil {
 		if jsonOut {
 			_ = clijson.PrintJSON(clijson.NewResponseError("config", "ERR_UPDATE", "Config update failed", err.Error(), "", nil))
 		} else {
@@ -576,11 +626,16 @@ func updateVMConfig(cmd *cobra.Command, prov provider.VMProvider, name string, j
 
 	if jsonOut {
 		_ = clijson.PrintJSON(clijson.NewResponseOK("config", map[string]interface{}{
-			"name":   name,
-			"result": "updated",
+			"name":    name,
+			"result":  "updated",
+			"applied": applied,
 		}))
 		return
 	}
+	if applied == provider.AppliedLive {
+		ui.Success("Configuration updated and applied to the running VM.")
+		return
+	}
 	ui.Success("Configuration updated. Restart VM to apply changes.")
 }
 
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	clijson "github.com/Josepavese/nido/internal/cli"
+	"github.com/Josepavese/nido/internal/provider"
+	"github.com/Josepavese/nido/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+func actionVMTTL(app *appContext) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		jsonOut := jsonEnabled(cmd)
+		name := args[0]
+		fail := func(code, title string, err error, hint string) {
+			if jsonOut {
+				_ = clijson.PrintJSON(clijson.NewResponseError("ttl", code, title, err.Error(), hint, nil))
+			} else {
+				ui.Error("%s: %v", title, err)
+			}
+			os.Exit(1)
+		}
+
+		if len(args) == 1 {
+			info, err := app.Provider.Info(name)
+			if err != nil {
+				fail(providerErrorCode(err), "TTL lookup failed", err, "Check the VM name and try again.")
+			}
+			onExpiry := ternaryString(info.OnExpiry != "", info.OnExpiry, provider.ExpiryDelete)
+			if jsonOut {
+				_ = clijson.PrintJSON(clijson.NewResponseOK("ttl", map[string]interface{}{
+					"action": map[string]interface{}{"vm": name, "expires_at": info.ExpiresAt, "on_expiry": onExpiry, "result": "shown"},
+				}))
+				return
+			}
+			if info.ExpiresAt == nil {
+				ui.Info("%s has no TTL.", name)
+				return
+			}
+			ui.Info("%s expires %s (%s), then %s.", name, info.ExpiresAt.Local().Format("2006-01-02 15:04:05"), formatTTLRemaining(info.ExpiresAt, time.Now()), ternaryString(onExpiry == provider.ExpiryStop, "stops", "is deleted"))
+			return
+		}
+
+		action := args[1]
+		var d time.Duration
+		var err error
+		switch {
+		case action == provider.TTLClear && len(args) == 2:
+		case (action == provider.TTLSet || action == provider.TTLExtend) && len(args) == 3:
+			d, err = provider.ParseTTL(args[2])
+		default:
+			err = fmt.Errorf("expected 'set <duration>', 'extend <duration>' or 'clear'")
+		}
+		if err != nil {
+			fail("ERR_INVALID_ARGS", "Invalid TTL", err, "Usage: nido ttl <vm> [set|extend|clear] [duration]")
+		}
+
+		expiresAt, err := app.Provider.SetTTL(name, action, d)
+		if err != nil {
+			fail(providerErrorCode(err), "TTL update failed", err, "Check the VM name and try again.")
+		}
+		if jsonOut {
+			_ = clijson.PrintJSON(clijson.NewResponseOK("ttl", map[string]interface{}{
+				"action": map[string]interface{}{"vm": name, "expires_at": expiresAt, "result": ternaryString(action == provider.TTLClear, "cleared", "updated")},
+			}))
+			return
+		}
+		if expiresAt == nil {
+			ui.Success("Cleared the TTL of %s.", name)
+			return
+		}
+		ui.Success("%s now expires %s (%s).", name, expiresAt.Local().Format("2006-01-02 15:04:05"), formatTTLRemaining(expiresAt, time.Now()))
+	}
+}
+
+// pruneExpired is 'nido prune --expired': reap VMs whose TTL ran out.
+func pruneExpired(app *appContext, jsonOut bool) {
+	if !jsonOut {
+		ui.Step("Reaping expired VMs...")
+	}
+	reaped, err := app.Provider.ReapExpired()
+	if err != nil {
+		if jsonOut {
+			_ = clijson.PrintJSON(clijson.NewResponseError("prune", "ERR_INTERNAL", "Prune failed", err.Error(), "Try again or run nido doctor.", nil))
+		} else {
+			ui.Error("Expired VM prune failed: %v", err)
+		}
+		os.Exit(1)
+	}
+	if jsonOut {
+		_ = clijson.PrintJSON(clijson.NewResponseOK("prune", map[string]interface{}{"expired": reaped}))
+		return
+	}
+	if len(reaped) == 0 {
+		ui.Info("No expired VMs.")
+		return
+	}
+	for _, r := range reaped {
+		if r.Error != "" {
+			ui.Error("%s expired but could not be reaped: %s", r.Name, r.Error)
+			continue
+		}
+		ui.Success("%s expired and was %s.", r.Name, r.Action)
+	}
+}
+
+// formatTTLRemaining renders the time left before expiresAt, e.g. 1h59m.
+func formatTTLRemaining(expiresAt *time.Time, now time.Time) string {
+	if expiresAt == nil {
+		return "-"
+	}
+	left := expiresAt.Sub(now)
+	switch {
+	case left <= 0:
+		return "expired"
+	case left < time.Minute:
+		return "<1m"
+	}
+	s := left.Truncate(time.Minute).String()
+	return s[:len(s)-2]
+}
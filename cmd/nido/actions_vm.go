@@ -1,10 +1,12 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/Josepavese/nido/internal/builder"
 	clijson "github.com/Josepavese/nido/internal/cli"
@@ -17,7 +19,17 @@ import (
 func actionVMList(app *appContext) func(cmd *cobra.Command, args []string) {
 	return func(cmd *cobra.Command, args []string) {
 		jsonOut := jsonEnabled(cmd)
+		sel, _, _, selErr := selectorFlag(cmd)
+		if selErr != nil {
+			if jsonOut {
+				_ = clijson.PrintJSON(clijson.NewResponseError("ls", "ERR_INVALID_ARGS", "Invalid selector", selErr.Error(), "Use -l key=value,key!=value,key,!key.", nil))
+			} else {
+				ui.Error("Invalid selector: %v", selErr)
+			}
+			os.Exit(1)
+		}
 		vms, err := app.Provider.List()
+		vms = provider.FilterVMs(vms, sel)
 		if jsonOut {
 			if err != nil {
 				_ = clijson.PrintJSON(clijson.NewResponseError("ls", "ERR_INTERNAL", "List failed", err.Error(), "Try again or run nido doctor for diagnostics.", nil))
@@ -31,17 +43,22 @@ func actionVMList(app *appContext) func(cmd *cobra.Command, args []string) {
 				SSHPort int    `json:"ssh_port"`
 				VNCPort int    `json:"vnc_port"`
 				SSHUser string `json:"ssh_user,omitempty"`
+				// ExpiresAt is set for VMs with a TTL.
+				ExpiresAt *time.Time        `json:"expires_at,omitempty"`
+				Labels    map[string]string `json:"labels,omitempty"`
 			}
 
 			items := make([]vmJSON, 0, len(vms))
 			for _, vm := range vms {
 				items = append(items, vmJSON{
-					Name:    vm.Name,
-					State:   vm.State,
-					PID:     vm.PID,
-					SSHPort: vm.SSHPort,
-					VNCPort: vm.VNCPort,
-					SSHUser: vm.SSHUser,
+					Name:      vm.Name,
+					State:     vm.State,
+					PID:       vm.PID,
+					SSHPort:   vm.SSHPort,
+					VNCPort:   vm.VNCPort,
+					SSHUser:   vm.SSHUser,
+					ExpiresAt: vm.ExpiresAt,
+					Labels:    vm.Labels,
 				})
 			}
 
@@ -58,14 +75,19 @@ func actionVMList(app *appContext) func(cmd *cobra.Command, args []string) {
 			return
 		}
 
-		fmt.Printf("\n %s%-20s %-12s %-10s %s%s\n", ui.Bold, "NAME", "STATE", "PID", "PORT", ui.Reset)
-		fmt.Printf(" %s%s%s\n", ui.Dim, strings.Repeat("-", 60), ui.Reset)
+		now := time.Now()
+		fmt.Printf("\n %s%-20s %-12s %-10s %-10s %-25s %s%s\n", ui.Bold, "NAME", "STATE", "PID", "TTL", "PORT", "LABELS", ui.Reset)
+		fmt.Printf(" %s%s%s\n", ui.Dim, strings.Repeat("-", 100), ui.Reset)
 		for _, vm := range vms {
 			stateColor := ui.Yellow
 			if vm.State == "running" {
 				stateColor = ui.Green
 			}
-			fmt.Printf(" %-20s %s%-12s%s %-10d %s\n", vm.Name, stateColor, vm.State, ui.Reset, vm.PID, formatVMTablePortSummary(vm))
+			labels := provider.FormatLabels(vm.Labels)
+			if labels == "" {
+				labels = "-"
+			}
+			fmt.Printf(" %-20s %s%-12s%s %-10d %-10s %-25s %s\n", vm.Name, stateColor, vm.State, ui.Reset, vm.PID, formatTTLRemaining(vm.ExpiresAt, now), formatVMTablePortSummary(vm), labels)
 		}
 		fmt.Println("")
 	}
@@ -83,23 +105,46 @@ func actionVMInfo(app *appContext) func(cmd *cobra.Command, args []string) {
 			}
 			os.Exit(1)
 		}
+		// Guest-side details need a running qemu-guest-agent; without one
+		// they are simply omitted.
+		var guest *provider.GuestInfo
+		if info.State == "running" {
+			if g, err := app.Provider.GuestInfo(args[0]); err == nil {
+				guest = &g
+			}
+		}
 
 		if jsonOut {
 			_ = clijson.PrintJSON(clijson.NewResponseOK("info", map[string]interface{}{
+				"guest": guest,
 				"vm": map[string]interface{}{
-					"name":          info.Name,
-					"state":         info.State,
-					"ip":            info.IP,
-					"ssh_user":      info.SSHUser,
-					"ssh_port":      info.SSHPort,
-					"vnc_port":      info.VNCPort,
-					"memory_mb":     info.MemoryMB,
-					"vcpus":         info.VCPUs,
-					"gui":           info.Gui,
-					"cmdline":       info.Cmdline,
-					"forwarding":    info.Forwarding,
-					"raw_qemu_args": info.RawQemuArgs,
-					"accelerators":  info.Accelerators,
+					"name":            info.Name,
+					"state":           info.State,
+					"ip":              info.IP,
+					"ssh_user":        info.SSHUser,
+					"ssh_port":        info.SSHPort,
+					"vnc_port":        info.VNCPort,
+					"memory_mb":       info.MemoryMB,
+					"vcpus":           info.VCPUs,
+					"max_memory_mb":   info.MaxMemoryMB,
+					"max_vcpus":       info.MaxVCPUs,
+					"gui":             info.Gui,
+					"cmdline":         info.Cmdline,
+					"forwarding":      info.Forwarding,
+					"raw_qemu_args":   info.RawQemuArgs,
+					"accelerators":    info.Accelerators,
+					"mounts":          info.Mounts,
+					"volumes":         info.Volumes,
+					"devices":         info.Devices,
+					"disk_size_bytes": info.DiskSizeBytes,
+					"limits":          info.Limits,
+					"cgroup":          info.Cgroup,
+					"restart_policy":  info.RestartPolicy,
+					"restarts":        info.Restarts,
+					"last_exit":       info.LastExit,
+					"expires_at":      info.ExpiresAt,
+					"on_expiry":       ternaryString(info.OnExpiry != "", info.OnExpiry, provider.ExpiryDelete),
+					"labels":          info.Labels,
 				},
 			}))
 			return
@@ -110,12 +155,24 @@ func actionVMInfo(app *appContext) func(cmd *cobra.Command, args []string) {
 		ui.FancyLabel("State", info.State)
 		ui.FancyLabel("IP Address", info.IP)
 		ui.FancyLabel("SSH Command", fmt.Sprintf("ssh -p %d %s@%s", info.SSHPort, info.SSHUser, info.IP))
+		if len(info.Labels) > 0 {
+			ui.FancyLabel("Labels", provider.FormatLabels(info.Labels))
+		}
 		if info.VNCPort > 0 {
 			ui.FancyLabel("GUI (VNC)", fmt.Sprintf("127.0.0.1:%d", info.VNCPort))
 		}
 		ui.FancyLabel("Memory", fmt.Sprintf("%d MB", info.MemoryMB))
 		ui.FancyLabel("vCPUs", fmt.Sprintf("%d", info.VCPUs))
+		if info.MaxMemoryMB > info.MemoryMB {
+			ui.FancyLabel("Max Memory", fmt.Sprintf("%d MB", info.MaxMemoryMB))
+		}
+		if info.MaxVCPUs > info.VCPUs {
+			ui.FancyLabel("Max vCPUs", fmt.Sprintf("%d", info.MaxVCPUs))
+		}
 		ui.FancyLabel("GUI Enabled", fmt.Sprintf("%v", info.Gui))
+		if info.DiskSizeBytes > 0 {
+			ui.FancyLabel("Disk Size", ui.HumanSize(info.DiskSizeBytes))
+		}
 		if info.Cmdline != "" {
 			ui.FancyLabel("Cmdline", info.Cmdline)
 		}
@@ -140,6 +197,108 @@ func actionVMInfo(app *appContext) func(cmd *cobra.Command, args []string) {
 				fmt.Printf(" %-15s %-10d %-10d %s%s%s\n", label, f.GuestPort, f.HostPort, ui.Dim, link, ui.Reset)
 			}
 		}
+		if len(info.Mounts) > 0 {
+			ui.Section("Shared Folders")
+			for _, m := range info.Mounts {
+				mode := "rw"
+				if m.ReadOnly {
+					mode = "ro"
+				}
+				ui.FancyLabel(m.GuestPath, fmt.Sprintf("%s (%s)", m.HostPath, mode))
+			}
+		}
+		if len(info.Volumes) > 0 {
+			ui.Section("Volumes")
+			for _, v := range info.Volumes {
+				mode := "rw"
+				if v.ReadOnly {
+					mode = "ro"
+				}
+				ui.FancyLabel(v.Volume, fmt.Sprintf("/dev/disk/by-id/virtio-%s (%s)", v.Volume, mode))
+			}
+		}
+		if len(info.Devices) > 0 {
+			ui.Section("Devices")
+			for _, d := range info.Devices {
+				desc := d.Type
+				if d.Source != "" {
+					desc += " " + d.Source
+				}
+				if d.ReadOnly {
+					desc += " (ro)"
+				}
+				if d.Removing {
+					desc += " (removing)"
+				}
+				ui.FancyLabel(d.ID, desc)
+			}
+		}
+		if info.Limits != nil {
+			ui.Section("Resource Limits")
+			l := info.Limits
+			if l.CPUs > 0 {
+				ui.FancyLabel("CPU", fmt.Sprintf("%g cores", l.CPUs))
+			}
+			if l.MemoryMaxMB > 0 {
+				ui.FancyLabel("Memory", fmt.Sprintf("%d MB", l.MemoryMaxMB))
+			}
+			if l.IOWeight > 0 {
+				ui.FancyLabel("I/O Weight", fmt.Sprintf("%d", l.IOWeight))
+			}
+			if l.PidsMax > 0 {
+				ui.FancyLabel("Tasks", fmt.Sprintf("%d", l.PidsMax))
+			}
+			if c := info.Cgroup; c != nil {
+				if c.Enforced {
+					ui.FancyLabel("Cgroup", c.Path)
+					ui.FancyLabel("Memory Used", ui.HumanSize(c.MemoryBytes))
+					ui.FancyLabel("CPU Time", (time.Duration(c.CPUUsec) * time.Microsecond).Round(time.Second).String())
+					ui.FancyLabel("Tasks Used", fmt.Sprintf("%d", c.Pids))
+					ui.FancyLabel("Disk I/O", fmt.Sprintf("%s read, %s written", ui.HumanSize(c.IOReadBytes), ui.HumanSize(c.IOWriteBytes)))
+				} else {
+					ui.FancyLabel("Enforced", "no: "+c.Reason)
+				}
+			}
+		}
+		if info.RestartPolicy != "" || info.LastExit != nil {
+			ui.Section("Supervisor")
+			ui.FancyLabel("Restart Policy", ternaryString(info.RestartPolicy != "", info.RestartPolicy, provider.RestartNo))
+			if info.Restarts > 0 {
+				ui.FancyLabel("Restarts", fmt.Sprintf("%d", info.Restarts))
+			}
+			if e := info.LastExit; e != nil {
+				ui.FancyLabel("Last Exit", fmt.Sprintf("%s (%s)", e.Reason, e.Time.Local().Format("2006-01-02 15:04:05")))
+				if e.RestartAt != nil {
+					ui.FancyLabel("Restart At", e.RestartAt.Local().Format("2006-01-02 15:04:05"))
+				}
+				for _, line := range e.Console {
+					fmt.Printf("   %s%s%s\n", ui.Dim, line, ui.Reset)
+				}
+			}
+		}
+		if info.ExpiresAt != nil {
+			ui.Section("Time-To-Live")
+			ui.FancyLabel("Expires", fmt.Sprintf("%s (%s)", info.ExpiresAt.Local().Format("2006-01-02 15:04:05"), formatTTLRemaining(info.ExpiresAt, time.Now())))
+			ui.FancyLabel("On Expiry", ternaryString(info.OnExpiry != "", info.OnExpiry, provider.ExpiryDelete))
+		}
+		if guest != nil {
+			ui.Section("Guest Agent")
+			if guest.Hostname != "" {
+				ui.FancyLabel("Hostname", guest.Hostname)
+			}
+			if guest.OS != "" {
+				ui.FancyLabel("OS", strings.TrimSpace(guest.OS+" "+guest.Kernel))
+			}
+			if len(guest.IPs) > 0 {
+				ui.FancyLabel("Guest IPs", strings.Join(guest.IPs, ", "))
+			}
+			for _, fs := range guest.Filesystems {
+				if fs.TotalBytes == 0 {
+					continue
+				}
+				ui.FancyLabel(fs.Mountpoint, fmt.Sprintf("%s / %s used (%d%%, %s)", ui.HumanSize(int64(fs.UsedBytes)), ui.HumanSize(int64(fs.TotalBytes)), fs.UsedBytes*100/fs.TotalBytes, fs.Type))
+			}
+		}
 		fmt.Println("")
 	}
 }
@@ -147,15 +306,31 @@ func actionVMInfo(app *appContext) func(cmd *cobra.Command, args []string) {
 func actionVMSpawn(app *appContext) func(cmd *cobra.Command, args []string) {
 	return func(cmd *cobra.Command, args []string) {
 		jsonOut := jsonEnabled(cmd)
-		name := args[0]
-		for _, r := range name {
-			if !((r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '-' || r == '_' || r == '.') {
-				if jsonOut {
-					_ = clijson.PrintJSON(clijson.NewResponseError("spawn", "ERR_INVALID_ARGS", "Invalid VM name", "Only alphanumeric, hyphens, underscores, and dots allowed.", "Usage: nido spawn <name> ...", nil))
-				} else {
-					ui.Error("Invalid VM name '%s'. (No spaces allowed, only alphanumeric, -, _, .)", name)
+		count, _ := cmd.Flags().GetInt("count")
+		parallel, _ := cmd.Flags().GetInt("parallel")
+		names, err := provider.ExpandSpawnNames(args[0], count)
+		if err == nil && parallel < 1 {
+			err = fmt.Errorf("--parallel must be at least 1")
+		}
+		if err != nil {
+			if jsonOut {
+				_ = clijson.PrintJSON(clijson.NewResponseError("spawn", "ERR_INVALID_ARGS", "Invalid batch spawn", err.Error(), "Usage: nido spawn 'worker-{i}' --count N [--parallel N] ...", nil))
+			} else {
+				ui.Error("Invalid batch spawn: %v", err)
+			}
+			os.Exit(1)
+		}
+		name := names[0]
+		for _, n := range names {
+			for _, r := range n {
+				if !((r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '-' || r == '_' || r == '.') {
+					if jsonOut {
+						_ = clijson.PrintJSON(clijson.NewResponseError("spawn", "ERR_INVALID_ARGS", "Invalid VM name", "Only alphanumeric, hyphens, underscores, and dots allowed.", "Usage: nido spawn <name> ...", nil))
+					} else {
+						ui.Error("Invalid VM name '%s'. (No spaces allowed, only alphanumeric, -, _, .)", n)
+					}
+					os.Exit(1)
 				}
-				os.Exit(1)
 			}
 		}
 
@@ -169,11 +344,69 @@ func actionVMSpawn(app *appContext) func(cmd *cobra.Command, args []string) {
 		cmdline, _ := cmd.Flags().GetString("cmdline")
 		spawnMem, _ := cmd.Flags().GetInt("memory")
 		spawnCPUs, _ := cmd.Flags().GetInt("cpus")
+		spawnMaxMem, _ := cmd.Flags().GetInt("max-memory")
+		spawnMaxCPUs, _ := cmd.Flags().GetInt("max-cpus")
 		rawArgs, _ := cmd.Flags().GetStringArray("qemu-arg")
 		accelerators, _ := cmd.Flags().GetStringArray("accel")
 		portMappings, _ := cmd.Flags().GetStringArray("port")
 		web, _ := cmd.Flags().GetBool("web")
 		ftp, _ := cmd.Flags().GetBool("ftp")
+		mountSpecs, _ := cmd.Flags().GetStringArray("mount")
+		wait, _ := cmd.Flags().GetBool("wait")
+		restartPolicy, _ := cmd.Flags().GetString("restart")
+		ttlRaw, _ := cmd.Flags().GetString("ttl")
+		onExpiry, _ := cmd.Flags().GetString("on-expiry")
+		labelSpecs, _ := cmd.Flags().GetStringArray("label")
+
+		var ttl time.Duration
+		limitSet, _, err := limitUpdates(cmd)
+		if err == nil {
+			err = provider.ValidateRestartPolicy(restartPolicy)
+		}
+		if err == nil {
+			err = provider.ValidateOnExpiry(onExpiry)
+		}
+		if err == nil && ttlRaw != "" {
+			ttl, err = provider.ParseTTL(ttlRaw)
+		}
+		var labels map[string]string
+		if err == nil {
+			labels, err = provider.ParseLabels(labelSpecs)
+		}
+		if err != nil {
+			if jsonOut {
+				_ = clijson.PrintJSON(clijson.NewResponseError("spawn", "ERR_INVALID_ARGS", "Invalid spawn options", err.Error(), "", nil))
+			} else {
+				ui.Error("Invalid spawn options: %v", err)
+			}
+			os.Exit(1)
+		}
+		limits := provider.ResourceLimits{}
+		if limitSet.CPULimit != nil {
+			limits.CPUs = *limitSet.CPULimit
+		}
+		if limitSet.MemoryLimitMB != nil {
+			limits.MemoryMaxMB = *limitSet.MemoryLimitMB
+		}
+		if limitSet.IOWeight != nil {
+			limits.IOWeight = *limitSet.IOWeight
+		}
+		if limitSet.PidsLimit != nil {
+			limits.PidsMax = *limitSet.PidsLimit
+		}
+
+		var waitOpts provider.WaitOptions
+		if wait {
+			var err error
+			if waitOpts, err = waitOptions(cmd, jsonOut); err != nil {
+				if jsonOut {
+					_ = clijson.PrintJSON(clijson.NewResponseError("spawn", "ERR_INVALID_ARGS", "Invalid wait options", err.Error(), "Use --for ssh|cloud-init|port:N|file:/path and a duration like 5m.", nil))
+				} else {
+					ui.Error("Invalid wait options: %v", err)
+				}
+				os.Exit(1)
+			}
+		}
 
 		var forwardings []provider.PortForward
 		for _, mapping := range portMappings {
@@ -194,108 +427,91 @@ func actionVMSpawn(app *appContext) func(cmd *cobra.Command, args []string) {
 			forwardings = append(forwardings, provider.PortForward{Label: "FTP", GuestPort: 21, Protocol: "tcp"})
 		}
 
-		customSshUser := ""
-		customSshPassword := ""
-		var seedFiles map[string]string
-		var resolvedVersion *image.Version
-
-		if imageTag != "" {
-			localPath := filepath.Join(app.ImageDir(), imageTag+".qcow2")
-			localExists := false
-			if _, err := os.Stat(localPath); err == nil {
-				localExists = true
-			} else if _, err := os.Stat(filepath.Join(app.ImageDir(), imageTag)); err == nil {
-				localPath = filepath.Join(app.ImageDir(), imageTag)
-				localExists = true
-			}
-
-			if localExists {
-				if !jsonOut {
-					ui.Info("Found local image: %s", filepath.Base(localPath))
-				}
-				applyBlueprintImageMetadata(app, imageTag, &customSshUser, &customSshPassword, &seedFiles)
-				tpl = localPath
-			} else {
-				catalog, err := imageCatalog(app)
-				if err != nil {
-					if jsonOut {
-						_ = clijson.PrintJSON(clijson.NewResponseError("spawn", "ERR_IO", "Catalog load failed", err.Error(), "Check your network connection and try again.", nil))
-					} else {
-						ui.Error("Failed to load catalog: %v", err)
-					}
-					os.Exit(1)
-				}
-
-				pName, pVer := imageTag, ""
-				if strings.Contains(imageTag, ":") {
-					parts := strings.Split(imageTag, ":")
-					pName, pVer = parts[0], parts[1]
-				}
-
-				img, ver, err := catalog.FindImage(pName, pVer)
-				if err != nil {
-					if jsonOut {
-						_ = clijson.PrintJSON(clijson.NewResponseError("spawn", "ERR_NOT_FOUND", "Image not found", err.Error(), "Run 'nido images list' to see available images.", nil))
-					} else {
-						ui.Error("Image %s not found in catalog (and not found locally in %s).", imageTag, app.ImageDir())
-					}
-					os.Exit(1)
-				}
-				resolvedVersion = ver
-				customSshUser = img.SSHUser
-				if ver.SSHPassword != "" {
-					customSshPassword = ver.SSHPassword
-				} else if img.SSHPassword != "" {
-					customSshPassword = img.SSHPassword
+		var mounts []provider.Mount
+		for _, spec := range mountSpecs {
+			m, err := provider.ParseMount(spec)
+			if err != nil {
+				if jsonOut {
+					_ = clijson.PrintJSON(clijson.NewResponseError("spawn", "ERR_INVALID_ARGS", "Invalid mount", err.Error(), "Use --mount <host-dir>:<guest-path>[:ro] with an existing host directory.", nil))
+				} else {
+					ui.Error("Invalid mount: %v", err)
 				}
+				os.Exit(1)
+			}
+			mounts = append(mounts, m)
+		}
 
-				imgPath := filepath.Join(app.ImageDir(), fmt.Sprintf("%s-%s.qcow2", img.Name, ver.Version))
-				if _, err := os.Stat(imgPath); os.IsNotExist(err) {
-					if !jsonOut {
-						ui.Info("Image not found locally. Pulling %s:%s...", img.Name, ver.Version)
-					}
-					downloader := image.Downloader{Quiet: jsonOut}
-					if err := image.PrepareLocalImage(*ver, imgPath, downloader); err != nil {
-						if jsonOut {
-							_ = clijson.PrintJSON(clijson.NewResponseError("spawn", "ERR_IO", "Image preparation failed", err.Error(), "Check your network connection and registry checksum metadata.", nil))
-						} else {
-							ui.Error("Image preparation failed: %v", err)
-						}
-						os.Exit(1)
-					}
-					if ver.Checksum == "" && !jsonOut {
-						ui.Warn("No checksum provided. Integrity cannot be verified.")
-					}
-					if !jsonOut {
-						ui.Success("Image prepared successfully.")
-					}
+		var img provider.VMOptions
+		if imageTag != "" {
+			var err error
+			if img, err = resolveSpawnImage(app, imageTag, jsonOut); err != nil {
+				var ie *imageError
+				errors.As(err, &ie)
+				if jsonOut {
+					_ = clijson.PrintJSON(clijson.NewResponseError("spawn", ie.code, ie.title, err.Error(), ie.hint, nil))
+				} else {
+					ui.Error("%s", ie.message)
 				}
-
-				tpl = imgPath
+				os.Exit(1)
 			}
+			tpl = img.DiskPath
 		}
-
-		if cmdline == "" && resolvedVersion != nil {
-			cmdline = resolvedVersion.Cmdline
+		customSshPassword := img.SSHPassword
+		if cmdline == "" {
+			cmdline = img.Cmdline
 		}
 
 		if !jsonOut {
-			ui.Step("Creating VM...")
+			if len(names) > 1 {
+				ui.Step("Creating %d VMs (%d at a time)...", len(names), parallel)
+			} else {
+				ui.Step("Creating VM...")
+			}
 		}
 
 		spawnOpts := provider.VMOptions{
 			DiskPath:     tpl,
 			UserDataPath: userDataPath,
 			Gui:          gui,
-			SSHUser:      customSshUser,
+			SSHUser:      img.SSHUser,
 			SSHPassword:  customSshPassword,
-			SeedFiles:    seedFiles,
+			SeedFiles:    img.SeedFiles,
 			Forwarding:   forwardings,
 			Cmdline:      cmdline,
 			MemoryMB:     spawnMem,
 			VCPUs:        spawnCPUs,
+			MaxMemoryMB:  spawnMaxMem,
+			MaxVCPUs:     spawnMaxCPUs,
 			RawQemuArgs:  rawArgs,
 			Accelerators: accelerators,
+			Mounts:       mounts,
+		}
+		if !limits.IsZero() {
+			spawnOpts.Limits = &limits
+		}
+		spawnOpts.RestartPolicy = restartPolicy
+		spawnOpts.TTL = ttl
+		spawnOpts.OnExpiry = onExpiry
+		if len(labels) > 0 {
+			spawnOpts.Labels = labels
+		}
+		source := "template"
+		if imageTag != "" {
+			source = "image " + imageTag
+		}
+		if len(names) > 1 {
+			var batchWait *provider.WaitOptions
+			if wait {
+				batchWait = &waitOpts
+			}
+			ok := spawnBatch(app, names, spawnOpts, parallel, batchWait, source, jsonOut)
+			if !app.Config.LinkedClones && imageTag != "" && tpl != "" {
+				_ = os.Remove(tpl)
+			}
+			if !ok {
+				os.Exit(1)
+			}
+			return
 		}
 		if err := app.Provider.Spawn(name, spawnOpts); err != nil {
 			if jsonOut {
@@ -310,21 +526,19 @@ func actionVMSpawn(app *appContext) func(cmd *cobra.Command, args []string) {
 			os.Exit(1)
 		}
 
-		source := "template"
-		if imageTag != "" {
-			source = "image " + imageTag
-		}
 		if jsonOut {
-			_ = clijson.PrintJSON(clijson.NewResponseOK("spawn", map[string]interface{}{
-				"action": map[string]interface{}{
-					"name":      name,
-					"result":    "spawned",
-					"source":    source,
-					"gui":       gui,
-					"user_data": userDataPath,
-					"image_tag": imageTag,
-				},
-			}))
+			action := map[string]interface{}{
+				"name":      name,
+				"result":    "spawned",
+				"source":    source,
+				"gui":       gui,
+				"user_data": userDataPath,
+				"image_tag": imageTag,
+			}
+			if wait {
+				action["wait"] = waitForVM(app, "spawn", name, waitOpts, true)
+			}
+			_ = clijson.PrintJSON(clijson.NewResponseOK("spawn", map[string]interface{}{"action": action}))
 			return
 		}
 
@@ -339,6 +553,10 @@ func actionVMSpawn(app *appContext) func(cmd *cobra.Command, args []string) {
 				ui.Step("Linked clones disabled: cleaned temporary image cache.")
 			}
 		}
+		if wait {
+			res := waitForVM(app, "spawn", name, waitOpts, false)
+			ui.Success("VM %s is ready after %s.", name, (time.Duration(res.DurationMS) * time.Millisecond).Round(100*time.Millisecond))
+		}
 	}
 }
 
@@ -358,11 +576,115 @@ func applyBlueprintImageMetadata(app *appContext, imageTag string, sshUser, sshP
 	}
 }
 
+// imageError is a failed --image resolution with what the JSON envelope
+// and the terminal report.
+type imageError struct {
+	code, title, hint, message string
+	err                        error
+}
+
+func (e *imageError) Error() string { return e.err.Error() }
+
+// resolveSpawnImage finds imageTag in the image directory or the catalog,
+// pulling it when missing. The returned options carry the disk (DiskPath)
+// and its SSH user, password, seed files and kernel command line; errors
+// are *imageError.
+func resolveSpawnImage(app *appContext, imageTag string, jsonOut bool) (provider.VMOptions, error) {
+	var opts provider.VMOptions
+	localPath := filepath.Join(app.ImageDir(), imageTag+".qcow2")
+	localExists := false
+	if _, err := os.Stat(localPath); err == nil {
+		localExists = true
+	} else if _, err := os.Stat(filepath.Join(app.ImageDir(), imageTag)); err == nil {
+		localPath = filepath.Join(app.ImageDir(), imageTag)
+		localExists = true
+	}
+
+	if localExists {
+		if !jsonOut {
+			ui.Info("Found local image: %s", filepath.Base(localPath))
+		}
+		applyBlueprintImageMetadata(app, imageTag, &opts.SSHUser, &opts.SSHPassword, &opts.SeedFiles)
+		opts.DiskPath = localPath
+		return opts, nil
+	}
+
+	catalog, err := imageCatalog(app)
+	if err != nil {
+		return opts, &imageError{"ERR_IO", "Catalog load failed", "Check your network connection and try again.", fmt.Sprintf("Failed to load catalog: %v", err), err}
+	}
+
+	pName, pVer := imageTag, ""
+	if strings.Contains(imageTag, ":") {
+		parts := strings.Split(imageTag, ":")
+		pName, pVer = parts[0], parts[1]
+	}
+
+	img, ver, err := catalog.FindImage(pName, pVer)
+	if err != nil {
+		return opts, &imageError{"ERR_NOT_FOUND", "Image not found", "Run 'nido images list' to see available images.", fmt.Sprintf("Image %s not found in catalog (and not found locally in %s).", imageTag, app.ImageDir()), err}
+	}
+	opts.SSHUser = img.SSHUser
+	if ver.SSHPassword != "" {
+		opts.SSHPassword = ver.SSHPassword
+	} else if img.SSHPassword != "" {
+		opts.SSHPassword = img.SSHPassword
+	}
+	opts.Cmdline = ver.Cmdline
+
+	imgPath := filepath.Join(app.ImageDir(), fmt.Sprintf("%s-%s.qcow2", img.Name, ver.Version))
+	if _, err := os.Stat(imgPath); os.IsNotExist(err) {
+		if !jsonOut {
+			ui.Info("Image not found locally. Pulling %s:%s...", img.Name, ver.Version)
+		}
+		downloader := image.Downloader{Quiet: jsonOut}
+		if err := image.PrepareLocalImage(*ver, imgPath, downloader); err != nil {
+			return opts, &imageError{"ERR_IO", "Image preparation failed", "Check your network connection and registry checksum metadata.", fmt.Sprintf("Image preparation failed: %v", err), err}
+		}
+		if ver.Checksum == "" && !jsonOut {
+			ui.Warn("No checksum provided. Integrity cannot be verified.")
+		}
+		if !jsonOut {
+			ui.Success("Image prepared successfully.")
+		}
+	}
+	opts.DiskPath = imgPath
+	return opts, nil
+}
+
 func actionVMStart(app *appContext) func(cmd *cobra.Command, args []string) {
 	return func(cmd *cobra.Command, args []string) {
 		jsonOut := jsonEnabled(cmd)
 		gui, _ := cmd.Flags().GetBool("gui")
 		startCmdline, _ := cmd.Flags().GetString("cmdline")
+		wait, _ := cmd.Flags().GetBool("wait")
+
+		if raw, _ := cmd.Flags().GetString("selector"); raw != "" && wait {
+			if jsonOut {
+				_ = clijson.PrintJSON(clijson.NewResponseError("start", "ERR_INVALID_ARGS", "Invalid start options", "--wait takes a single VM, not -l", "Start by selector, then 'nido wait' each VM.", nil))
+			} else {
+				ui.Error("--wait takes a single VM, not -l.")
+			}
+			os.Exit(1)
+		}
+		if bulkVMAction(app, cmd, args, "start", "started", func(vm provider.VMStatus) bool { return vm.State == "stopped" }, func(name string) error {
+			return app.Provider.Start(name, provider.VMOptions{Gui: gui, Cmdline: startCmdline})
+		}) {
+			return
+		}
+
+		var waitOpts provider.WaitOptions
+		if wait {
+			var err error
+			if waitOpts, err = waitOptions(cmd, jsonOut); err != nil {
+				if jsonOut {
+					_ = clijson.PrintJSON(clijson.NewResponseError("start", "ERR_INVALID_ARGS", "Invalid wait options", err.Error(), "Use --for ssh|cloud-init|port:N|file:/path and a duration like 5m.", nil))
+				} else {
+					ui.Error("Invalid wait options: %v", err)
+				}
+				os.Exit(1)
+			}
+		}
 
 		if !jsonOut {
 			ui.Step("Starting VM...")
@@ -376,22 +698,167 @@ func actionVMStart(app *appContext) func(cmd *cobra.Command, args []string) {
 			os.Exit(1)
 		}
 		if jsonOut {
-			_ = clijson.PrintJSON(clijson.NewResponseOK("start", map[string]interface{}{
-				"action": map[string]interface{}{
-					"name":   args[0],
-					"result": "started",
-					"gui":    gui,
-				},
-			}))
+			action := map[string]interface{}{
+				"name":   args[0],
+				"result": "started",
+				"gui":    gui,
+			}
+			if wait {
+				action["wait"] = waitForVM(app, "start", args[0], waitOpts, true)
+			}
+			_ = clijson.PrintJSON(clijson.NewResponseOK("start", map[string]interface{}{"action": action}))
 			return
 		}
 		ui.Success("VM %s started.", args[0])
+		if wait {
+			res := waitForVM(app, "start", args[0], waitOpts, false)
+			ui.Success("VM %s is ready after %s.", args[0], (time.Duration(res.DurationMS) * time.Millisecond).Round(100*time.Millisecond))
+		}
+	}
+}
+
+func actionVMWait(app *appContext) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		jsonOut := jsonEnabled(cmd)
+		opts, err := waitOptions(cmd, jsonOut)
+		if err != nil {
+			if jsonOut {
+				_ = clijson.PrintJSON(clijson.NewResponseError("wait", "ERR_INVALID_ARGS", "Invalid wait options", err.Error(), "Use --for ssh|cloud-init|port:N|file:/path and a duration like 5m.", nil))
+			} else {
+				ui.Error("Invalid wait options: %v", err)
+			}
+			os.Exit(1)
+		}
+		res := waitForVM(app, "wait", args[0], opts, jsonOut)
+		if jsonOut {
+			_ = clijson.PrintJSON(clijson.NewResponseOK("wait", map[string]interface{}{
+				"name":   args[0],
+				"result": res,
+			}))
+			return
+		}
+		ui.Success("VM %s is ready after %s.", args[0], (time.Duration(res.DurationMS) * time.Millisecond).Round(100*time.Millisecond))
+	}
+}
+
+// spawnBatch creates every VM in names and reports each outcome, returning
+// false when any of them failed.
+func spawnBatch(app *appContext, names []string, opts provider.VMOptions, parallel int, wait *provider.WaitOptions, source string, jsonOut bool) bool {
+	results, err := app.Provider.SpawnBatch(names, opts, parallel, wait)
+	if err != nil {
+		if jsonOut {
+			_ = clijson.PrintJSON(clijson.NewResponseError("spawn", "ERR_INVALID_ARGS", "Batch spawn failed", err.Error(), "Check the names and options and try again.", nil))
+		} else {
+			ui.Error("Batch spawn failed: %v", err)
+		}
+		return false
+	}
+
+	failed := 0
+	for _, r := range results {
+		if r.Error != "" {
+			failed++
+		}
+		if jsonOut {
+			continue
+		}
+		switch r.Result {
+		case "spawned":
+			ui.Success("VM %s created from %s (SSH %d).", r.Name, source, r.SSHPort)
+		case "not_ready":
+			ui.Warn("VM %s created but not ready: %s", r.Name, r.Error)
+		default:
+			ui.Error("VM creation failed for %s: %s", r.Name, r.Error)
+		}
+	}
+
+	if jsonOut {
+		action := map[string]interface{}{
+			"count":    len(names),
+			"parallel": parallel,
+			"source":   source,
+			"results":  results,
+		}
+		if failed > 0 {
+			_ = clijson.PrintJSON(clijson.NewResponseError("spawn", "ERR_INTERNAL", "Batch spawn failed", fmt.Sprintf("%d of %d VMs failed", failed, len(results)), "See details.results for each VM; the others were created.", map[string]interface{}{"results": results}))
+		} else {
+			_ = clijson.PrintJSON(clijson.NewResponseOK("spawn", map[string]interface{}{"action": action}))
+		}
+	} else if failed > 0 {
+		ui.Error("%d of %d VMs failed.", failed, len(results))
+	} else if opts.SSHPassword != "" {
+		ui.Info("Initial SSH password: %s", opts.SSHPassword)
+	}
+	return failed == 0
+}
+
+func actionVMFork(app *appContext) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		jsonOut := jsonEnabled(cmd)
+		count, _ := cmd.Flags().GetInt("count")
+		prefix, _ := cmd.Flags().GetString("prefix")
+
+		if !jsonOut {
+			ui.Step("Forking %s into %d...", args[0], count)
+		}
+		created, err := app.Provider.Fork(args[0], count, prefix)
+
+		type forkEntry struct {
+			Name    string `json:"name"`
+			State   string `json:"state"`
+			SSHPort int    `json:"ssh_port"`
+			VNCPort int    `json:"vnc_port"`
+		}
+		forks := make([]forkEntry, 0, len(created))
+		for _, name := range created {
+			entry := forkEntry{Name: name}
+			if info, infoErr := app.Provider.Info(name); infoErr == nil {
+				entry.State = info.State
+				entry.SSHPort = info.SSHPort
+				entry.VNCPort = info.VNCPort
+			}
+			forks = append(forks, entry)
+		}
+
+		if err != nil {
+			code := "ERR_INTERNAL"
+			if isNotFoundErr(err) {
+				code = "ERR_NOT_FOUND"
+			} else if isAlreadyExistsErr(err) {
+				code = "ERR_ALREADY_EXISTS"
+			}
+			if jsonOut {
+				_ = clijson.PrintJSON(clijson.NewResponseError("fork", code, "Fork failed", err.Error(), "Check the source VM and clone names; forks listed in details were created.", map[string]interface{}{"forks": forks}))
+			} else {
+				for _, f := range forks {
+					ui.Info("Fork %s created (SSH %d).", f.Name, f.SSHPort)
+				}
+				ui.Error("Failed to fork VM %s: %v", args[0], err)
+			}
+			os.Exit(1)
+		}
+
+		if jsonOut {
+			_ = clijson.PrintJSON(clijson.NewResponseOK("fork", map[string]interface{}{
+				"source": args[0],
+				"forks":  forks,
+			}))
+			return
+		}
+		for _, f := range forks {
+			ui.Success("Fork %s hatched (SSH %d).", f.Name, f.SSHPort)
+		}
 	}
 }
 
 func actionVMStop(app *appContext) func(cmd *cobra.Command, args []string) {
 	return func(cmd *cobra.Command, args []string) {
 		jsonOut := jsonEnabled(cmd)
+		if bulkVMAction(app, cmd, args, "stop", "stopped", func(vm provider.VMStatus) bool { return vm.State != "stopped" }, func(name string) error {
+			return app.Provider.Stop(name, true)
+		}) {
+			return
+		}
 		if !jsonOut {
 			ui.Step("Stopping VM...")
 		}
@@ -422,9 +889,145 @@ func actionVMSSH(app *appContext) func(cmd *cobra.Command, args []string) {
 	}
 }
 
+func actionVMExec(app *appContext) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		jsonOut := jsonEnabled(cmd)
+		env, _ := cmd.Flags().GetStringArray("env")
+		workdir, _ := cmd.Flags().GetString("workdir")
+
+		command := args[1:]
+		if dash := cmd.ArgsLenAtDash(); dash > 0 {
+			command = args[dash:]
+		}
+		fail := func(code, detail string) {
+			if jsonOut {
+				_ = clijson.PrintJSON(clijson.NewResponseError("exec", code, "Exec failed", detail, "Check that the VM is running and reachable over SSH.", nil))
+			} else {
+				ui.Error("Exec failed: %s", detail)
+			}
+			os.Exit(1)
+		}
+
+		timeout, err := timeoutFlag(cmd)
+		if err != nil {
+			fail("ERR_INVALID_ARGS", err.Error())
+		}
+
+		res, err := app.Provider.Exec(args[0], command, provider.ExecOptions{Env: env, Workdir: workdir, Timeout: timeout})
+		if err != nil {
+			code := "ERR_INTERNAL"
+			if isNotFoundErr(err) {
+				code = "ERR_NOT_FOUND"
+			}
+			fail(code, err.Error())
+		}
+
+		// JSON mode reports the guest exit code in the payload; the response
+		// itself succeeded.
+		if jsonOut {
+			_ = clijson.PrintJSON(clijson.NewResponseOK("exec", map[string]interface{}{
+				"name":    args[0],
+				"command": command,
+				"result":  res,
+			}))
+			return
+		}
+		// Human mode stays pipe-friendly: guest output goes through untouched.
+		fmt.Fprint(os.Stdout, res.Stdout)
+		fmt.Fprint(os.Stderr, res.Stderr)
+		if res.TimedOut {
+			fmt.Fprintf(os.Stderr, "nido: command timed out after %s\n", timeout)
+		}
+		if res.ExitCode != 0 {
+			os.Exit(res.ExitCode)
+		}
+	}
+}
+
+func actionVMCopy(app *appContext) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		jsonOut := jsonEnabled(cmd)
+		fail := func(code, detail string) {
+			if jsonOut {
+				_ = clijson.PrintJSON(clijson.NewResponseError("cp", code, "Copy failed", detail, "Use <vm>:<path> for the guest side and check that the VM is running.", nil))
+			} else {
+				ui.Error("Copy failed: %s", detail)
+			}
+			os.Exit(1)
+		}
+
+		srcVM, srcPath := parseCopyTarget(args[0])
+		dstVM, dstPath := parseCopyTarget(args[1])
+		if (srcVM == "") == (dstVM == "") {
+			fail("ERR_INVALID_ARGS", "exactly one of source and destination must be a VM path (<vm>:<path>)")
+		}
+
+		// Progress goes to stderr and is throttled; JSON mode stays silent.
+		var opts provider.CopyOptions
+		if !jsonOut {
+			var last time.Time
+			opts.OnProgress = func(current, total int64) {
+				if time.Since(last) < 100*time.Millisecond {
+					return
+				}
+				last = time.Now()
+				if total > 0 {
+					fmt.Fprintf(os.Stderr, "\r  %s / %s (%d%%)   ", ui.HumanSize(current), ui.HumanSize(total), current*100/total)
+				} else {
+					fmt.Fprintf(os.Stderr, "\r  %s   ", ui.HumanSize(current))
+				}
+			}
+		}
+
+		var (
+			res       provider.CopyResult
+			err       error
+			vm        string
+			direction string
+		)
+		if dstVM != "" {
+			vm, direction = dstVM, "upload"
+			if !jsonOut {
+				ui.Step("Copying %s to %s:%s...", srcPath, vm, dstPath)
+			}
+			res, err = app.Provider.Upload(vm, srcPath, dstPath, opts)
+		} else {
+			vm, direction = srcVM, "download"
+			if !jsonOut {
+				ui.Step("Copying %s:%s to %s...", vm, srcPath, dstPath)
+			}
+			res, err = app.Provider.Download(vm, srcPath, dstPath, opts)
+		}
+		if !jsonOut && opts.OnProgress != nil {
+			fmt.Fprint(os.Stderr, "\r\033[K")
+		}
+		if err != nil {
+			code := "ERR_IO"
+			if isNotFoundErr(err) {
+				code = "ERR_NOT_FOUND"
+			}
+			fail(code, err.Error())
+		}
+
+		if jsonOut {
+			_ = clijson.PrintJSON(clijson.NewResponseOK("cp", map[string]interface{}{
+				"direction": direction,
+				"vm":        vm,
+				"source":    srcPath,
+				"result":    res,
+			}))
+			return
+		}
+		ui.Success("Copied %d files (%s) to %s in %s.", res.Files, ui.HumanSize(res.Bytes), res.Target, (time.Duration(res.DurationMS) * time.Millisecond).Round(time.Millisecond))
+	}
+}
+
 func actionVMDelete(app *appContext) func(cmd *cobra.Command, args []string) {
 	return func(cmd *cobra.Command, args []string) {
 		jsonOut := jsonEnabled(cmd)
+		if bulkVMAction(app, cmd, args, "delete", "deleted", func(provider.VMStatus) bool { return true }, app.Provider.Delete) {
+			return
+		}
 		if !jsonOut {
 			ui.Step("Deleting VM...")
 		}
@@ -459,6 +1062,21 @@ func actionVMDelete(app *appContext) func(cmd *cobra.Command, args []string) {
 func actionVMPrune(app *appContext) func(cmd *cobra.Command, args []string) {
 	return func(cmd *cobra.Command, args []string) {
 		jsonOut := jsonEnabled(cmd)
+		if expired, _ := cmd.Flags().GetBool("expired"); expired {
+			if raw, _ := cmd.Flags().GetString("selector"); raw != "" {
+				if jsonOut {
+					_ = clijson.PrintJSON(clijson.NewResponseError("prune", "ERR_INVALID_ARGS", "Invalid prune options", "--expired reaps every expired VM and takes no -l", "Use 'nido prune --expired' or 'nido prune -l ...'.", nil))
+				} else {
+					ui.Error("--expired reaps every expired VM and takes no -l.")
+				}
+				os.Exit(1)
+			}
+			pruneExpired(app, jsonOut)
+			return
+		}
+		if bulkVMAction(app, cmd, args, "prune", "deleted", func(vm provider.VMStatus) bool { return vm.State == "stopped" }, app.Provider.Delete) {
+			return
+		}
 		if !jsonOut {
 			ui.Step("Pruning stopped VMs...")
 		}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	clijson "github.com/Josepavese/nido/internal/cli"
+	"github.com/Josepavese/nido/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+func actionVolumeCreate(app *appContext) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		jsonOut := jsonEnabled(cmd)
+		if !jsonOut {
+			ui.Step("Creating volume %s (%s)...", args[0], args[1])
+		}
+		vol, err := app.Provider.VolumeCreate(args[0], args[1])
+		if err != nil {
+			if jsonOut {
+				_ = clijson.PrintJSON(clijson.NewResponseError("volume create", providerErrorCode(err), "Volume create failed", err.Error(), "Use a name of up to 20 letters, digits, '-' or '_' and a size like 50G.", nil))
+			} else {
+				ui.Error("Failed to create volume: %v", err)
+			}
+			os.Exit(1)
+		}
+		if jsonOut {
+			_ = clijson.PrintJSON(clijson.NewResponseOK("volume create", map[string]interface{}{"volume": vol}))
+			return
+		}
+		ui.Success("Volume %s created (%s).", vol.Name, ui.HumanSize(vol.SizeBytes))
+	}
+}
+
+func actionVolumeList(app *appContext) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		jsonOut := jsonEnabled(cmd)
+		volumes, err := app.Provider.VolumeList()
+		if err != nil {
+			if jsonOut {
+				_ = clijson.PrintJSON(clijson.NewResponseError("volume list", "ERR_IO", "Volume list failed", err.Error(), "Check your storage path and try again.", nil))
+			} else {
+				ui.Error("Failed to list volumes: %v", err)
+			}
+			os.Exit(1)
+		}
+		if jsonOut {
+			_ = clijson.PrintJSON(clijson.NewResponseOK("volume list", map[string]interface{}{"volumes": volumes}))
+			return
+		}
+		if len(volumes) == 0 {
+			ui.Info("No volumes yet. Create one with 'nido volume create <name> <size>'.")
+			return
+		}
+
+		ui.Header("Volumes")
+		fmt.Printf("\n %s%-22s %-10s %s%s\n", ui.Bold, "NAME", "SIZE", "ATTACHED TO", ui.Reset)
+		for _, v := range volumes {
+			users := make([]string, 0, len(v.Attachments))
+			for _, a := range v.Attachments {
+				if a.ReadOnly {
+					users = append(users, a.VM+" (ro)")
+				} else {
+					users = append(users, a.VM)
+				}
+			}
+			attached := "-"
+			if len(users) > 0 {
+				attached = strings.Join(users, ", ")
+			}
+			fmt.Printf(" %s%-22s%s %-10s %s\n", ui.Cyan, v.Name, ui.Reset, ui.HumanSize(v.SizeBytes), attached)
+		}
+		fmt.Println("")
+	}
+}
+
+func actionVolumeDelete(app *appContext) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		jsonOut := jsonEnabled(cmd)
+		if err := app.Provider.VolumeDelete(args[0]); err != nil {
+			if jsonOut {
+				_ = clijson.PrintJSON(clijson.NewResponseError("volume delete", providerErrorCode(err), "Volume delete failed", err.Error(), "Detach the volume from every VM first.", nil))
+			} else {
+				ui.Error("Failed to delete volume: %v", err)
+			}
+			os.Exit(1)
+		}
+		if jsonOut {
+			_ = clijson.PrintJSON(clijson.NewResponseOK("volume delete", map[string]interface{}{
+				"action": map[string]interface{}{"volume": args[0], "result": "deleted"},
+			}))
+			return
+		}
+		ui.Success("Volume %s deleted.", args[0])
+	}
+}
+
+func actionVolumeAttach(app *appContext) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		jsonOut := jsonEnabled(cmd)
+		readOnly, _ := cmd.Flags().GetBool("ro")
+		if err := app.Provider.VolumeAttach(args[0], args[1], readOnly); err != nil {
+			if jsonOut {
+				_ = clijson.PrintJSON(clijson.NewResponseError("volume attach", providerErrorCode(err), "Volume attach failed", err.Error(), "Stop the VM first; a volume in read-write use cannot be shared.", nil))
+			} else {
+				ui.Error("Failed to attach volume: %v", err)
+			}
+			os.Exit(1)
+		}
+		if jsonOut {
+			_ = clijson.PrintJSON(clijson.NewResponseOK("volume attach", map[string]interface{}{
+				"action": map[string]interface{}{"vm": args[0], "volume": args[1], "read_only": readOnly, "result": "attached"},
+			}))
+			return
+		}
+		ui.Success("Volume %s attached to %s; the guest sees it as /dev/disk/by-id/virtio-%s on next boot.", args[1], args[0], args[1])
+	}
+}
+
+func actionVolumeDetach(app *appContext) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		jsonOut := jsonEnabled(cmd)
+		if err := app.Provider.VolumeDetach(args[0], args[1]); err != nil {
+			if jsonOut {
+				_ = clijson.PrintJSON(clijson.NewResponseError("volume detach", providerErrorCode(err), "Volume detach failed", err.Error(), "Stop the VM first and check 'nido volume list'.", nil))
+			} else {
+				ui.Error("Failed to detach volume: %v", err)
+			}
+			os.Exit(1)
+		}
+		if jsonOut {
+			_ = clijson.PrintJSON(clijson.NewResponseOK("volume detach", map[string]interface{}{
+				"action": map[string]interface{}{"vm": args[0], "volume": args[1], "result": "detached"},
+			}))
+			return
+		}
+		ui.Success("Volume %s detached from %s.", args[1], args[0])
+	}
+}
@@ -3,9 +3,13 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"image"
+	"image/png"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/Josepavese/nido/internal/config"
 	"github.com/Josepavese/nido/internal/provider"
@@ -13,15 +17,57 @@ import (
 
 func TestJSONCommandsProduceSingleJSONAndNoStderr(t *testing.T) {
 	app := testAppContext(t)
+	if err := os.WriteFile(filepath.Join(app.Cwd, "nido.yaml"), []byte("vms:\n  vm-a:\n    template: base\n    labels: {team: search}\n  vm-b:\n    template: base\n"), 0o644); err != nil {
+		t.Fatalf("write nest file: %v", err)
+	}
 
 	cases := [][]string{
 		{"ls", "--json"},
 		{"info", "vm-a", "--json"},
+		{"snapshot", "list", "vm-a", "--json"},
+		{"checkpoint", "vm-a", "--json"},
+		{"fork", "vm-a", "--prefix", "trial-", "--json"},
+		{"exec", "vm-a", "--json", "--env", "A=1", "--", "ls", "-la"},
+		{"cp", "./notes.txt", "vm-a:/tmp/notes.txt", "--json"},
+		{"cp", "vm-a:/var/log", "./logs", "--json"},
+		{"wait", "vm-a", "--for", "cloud-init", "--timeout", "1m", "--json"},
+		{"start", "vm-a", "--wait", "--json"},
+		{"mount", "add", "vm-a", ".:/work:ro", "--json"},
+		{"mount", "remove", "vm-a", "/work", "--json"},
+		{"disk", "resize", "vm-a", "+20G", "--json"},
+		{"resize", "vm-a", "--memory", "1024", "--live", "--json"},
+		{"device", "add", "vm-a", "nic", "--json"},
+		{"logs", "vm-a", "--since", "10m", "--tail", "5", "--json"},
+		{"input", "vm-a", "key", "ctrl+alt+t", "--json"},
+		{"input", "vm-a", "click", "10", "20", "--button", "right", "--json"},
+		{"screenshot", "vm-a", "-o", filepath.Join(app.NidoDir, "vm-a.png"), "--json"},
+		{"device", "remove", "vm-a", "nic0", "--json"},
+		{"volume", "create", "data", "50G", "--json"},
+		{"volume", "list", "--json"},
+		{"volume", "attach", "vm-a", "data", "--ro", "--json"},
+		{"volume", "detach", "vm-a", "data", "--json"},
+		{"volume", "delete", "data", "--json"},
+		{"resume", "vm-a", "--from", "ckpt", "--json"},
 		{"template", "list", "--json"},
 		{"cache", "info", "--json"},
 		{"blueprint", "list", "--json"},
 		{"doctor", "--json"},
 		{"config", "--json"},
+		{"config", "vm-a", "--limit-cpu", "1.5", "--limit-pids", "256", "--json"},
+		{"config", "vm-a", "--restart", "on-failure", "--json"},
+		{"config", "vm-a", "--on-expiry", "stop", "--json"},
+		{"ttl", "vm-a", "--json"},
+		{"ttl", "vm-a", "extend", "30m", "--json"},
+		{"prune", "--expired", "--json"},
+		{"label", "vm-a", "team=search", "purpose-", "--json"},
+		{"spawn", "worker-{i}", "base", "--count", "3", "--parallel", "2", "--json"},
+		{"plan", "--json"},
+		{"up", "--json"},
+		{"down", "-f", "nido.yaml", "--json"},
+		{"state", "migrate", "--dry-run", "--json"},
+		{"ls", "-l", "team=search", "--json"},
+		{"stop", "-l", "team=search", "--json"},
+		{"delete", "-l", "team!=search", "--json"},
 		{"version", "--json"},
 		{"register", "--json"},
 	}
@@ -115,6 +161,25 @@ func TestHumanCommandsExecuteWithUnifiedOutput(t *testing.T) {
 	}
 }
 
+func TestSelectorActsOnlyOnMatchingVMs(t *testing.T) {
+	app := testAppContext(t)
+	for selector, want := range map[string]string{"team=search": `"results":[{"name":"vm-a","result":"stopped"}]`, "team=ads": `"results":[]`} {
+		root, err := newRootCommand(app)
+		if err != nil {
+			t.Fatalf("newRootCommand failed: %v", err)
+		}
+		stdout, _ := captureProcessIO(t, func() {
+			root.SetArgs([]string{"stop", "-l", selector, "--json"})
+			if err := root.Execute(); err != nil {
+				t.Fatalf("Execute failed: %v", err)
+			}
+		})
+		if !strings.Contains(stdout, want) {
+			t.Fatalf("stop -l %s: want %s in\n%s", selector, want, stdout)
+		}
+	}
+}
+
 func TestImageInfoAndRemoveJSONStayClean(t *testing.T) {
 	app := testAppContext(t)
 	writeCatalogFixture(t, app.Cwd)
@@ -279,11 +344,18 @@ scripts:
 type fakeProvider struct{}
 
 func (fakeProvider) Spawn(name string, opts provider.VMOptions) error { return nil }
+func (fakeProvider) SpawnBatch(names []string, opts provider.VMOptions, parallel int, wait *provider.WaitOptions) ([]provider.SpawnResult, error) {
+	results := make([]provider.SpawnResult, len(names))
+	for i, n := range names {
+		results[i] = provider.SpawnResult{Name: n, Result: "spawned", SSHPort: 50022 + i}
+	}
+	return results, nil
+}
 func (fakeProvider) Start(name string, opts provider.VMOptions) error { return nil }
 func (fakeProvider) Stop(name string, graceful bool) error            { return nil }
 func (fakeProvider) Delete(name string) error                         { return nil }
 func (fakeProvider) List() ([]provider.VMStatus, error) {
-	return []provider.VMStatus{{Name: "vm-a", State: "running", PID: 123, SSHPort: 50022, VNCPort: 59000, SSHUser: "vmuser"}}, nil
+	return []provider.VMStatus{{Name: "vm-a", State: "running", PID: 123, SSHPort: 50022, VNCPort: 59000, SSHUser: "vmuser", Labels: map[string]string{"team": "search"}}}, nil
 }
 func (fakeProvider) Info(name string) (provider.VMDetail, error) {
 	return provider.VMDetail{
@@ -303,6 +375,19 @@ func (fakeProvider) ListAccelerators() ([]provider.Accelerator, error) { return
 func (fakeProvider) GetUsedBackingFiles() ([]string, error)            { return nil, nil }
 func (fakeProvider) DeleteTemplate(name string, force bool) error      { return nil }
 func (fakeProvider) Prune() (int, error)                               { return 1, nil }
+func (fakeProvider) SetTTL(name, action string, d time.Duration) (*time.Time, error) {
+	at := time.Date(2026, 1, 1, 12, 30, 0, 0, time.UTC)
+	return &at, nil
+}
+func (fakeProvider) SetLabels(name string, set map[string]string, remove []string) (map[string]string, error) {
+	return set, nil
+}
+func (fakeProvider) ReapExpired() ([]provider.ExpiredVM, error) {
+	return []provider.ExpiredVM{{Name: "vm-old", ExpiredAt: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), Action: "deleted"}}, nil
+}
+func (fakeProvider) MigrateStates(dryRun bool) ([]provider.StateMigration, error) {
+	return []provider.StateMigration{{Name: "vm-old", From: 0, To: provider.StateSchemaVersion, Changes: []string{"ssh_port: assigned 50022"}}}, nil
+}
 func (fakeProvider) ListCachedImages() ([]provider.CachedImage, error) {
 	return []provider.CachedImage{{Name: "ubuntu", Version: "24.04", Size: "1.2 GB"}}, nil
 }
@@ -314,12 +399,81 @@ func (fakeProvider) CacheRemove(name, version string) error         { return nil
 func (fakeProvider) SSHCommand(name string) (string, error) {
 	return "ssh -p 50022 vmuser@127.0.0.1", nil
 }
-func (fakeProvider) PortForward(name string, pf provider.PortForward) (provider.PortForward, error) {
-	return pf, nil
+func (fakeProvider) PortForward(name string, pf provider.PortForward) (provider.PortForward, provider.ApplyMode, error) {
+	return pf, provider.AppliedNextBoot, nil
+}
+func (fakeProvider) PortUnforward(name string, guestPort int, protocol string) (provider.ApplyMode, error) {
+	return provider.AppliedNextBoot, nil
+}
+func (fakeProvider) PortList(name string) ([]provider.PortForward, error) { return nil, nil }
+func (fakeProvider) UpdateConfig(name string, updates provider.VMConfigUpdates) (provider.ApplyMode, error) {
+	return provider.AppliedNextBoot, nil
+}
+func (fakeProvider) SnapshotCreate(vmName, name string) error { return nil }
+func (fakeProvider) SnapshotList(vmName string) ([]provider.Snapshot, error) {
+	return []provider.Snapshot{{ID: "1", Name: "clean", CreatedAt: time.Unix(1700000000, 0).UTC()}}, nil
+}
+func (fakeProvider) SnapshotRestore(vmName, name string) error { return nil }
+func (fakeProvider) SnapshotDelete(vmName, name string) error  { return nil }
+func (fakeProvider) Checkpoint(vmName, name string) (provider.Snapshot, error) {
+	return provider.Snapshot{ID: "2", Name: "ckpt", VMStateSize: 256 << 20}, nil
+}
+func (fakeProvider) Exec(name string, command []string, opts provider.ExecOptions) (provider.ExecResult, error) {
+	return provider.ExecResult{ExitCode: 3, Stdout: "out\n", Stderr: "err\n"}, nil
+}
+func (fakeProvider) Upload(name, hostPath, guestPath string, opts provider.CopyOptions) (provider.CopyResult, error) {
+	return provider.CopyResult{Target: guestPath, Files: 1, Bytes: 42}, nil
+}
+func (fakeProvider) Download(name, guestPath, hostPath string, opts provider.CopyOptions) (provider.CopyResult, error) {
+	return provider.CopyResult{Target: hostPath, Files: 1, Bytes: 42}, nil
+}
+func (fakeProvider) Wait(name string, opts provider.WaitOptions) (provider.WaitResult, error) {
+	return provider.WaitResult{Ready: true, Stages: []provider.WaitStage{{Stage: "running", Reached: true}, {Stage: "ssh", Reached: true, DurationMS: 1200}}, DurationMS: 1200}, nil
+}
+func (fakeProvider) GuestInfo(name string) (provider.GuestInfo, error) {
+	return provider.GuestInfo{Hostname: name, OS: "Ubuntu 24.04 LTS", IPs: []string{"10.0.2.15/24"}}, nil
+}
+func (fakeProvider) MountAdd(name string, m provider.Mount) error { return nil }
+func (fakeProvider) MountRemove(name, guestPath string) error     { return nil }
+func (fakeProvider) VolumeCreate(name, size string) (provider.Volume, error) {
+	return provider.Volume{Name: name, SizeBytes: 50 << 30, Attachments: []provider.VolumeAttachment{}}, nil
+}
+func (fakeProvider) VolumeList() ([]provider.Volume, error) {
+	return []provider.Volume{{Name: "data", SizeBytes: 50 << 30, Attachments: []provider.VolumeAttachment{{VM: "vm-a", ReadOnly: true}}}}, nil
+}
+func (fakeProvider) VolumeDelete(name string) error                          { return nil }
+func (fakeProvider) VolumeAttach(vmName, volume string, readOnly bool) error { return nil }
+func (fakeProvider) VolumeDetach(vmName, volume string) error                { return nil }
+func (fakeProvider) DeviceAdd(name string, dev provider.Device) (provider.Device, provider.ApplyMode, error) {
+	if dev.ID == "" {
+		dev.ID = "nic0"
+	}
+	return dev, provider.AppliedLive, nil
+}
+func (fakeProvider) DeviceRemove(name, id string) (provider.ApplyMode, error) {
+	return provider.AppliedLive, nil
+}
+func (fakeProvider) ConsoleSocket(name string) (string, error) {
+	return "/tmp/" + name + ".console", nil
+}
+func (fakeProvider) Logs(name string, opts provider.LogOptions, emit func(provider.LogLine)) error {
+	emit(provider.LogLine{Time: time.Unix(0, 0).UTC(), Text: "login:"})
+	return nil
+}
+func (fakeProvider) Screenshot(name string) ([]byte, error) {
+	var buf bytes.Buffer
+	_ = png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 3)))
+	return buf.Bytes(), nil
+}
+func (fakeProvider) SendInput(name string, in provider.InputAction) error {
+	return nil
+}
+func (fakeProvider) Fork(vmName string, count int, prefix string) ([]string, error) {
+	return []string{prefix + "1"}, nil
+}
+func (fakeProvider) Resume(vmName, checkpoint string) (provider.Snapshot, error) {
+	return provider.Snapshot{ID: "2", Name: "ckpt", VMStateSize: 256 << 20}, nil
 }
-func (fakeProvider) PortUnforward(name string, guestPort int, protocol string) error  { return nil }
-func (fakeProvider) PortList(name string) ([]provider.PortForward, error)             { return nil, nil }
-func (fakeProvider) UpdateConfig(name string, updates provider.VMConfigUpdates) error { return nil }
 func (fakeProvider) Doctor() []string {
 	return []string{"Binary: QEMU [PASS] /usr/bin/qemu-system-x86_64"}
 }
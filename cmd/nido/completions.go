@@ -5,19 +5,31 @@ import (
 
 	"github.com/Josepavese/nido/internal/builder"
 	climeta "github.com/Josepavese/nido/internal/cli"
+	"github.com/Josepavese/nido/internal/provider"
 	"github.com/spf13/cobra"
 )
 
 func buildCompletionRegistry(app *appContext) map[string]climeta.CompletionFunc {
 	return map[string]climeta.CompletionFunc{
-		"vms":        completeVMs(app),
-		"templates":  completeTemplates(app),
-		"images":     completeImages(app),
-		"blueprints": completeBlueprints(app),
-		"config":     completeConfig(app),
-		"config_set": completeConfigSet(),
-		"spawn":      completeSpawn(app),
-		"ssh":        completeSSH(app),
+		"vms":              completeVMs(app),
+		"templates":        completeTemplates(app),
+		"snapshots":        completeSnapshots(app),
+		"checkpoints":      completeCheckpoints(app),
+		"mounts":           completeMounts(app),
+		"volumes":          completeVolumes(app),
+		"devices":          completeDevices(app),
+		"device_types":     completeDeviceTypes(),
+		"input_actions":    completeInputActions(),
+		"input_buttons":    completeInputButtons(),
+		"restart_policies": completeRestartPolicies(),
+		"ttl_actions":      completeTTLActions(),
+		"expiry_actions":   completeExpiryActions(),
+		"images":           completeImages(app),
+		"blueprints":       completeBlueprints(app),
+		"config":           completeConfig(app),
+		"config_set":       completeConfigSet(),
+		"spawn":            completeSpawn(app),
+		"ssh":              completeSSH(app),
 		"files": func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
 			return nil, cobra.ShellCompDirectiveDefault
 		},
@@ -38,6 +50,126 @@ func completeVMs(app *appContext) func(cmd *cobra.Command, args []string, toComp
 	}
 }
 
+func completeSnapshots(app *appContext) func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) == 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		snapshots, err := app.Provider.SnapshotList(args[0])
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		items := make([]string, 0, len(snapshots))
+		for _, s := range snapshots {
+			items = append(items, s.Name)
+		}
+		return toShellDirective(items)
+	}
+}
+
+func completeCheckpoints(app *appContext) func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) == 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		snapshots, err := app.Provider.SnapshotList(args[0])
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		var items []string
+		for _, s := range snapshots {
+			if s.IsCheckpoint() {
+				items = append(items, s.Name)
+			}
+		}
+		return toShellDirective(items)
+	}
+}
+
+func completeDeviceTypes() func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return toShellDirective([]string{provider.DeviceDisk, provider.DeviceNIC, provider.DeviceUSBStorage})
+	}
+}
+
+func completeInputActions() func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return toShellDirective([]string{provider.InputType, provider.InputKey, provider.InputClick, provider.InputMove})
+	}
+}
+
+func completeRestartPolicies() func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return toShellDirective([]string{provider.RestartNo, provider.RestartOnFailure, provider.RestartAlways})
+	}
+}
+
+func completeTTLActions() func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return toShellDirective([]string{provider.TTLSet, provider.TTLExtend, provider.TTLClear})
+	}
+}
+
+func completeExpiryActions() func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return toShellDirective([]string{provider.ExpiryDelete, provider.ExpiryStop})
+	}
+}
+
+func completeInputButtons() func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return toShellDirective([]string{"left", "right", "middle"})
+	}
+}
+
+func completeDevices(app *appContext) func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) == 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		detail, err := app.Provider.Info(args[0])
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		items := make([]string, 0, len(detail.Devices))
+		for _, d := range detail.Devices {
+			items = append(items, d.ID)
+		}
+		return toShellDirective(items)
+	}
+}
+
+func completeMounts(app *appContext) func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) == 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		detail, err := app.Provider.Info(args[0])
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		items := make([]string, 0, len(detail.Mounts))
+		for _, m := range detail.Mounts {
+			items = append(items, m.GuestPath)
+		}
+		return toShellDirective(items)
+	}
+}
+
+func completeVolumes(app *appContext) func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		volumes, err := app.Provider.VolumeList()
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		items := make([]string, 0, len(volumes))
+		for _, v := range volumes {
+			items = append(items, v.Name)
+		}
+		return toShellDirective(items)
+	}
+}
+
 func completeTemplates(app *appContext) func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
 	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
 		templates, err := app.Provider.ListTemplates()
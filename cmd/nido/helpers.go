@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	clijson "github.com/Josepavese/nido/internal/cli"
 	"github.com/Josepavese/nido/internal/config"
@@ -90,3 +92,126 @@ func formatVMTablePortSummary(vm provider.VMStatus) string {
 	}
 	return portSum
 }
+
+// parseCopyTarget splits a cp operand into VM name and path. Host paths
+// return an empty VM: anything without a colon, Windows drive letters
+// (C:\x), and prefixes holding a path separator (./a:b).
+func parseCopyTarget(arg string) (vm, path string) {
+	name, rest, ok := strings.Cut(arg, ":")
+	if !ok || name == "" || len(name) == 1 || strings.ContainsAny(name, `/\`) {
+		return "", arg
+	}
+	return name, rest
+}
+
+// timeoutFlag parses --timeout; empty means no explicit limit.
+func timeoutFlag(cmd *cobra.Command) (time.Duration, error) {
+	raw, _ := cmd.Flags().GetString("timeout")
+	if raw == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid --timeout %q", raw)
+	}
+	return d, nil
+}
+
+// sinceFlag parses --since as a duration ago or an RFC3339 time; empty
+// means no lower bound.
+func sinceFlag(cmd *cobra.Command, now time.Time) (time.Time, error) {
+	raw, _ := cmd.Flags().GetString("since")
+	since, err := provider.ParseSince(raw, now)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid --since: %w", err)
+	}
+	return since, nil
+}
+
+// limitUpdates reads the --limit-* flags that were given; 0 removes a limit.
+func limitUpdates(cmd *cobra.Command) (provider.VMConfigUpdates, bool, error) {
+	var updates provider.VMConfigUpdates
+	changed := false
+	if cmd.Flags().Changed("limit-cpu") {
+		raw, _ := cmd.Flags().GetString("limit-cpu")
+		cpus, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+		if err != nil || cpus < 0 {
+			return updates, false, fmt.Errorf("invalid --limit-cpu %q: use a number of cores like 1.5", raw)
+		}
+		updates.CPULimit = &cpus
+		changed = true
+	}
+	for flag, dst := range map[string]**int{
+		"limit-memory":    &updates.MemoryLimitMB,
+		"limit-io-weight": &updates.IOWeight,
+		"limit-pids":      &updates.PidsLimit,
+	} {
+		if cmd.Flags().Changed(flag) {
+			val, _ := cmd.Flags().GetInt(flag)
+			*dst = &val
+			changed = true
+		}
+	}
+	return updates, changed, nil
+}
+
+// waitOptions builds readiness options from --for and --timeout. Human mode
+// reports each stage as it is reached.
+func waitOptions(cmd *cobra.Command, jsonOut bool) (provider.WaitOptions, error) {
+	conditions, _ := cmd.Flags().GetStringArray("for")
+	for _, c := range conditions {
+		if err := provider.ValidateWaitCondition(c); err != nil {
+			return provider.WaitOptions{}, err
+		}
+	}
+	timeout, err := timeoutFlag(cmd)
+	if err != nil {
+		return provider.WaitOptions{}, err
+	}
+	opts := provider.WaitOptions{For: conditions, Timeout: timeout}
+	if !jsonOut {
+		opts.OnStage = func(s provider.WaitStage) {
+			if s.Reached {
+				ui.Success("%s reached in %s", s.Stage, (time.Duration(s.DurationMS) * time.Millisecond).Round(100*time.Millisecond))
+			}
+		}
+	}
+	return opts, nil
+}
+
+// waitForVM runs Wait and exits on failure, leaving the VM as it is. The
+// JSON error carries the stages reached so far.
+func waitForVM(app *appContext, command, name string, opts provider.WaitOptions, jsonOut bool) provider.WaitResult {
+	if !jsonOut {
+		ui.Step("Waiting for %s to become ready...", name)
+	}
+	res, err := app.Provider.Wait(name, opts)
+	if err != nil {
+		code := "ERR_INTERNAL"
+		switch {
+		case strings.Contains(err.Error(), "timed out"):
+			code = "ERR_TIMEOUT"
+		case isNotFoundErr(err):
+			code = "ERR_NOT_FOUND"
+		}
+		if jsonOut {
+			_ = clijson.PrintJSON(clijson.NewResponseError(command, code, "VM not ready", err.Error(), "Check 'nido info "+name+"' and retry 'nido wait' with a longer --timeout.", map[string]interface{}{"wait": res}))
+		} else {
+			ui.Error("VM %s is not ready: %v", name, err)
+		}
+		os.Exit(1)
+	}
+	return res
+}
+
+// providerErrorCode maps provider errors onto the shared JSON error codes.
+func providerErrorCode(err error) string {
+	switch {
+	case isNotFoundErr(err):
+		return "ERR_NOT_FOUND"
+	case isAlreadyExistsErr(err):
+		return "ERR_ALREADY_EXISTS"
+	default:
+		return "ERR_IO"
+	}
+}
@@ -0,0 +1,279 @@
+// Package cgroup confines processes with cgroup v2 resource limits.
+//
+// Groups are placed in one of two ways. When the caller's cgroup parent is
+// delegated to it (root, containers with a cgroup namespace, services with
+// Delegate=yes) the group is created directly in the cgroup filesystem.
+// Ordinary login sessions are not delegated, so there the command runs in
+// a transient systemd user scope that carries the limits instead.
+package cgroup
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Root is the cgroup v2 mount point.
+var Root = "/sys/fs/cgroup"
+
+// cpuPeriodUsec is the cpu.max period; the quota is CPUs times this.
+const cpuPeriodUsec = 100000
+
+// controllers are enabled for nido groups whenever the parent allows it.
+var controllers = []string{"cpu", "memory", "io", "pids"}
+
+// Limits are the controls of a group. Zero fields are unlimited.
+type Limits struct {
+	// CPUs is the CPU time quota in cores (1.5 = one and a half cores).
+	CPUs float64
+	// MemoryMax caps memory in bytes.
+	MemoryMax int64
+	// IOWeight is the relative block IO weight, 1-10000.
+	IOWeight int
+	// PidsMax caps processes and threads.
+	PidsMax int
+}
+
+// Usage is the live resource use of a group. Fields whose controller is not
+// enabled stay zero.
+type Usage struct {
+	MemoryBytes  int64 `json:"memory_bytes"`
+	CPUUsec      int64 `json:"cpu_usec"`
+	Pids         int   `json:"pids"`
+	IOReadBytes  int64 `json:"io_read_bytes"`
+	IOWriteBytes int64 `json:"io_write_bytes"`
+}
+
+// Files renders l as control file contents. Unlimited fields reset the
+// control, so the same files serve creation and live updates.
+func Files(l Limits) map[string]string {
+	files := map[string]string{
+		"cpu.max":    fmt.Sprintf("max %d", cpuPeriodUsec),
+		"memory.max": "max",
+		"io.weight":  "default 100",
+		"pids.max":   "max",
+	}
+	if l.CPUs > 0 {
+		files["cpu.max"] = fmt.Sprintf("%d %d", int64(l.CPUs*cpuPeriodUsec), cpuPeriodUsec)
+	}
+	if l.MemoryMax > 0 {
+		files["memory.max"] = strconv.FormatInt(l.MemoryMax, 10)
+	}
+	if l.IOWeight > 0 {
+		files["io.weight"] = fmt.Sprintf("default %d", l.IOWeight)
+	}
+	if l.PidsMax > 0 {
+		files["pids.max"] = strconv.Itoa(l.PidsMax)
+	}
+	return files
+}
+
+// requested reports whether l sets the control in file.
+func requested(l Limits, file string) bool {
+	switch file {
+	case "cpu.max":
+		return l.CPUs > 0
+	case "memory.max":
+		return l.MemoryMax > 0
+	case "io.weight":
+		return l.IOWeight > 0
+	case "pids.max":
+		return l.PidsMax > 0
+	}
+	return false
+}
+
+// Set writes l to an existing group. A missing control file means its
+// controller is not delegated; that is only an error if l asks for it.
+func Set(dir string, l Limits) error {
+	for file, value := range Files(l) {
+		err := writeControl(filepath.Join(dir, file), value)
+		if err == nil {
+			continue
+		}
+		if os.IsNotExist(err) && !requested(l, file) {
+			continue
+		}
+		if os.IsNotExist(err) {
+			return fmt.Errorf("the %s controller is not available in %s", strings.SplitN(file, ".", 2)[0], dir)
+		}
+		return err
+	}
+	return nil
+}
+
+// writeControl writes an existing control file; control files cannot be
+// created, so a missing one reports os.ErrNotExist.
+func writeControl(path, value string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(value); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Create makes the group dir, enabling controllers in its parent first, and
+// writes l to it. An existing empty group is reused.
+func Create(dir string, l Limits) error {
+	parent := filepath.Dir(dir)
+	for _, c := range controllers {
+		// Each controller on its own: one missing must not block the rest.
+		_ = os.WriteFile(filepath.Join(parent, "cgroup.subtree_control"), []byte("+"+c), 0644)
+	}
+	if err := os.Mkdir(dir, 0755); err != nil && !os.IsExist(err) {
+		return err
+	}
+	return Set(dir, l)
+}
+
+// Move puts pid, with all its threads, into the group dir.
+func Move(dir string, pid int) error {
+	return os.WriteFile(filepath.Join(dir, "cgroup.procs"), []byte(strconv.Itoa(pid)), 0644)
+}
+
+// Remove deletes an empty group. A missing group is not an error.
+func Remove(dir string) error {
+	if err := os.Remove(dir); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Of returns the cgroup v2 directory of pid.
+func Of(pid int) (string, error) {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/cgroup", pid))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if rel, ok := strings.CutPrefix(scanner.Text(), "0::"); ok {
+			return filepath.Join(Root, rel), nil
+		}
+	}
+	return "", errors.New("process is not in a cgroup v2 hierarchy")
+}
+
+// Delegated returns the directory nido groups can be created in directly:
+// the parent of the caller's cgroup (or the root of a cgroup namespace),
+// provided the caller may write to it.
+func Delegated() (string, error) {
+	if _, err := os.Stat(filepath.Join(Root, "cgroup.controllers")); err != nil {
+		return "", fmt.Errorf("cgroup v2 is not mounted at %s", Root)
+	}
+	own, err := Of(os.Getpid())
+	if err != nil {
+		return "", err
+	}
+	base := own
+	if own != Root {
+		base = filepath.Dir(own)
+	}
+	for _, file := range []string{"cgroup.procs", "cgroup.subtree_control"} {
+		f, err := os.OpenFile(filepath.Join(base, file), os.O_WRONLY, 0)
+		if err != nil {
+			return "", fmt.Errorf("%s is not delegated to this user", base)
+		}
+		f.Close()
+	}
+	return base, nil
+}
+
+// SystemdScopeAvailable reports whether a systemd user manager can run
+// commands in transient scopes.
+func SystemdScopeAvailable() bool {
+	if _, err := exec.LookPath("systemd-run"); err != nil {
+		return false
+	}
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	if runtimeDir == "" {
+		runtimeDir = fmt.Sprintf("/run/user/%d", os.Getuid())
+	}
+	_, err := os.Stat(filepath.Join(runtimeDir, "systemd", "private"))
+	return err == nil
+}
+
+// SystemdRunArgs is the command prefix that runs a command in the transient
+// user scope unit with l applied.
+func SystemdRunArgs(unit string, l Limits) []string {
+	args := []string{"systemd-run", "--user", "--scope", "--quiet", "--collect", "--unit=" + unit}
+	if l.CPUs > 0 {
+		args = append(args, "-p", fmt.Sprintf("CPUQuota=%d%%", int64(l.CPUs*100)))
+	}
+	if l.MemoryMax > 0 {
+		args = append(args, "-p", fmt.Sprintf("MemoryMax=%d", l.MemoryMax))
+	}
+	if l.IOWeight > 0 {
+		args = append(args, "-p", fmt.Sprintf("IOWeight=%d", l.IOWeight))
+	}
+	if l.PidsMax > 0 {
+		args = append(args, "-p", fmt.Sprintf("TasksMax=%d", l.PidsMax))
+	}
+	return append(args, "--")
+}
+
+// ReadUsage reads the live usage of the group dir.
+func ReadUsage(dir string) (Usage, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return Usage{}, err
+	}
+	var u Usage
+	u.MemoryBytes = readInt(filepath.Join(dir, "memory.current"))
+	u.Pids = int(readInt(filepath.Join(dir, "pids.current")))
+	u.CPUUsec = readKeyed(filepath.Join(dir, "cpu.stat"), "usage_usec")
+	u.IOReadBytes = readKeyed(filepath.Join(dir, "io.stat"), "rbytes")
+	u.IOWriteBytes = readKeyed(filepath.Join(dir, "io.stat"), "wbytes")
+	return u, nil
+}
+
+// OOMKills returns how many processes of the group dir the OOM killer has
+// ended at its memory limit.
+func OOMKills(dir string) int64 {
+	return readKeyed(filepath.Join(dir, "memory.events"), "oom_kill")
+}
+
+func readInt(path string) int64 {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	v, _ := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	return v
+}
+
+// readKeyed sums every "key value" or "key=value" field named key, which
+// covers both cpu.stat and the per-device lines of io.stat.
+func readKeyed(path, key string) int64 {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	var total int64
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		for i, f := range fields {
+			var raw string
+			if v, ok := strings.CutPrefix(f, key+"="); ok {
+				raw = v
+			} else if f == key && i+1 < len(fields) {
+				raw = fields[i+1]
+			} else {
+				continue
+			}
+			if v, err := strconv.ParseInt(raw, 10, 64); err == nil {
+				total += v
+			}
+		}
+	}
+	return total
+}
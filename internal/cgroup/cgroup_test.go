@@ -0,0 +1,103 @@
+package cgroup
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFilesRenderLimitsAndResets(t *testing.T) {
+	got := Files(Limits{CPUs: 1.5, MemoryMax: 3 << 30, IOWeight: 200, PidsMax: 256})
+	want := map[string]string{
+		"cpu.max":    "150000 100000",
+		"memory.max": "3221225472",
+		"io.weight":  "default 200",
+		"pids.max":   "256",
+	}
+	for file, value := range want {
+		if got[file] != value {
+			t.Fatalf("%s = %q, want %q", file, got[file], value)
+		}
+	}
+
+	reset := Files(Limits{})
+	if reset["cpu.max"] != "max 100000" || reset["memory.max"] != "max" || reset["io.weight"] != "default 100" || reset["pids.max"] != "max" {
+		t.Fatalf("reset files = %v", reset)
+	}
+}
+
+func TestSystemdRunArgs(t *testing.T) {
+	got := strings.Join(SystemdRunArgs("nido-vm1.scope", Limits{CPUs: 0.5, MemoryMax: 1 << 30, PidsMax: 64}), " ")
+	want := "systemd-run --user --scope --quiet --collect --unit=nido-vm1.scope -p CPUQuota=50% -p MemoryMax=1073741824 -p TasksMax=64 --"
+	if got != want {
+		t.Fatalf("args = %q, want %q", got, want)
+	}
+}
+
+func TestSetSkipsUnrequestedMissingControllers(t *testing.T) {
+	dir := t.TempDir()
+	// Only cpu and pids are delegated.
+	for _, f := range []string{"cpu.max", "pids.max"} {
+		if err := os.WriteFile(filepath.Join(dir, f), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := Set(dir, Limits{CPUs: 2, PidsMax: 100}); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "cpu.max")); string(data) != "200000 100000" {
+		t.Fatalf("cpu.max = %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "memory.max")); !os.IsNotExist(err) {
+		t.Fatalf("Set created memory.max")
+	}
+
+	err := Set(dir, Limits{MemoryMax: 1 << 30})
+	if err == nil || !strings.Contains(err.Error(), "memory controller") {
+		t.Fatalf("Set with a missing requested controller = %v", err)
+	}
+}
+
+func TestReadUsage(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"memory.current": "52428800\n",
+		"pids.current":   "7\n",
+		"cpu.stat":       "usage_usec 1500000\nuser_usec 1000000\nsystem_usec 500000\n",
+		"io.stat":        "8:0 rbytes=1000 wbytes=2000 rios=1 wios=2\n259:0 rbytes=24 wbytes=48 rios=1 wios=1\n",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	u, err := ReadUsage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u != (Usage{MemoryBytes: 52428800, CPUUsec: 1500000, Pids: 7, IOReadBytes: 1024, IOWriteBytes: 2048}) {
+		t.Fatalf("usage = %+v", u)
+	}
+	if _, err := ReadUsage(filepath.Join(dir, "gone")); err == nil {
+		t.Fatal("ReadUsage of a missing group succeeded")
+	}
+}
+
+func TestCreateEnablesControllersAndMoves(t *testing.T) {
+	parent := t.TempDir()
+	dir := filepath.Join(parent, "nido-vm1")
+	if err := Create(dir, Limits{}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(parent, "cgroup.subtree_control")); string(data) != "+pids" {
+		// A plain file keeps only the last write; the real file accumulates.
+		t.Fatalf("subtree_control = %q", data)
+	}
+	if err := Move(dir, 1234); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "cgroup.procs")); string(data) != "1234" {
+		t.Fatalf("cgroup.procs = %q", data)
+	}
+}
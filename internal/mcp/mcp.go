@@ -1,7 +1,9 @@
 package mcp
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/url"
@@ -16,6 +18,7 @@ import (
 	"github.com/Josepavese/nido/internal/config"
 	"github.com/Josepavese/nido/internal/image"
 	"github.com/Josepavese/nido/internal/lifecycle"
+	"github.com/Josepavese/nido/internal/nest"
 	"github.com/Josepavese/nido/internal/pkg/sysutil"
 	"github.com/Josepavese/nido/internal/provider"
 )
@@ -74,30 +77,74 @@ func ToolsCatalog() []map[string]interface{} {
 	return []map[string]interface{}{
 		{
 			"name":        "nido_vm",
-			"description": "Operate the VM fleet through a single high-power tool. Use actions such as list, info, create, start, stop, delete, ssh, prune, config_update, port_forward, port_unforward, and port_list. Prefer resources like nido://fleet/vms or nido://vm/{name} for inspection when your client supports resources; use this tool for mutations or as a universal fallback.",
+			"description": "Operate the VM fleet through a single tool. Actions by group: lifecycle (list, info, create, start, stop, delete, prune, wait, fork); configuration (config_update, label, ttl_set, ttl_extend, ttl_clear); ports (port_forward, port_unforward, port_list); snapshots (snapshot_create, snapshot_list, snapshot_restore, snapshot_delete, checkpoint, resume); guest access (ssh, exec, upload, download, logs); display (screenshot, input_type, input_key, input_click, input_move); storage (mount_add, mount_remove, device_add, device_remove, volume_create, volume_list, volume_delete, volume_attach, volume_detach); nest files (nest_plan, nest_up, nest_down). Each parameter says which actions use it. Prefer resources like nido://fleet/vms or nido://vm/{name} for inspection when your client supports resources; use this tool for mutations or as a universal fallback.",
 			"inputSchema": map[string]interface{}{
 				"type": "object",
 				"properties": map[string]interface{}{
-					"action":        map[string]interface{}{"type": "string", "enum": []string{"list", "info", "create", "start", "stop", "delete", "ssh", "prune", "config_update", "port_forward", "port_unforward", "port_list"}},
-					"name":          map[string]interface{}{"type": "string", "description": "VM name for any action that targets a specific VM."},
-					"template":      map[string]interface{}{"type": "string", "description": "Template name for action=create."},
-					"image":         map[string]interface{}{"type": "string", "description": "Image tag like ubuntu:24.04 for action=create."},
-					"user_data":     map[string]interface{}{"type": "string", "description": "Cloud-init user-data content for action=create."},
-					"gui":           map[string]interface{}{"type": "boolean"},
-					"cmdline":       map[string]interface{}{"type": "string"},
-					"memory_mb":     map[string]interface{}{"type": "integer"},
-					"vcpus":         map[string]interface{}{"type": "integer"},
-					"ports":         map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}, "description": "Port rules like [\"http:80:30080/tcp\"]."},
-					"raw_qemu_args": map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
-					"accelerators":  map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
-					"mapping":       map[string]interface{}{"type": "string", "description": "Single port mapping used by action=port_forward."},
-					"guest_port":    map[string]interface{}{"type": "integer", "description": "Guest port used by action=port_unforward."},
-					"protocol":      map[string]interface{}{"type": "string", "description": "Protocol used by action=port_unforward, typically tcp or udp."},
-					"ssh_port":      map[string]interface{}{"type": "integer"},
-					"vnc_port":      map[string]interface{}{"type": "integer"},
-					"ssh_user":      map[string]interface{}{"type": "string"},
-					"web":           map[string]interface{}{"type": "boolean", "description": "Expose HTTP and HTTPS defaults for action=create."},
-					"ftp":           map[string]interface{}{"type": "boolean", "description": "Expose FTP default port for action=create."},
+					"action":          map[string]interface{}{"type": "string", "description": "Operation to run. fork clones a VM into independent copies, checkpoint/resume save and restore memory state, logs reads the serial console (boot output, kernel panics), screenshot returns the display of a running VM as a PNG image, and input_* drive its keyboard and mouse.", "enum": []string{"list", "info", "create", "start", "stop", "delete", "ssh", "prune", "config_update", "port_forward", "port_unforward", "port_list", "snapshot_create", "snapshot_list", "snapshot_restore", "snapshot_delete", "checkpoint", "resume", "fork", "exec", "upload", "download", "wait", "mount_add", "mount_remove", "volume_create", "volume_list", "volume_delete", "volume_attach", "volume_detach", "device_add", "device_remove", "logs", "screenshot", "input_type", "input_key", "input_click", "input_move", "ttl_set", "ttl_extend", "ttl_clear", "label", "nest_plan", "nest_up", "nest_down"}},
+					"name":            map[string]interface{}{"type": "string", "description": "VM name for any action that targets a specific VM."},
+					"template":        map[string]interface{}{"type": "string", "description": "Template name for action=create."},
+					"image":           map[string]interface{}{"type": "string", "description": "Image tag like ubuntu:24.04 for action=create."},
+					"user_data":       map[string]interface{}{"type": "string", "description": "Cloud-init user-data content for action=create."},
+					"gui":             map[string]interface{}{"type": "boolean"},
+					"cmdline":         map[string]interface{}{"type": "string"},
+					"memory_mb":       map[string]interface{}{"type": "integer"},
+					"vcpus":           map[string]interface{}{"type": "integer"},
+					"max_memory_mb":   map[string]interface{}{"type": "integer", "description": "For create/config_update: memory ceiling for live balloon resizing (defaults to memory_mb)."},
+					"max_vcpus":       map[string]interface{}{"type": "integer", "description": "For create/config_update: vCPU ceiling for live vCPU hotplug (defaults to vcpus, no hotplug)."},
+					"cpu_limit":       map[string]interface{}{"type": "number", "description": "For create/config_update: host CPU cap for the VM's QEMU process in cores, e.g. 1.5 (0 removes it). Enforced through a cgroup when the host allows; info reports whether it is and the live usage."},
+					"memory_limit_mb": map[string]interface{}{"type": "integer", "description": "For create/config_update: host memory cap in MB for the QEMU process; must cover guest RAM plus QEMU overhead (0 removes it)."},
+					"io_weight":       map[string]interface{}{"type": "integer", "description": "For create/config_update: block I/O weight 1-10000 (0 removes it)."},
+					"pids_limit":      map[string]interface{}{"type": "integer", "description": "For create/config_update: maximum tasks for the QEMU process (0 removes it)."},
+					"restart_policy":  map[string]interface{}{"type": "string", "enum": []string{"no", "on-failure", "always"}, "description": "For create/config_update: what the supervisor (nido daemon) does when QEMU exits on its own. info reports restarts and last_exit with the exit reason."},
+					"ttl":             map[string]interface{}{"type": "string", "description": "Time-to-live like \"30m\", \"2h\" or \"7d\" for create, ttl_set (counted from now) and ttl_extend (added to the current expiry); ttl_clear removes it. list and info report expires_at."},
+					"on_expiry":       map[string]interface{}{"type": "string", "enum": []string{"delete", "stop"}, "description": "For create/config_update: what the reaper does once the TTL runs out (default delete)."},
+					"labels":          map[string]interface{}{"type": "object", "additionalProperties": map[string]interface{}{"type": "string"}, "description": "key=value labels for create and action=label, e.g. {\"team\": \"search\"}. list and info report them."},
+					"remove_labels":   map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}, "description": "Label keys to drop for action=label."},
+					"file":            map[string]interface{}{"type": "string", "description": "Declarative nest file for nest_plan (per-VM create/update/start and drift), nest_up (applies the plan) and nest_down (deletes the declared VMs); default nido.yaml in the server's working directory."},
+					"selector":        map[string]interface{}{"type": "string", "description": "Label selector for list, start, stop, delete and prune, used instead of name to act on every VM whose labels match: comma-separated key=value, key!=value, key (present) and !key (absent). Bulk actions return per-VM results."},
+					"expired":         map[string]interface{}{"type": "boolean", "description": "For action=prune: reap VMs whose TTL ran out instead of deleting stopped VMs."},
+					"live":            map[string]interface{}{"type": "boolean", "description": "For action=config_update: apply memory_mb (balloon) and vcpus (hotplug) to the running VM now, failing instead of deferring to next boot."},
+					"ports":           map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}, "description": "Port rules like [\"http:80:30080/tcp\"]."},
+					"raw_qemu_args":   map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+					"accelerators":    map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+					"mapping":         map[string]interface{}{"type": "string", "description": "Single port mapping used by action=port_forward."},
+					"guest_port":      map[string]interface{}{"type": "integer", "description": "Guest port used by action=port_unforward."},
+					"protocol":        map[string]interface{}{"type": "string", "description": "Protocol used by action=port_unforward, typically tcp or udp."},
+					"ssh_port":        map[string]interface{}{"type": "integer"},
+					"vnc_port":        map[string]interface{}{"type": "integer"},
+					"ssh_user":        map[string]interface{}{"type": "string"},
+					"web":             map[string]interface{}{"type": "boolean", "description": "Expose HTTP and HTTPS defaults for action=create."},
+					"ftp":             map[string]interface{}{"type": "boolean", "description": "Expose FTP default port for action=create."},
+					"snapshot":        map[string]interface{}{"type": "string", "description": "Snapshot name for snapshot_create, snapshot_restore, and snapshot_delete. Restore requires a stopped VM. For checkpoint and resume it names the memory checkpoint; omit it to auto-name (checkpoint) or pick the newest (resume)."},
+					"command":         map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}, "description": "Command and arguments for action=exec, which returns exit_code, stdout and stderr. Passed verbatim without a shell (use [\"sh\", \"-c\", \"...\"] for pipelines)."},
+					"env":             map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}, "description": "KEY=VALUE environment entries for action=exec."},
+					"workdir":         map[string]interface{}{"type": "string", "description": "Guest working directory for action=exec."},
+					"timeout_sec":     map[string]interface{}{"type": "integer", "description": "Abort action=exec after this many seconds; exit_code becomes 124 and timed_out true. For action=wait (and create/start with wait) it bounds the wait (default 300)."},
+					"count":           map[string]interface{}{"type": "integer", "description": "Number of copies for action=fork, or of VMs for action=create with a name containing {i}, which then returns per-VM results (default 1)."},
+					"parallel":        map[string]interface{}{"type": "integer", "description": "How many VMs action=create with count makes at once (default 4)."},
+					"prefix":          map[string]interface{}{"type": "string", "description": "Clone name prefix for action=fork; clones are named prefix1..prefixN (default '<name>-')."},
+					"guest_path":      map[string]interface{}{"type": "string", "description": "Guest file or directory for action=upload (destination) and action=download (source)."},
+					"host_path":       map[string]interface{}{"type": "string", "description": "Host file or directory for upload/download, which move files in and out of a running VM. Prefer it for large or recursive transfers."},
+					"wait":            map[string]interface{}{"type": "boolean", "description": "For create and start: block until the VM meets the `for` conditions and report the stages."},
+					"for":             map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}, "description": "Readiness conditions for action=wait (and create/start with wait), checked in order: ssh, cloud-init, port:N, file:/path (default [\"ssh\"])."},
+					"content_base64":  map[string]interface{}{"type": "string", "description": "Inline file content for action=upload when no host_path is given; it is written to exactly guest_path. download without host_path returns content_base64 for a single file up to 1 MiB."},
+					"mounts":          map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}, "description": "Shared host folders for action=create, as [\"/host/dir:/guest/path[:ro]\"]."},
+					"disk_size":       map[string]interface{}{"type": "string", "description": "For action=config_update: grow the root disk, e.g. \"+20G\" or \"60G\". Running VMs are resized live; the guest filesystem grows on next boot. Shrinking is rejected."},
+					"volume":          map[string]interface{}{"type": "string", "description": "Named data disk that outlives VMs, for the volume_* actions (up to 20 letters, digits, '-' or '_'). Attach and detach take the VM in name and require it stopped."},
+					"size":            map[string]interface{}{"type": "string", "description": "Volume size for action=volume_create, e.g. \"50G\"."},
+					"read_only":       map[string]interface{}{"type": "boolean", "description": "For action=volume_attach or device_add: attach read-only. Read-only volumes can be shared by several VMs."},
+					"device_type":     map[string]interface{}{"type": "string", "enum": []string{"disk", "nic", "usb-storage"}, "description": "Device type for action=device_add; running VMs get it hotplugged, stopped ones on next boot."},
+					"source":          map[string]interface{}{"type": "string", "description": "Host image file (qcow2 or raw) for action=device_add with disk or usb-storage."},
+					"device_id":       map[string]interface{}{"type": "string", "description": "Device ID for action=device_add (optional, defaults to disk0, nic0, usb0, ...) or device_remove."},
+					"since":           map[string]interface{}{"type": "string", "description": "For action=logs: only lines newer than a duration ago (\"10m\") or an RFC3339 time."},
+					"tail":            map[string]interface{}{"type": "integer", "description": "For action=logs: only the last N lines (default 200, 0 for all)."},
+					"text":            map[string]interface{}{"type": "string", "description": "Text for action=input_type (US keyboard layout, \\n presses Enter)."},
+					"keys":            map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}, "description": "Key chords for action=input_key, pressed in order, e.g. [\"ctrl+alt+t\", \"enter\"]. Names are QEMU qcodes or aliases like enter, esc, win."},
+					"x":               map[string]interface{}{"type": "integer", "description": "Display pixel column for input_click/input_move, as in the screenshot."},
+					"y":               map[string]interface{}{"type": "integer", "description": "Display pixel row for input_click/input_move."},
+					"button":          map[string]interface{}{"type": "string", "enum": []string{"left", "right", "middle"}, "description": "Mouse button for action=input_click (default left)."},
+					"mount":           map[string]interface{}{"type": "string", "description": "Shared folder spec /host/dir:/guest/path[:ro] for action=mount_add. mount_remove takes guest_path instead; both require a stopped VM and apply on next boot."},
 				},
 				"required": []string{"action"},
 			},
@@ -144,16 +191,17 @@ func ToolsCatalog() []map[string]interface{} {
 		},
 		{
 			"name":        "nido_system",
-			"description": "Access system-wide Nido operations that are not tied to one VM. Supported actions are doctor, version, update_check, update, config_get, config_set, accel_list, register, completion, build_image, and uninstall. Use read-only resources when possible.",
+			"description": "Access system-wide Nido operations that are not tied to one VM. Supported actions are doctor, version, update_check, update, config_get, config_set, accel_list, register, completion, build_image, state_migrate, and uninstall. Use read-only resources when possible.",
 			"inputSchema": map[string]interface{}{
 				"type": "object",
 				"properties": map[string]interface{}{
-					"action":         map[string]interface{}{"type": "string", "enum": []string{"doctor", "version", "update_check", "update", "config_get", "config_set", "accel_list", "register", "completion", "build_image", "uninstall"}},
+					"action":         map[string]interface{}{"type": "string", "enum": []string{"doctor", "version", "update_check", "update", "config_get", "config_set", "accel_list", "register", "completion", "build_image", "state_migrate", "uninstall"}},
 					"blueprint_name": map[string]interface{}{"type": "string", "description": "Blueprint used by action=build_image."},
 					"key":            map[string]interface{}{"type": "string", "description": "Global config key for action=config_set."},
 					"value":          map[string]interface{}{"type": "string", "description": "Global config value for action=config_set."},
 					"shell":          map[string]interface{}{"type": "string", "enum": []string{"bash", "zsh", "fish", "powershell"}, "description": "Shell for action=completion."},
 					"force":          map[string]interface{}{"type": "boolean", "description": "Required for action=uninstall."},
+					"dry_run":        map[string]interface{}{"type": "boolean", "description": "For action=state_migrate: report the upgrades without writing."},
 				},
 				"required": []string{"action"},
 			},
@@ -181,6 +229,8 @@ func ResourcesCatalog() []map[string]interface{} {
 func ResourceTemplatesCatalog() []map[string]interface{} {
 	return []map[string]interface{}{
 		{"name": "VM Detail", "uriTemplate": "nido://vm/{name}", "mimeType": "application/json", "description": "Detailed state for one VM."},
+		{"name": "VM Screen", "uriTemplate": "nido://vm/{name}/screen", "mimeType": "image/png", "description": "Current display of a running VM as a PNG image."},
+		{"name": "VM Serial Log", "uriTemplate": "nido://vm/{name}/logs", "mimeType": "application/json", "description": "Last 200 lines of the VM serial console log, with timestamps."},
 		{"name": "Image Detail", "uriTemplate": "nido://image/{tag}", "mimeType": "application/json", "description": "Detailed catalog metadata for one image tag."},
 		{"name": "Blueprint Detail", "uriTemplate": "nido://blueprint/{name}", "mimeType": "application/json", "description": "Detailed metadata for one image blueprint."},
 	}
@@ -217,11 +267,11 @@ func HelpPayload() map[string]interface{} {
 		"usage_rules": []string{
 			"Prefer resources for read-only inspection because they are cheaper and easier for agents to plan around.",
 			"Use tools only for mutations or when your MCP client cannot read resources.",
-			"Use nido_vm for VM lifecycle, inspection fallback, config changes, and port operations.",
+			"Use nido_vm for VM lifecycle, inspection fallback, config changes, port operations, disk snapshots, memory checkpoints, shared folders, and data volumes.",
 			"Use nido_template for template lifecycle.",
 			"Use nido_image for catalog and cache operations.",
 			"Use nido_blueprint for blueprint list, inspection, and image builds.",
-			"Use nido_system for system operations: doctor, version, update_check, update, config_get, config_set, accel_list, register, completion, build_image, and guarded uninstall.",
+			"Use nido_system for system operations: doctor, version, update_check, update, config_get, config_set, accel_list, register, completion, build_image, state_migrate, and guarded uninstall.",
 			"Use nido_system update, config_set, and uninstall only when the user explicitly asked for those mutations.",
 			"Every high-power tool requires an action field.",
 		},
@@ -377,6 +427,17 @@ func (s *Server) handleToolsCall(req JSONRPCRequest) {
 		return
 	}
 
+	if img, ok := payload.(screenImage); ok {
+		s.sendResponse(req.ID, map[string]interface{}{
+			"content": []map[string]interface{}{{
+				"type":     "image",
+				"mimeType": "image/png",
+				"data":     base64.StdEncoding.EncodeToString(img.PNG),
+			}},
+		})
+		return
+	}
+
 	s.sendResponse(req.ID, map[string]interface{}{
 		"content": []map[string]interface{}{{
 			"type": "text",
@@ -387,53 +448,148 @@ func (s *Server) handleToolsCall(req JSONRPCRequest) {
 
 func (s *Server) callVMTool(raw json.RawMessage) (interface{}, error) {
 	var args struct {
-		Action       string   `json:"action"`
-		Name         string   `json:"name"`
-		Template     string   `json:"template"`
-		Image        string   `json:"image"`
-		UserData     string   `json:"user_data"`
-		Gui          bool     `json:"gui"`
-		Cmdline      string   `json:"cmdline"`
-		MemoryMB     int      `json:"memory_mb"`
-		VCPUs        int      `json:"vcpus"`
-		Ports        []string `json:"ports"`
-		RawQemuArgs  []string `json:"raw_qemu_args"`
-		Accelerators []string `json:"accelerators"`
-		Mapping      string   `json:"mapping"`
-		GuestPort    int      `json:"guest_port"`
-		Protocol     string   `json:"protocol"`
-		SSHPort      *int     `json:"ssh_port"`
-		VNCPort      *int     `json:"vnc_port"`
-		SSHUser      *string  `json:"ssh_user"`
-		Web          bool     `json:"web"`
-		FTP          bool     `json:"ftp"`
+		Action       string            `json:"action"`
+		Name         string            `json:"name"`
+		Template     string            `json:"template"`
+		Image        string            `json:"image"`
+		UserData     string            `json:"user_data"`
+		Gui          bool              `json:"gui"`
+		Cmdline      string            `json:"cmdline"`
+		MemoryMB     int               `json:"memory_mb"`
+		VCPUs        int               `json:"vcpus"`
+		MaxMemoryMB  int               `json:"max_memory_mb"`
+		MaxVCPUs     int               `json:"max_vcpus"`
+		Live         bool              `json:"live"`
+		CPULimit     float64           `json:"cpu_limit"`
+		MemoryLimit  int               `json:"memory_limit_mb"`
+		IOWeight     int               `json:"io_weight"`
+		PidsLimit    int               `json:"pids_limit"`
+		Restart      string            `json:"restart_policy"`
+		TTL          string            `json:"ttl"`
+		OnExpiry     string            `json:"on_expiry"`
+		Expired      bool              `json:"expired"`
+		Labels       map[string]string `json:"labels"`
+		RemoveLabels []string          `json:"remove_labels"`
+		Selector     string            `json:"selector"`
+		File         string            `json:"file"`
+		Ports        []string          `json:"ports"`
+		RawQemuArgs  []string          `json:"raw_qemu_args"`
+		Accelerators []string          `json:"accelerators"`
+		Mapping      string            `json:"mapping"`
+		GuestPort    int               `json:"guest_port"`
+		Protocol     string            `json:"protocol"`
+		SSHPort      *int              `json:"ssh_port"`
+		VNCPort      *int              `json:"vnc_port"`
+		SSHUser      *string           `json:"ssh_user"`
+		Web          bool              `json:"web"`
+		FTP          bool              `json:"ftp"`
+		Snapshot     string            `json:"snapshot"`
+		Command      []string          `json:"command"`
+		Env          []string          `json:"env"`
+		Workdir      string            `json:"workdir"`
+		TimeoutSec   int               `json:"timeout_sec"`
+		Count        int               `json:"count"`
+		Parallel     int               `json:"parallel"`
+		Prefix       string            `json:"prefix"`
+		GuestPath    string            `json:"guest_path"`
+		HostPath     string            `json:"host_path"`
+		ContentB64   string            `json:"content_base64"`
+		Wait         bool              `json:"wait"`
+		For          []string          `json:"for"`
+		Mounts       []string          `json:"mounts"`
+		Mount        string            `json:"mount"`
+		DiskSize     string            `json:"disk_size"`
+		Volume       string            `json:"volume"`
+		Size         string            `json:"size"`
+		ReadOnly     bool              `json:"read_only"`
+		DeviceType   string            `json:"device_type"`
+		Source       string            `json:"source"`
+		DeviceID     string            `json:"device_id"`
+		Since        string            `json:"since"`
+		Text         string            `json:"text"`
+		Keys         []string          `json:"keys"`
+		X            int               `json:"x"`
+		Y            int               `json:"y"`
+		Button       string            `json:"button"`
+		Tail         *int              `json:"tail"`
 	}
 	if err := json.Unmarshal(raw, &args); err != nil {
 		return nil, err
 	}
 
+	if args.Selector != "" {
+		switch args.Action {
+		case "list":
+		case "start", "stop", "delete", "prune":
+			if args.Name != "" {
+				return nil, fmt.Errorf("give either a VM name or a selector, not both")
+			}
+			if args.Wait {
+				return nil, fmt.Errorf("wait takes a single VM name, not a selector")
+			}
+			return s.bulkVMAction(args.Action, args.Selector, provider.VMOptions{Gui: args.Gui, Cmdline: args.Cmdline})
+		default:
+			return nil, fmt.Errorf("action=%s does not take a selector", args.Action)
+		}
+	}
+
 	switch args.Action {
 	case "list":
+		var sel provider.Selector
+		if args.Selector != "" {
+			var err error
+			if sel, err = provider.ParseSelector(args.Selector); err != nil {
+				return nil, err
+			}
+		}
 		vms, err := s.Provider.List()
 		if err != nil {
 			return nil, err
 		}
-		return map[string]interface{}{"action": "list", "vms": vms}, nil
+		return map[string]interface{}{"action": "list", "vms": provider.FilterVMs(vms, sel)}, nil
 	case "info":
 		info, err := s.Provider.Info(args.Name)
 		if err != nil {
 			return nil, err
 		}
-		return map[string]interface{}{"action": "info", "vm": info}, nil
+		return map[string]interface{}{"action": "info", "vm": info, "guest": s.guestInfo(info)}, nil
 	case "create":
 		opts := provider.VMOptions{
 			Gui:          args.Gui,
 			Cmdline:      args.Cmdline,
 			MemoryMB:     args.MemoryMB,
 			VCPUs:        args.VCPUs,
+			MaxMemoryMB:  args.MaxMemoryMB,
+			MaxVCPUs:     args.MaxVCPUs,
 			RawQemuArgs:  args.RawQemuArgs,
 			Accelerators: args.Accelerators,
 		}
+		if err := provider.ValidateRestartPolicy(args.Restart); err != nil {
+			return nil, err
+		}
+		opts.RestartPolicy = args.Restart
+		if err := provider.ValidateOnExpiry(args.OnExpiry); err != nil {
+			return nil, err
+		}
+		opts.OnExpiry = args.OnExpiry
+		opts.Labels = args.Labels
+		if args.TTL != "" {
+			ttl, err := provider.ParseTTL(args.TTL)
+			if err != nil {
+				return nil, err
+			}
+			opts.TTL = ttl
+		}
+		if limits := (provider.ResourceLimits{CPUs: args.CPULimit, MemoryMaxMB: args.MemoryLimit, IOWeight: args.IOWeight, PidsMax: args.PidsLimit}); !limits.IsZero() {
+			opts.Limits = &limits
+		}
+		for _, spec := range args.Mounts {
+			m, err := provider.ParseMount(spec)
+			if err != nil {
+				return nil, err
+			}
+			opts.Mounts = append(opts.Mounts, m)
+		}
 		for _, ps := range args.Ports {
 			pf, err := parsePortString(ps)
 			if err != nil {
@@ -480,15 +636,148 @@ func (s *Server) callVMTool(raw json.RawMessage) (interface{}, error) {
 		} else if args.Template != "" {
 			opts.DiskPath = args.Template
 		}
+		if args.Count > 1 {
+			names, err := provider.ExpandSpawnNames(args.Name, args.Count)
+			if err != nil {
+				return nil, err
+			}
+			parallel := args.Parallel
+			if parallel == 0 {
+				parallel = 4
+			}
+			var wait *provider.WaitOptions
+			if args.Wait {
+				wait = &provider.WaitOptions{For: args.For, Timeout: time.Duration(args.TimeoutSec) * time.Second}
+			}
+			results, err := s.Provider.SpawnBatch(names, opts, parallel, wait)
+			if err != nil {
+				return nil, err
+			}
+			failed := 0
+			for _, r := range results {
+				if r.Error != "" {
+					failed++
+				}
+			}
+			return map[string]interface{}{"action": "create", "source": source, "parallel": parallel, "results": results, "failed": failed}, nil
+		}
 		if err := s.Provider.Spawn(args.Name, opts); err != nil {
 			return nil, err
 		}
-		return map[string]interface{}{"action": "create", "name": args.Name, "source": source, "status": "created"}, nil
+		out := map[string]interface{}{"action": "create", "name": args.Name, "source": source, "status": "created"}
+		if args.Wait {
+			res, err := s.Provider.Wait(args.Name, provider.WaitOptions{For: args.For, Timeout: time.Duration(args.TimeoutSec) * time.Second})
+			if err != nil {
+				return nil, fmt.Errorf("VM created but not ready: %w", err)
+			}
+			out["wait"] = res
+		}
+		return out, nil
 	case "start":
 		if err := s.Provider.Start(args.Name, provider.VMOptions{Gui: args.Gui, Cmdline: args.Cmdline}); err != nil {
 			return nil, err
 		}
-		return map[string]interface{}{"action": "start", "name": args.Name, "status": "started"}, nil
+		out := map[string]interface{}{"action": "start", "name": args.Name, "status": "started"}
+		if args.Wait {
+			res, err := s.Provider.Wait(args.Name, provider.WaitOptions{For: args.For, Timeout: time.Duration(args.TimeoutSec) * time.Second})
+			if err != nil {
+				return nil, fmt.Errorf("VM started but not ready: %w", err)
+			}
+			out["wait"] = res
+		}
+		return out, nil
+	case "wait":
+		res, err := s.Provider.Wait(args.Name, provider.WaitOptions{For: args.For, Timeout: time.Duration(args.TimeoutSec) * time.Second})
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"action": "wait", "name": args.Name, "result": res}, nil
+	case "mount_add":
+		m, err := provider.ParseMount(args.Mount)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.Provider.MountAdd(args.Name, m); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"action": "mount_add", "name": args.Name, "mount": m, "status": "added"}, nil
+	case "mount_remove":
+		if err := s.Provider.MountRemove(args.Name, args.GuestPath); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"action": "mount_remove", "name": args.Name, "guest_path": args.GuestPath, "status": "removed"}, nil
+	case "volume_create":
+		vol, err := s.Provider.VolumeCreate(args.Volume, args.Size)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"action": "volume_create", "volume": vol, "status": "created"}, nil
+	case "volume_list":
+		volumes, err := s.Provider.VolumeList()
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"action": "volume_list", "volumes": volumes}, nil
+	case "volume_delete":
+		if err := s.Provider.VolumeDelete(args.Volume); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"action": "volume_delete", "volume": args.Volume, "status": "deleted"}, nil
+	case "volume_attach":
+		if err := s.Provider.VolumeAttach(args.Name, args.Volume, args.ReadOnly); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"action": "volume_attach", "name": args.Name, "volume": args.Volume, "read_only": args.ReadOnly, "status": "attached"}, nil
+	case "device_add":
+		dev, applied, err := s.Provider.DeviceAdd(args.Name, provider.Device{ID: args.DeviceID, Type: args.DeviceType, Source: args.Source, ReadOnly: args.ReadOnly})
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"action": "device_add", "name": args.Name, "device": dev, "applied": applied, "status": "added"}, nil
+	case "device_remove":
+		applied, err := s.Provider.DeviceRemove(args.Name, args.DeviceID)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"action": "device_remove", "name": args.Name, "device_id": args.DeviceID, "applied": applied, "status": "removed"}, nil
+	case "screenshot":
+		data, err := s.Provider.Screenshot(args.Name)
+		if err != nil {
+			return nil, err
+		}
+		return screenImage{PNG: data}, nil
+	case "input_type", "input_key", "input_click", "input_move":
+		in := provider.InputAction{
+			Action: strings.TrimPrefix(args.Action, "input_"),
+			Text:   args.Text,
+			Keys:   args.Keys,
+			X:      args.X,
+			Y:      args.Y,
+			Button: args.Button,
+		}
+		if err := s.Provider.SendInput(args.Name, in); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"action": args.Action, "name": args.Name, "input": in, "status": "sent"}, nil
+	case "logs":
+		since, err := provider.ParseSince(args.Since, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		tail := defaultLogTail
+		if args.Tail != nil {
+			tail = *args.Tail
+		}
+		lines, err := s.vmLogs(args.Name, provider.LogOptions{Since: since, Tail: tail})
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"action": "logs", "name": args.Name, "lines": lines}, nil
+	case "volume_detach":
+		if err := s.Provider.VolumeDetach(args.Name, args.Volume); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"action": "volume_detach", "name": args.Name, "volume": args.Volume, "status": "detached"}, nil
 	case "stop":
 		if err := s.Provider.Stop(args.Name, true); err != nil {
 			return nil, err
@@ -505,23 +794,98 @@ func (s *Server) callVMTool(raw json.RawMessage) (interface{}, error) {
 			return nil, err
 		}
 		return map[string]interface{}{"action": "ssh", "name": args.Name, "command": cmd}, nil
+	case "exec":
+		res, err := s.Provider.Exec(args.Name, args.Command, provider.ExecOptions{
+			Env:     args.Env,
+			Workdir: args.Workdir,
+			Timeout: time.Duration(args.TimeoutSec) * time.Second,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"action": "exec", "name": args.Name, "result": res}, nil
 	case "prune":
+		if args.Expired {
+			reaped, err := s.Provider.ReapExpired()
+			if err != nil {
+				return nil, err
+			}
+			return map[string]interface{}{"action": "prune", "expired": reaped}, nil
+		}
 		count, err := s.Provider.Prune()
 		if err != nil {
 			return nil, err
 		}
 		return map[string]interface{}{"action": "prune", "removed_count": count}, nil
+	case "label":
+		labels, err := s.Provider.SetLabels(args.Name, args.Labels, args.RemoveLabels)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"action": "label", "name": args.Name, "labels": labels}, nil
+	case "nest_plan", "nest_up", "nest_down":
+		file := args.File
+		if file == "" {
+			file = nest.DefaultFile
+		}
+		f, err := nest.Load(file)
+		if err != nil {
+			return nil, err
+		}
+		if args.Action == "nest_down" {
+			results, err := nest.Down(f, s.Provider)
+			if err != nil {
+				return nil, err
+			}
+			return nestResults(args.Action, f, results), nil
+		}
+		changes, err := nest.Plan(f, s.Provider)
+		if err != nil {
+			return nil, err
+		}
+		if args.Action == "nest_plan" {
+			return map[string]interface{}{"action": args.Action, "file": f.Path, "changes": changes}, nil
+		}
+		results := nest.Up(f, s.Provider, changes, func(tag string) (provider.VMOptions, error) {
+			res, err := s.resolveCreateImage(tag)
+			return provider.VMOptions{DiskPath: res.DiskPath, SSHUser: res.SSHUser, SSHPassword: res.SSHPassword, SeedFiles: res.SeedFiles, Cmdline: res.Cmdline}, err
+		})
+		return nestResults(args.Action, f, results), nil
+	case "ttl_set", "ttl_extend", "ttl_clear":
+		action := strings.TrimPrefix(args.Action, "ttl_")
+		var ttl time.Duration
+		if action != provider.TTLClear {
+			var err error
+			if ttl, err = provider.ParseTTL(args.TTL); err != nil {
+				return nil, err
+			}
+		}
+		expiresAt, err := s.Provider.SetTTL(args.Name, action, ttl)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"action": args.Action, "name": args.Name, "expires_at": expiresAt}, nil
 	case "config_update":
 		updates := provider.VMConfigUpdates{
-			MemoryMB:     intPtrIfPresent(args.MemoryMB, raw, "memory_mb"),
-			VCPUs:        intPtrIfPresent(args.VCPUs, raw, "vcpus"),
-			SSHPort:      args.SSHPort,
-			VNCPort:      args.VNCPort,
-			Gui:          boolPtr(args.Gui, raw, "gui"),
-			SSHUser:      args.SSHUser,
-			Cmdline:      stringPtrIfPresent(args.Cmdline, raw, "cmdline"),
-			RawQemuArgs:  slicePtrIfPresent(args.RawQemuArgs, raw, "raw_qemu_args"),
-			Accelerators: slicePtrIfPresent(args.Accelerators, raw, "accelerators"),
+			MemoryMB:      intPtrIfPresent(args.MemoryMB, raw, "memory_mb"),
+			VCPUs:         intPtrIfPresent(args.VCPUs, raw, "vcpus"),
+			SSHPort:       args.SSHPort,
+			VNCPort:       args.VNCPort,
+			Gui:           boolPtr(args.Gui, raw, "gui"),
+			SSHUser:       args.SSHUser,
+			Cmdline:       stringPtrIfPresent(args.Cmdline, raw, "cmdline"),
+			RawQemuArgs:   slicePtrIfPresent(args.RawQemuArgs, raw, "raw_qemu_args"),
+			Accelerators:  slicePtrIfPresent(args.Accelerators, raw, "accelerators"),
+			DiskSize:      stringPtrIfPresent(args.DiskSize, raw, "disk_size"),
+			MaxMemoryMB:   intPtrIfPresent(args.MaxMemoryMB, raw, "max_memory_mb"),
+			MaxVCPUs:      intPtrIfPresent(args.MaxVCPUs, raw, "max_vcpus"),
+			CPULimit:      floatPtrIfPresent(args.CPULimit, raw, "cpu_limit"),
+			MemoryLimitMB: intPtrIfPresent(args.MemoryLimit, raw, "memory_limit_mb"),
+			IOWeight:      intPtrIfPresent(args.IOWeight, raw, "io_weight"),
+			PidsLimit:     intPtrIfPresent(args.PidsLimit, raw, "pids_limit"),
+			RestartPolicy: stringPtrIfPresent(args.Restart, raw, "restart_policy"),
+			OnExpiry:      stringPtrIfPresent(args.OnExpiry, raw, "on_expiry"),
+			Live:          args.Live,
 		}
 		if fieldPresent(raw, "ports") {
 			var fwd []provider.PortForward
@@ -534,36 +898,242 @@ func (s *Server) callVMTool(raw json.RawMessage) (interface{}, error) {
 			}
 			updates.Forwarding = &fwd
 		}
-		if err := s.Provider.UpdateConfig(args.Name, updates); err != nil {
+		applied, err := s.Provider.UpdateConfig(args.Name, updates)
+		if err != nil {
 			return nil, err
 		}
-		return map[string]interface{}{"action": "config_update", "name": args.Name, "status": "updated"}, nil
+		return map[string]interface{}{"action": "config_update", "name": args.Name, "status": "updated", "applied": applied}, nil
 	case "port_forward":
 		pf, err := parsePortString(args.Mapping)
 		if err != nil {
 			return nil, err
 		}
-		res, err := s.Provider.PortForward(args.Name, pf)
+		res, applied, err := s.Provider.PortForward(args.Name, pf)
 		if err != nil {
 			return nil, err
 		}
-		return map[string]interface{}{"action": "port_forward", "name": args.Name, "forward": res}, nil
+		return map[string]interface{}{"action": "port_forward", "name": args.Name, "forward": res, "applied": applied}, nil
 	case "port_unforward":
-		if err := s.Provider.PortUnforward(args.Name, args.GuestPort, args.Protocol); err != nil {
+		applied, err := s.Provider.PortUnforward(args.Name, args.GuestPort, args.Protocol)
+		if err != nil {
 			return nil, err
 		}
-		return map[string]interface{}{"action": "port_unforward", "name": args.Name, "guest_port": args.GuestPort, "protocol": args.Protocol}, nil
+		return map[string]interface{}{"action": "port_unforward", "name": args.Name, "guest_port": args.GuestPort, "protocol": args.Protocol, "applied": applied}, nil
 	case "port_list":
 		list, err := s.Provider.PortList(args.Name)
 		if err != nil {
 			return nil, err
 		}
 		return map[string]interface{}{"action": "port_list", "name": args.Name, "forwarding": list}, nil
+	case "snapshot_create":
+		if err := s.Provider.SnapshotCreate(args.Name, args.Snapshot); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"action": "snapshot_create", "name": args.Name, "snapshot": args.Snapshot, "status": "created"}, nil
+	case "snapshot_list":
+		snapshots, err := s.Provider.SnapshotList(args.Name)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"action": "snapshot_list", "name": args.Name, "snapshots": snapshots}, nil
+	case "snapshot_restore":
+		if err := s.Provider.SnapshotRestore(args.Name, args.Snapshot); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"action": "snapshot_restore", "name": args.Name, "snapshot": args.Snapshot, "status": "restored"}, nil
+	case "snapshot_delete":
+		if err := s.Provider.SnapshotDelete(args.Name, args.Snapshot); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"action": "snapshot_delete", "name": args.Name, "snapshot": args.Snapshot, "status": "deleted"}, nil
+	case "checkpoint":
+		snap, err := s.Provider.Checkpoint(args.Name, args.Snapshot)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"action": "checkpoint", "name": args.Name, "snapshot": snap, "status": "checkpointed"}, nil
+	case "resume":
+		snap, err := s.Provider.Resume(args.Name, args.Snapshot)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"action": "resume", "name": args.Name, "snapshot": snap, "status": "resumed"}, nil
+	case "fork":
+		count := args.Count
+		if count == 0 {
+			count = 1
+		}
+		created, err := s.Provider.Fork(args.Name, count, args.Prefix)
+		if err != nil {
+			return nil, fmt.Errorf("%w (forks created: %v)", err, created)
+		}
+		return map[string]interface{}{"action": "fork", "name": args.Name, "forks": created, "status": "forked"}, nil
+	case "upload":
+		return s.uploadToVM(args.Name, args.GuestPath, args.HostPath, args.ContentB64)
+	case "download":
+		return s.downloadFromVM(args.Name, args.GuestPath, args.HostPath)
 	default:
 		return nil, fmt.Errorf("unsupported nido_vm action %q", args.Action)
 	}
 }
 
+// bulkVMAction applies start, stop, delete or prune to every VM matching
+// selector. Start only touches stopped VMs, stop running ones and prune
+// deletes stopped ones. Failures are reported per VM, not as a tool error.
+func (s *Server) bulkVMAction(action, selector string, opts provider.VMOptions) (interface{}, error) {
+	sel, err := provider.ParseSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+	vms, err := s.Provider.List()
+	if err != nil {
+		return nil, err
+	}
+	type vmResult struct {
+		Name   string `json:"name"`
+		Status string `json:"status"`
+		Error  string `json:"error,omitempty"`
+	}
+	results := []vmResult{}
+	failed := 0
+	for _, vm := range provider.FilterVMs(vms, sel) {
+		var opErr error
+		status := ""
+		switch {
+		case action == "start" && vm.State == "stopped":
+			status, opErr = "started", s.Provider.Start(vm.Name, opts)
+		case action == "stop" && vm.State != "stopped":
+			status, opErr = "stopped", s.Provider.Stop(vm.Name, true)
+		case action == "delete", action == "prune" && vm.State == "stopped":
+			status, opErr = "deleted", s.Provider.Delete(vm.Name)
+		default:
+			continue
+		}
+		r := vmResult{Name: vm.Name, Status: status}
+		if opErr != nil {
+			r.Status, r.Error = "failed", opErr.Error()
+			failed++
+		}
+		results = append(results, r)
+	}
+	return map[string]interface{}{"action": action, "selector": selector, "results": results, "failed": failed}, nil
+}
+
+// guestInfo returns guest agent details for a running VM, or nil when the
+// VM is down or has no responsive agent.
+func (s *Server) guestInfo(vm provider.VMDetail) *provider.GuestInfo {
+	if vm.State != "running" {
+		return nil
+	}
+	guest, err := s.Provider.GuestInfo(vm.Name)
+	if err != nil {
+		return nil
+	}
+	return &guest
+}
+
+// screenImage is a PNG screenshot. Tool calls and resource reads send it as
+// image content instead of JSON text so multimodal clients can view it.
+type screenImage struct {
+	PNG []byte
+}
+
+// defaultLogTail bounds serial log replies so a chatty guest cannot flood
+// the context.
+const defaultLogTail = 200
+
+// vmLogs collects the selected serial log lines of a VM.
+func (s *Server) vmLogs(name string, opts provider.LogOptions) ([]provider.LogLine, error) {
+	lines := []provider.LogLine{}
+	err := s.Provider.Logs(name, opts, func(l provider.LogLine) {
+		lines = append(lines, l)
+	})
+	return lines, err
+}
+
+// inlineTransferLimit caps base64 payloads so large files go through host paths.
+const inlineTransferLimit = 1 << 20
+
+// uploadToVM copies host_path, or inline base64 content staged in a temp
+// file, to guest_path. Inline content lands at exactly guest_path.
+func (s *Server) uploadToVM(name, guestPath, hostPath, content string) (interface{}, error) {
+	if guestPath == "" {
+		return nil, fmt.Errorf("guest_path is required for action=upload")
+	}
+	opts := provider.CopyOptions{}
+	if hostPath == "" {
+		if content == "" {
+			return nil, fmt.Errorf("action=upload needs host_path or content_base64")
+		}
+		if strings.HasSuffix(guestPath, "/") {
+			return nil, fmt.Errorf("guest_path must name a file for content_base64, not a directory")
+		}
+		data, err := base64.StdEncoding.DecodeString(content)
+		if err != nil {
+			return nil, fmt.Errorf("invalid content_base64: %w", err)
+		}
+		if len(data) > inlineTransferLimit {
+			return nil, fmt.Errorf("content_base64 exceeds %d bytes; pass host_path instead", inlineTransferLimit)
+		}
+		dir, err := os.MkdirTemp("", "nido-upload-")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(dir)
+		hostPath = filepath.Join(dir, "content")
+		if err := os.WriteFile(hostPath, data, 0644); err != nil {
+			return nil, err
+		}
+		opts.NoTargetDirectory = true
+	}
+	res, err := s.Provider.Upload(name, hostPath, guestPath, opts)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"action": "upload", "name": name, "result": res}, nil
+}
+
+// downloadFromVM copies guest_path to host_path, or returns a single small
+// file inline as base64 when no host_path is given.
+func (s *Server) downloadFromVM(name, guestPath, hostPath string) (interface{}, error) {
+	if guestPath == "" {
+		return nil, fmt.Errorf("guest_path is required for action=download")
+	}
+	if hostPath != "" {
+		res, err := s.Provider.Download(name, guestPath, hostPath, provider.CopyOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"action": "download", "name": name, "result": res}, nil
+	}
+
+	dir, err := os.MkdirTemp("", "nido-download-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	res, err := s.Provider.Download(name, guestPath, dir, provider.CopyOptions{MaxBytes: inlineTransferLimit})
+	if errors.Is(err, provider.ErrCopyTooLarge) {
+		return nil, fmt.Errorf("%s is over the %d byte inline limit; pass host_path instead", guestPath, inlineTransferLimit)
+	}
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Lstat(res.Target)
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("%s is not a regular file; pass host_path to download directories", guestPath)
+	}
+	data, err := os.ReadFile(res.Target)
+	if err != nil {
+		return nil, err
+	}
+	res.Target = ""
+	return map[string]interface{}{"action": "download", "name": name, "result": res, "content_base64": base64.StdEncoding.EncodeToString(data)}, nil
+}
+
 func (s *Server) callTemplateTool(raw json.RawMessage) (interface{}, error) {
 	var args struct {
 		Action       string `json:"action"`
@@ -736,6 +1306,7 @@ func (s *Server) callSystemTool(raw json.RawMessage) (interface{}, error) {
 		Value         string `json:"value"`
 		Shell         string `json:"shell"`
 		Force         bool   `json:"force"`
+		DryRun        bool   `json:"dry_run"`
 	}
 	if err := json.Unmarshal(raw, &args); err != nil {
 		return nil, err
@@ -796,6 +1367,18 @@ func (s *Server) callSystemTool(raw json.RawMessage) (interface{}, error) {
 			return nil, err
 		}
 		return map[string]interface{}{"action": "build_image", "blueprint_name": info.Name, "output_image": info.OutputImage, "output_tag": info.OutputTag, "status": status}, nil
+	case "state_migrate":
+		migrations, err := s.Provider.MigrateStates(args.DryRun)
+		if err != nil {
+			return nil, err
+		}
+		failed := 0
+		for _, m := range migrations {
+			if m.Error != "" {
+				failed++
+			}
+		}
+		return map[string]interface{}{"action": "state_migrate", "dry_run": args.DryRun, "schema_version": provider.StateSchemaVersion, "migrations": migrations, "failed": failed}, nil
 	case "uninstall":
 		if !args.Force {
 			return nil, fmt.Errorf("uninstall requires force=true")
@@ -826,6 +1409,17 @@ func (s *Server) handleResourceRead(req JSONRPCRequest) {
 		return
 	}
 
+	if img, ok := payload.(screenImage); ok {
+		s.sendResponse(req.ID, map[string]interface{}{
+			"contents": []map[string]interface{}{{
+				"uri":      params.URI,
+				"mimeType": "image/png",
+				"blob":     base64.StdEncoding.EncodeToString(img.PNG),
+			}},
+		})
+		return
+	}
+
 	s.sendResponse(req.ID, map[string]interface{}{
 		"contents": []map[string]interface{}{{
 			"uri":      params.URI,
@@ -890,6 +1484,28 @@ func (s *Server) readResource(uri string) (interface{}, error) {
 	case "nido://system/mcp-registration":
 		return s.registrationPayload(), nil
 	default:
+		if strings.HasPrefix(uri, "nido://vm/") && strings.HasSuffix(uri, "/screen") {
+			name, err := url.PathUnescape(strings.TrimSuffix(strings.TrimPrefix(uri, "nido://vm/"), "/screen"))
+			if err != nil {
+				return nil, err
+			}
+			data, err := s.Provider.Screenshot(name)
+			if err != nil {
+				return nil, err
+			}
+			return screenImage{PNG: data}, nil
+		}
+		if strings.HasPrefix(uri, "nido://vm/") && strings.HasSuffix(uri, "/logs") {
+			name, err := url.PathUnescape(strings.TrimSuffix(strings.TrimPrefix(uri, "nido://vm/"), "/logs"))
+			if err != nil {
+				return nil, err
+			}
+			lines, err := s.vmLogs(name, provider.LogOptions{Tail: defaultLogTail})
+			if err != nil {
+				return nil, err
+			}
+			return map[string]interface{}{"name": name, "lines": lines}, nil
+		}
 		if strings.HasPrefix(uri, "nido://vm/") {
 			name, err := url.PathUnescape(strings.TrimPrefix(uri, "nido://vm/"))
 			if err != nil {
@@ -899,7 +1515,7 @@ func (s *Server) readResource(uri string) (interface{}, error) {
 			if err != nil {
 				return nil, err
 			}
-			return map[string]interface{}{"vm": vm}, nil
+			return map[string]interface{}{"vm": vm, "guest": s.guestInfo(vm)}, nil
 		}
 		if strings.HasPrefix(uri, "nido://image/") {
 			tag, err := url.PathUnescape(strings.TrimPrefix(uri, "nido://image/"))
@@ -945,7 +1561,7 @@ func (s *Server) handlePromptGet(req JSONRPCRequest) {
 				"role": "user",
 				"content": map[string]interface{}{
 					"type": "text",
-					"text": "Use resources first for inspection: nido://fleet/vms, nido://vm/{name}, nido://catalog/images, nido://image/{tag}, nido://catalog/blueprints, nido://blueprint/{name}, nido://storage/cache, nido://system/config, nido://system/doctor, nido://system/version, nido://system/accelerators, and nido://system/mcp-registration. Use tools only when you need to mutate state or when your client cannot read resources. Prefer the compact actions on nido_vm, nido_template, nido_image, nido_blueprint, and nido_system instead of planning around many micro-tools.",
+					"text": "Use resources first for inspection: nido://fleet/vms, nido://vm/{name}, nido://vm/{name}/logs, nido://vm/{name}/screen, nido://catalog/images, nido://image/{tag}, nido://catalog/blueprints, nido://blueprint/{name}, nido://storage/cache, nido://system/config, nido://system/doctor, nido://system/version, nido://system/accelerators, and nido://system/mcp-registration. Use tools only when you need to mutate state or when your client cannot read resources. Prefer the compact actions on nido_vm, nido_template, nido_image, nido_blueprint, and nido_system instead of planning around many micro-tools.",
 				},
 			},
 		},
@@ -1119,6 +1735,18 @@ func (s *Server) resolveCreateImage(tag string) (createImageResolution, error) {
 	return res, nil
 }
 
+// nestResults reports nest_up or nest_down per VM, with a failed count; a
+// failing VM does not fail the call.
+func nestResults(action string, f *nest.File, results []nest.Result) map[string]interface{} {
+	failed := 0
+	for _, r := range results {
+		if r.Error != "" {
+			failed++
+		}
+	}
+	return map[string]interface{}{"action": action, "file": f.Path, "results": results, "failed": failed}
+}
+
 func (s *Server) applyBlueprintMetadata(imageTag string, res *createImageResolution) {
 	cwd, _ := os.Getwd()
 	metadata, ok, err := builder.ResolveBlueprintImageMetadata(cwd, s.nidoDir(), s.imageDir(), imageTag)
@@ -1247,6 +1875,13 @@ func intPtrIfPresent(v int, raw json.RawMessage, field string) *int {
 	return &v
 }
 
+func floatPtrIfPresent(v float64, raw json.RawMessage, field string) *float64 {
+	if !fieldPresent(raw, field) {
+		return nil
+	}
+	return &v
+}
+
 func boolPtr(v bool, raw json.RawMessage, field string) *bool {
 	if !fieldPresent(raw, field) {
 		return nil
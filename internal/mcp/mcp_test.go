@@ -4,9 +4,11 @@ import (
 	"encoding/json"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	climeta "github.com/Josepavese/nido/internal/cli"
 	"github.com/Josepavese/nido/internal/config"
@@ -19,6 +21,17 @@ type mockProvider struct {
 	cachePruneCalls      int
 	spawnName            string
 	spawnOpts            provider.VMOptions
+	spawnNames           []string
+	spawnParallel        int
+	updates              provider.VMConfigUpdates
+	ttlAction            string
+	labelSet             map[string]string
+	labelRemove          []string
+	vms                  []provider.VMStatus
+	stopped              []string
+	ttl                  time.Duration
+	migrateDryRun        bool
+	copyOpts             provider.CopyOptions
 }
 
 func (m *mockProvider) Spawn(name string, opts provider.VMOptions) error {
@@ -26,10 +39,21 @@ func (m *mockProvider) Spawn(name string, opts provider.VMOptions) error {
 	m.spawnOpts = opts
 	return nil
 }
-func (m *mockProvider) Start(name string, opts provider.VMOptions) error               { return nil }
-func (m *mockProvider) Stop(name string, graceful bool) error                          { return nil }
+func (m *mockProvider) SpawnBatch(names []string, opts provider.VMOptions, parallel int, wait *provider.WaitOptions) ([]provider.SpawnResult, error) {
+	m.spawnNames, m.spawnOpts, m.spawnParallel = names, opts, parallel
+	results := make([]provider.SpawnResult, len(names))
+	for i, n := range names {
+		results[i] = provider.SpawnResult{Name: n, Result: "spawned"}
+	}
+	return results, nil
+}
+func (m *mockProvider) Start(name string, opts provider.VMOptions) error { return nil }
+func (m *mockProvider) Stop(name string, graceful bool) error {
+	m.stopped = append(m.stopped, name)
+	return nil
+}
 func (m *mockProvider) Delete(name string) error                                       { return nil }
-func (m *mockProvider) List() ([]provider.VMStatus, error)                             { return nil, nil }
+func (m *mockProvider) List() ([]provider.VMStatus, error)                             { return m.vms, nil }
 func (m *mockProvider) Info(name string) (provider.VMDetail, error)                    { return provider.VMDetail{}, nil }
 func (m *mockProvider) GetConfig() config.Config                                       { return m.cfg }
 func (m *mockProvider) CreateDisk(name string, size string, templatePath string) error { return nil }
@@ -42,19 +66,116 @@ func (m *mockProvider) ListAccelerators() ([]provider.Accelerator, error) { retu
 func (m *mockProvider) GetUsedBackingFiles() ([]string, error)            { return nil, nil }
 func (m *mockProvider) DeleteTemplate(name string, force bool) error      { return nil }
 func (m *mockProvider) Prune() (int, error)                               { return 0, nil }
+func (m *mockProvider) SetTTL(name, action string, d time.Duration) (*time.Time, error) {
+	m.ttlAction, m.ttl = action, d
+	at := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	return &at, nil
+}
+func (m *mockProvider) SetLabels(name string, set map[string]string, remove []string) (map[string]string, error) {
+	m.labelSet, m.labelRemove = set, remove
+	return set, nil
+}
+func (m *mockProvider) ReapExpired() ([]provider.ExpiredVM, error) {
+	return []provider.ExpiredVM{}, nil
+}
+func (m *mockProvider) MigrateStates(dryRun bool) ([]provider.StateMigration, error) {
+	m.migrateDryRun = dryRun
+	return []provider.StateMigration{{Name: "vm-old", From: 0, To: provider.StateSchemaVersion, Error: "disk full"}}, nil
+}
 func (m *mockProvider) ListCachedImages() ([]provider.CachedImage, error) { return nil, nil }
 func (m *mockProvider) CacheInfo() (provider.CacheInfoResult, error) {
 	return provider.CacheInfoResult{}, nil
 }
 func (m *mockProvider) CacheRemove(name, version string) error { return nil }
 func (m *mockProvider) SSHCommand(name string) (string, error) { return "", nil }
-func (m *mockProvider) PortForward(name string, pf provider.PortForward) (provider.PortForward, error) {
-	return pf, nil
+func (m *mockProvider) PortForward(name string, pf provider.PortForward) (provider.PortForward, provider.ApplyMode, error) {
+	return pf, provider.AppliedNextBoot, nil
+}
+func (m *mockProvider) PortUnforward(name string, guestPort int, protocol string) (provider.ApplyMode, error) {
+	return provider.AppliedNextBoot, nil
 }
-func (m *mockProvider) PortUnforward(name string, guestPort int, protocol string) error  { return nil }
-func (m *mockProvider) PortList(name string) ([]provider.PortForward, error)             { return nil, nil }
-func (m *mockProvider) UpdateConfig(name string, updates provider.VMConfigUpdates) error { return nil }
-func (m *mockProvider) Doctor() []string                                                 { return []string{"ok"} }
+func (m *mockProvider) PortList(name string) ([]provider.PortForward, error) { return nil, nil }
+func (m *mockProvider) UpdateConfig(name string, updates provider.VMConfigUpdates) (provider.ApplyMode, error) {
+	m.updates = updates
+	return provider.AppliedNextBoot, nil
+}
+func (m *mockProvider) SnapshotCreate(vmName, name string) error { return nil }
+func (m *mockProvider) SnapshotList(vmName string) ([]provider.Snapshot, error) {
+	return nil, nil
+}
+func (m *mockProvider) SnapshotRestore(vmName, name string) error { return nil }
+func (m *mockProvider) SnapshotDelete(vmName, name string) error  { return nil }
+func (m *mockProvider) Checkpoint(vmName, name string) (provider.Snapshot, error) {
+	return provider.Snapshot{Name: name, VMStateSize: 1 << 20}, nil
+}
+func (m *mockProvider) Exec(name string, command []string, opts provider.ExecOptions) (provider.ExecResult, error) {
+	return provider.ExecResult{Stdout: strings.Join(command, " ") + "\n"}, nil
+}
+func (m *mockProvider) Upload(name, hostPath, guestPath string, opts provider.CopyOptions) (provider.CopyResult, error) {
+	m.copyOpts = opts
+	data, err := os.ReadFile(hostPath)
+	if err != nil {
+		return provider.CopyResult{}, err
+	}
+	return provider.CopyResult{Target: guestPath, Files: 1, Bytes: int64(len(data))}, nil
+}
+func (m *mockProvider) Download(name, guestPath, hostPath string, opts provider.CopyOptions) (provider.CopyResult, error) {
+	m.copyOpts = opts
+	if opts.MaxBytes > 0 && opts.MaxBytes < int64(len("guest data")) {
+		return provider.CopyResult{}, provider.ErrCopyTooLarge
+	}
+	target := filepath.Join(hostPath, path.Base(guestPath))
+	if err := os.WriteFile(target, []byte("guest data"), 0644); err != nil {
+		return provider.CopyResult{}, err
+	}
+	return provider.CopyResult{Target: target, Files: 1, Bytes: 10}, nil
+}
+func (m *mockProvider) Wait(name string, opts provider.WaitOptions) (provider.WaitResult, error) {
+	return provider.WaitResult{Ready: true, Stages: []provider.WaitStage{{Stage: "running", Reached: true}, {Stage: "ssh", Reached: true}}}, nil
+}
+func (m *mockProvider) GuestInfo(name string) (provider.GuestInfo, error) {
+	return provider.GuestInfo{Hostname: name, IPs: []string{"10.0.2.15/24"}}, nil
+}
+func (m *mockProvider) MountAdd(name string, mount provider.Mount) error { return nil }
+func (m *mockProvider) MountRemove(name, guestPath string) error         { return nil }
+func (m *mockProvider) VolumeCreate(name, size string) (provider.Volume, error) {
+	return provider.Volume{Name: name, SizeBytes: 50 << 30, Attachments: []provider.VolumeAttachment{}}, nil
+}
+func (m *mockProvider) VolumeList() ([]provider.Volume, error) {
+	return []provider.Volume{{Name: "data", SizeBytes: 50 << 30, Attachments: []provider.VolumeAttachment{{VM: "vm-a"}}}}, nil
+}
+func (m *mockProvider) VolumeDelete(name string) error                          { return nil }
+func (m *mockProvider) VolumeAttach(vmName, volume string, readOnly bool) error { return nil }
+func (m *mockProvider) VolumeDetach(vmName, volume string) error                { return nil }
+func (m *mockProvider) DeviceAdd(name string, dev provider.Device) (provider.Device, provider.ApplyMode, error) {
+	if dev.ID == "" {
+		dev.ID = "disk0"
+	}
+	return dev, provider.AppliedLive, nil
+}
+func (m *mockProvider) DeviceRemove(name, id string) (provider.ApplyMode, error) {
+	return provider.AppliedLive, nil
+}
+func (m *mockProvider) ConsoleSocket(name string) (string, error) {
+	return "/tmp/" + name + ".console", nil
+}
+func (m *mockProvider) Logs(name string, opts provider.LogOptions, emit func(provider.LogLine)) error {
+	emit(provider.LogLine{Time: time.Unix(0, 0).UTC(), Text: "login:"})
+	return nil
+}
+func (m *mockProvider) Screenshot(name string) ([]byte, error) {
+	return []byte("\x89PNG"), nil
+}
+func (m *mockProvider) SendInput(name string, in provider.InputAction) error {
+	return provider.ValidateInput(in)
+}
+func (m *mockProvider) Fork(vmName string, count int, prefix string) ([]string, error) {
+	return []string{prefix + "1"}, nil
+}
+func (m *mockProvider) Resume(vmName, checkpoint string) (provider.Snapshot, error) {
+	return provider.Snapshot{Name: checkpoint, VMStateSize: 1 << 20}, nil
+}
+func (m *mockProvider) Doctor() []string { return []string{"ok"} }
 func (m *mockProvider) CachePrune(unusedOnly bool) (int, int64, error) {
 	m.cachePruneCalls++
 	m.cachePruneUnusedOnly = unusedOnly
@@ -97,8 +218,8 @@ func TestResourceAndPromptCatalogsExposeCompactSurface(t *testing.T) {
 	if len(ResourcesCatalog()) != 10 {
 		t.Fatalf("ResourcesCatalog() count = %d, want 10", len(ResourcesCatalog()))
 	}
-	if len(ResourceTemplatesCatalog()) != 3 {
-		t.Fatalf("ResourceTemplatesCatalog() count = %d, want 3", len(ResourceTemplatesCatalog()))
+	if len(ResourceTemplatesCatalog()) != 5 {
+		t.Fatalf("ResourceTemplatesCatalog() count = %d, want 5", len(ResourceTemplatesCatalog()))
 	}
 	if len(PromptsCatalog()) != 1 {
 		t.Fatalf("PromptsCatalog() count = %d, want 1", len(PromptsCatalog()))
@@ -121,7 +242,7 @@ func TestSystemToolCatalogCoversCLISystemActions(t *testing.T) {
 	for _, action := range actions {
 		seen[action] = true
 	}
-	for _, want := range []string{"doctor", "version", "update_check", "update", "config_get", "config_set", "accel_list", "register", "completion", "build_image", "uninstall"} {
+	for _, want := range []string{"doctor", "version", "update_check", "update", "config_get", "config_set", "accel_list", "register", "completion", "build_image", "state_migrate", "uninstall"} {
 		if !seen[want] {
 			t.Fatalf("nido_system action %q not present in tool catalog", want)
 		}
@@ -146,6 +267,35 @@ func TestMCPActionsCoverCLIManifest(t *testing.T) {
 		"vm.ssh":                       {"nido_vm", "ssh"},
 		"vm.delete":                    {"nido_vm", "delete"},
 		"vm.prune":                     {"nido_vm", "prune"},
+		"vm.ttl":                       {"nido_vm", "ttl_extend"},
+		"vm.label":                     {"nido_vm", "label"},
+		"nest.plan":                    {"nido_vm", "nest_plan"},
+		"nest.up":                      {"nido_vm", "nest_up"},
+		"nest.down":                    {"nido_vm", "nest_down"},
+		"snapshot.create":              {"nido_vm", "snapshot_create"},
+		"snapshot.list":                {"nido_vm", "snapshot_list"},
+		"snapshot.restore":             {"nido_vm", "snapshot_restore"},
+		"snapshot.delete":              {"nido_vm", "snapshot_delete"},
+		"vm.checkpoint":                {"nido_vm", "checkpoint"},
+		"vm.resume":                    {"nido_vm", "resume"},
+		"vm.fork":                      {"nido_vm", "fork"},
+		"vm.exec":                      {"nido_vm", "exec"},
+		"vm.cp":                        {"nido_vm", "upload"},
+		"vm.wait":                      {"nido_vm", "wait"},
+		"disk.resize":                  {"nido_vm", "config_update"},
+		"mount.add":                    {"nido_vm", "mount_add"},
+		"mount.remove":                 {"nido_vm", "mount_remove"},
+		"vm.resize":                    {"nido_vm", "config_update"},
+		"vm.logs":                      {"nido_vm", "logs"},
+		"vm.screenshot":                {"nido_vm", "screenshot"},
+		"vm.input":                     {"nido_vm", "input_key"},
+		"device.add":                   {"nido_vm", "device_add"},
+		"device.remove":                {"nido_vm", "device_remove"},
+		"volume.create":                {"nido_vm", "volume_create"},
+		"volume.list":                  {"nido_vm", "volume_list"},
+		"volume.attach":                {"nido_vm", "volume_attach"},
+		"volume.detach":                {"nido_vm", "volume_detach"},
+		"volume.delete":                {"nido_vm", "volume_delete"},
 		"template.list":                {"nido_template", "list"},
 		"template.create":              {"nido_template", "create"},
 		"template.delete":              {"nido_template", "delete"},
@@ -170,6 +320,7 @@ func TestMCPActionsCoverCLIManifest(t *testing.T) {
 		"system.version":               {"nido_system", "version"},
 		"system.update":                {"nido_system", "update"},
 		"system.uninstall":             {"nido_system", "uninstall"},
+		"state.migrate":                {"nido_system", "state_migrate"},
 		"system.completion.bash":       {"nido_system", "completion"},
 		"system.completion.zsh":        {"nido_system", "completion"},
 		"system.completion.fish":       {"nido_system", "completion"},
@@ -179,6 +330,9 @@ func TestMCPActionsCoverCLIManifest(t *testing.T) {
 		"ui.gui":          "interactive TUI, not an agent MCP operation",
 		"system.mcp":      "MCP transport entrypoint",
 		"system.mcp_help": "MCP guide is exposed by HelpPayload",
+		"vm.console":      "interactive terminal session; agents read nido://vm/{name}/logs",
+		"vm.serial_relay": "internal helper process started with the VM",
+		"system.daemon":   "long-running host supervisor; agents set restart_policy and read last_exit",
 	}
 
 	for _, action := range manifestActions(manifest.Commands) {
@@ -394,3 +548,208 @@ scripts:
 		t.Fatalf("web forwarding count = %d, want 2", len(p.spawnOpts.Forwarding))
 	}
 }
+
+func TestVMToolTransfersInlineContent(t *testing.T) {
+	p := &mockProvider{}
+	s := NewServer(p)
+
+	payload, err := s.callVMTool(json.RawMessage(`{"action":"upload","name":"vm-a","guest_path":"/tmp/hello.txt","content_base64":"aGVsbG8="}`))
+	if err != nil {
+		t.Fatalf("callVMTool(upload) failed: %v", err)
+	}
+	up := payload.(map[string]interface{})["result"].(provider.CopyResult)
+	if up.Target != "/tmp/hello.txt" || up.Bytes != 5 {
+		t.Fatalf("upload result = %+v", up)
+	}
+	if !p.copyOpts.NoTargetDirectory {
+		t.Fatal("inline upload must land at exactly guest_path")
+	}
+	for _, guestPath := range []string{"/tmp/", "/"} {
+		if _, err := s.callVMTool(json.RawMessage(`{"action":"upload","name":"vm-a","guest_path":"` + guestPath + `","content_base64":"aGVsbG8="}`)); err == nil {
+			t.Fatalf("inline upload to directory %q should fail", guestPath)
+		}
+	}
+
+	payload, err = s.callVMTool(json.RawMessage(`{"action":"download","name":"vm-a","guest_path":"/etc/motd"}`))
+	if err != nil {
+		t.Fatalf("callVMTool(download) failed: %v", err)
+	}
+	if got := payload.(map[string]interface{})["content_base64"]; got != "Z3Vlc3QgZGF0YQ==" {
+		t.Fatalf("content_base64 = %v, want guest data encoded", got)
+	}
+	if p.copyOpts.MaxBytes != inlineTransferLimit {
+		t.Fatalf("inline download MaxBytes = %d, want %d", p.copyOpts.MaxBytes, inlineTransferLimit)
+	}
+}
+
+func TestVMScreenIsReturnedAsImage(t *testing.T) {
+	s := NewServer(&mockProvider{})
+
+	payload, err := s.callVMTool(json.RawMessage(`{"action":"screenshot","name":"vm-a"}`))
+	if err != nil {
+		t.Fatalf("callVMTool(screenshot) failed: %v", err)
+	}
+	if img, ok := payload.(screenImage); !ok || string(img.PNG) != "\x89PNG" {
+		t.Fatalf("screenshot payload = %#v, want screenImage", payload)
+	}
+
+	payload, err = s.readResource("nido://vm/vm-a/screen")
+	if err != nil {
+		t.Fatalf("readResource(screen) failed: %v", err)
+	}
+	if _, ok := payload.(screenImage); !ok {
+		t.Fatalf("screen resource payload = %#v, want screenImage", payload)
+	}
+}
+
+func TestVMInputActionsMapToInputAction(t *testing.T) {
+	s := NewServer(&mockProvider{})
+
+	payload, err := s.callVMTool(json.RawMessage(`{"action":"input_click","name":"vm-a","x":10,"y":20,"button":"right"}`))
+	if err != nil {
+		t.Fatalf("callVMTool(input_click) failed: %v", err)
+	}
+	in := payload.(map[string]interface{})["input"].(provider.InputAction)
+	if in.Action != provider.InputClick || in.X != 10 || in.Y != 20 || in.Button != "right" {
+		t.Fatalf("input = %+v", in)
+	}
+	if _, err := s.callVMTool(json.RawMessage(`{"action":"input_type","name":"vm-a","text":"caf\u00e9"}`)); err == nil {
+		t.Fatal("input_type with non-ASCII text succeeded, want error")
+	}
+}
+
+func TestVMConfigUpdatePassesOnlyGivenLimits(t *testing.T) {
+	p := &mockProvider{}
+	s := NewServer(p)
+
+	if _, err := s.callVMTool(json.RawMessage(`{"action":"config_update","name":"vm-a","cpu_limit":1.5,"pids_limit":0}`)); err != nil {
+		t.Fatalf("callVMTool(config_update) failed: %v", err)
+	}
+	u := p.updates
+	if u.CPULimit == nil || *u.CPULimit != 1.5 || u.PidsLimit == nil || *u.PidsLimit != 0 {
+		t.Fatalf("limit updates = cpu %v pids %v", u.CPULimit, u.PidsLimit)
+	}
+	if u.MemoryLimitMB != nil || u.IOWeight != nil {
+		t.Fatalf("absent limits were set: memory %v io %v", u.MemoryLimitMB, u.IOWeight)
+	}
+}
+
+func TestVMTTLActions(t *testing.T) {
+	p := &mockProvider{}
+	s := NewServer(p)
+
+	if _, err := s.callVMTool(json.RawMessage(`{"action":"ttl_extend","name":"vm-a","ttl":"1d"}`)); err != nil {
+		t.Fatalf("callVMTool(ttl_extend) failed: %v", err)
+	}
+	if p.ttlAction != provider.TTLExtend || p.ttl != 24*time.Hour {
+		t.Fatalf("SetTTL got %q %s", p.ttlAction, p.ttl)
+	}
+	if _, err := s.callVMTool(json.RawMessage(`{"action":"ttl_set","name":"vm-a"}`)); err == nil {
+		t.Fatal("ttl_set without ttl succeeded")
+	}
+	if _, err := s.callVMTool(json.RawMessage(`{"action":"create","name":"vm-b","template":"base","ttl":"2h","on_expiry":"stop"}`)); err != nil {
+		t.Fatalf("callVMTool(create) failed: %v", err)
+	}
+	if p.spawnOpts.TTL != 2*time.Hour || p.spawnOpts.OnExpiry != provider.ExpiryStop {
+		t.Fatalf("spawn ttl = %s, on expiry %q", p.spawnOpts.TTL, p.spawnOpts.OnExpiry)
+	}
+}
+
+func TestVMSelectorActions(t *testing.T) {
+	p := &mockProvider{vms: []provider.VMStatus{
+		{Name: "a", State: "running", Labels: map[string]string{"team": "search"}},
+		{Name: "b", State: "running", Labels: map[string]string{"team": "ads"}},
+		{Name: "c", State: "stopped", Labels: map[string]string{"team": "search"}},
+	}}
+	s := NewServer(p)
+
+	out, err := s.callVMTool(json.RawMessage(`{"action":"list","selector":"team=search"}`))
+	if err != nil {
+		t.Fatalf("callVMTool(list) failed: %v", err)
+	}
+	if vms := out.(map[string]interface{})["vms"].([]provider.VMStatus); len(vms) != 2 {
+		t.Fatalf("list with selector = %+v", vms)
+	}
+	out, err = s.callVMTool(json.RawMessage(`{"action":"stop","selector":"team=search"}`))
+	if err != nil {
+		t.Fatalf("callVMTool(stop) failed: %v", err)
+	}
+	if len(p.stopped) != 1 || p.stopped[0] != "a" || !strings.Contains(jsonText(out), `"results":[{"name":"a","status":"stopped"}]`) {
+		t.Fatalf("bulk stop stopped %v: %s", p.stopped, jsonText(out))
+	}
+	if _, err := s.callVMTool(json.RawMessage(`{"action":"label","name":"a","labels":{"purpose":"eval"},"remove_labels":["team"]}`)); err != nil {
+		t.Fatalf("callVMTool(label) failed: %v", err)
+	}
+	if p.labelSet["purpose"] != "eval" || len(p.labelRemove) != 1 {
+		t.Fatalf("SetLabels got %v, %v", p.labelSet, p.labelRemove)
+	}
+	if _, err := s.callVMTool(json.RawMessage(`{"action":"stop","selector":","}`)); err == nil || len(p.stopped) != 1 {
+		t.Fatalf("stop with an empty selector = %v, stopped %v", err, p.stopped)
+	}
+	if _, err := s.callVMTool(json.RawMessage(`{"action":"stop","name":"b","selector":"team=search"}`)); err == nil || len(p.stopped) != 1 {
+		t.Fatalf("stop with a name and a selector = %v, stopped %v", err, p.stopped)
+	}
+	if _, err := s.callVMTool(json.RawMessage(`{"action":"info","selector":"team=search"}`)); err == nil || !strings.Contains(err.Error(), "selector") {
+		t.Fatalf("info with a selector = %v", err)
+	}
+}
+
+func TestVMCreateBatch(t *testing.T) {
+	p := &mockProvider{}
+	s := NewServer(p)
+
+	out, err := s.callVMTool(json.RawMessage(`{"action":"create","name":"worker-{i}","template":"base","count":3,"parallel":2,"labels":{"pool":"ci"}}`))
+	if err != nil {
+		t.Fatalf("callVMTool(create) failed: %v", err)
+	}
+	if strings.Join(p.spawnNames, ",") != "worker-1,worker-2,worker-3" || p.spawnParallel != 2 || p.spawnOpts.Labels["pool"] != "ci" {
+		t.Fatalf("SpawnBatch got %v, parallel %d, opts %+v", p.spawnNames, p.spawnParallel, p.spawnOpts)
+	}
+	if got := jsonText(out); !strings.Contains(got, `"failed":0`) || !strings.Contains(got, `{"name":"worker-3","result":"spawned"}`) {
+		t.Fatalf("batch create output: %s", got)
+	}
+	if _, err := s.callVMTool(json.RawMessage(`{"action":"create","name":"worker","template":"base","count":2}`)); err == nil {
+		t.Fatal("batch create without {i} succeeded")
+	}
+}
+
+func TestVMNestActions(t *testing.T) {
+	p := &mockProvider{}
+	s := NewServer(p)
+	file := filepath.Join(t.TempDir(), "nido.yaml")
+	if err := os.WriteFile(file, []byte("vms:\n  agent:\n    template: base\n    memory: 2048\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := s.callVMTool(json.RawMessage(`{"action":"nest_plan","file":` + jsonText(file) + `}`))
+	if err != nil {
+		t.Fatalf("callVMTool(nest_plan) failed: %v", err)
+	}
+	if got := jsonText(out); !strings.Contains(got, `{"vm":"agent","actions":["create"]}`) {
+		t.Fatalf("nest_plan output: %s", got)
+	}
+	out, err = s.callVMTool(json.RawMessage(`{"action":"nest_up","file":` + jsonText(file) + `}`))
+	if err != nil {
+		t.Fatalf("callVMTool(nest_up) failed: %v", err)
+	}
+	if p.spawnName != "agent" || p.spawnOpts.DiskPath != "base" || p.spawnOpts.MemoryMB != 2048 || !strings.Contains(jsonText(out), `"failed":0`) {
+		t.Fatalf("nest_up spawned %q with %+v: %s", p.spawnName, p.spawnOpts, jsonText(out))
+	}
+	if _, err := s.callVMTool(json.RawMessage(`{"action":"nest_plan","file":"/nonexistent/nido.yaml"}`)); err == nil {
+		t.Fatal("nest_plan with a missing file succeeded")
+	}
+}
+
+func TestSystemStateMigrate(t *testing.T) {
+	p := &mockProvider{}
+	s := NewServer(p)
+
+	out, err := s.callSystemTool(json.RawMessage(`{"action":"state_migrate","dry_run":true}`))
+	if err != nil {
+		t.Fatalf("callSystemTool(state_migrate) failed: %v", err)
+	}
+	res, _ := out.(map[string]interface{})
+	if !p.migrateDryRun || res["failed"] != 1 || res["schema_version"] != provider.StateSchemaVersion {
+		t.Fatalf("state_migrate = %v (dry run %v)", res, p.migrateDryRun)
+	}
+}
@@ -0,0 +1,184 @@
+// Package nest reads project nest files (nido.yaml) that declare the VMs a
+// repository needs, and reconciles the local fleet with them.
+package nest
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Josepavese/nido/internal/pkg/sysutil"
+	"github.com/Josepavese/nido/internal/provider"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultFile is the nest file looked up in the working directory.
+const DefaultFile = "nido.yaml"
+
+// File is a parsed nest file. Relative host paths (user_data, mounts) are
+// resolved against the directory holding the file.
+type File struct {
+	// Path is the absolute path the file was read from.
+	Path string        `yaml:"-"`
+	VMs  map[string]VM `yaml:"vms"`
+}
+
+// VM declares one VM. Image or Template picks the source (neither uses the
+// default template); the remaining fields mirror the spawn flags.
+type VM struct {
+	Image         string            `yaml:"image,omitempty"`
+	Template      string            `yaml:"template,omitempty"`
+	Memory        int               `yaml:"memory,omitempty"`
+	CPUs          int               `yaml:"cpus,omitempty"`
+	Gui           bool              `yaml:"gui,omitempty"`
+	Ports         []string          `yaml:"ports,omitempty"`
+	UserData      string            `yaml:"user_data,omitempty"`
+	Mounts        []string          `yaml:"mounts,omitempty"`
+	Labels        map[string]string `yaml:"labels,omitempty"`
+	Restart       string            `yaml:"restart,omitempty"`
+	LimitCPU      float64           `yaml:"limit_cpu,omitempty"`
+	LimitMemory   int               `yaml:"limit_memory,omitempty"`
+	LimitIOWeight int               `yaml:"limit_io_weight,omitempty"`
+	LimitPids     int               `yaml:"limit_pids,omitempty"`
+
+	forwarding []provider.PortForward
+	mounts     []provider.Mount
+}
+
+// Load reads and validates a nest file.
+func Load(path string) (*File, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(abs)
+	if err != nil {
+		return nil, err
+	}
+	f := &File{Path: abs}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(f); err != nil {
+		return nil, fmt.Errorf("%s: %w", abs, err)
+	}
+	if len(f.VMs) == 0 {
+		return nil, fmt.Errorf("%s declares no VMs", abs)
+	}
+	dir := filepath.Dir(abs)
+	for name, vm := range f.VMs {
+		if err := vm.resolve(name, dir); err != nil {
+			return nil, fmt.Errorf("%s: vm %s: %w", abs, name, err)
+		}
+		f.VMs[name] = vm
+	}
+	return f, nil
+}
+
+// Names returns the declared VM names in a stable order.
+func (f *File) Names() []string {
+	names := make([]string, 0, len(f.VMs))
+	for name := range f.VMs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// resolve validates the declaration and parses its ports and mounts.
+func (vm *VM) resolve(name, dir string) error {
+	for _, r := range name {
+		if !((r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '-' || r == '_' || r == '.') {
+			return fmt.Errorf("invalid name: only alphanumeric, hyphens, underscores, and dots allowed")
+		}
+	}
+	if vm.Image != "" && vm.Template != "" {
+		return fmt.Errorf("set image or template, not both")
+	}
+	if err := provider.ValidateRestartPolicy(vm.Restart); err != nil {
+		return err
+	}
+	for k, v := range vm.Labels {
+		if err := provider.ValidateLabel(k, v); err != nil {
+			return err
+		}
+	}
+	vm.forwarding = nil
+	for _, spec := range vm.Ports {
+		pf, err := provider.ParsePortForward(spec)
+		if err != nil {
+			return fmt.Errorf("port %q: %w", spec, err)
+		}
+		vm.forwarding = append(vm.forwarding, pf)
+	}
+	if vm.UserData != "" {
+		vm.UserData = hostPath(dir, vm.UserData)
+		if _, err := os.Stat(vm.UserData); err != nil {
+			return fmt.Errorf("user_data: %w", err)
+		}
+	}
+	vm.mounts = nil
+	for _, spec := range vm.Mounts {
+		m, err := parseMount(dir, spec)
+		if err != nil {
+			return err
+		}
+		vm.mounts = append(vm.mounts, m)
+	}
+	return nil
+}
+
+// limits returns the declared cgroup limits.
+func (vm VM) limits() provider.ResourceLimits {
+	return provider.ResourceLimits{CPUs: vm.LimitCPU, MemoryMaxMB: vm.LimitMemory, IOWeight: vm.LimitIOWeight, PidsMax: vm.LimitPids}
+}
+
+// options returns the spawn options for the declaration, without the
+// image resolution that only the caller can do.
+func (vm VM) options() provider.VMOptions {
+	opts := provider.VMOptions{
+		DiskPath:      vm.Template,
+		UserDataPath:  vm.UserData,
+		Gui:           vm.Gui,
+		Forwarding:    append([]provider.PortForward(nil), vm.forwarding...),
+		MemoryMB:      vm.Memory,
+		VCPUs:         vm.CPUs,
+		Mounts:        append([]provider.Mount(nil), vm.mounts...),
+		RestartPolicy: vm.Restart,
+	}
+	if len(vm.Labels) > 0 {
+		opts.Labels = map[string]string{}
+		for k, v := range vm.Labels {
+			opts.Labels[k] = v
+		}
+	}
+	if limits := vm.limits(); !limits.IsZero() {
+		opts.Limits = &limits
+	}
+	return opts
+}
+
+// hostPath expands ~ and makes p absolute relative to dir.
+func hostPath(dir, p string) string {
+	if p == "~" || strings.HasPrefix(p, "~/") {
+		if home, err := sysutil.UserHome(); err == nil {
+			p = filepath.Join(home, strings.TrimPrefix(p, "~"))
+		}
+	}
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(dir, p)
+	}
+	return p
+}
+
+// parseMount parses a <host-dir>:<guest-path>[:ro] spec whose host side is
+// relative to dir.
+func parseMount(dir, spec string) (provider.Mount, error) {
+	rest := strings.TrimSuffix(strings.TrimSuffix(spec, ":ro"), ":rw")
+	if i := strings.LastIndex(rest, ":"); i > 0 {
+		spec = hostPath(dir, rest[:i]) + spec[i:]
+	}
+	return provider.ParseMount(spec)
+}
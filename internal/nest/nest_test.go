@@ -0,0 +1,213 @@
+package nest
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/Josepavese/nido/internal/provider"
+)
+
+// fakeProvider implements the calls Plan, Up and Down make; any other
+// call panics through the nil embedded interface.
+type fakeProvider struct {
+	provider.VMProvider
+	vms     map[string]provider.VMDetail
+	spawned map[string]provider.VMOptions
+	updates map[string]provider.VMConfigUpdates
+	labels  map[string]map[string]string
+	started []string
+	deleted []string
+}
+
+func (f *fakeProvider) List() ([]provider.VMStatus, error) {
+	var out []provider.VMStatus
+	for name, vm := range f.vms {
+		out = append(out, provider.VMStatus{Name: name, State: vm.State})
+	}
+	return out, nil
+}
+
+func (f *fakeProvider) Info(name string) (provider.VMDetail, error) {
+	return f.vms[name], nil
+}
+
+func (f *fakeProvider) Spawn(name string, opts provider.VMOptions) error {
+	f.spawned[name] = opts
+	return nil
+}
+
+func (f *fakeProvider) UpdateConfig(name string, u provider.VMConfigUpdates) (provider.ApplyMode, error) {
+	f.updates[name] = u
+	return provider.AppliedNextBoot, nil
+}
+
+func (f *fakeProvider) SetLabels(name string, set map[string]string, remove []string) (map[string]string, error) {
+	f.labels[name] = set
+	return set, nil
+}
+
+func (f *fakeProvider) Start(name string, opts provider.VMOptions) error {
+	f.started = append(f.started, name)
+	return nil
+}
+
+func (f *fakeProvider) Delete(name string) error {
+	f.deleted = append(f.deleted, name)
+	return nil
+}
+
+func writeNest(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), DefaultFile)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadResolvesPathsAgainstTheFile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shared folders are not supported on Windows hosts")
+	}
+	path := writeNest(t, `
+vms:
+  agent:
+    image: ubuntu:24.04
+    memory: 2048
+    ports: ["web:80", "8080:31080/tcp"]
+    user_data: cloud-init.yaml
+    mounts: ["./src:/work:ro"]
+    labels: {role: agent}
+`)
+	dir := filepath.Dir(path)
+	if err := os.WriteFile(filepath.Join(dir, "cloud-init.yaml"), []byte("#cloud-config\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "src"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	vm := f.VMs["agent"]
+	if vm.UserData != filepath.Join(dir, "cloud-init.yaml") {
+		t.Fatalf("user_data = %s", vm.UserData)
+	}
+	if len(vm.mounts) != 1 || vm.mounts[0].HostPath != filepath.Join(dir, "src") || !vm.mounts[0].ReadOnly {
+		t.Fatalf("mounts = %+v", vm.mounts)
+	}
+	if len(vm.forwarding) != 2 || vm.forwarding[0].Label != "web" || vm.forwarding[1].HostPort != 31080 {
+		t.Fatalf("ports = %+v", vm.forwarding)
+	}
+}
+
+func TestLoadRejectsInvalidFiles(t *testing.T) {
+	for _, content := range []string{
+		"vms: {}",
+		"vms:\n  a:\n    image: x\n    template: y\n",
+		"vms:\n  a:\n    memroy: 1024\n",
+		"vms:\n  a:\n    ports: [\"http\"]\n",
+		"vms:\n  a:\n    user_data: missing.yaml\n",
+		"vms:\n  a:\n    restart: sometimes\n",
+		"vms:\n  bad name:\n    image: x\n",
+	} {
+		if _, err := Load(writeNest(t, content)); err == nil {
+			t.Fatalf("Load accepted:\n%s", content)
+		}
+	}
+}
+
+func TestPlanAndUp(t *testing.T) {
+	f, err := Load(writeNest(t, `
+vms:
+  agent:
+    image: ubuntu:24.04
+  db:
+    template: base
+    memory: 2048
+    ports: ["80"]
+    labels: {role: db, tier: data}
+  cache:
+    template: base
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &fakeProvider{
+		vms: map[string]provider.VMDetail{
+			"db": {Name: "db", State: "stopped", MemoryMB: 1024, Labels: map[string]string{"role": "db", "owner": "me"},
+				Forwarding: []provider.PortForward{{GuestPort: 80, HostPort: 31000, Protocol: "tcp"}}},
+			"cache": {Name: "cache", State: "running"},
+		},
+		spawned: map[string]provider.VMOptions{},
+		updates: map[string]provider.VMConfigUpdates{},
+		labels:  map[string]map[string]string{},
+	}
+
+	changes, err := Plan(f, p)
+	if err != nil {
+		t.Fatalf("Plan failed: %v", err)
+	}
+	got := map[string]Change{}
+	for _, c := range changes {
+		got[c.VM] = c
+	}
+	if a := got["agent"].Actions; len(a) != 1 || a[0] != ActionCreate {
+		t.Fatalf("agent actions = %v", a)
+	}
+	if c := got["db"]; strings.Join(c.Actions, ",") != "update,start" || strings.Join(c.Drift, ",") != "memory,labels" {
+		t.Fatalf("db change = %+v", c)
+	}
+	if c := got["cache"]; len(c.Actions) != 0 || len(c.Drift) != 0 {
+		t.Fatalf("cache change = %+v", c)
+	}
+
+	results := Up(f, p, changes, func(tag string) (provider.VMOptions, error) {
+		return provider.VMOptions{DiskPath: "/images/" + tag + ".qcow2", SSHUser: "ubuntu"}, nil
+	})
+	for _, r := range results {
+		if r.Error != "" {
+			t.Fatalf("Up %s failed: %s", r.VM, r.Error)
+		}
+	}
+	if opts := p.spawned["agent"]; opts.DiskPath != "/images/ubuntu:24.04.qcow2" || opts.SSHUser != "ubuntu" {
+		t.Fatalf("spawn options = %+v", opts)
+	}
+	if u := p.updates["db"]; u.MemoryMB == nil || *u.MemoryMB != 2048 || u.Forwarding != nil {
+		t.Fatalf("db updates = %+v", u)
+	}
+	if l := p.labels["db"]; len(l) != 1 || l["tier"] != "data" {
+		t.Fatalf("db labels = %v", l)
+	}
+	if len(p.started) != 1 || p.started[0] != "db" {
+		t.Fatalf("started = %v", p.started)
+	}
+
+	results = Up(f, p, changes[:1], func(string) (provider.VMOptions, error) {
+		return provider.VMOptions{}, errors.New("catalog offline")
+	})
+	if len(results) != 1 || !strings.Contains(results[0].Error, "catalog offline") || len(results[0].Actions) != 0 {
+		t.Fatalf("failed create = %+v", results)
+	}
+}
+
+func TestDownDeletesOnlyDeclaredVMs(t *testing.T) {
+	f, err := Load(writeNest(t, "vms:\n  agent: {}\n  gone: {}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &fakeProvider{vms: map[string]provider.VMDetail{"agent": {Name: "agent"}, "other": {Name: "other"}}}
+	results, err := Down(f, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.deleted) != 1 || p.deleted[0] != "agent" || len(results) != 2 || len(results[1].Actions) != 0 {
+		t.Fatalf("deleted %v, results %+v", p.deleted, results)
+	}
+}
@@ -0,0 +1,293 @@
+package nest
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/Josepavese/nido/internal/provider"
+)
+
+// Reconcile actions, in the order Up performs them.
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionStart  = "start"
+	ActionDelete = "delete"
+)
+
+// Change is what it takes to bring one declared VM in line with the nest
+// file. Empty Actions means the VM already matches; Drift names the fields
+// that differ and Notes explains drift that Up cannot fix.
+type Change struct {
+	VM      string   `json:"vm"`
+	Actions []string `json:"actions"`
+	Drift   []string `json:"drift,omitempty"`
+	Notes   []string `json:"notes,omitempty"`
+
+	updates      *provider.VMConfigUpdates
+	setLabels    map[string]string
+	mountsAdd    []provider.Mount
+	mountsRemove []string
+}
+
+// Result is the outcome of Up or Down for one VM: the actions done before
+// any failure, the UpdateConfig apply mode and the error.
+type Result struct {
+	VM      string             `json:"vm"`
+	Actions []string           `json:"actions"`
+	Applied provider.ApplyMode `json:"applied,omitempty"`
+	Error   string             `json:"error,omitempty"`
+}
+
+// ImageResolver turns an image tag into spawn options that carry the local
+// disk (DiskPath) and its SSH and boot metadata, pulling it if needed.
+type ImageResolver func(tag string) (provider.VMOptions, error)
+
+// Plan compares the fleet with the nest file, one change per declared VM.
+// Image, template and user_data only apply when a VM is created.
+func Plan(f *File, p provider.VMProvider) ([]Change, error) {
+	vms, err := p.List()
+	if err != nil {
+		return nil, err
+	}
+	exists := map[string]bool{}
+	for _, vm := range vms {
+		exists[vm.Name] = true
+	}
+
+	changes := make([]Change, 0, len(f.VMs))
+	for _, name := range f.Names() {
+		c := Change{VM: name, Actions: []string{}}
+		if !exists[name] {
+			c.Actions = append(c.Actions, ActionCreate)
+			changes = append(changes, c)
+			continue
+		}
+		info, err := p.Info(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to inspect VM %s: %w", name, err)
+		}
+		c.diff(f.VMs[name], info)
+		if c.updates != nil || c.setLabels != nil || c.mountsAdd != nil || c.mountsRemove != nil {
+			c.Actions = append(c.Actions, ActionUpdate)
+		}
+		if info.State == "stopped" {
+			c.Actions = append(c.Actions, ActionStart)
+		}
+		changes = append(changes, c)
+	}
+	return changes, nil
+}
+
+// diff records where the VM differs from its declaration. Memory and vCPUs
+// left out of the file keep whatever the VM has; ports, limits, restart
+// policy and mounts are taken as declared, and declared labels are set
+// without removing others.
+func (c *Change) diff(vm VM, info provider.VMDetail) {
+	u := provider.VMConfigUpdates{}
+	drift := func(field string) {
+		c.Drift = append(c.Drift, field)
+		c.updates = &u
+	}
+	if vm.Memory > 0 && vm.Memory != info.MemoryMB {
+		u.MemoryMB = &vm.Memory
+		drift("memory")
+	}
+	if vm.CPUs > 0 && vm.CPUs != info.VCPUs {
+		u.VCPUs = &vm.CPUs
+		drift("cpus")
+	}
+	if vm.Gui != info.Gui {
+		u.Gui = &vm.Gui
+		drift("gui")
+	}
+	if fw, same := matchPorts(vm.forwarding, info.Forwarding); !same {
+		u.Forwarding = &fw
+		drift("ports")
+	}
+
+	want, have := vm.limits(), provider.ResourceLimits{}
+	if info.Limits != nil {
+		have = *info.Limits
+	}
+	if want != have {
+		u.CPULimit, u.MemoryLimitMB, u.IOWeight, u.PidsLimit = &want.CPUs, &want.MemoryMaxMB, &want.IOWeight, &want.PidsMax
+		drift("limits")
+	}
+	restart, current := vm.Restart, info.RestartPolicy
+	if restart == "" {
+		restart = provider.RestartNo
+	}
+	if current == "" {
+		current = provider.RestartNo
+	}
+	if restart != current {
+		u.RestartPolicy = &restart
+		drift("restart")
+	}
+
+	for k, v := range vm.Labels {
+		if have, ok := info.Labels[k]; !ok || have != v {
+			if c.setLabels == nil {
+				c.setLabels = map[string]string{}
+				c.Drift = append(c.Drift, "labels")
+			}
+			c.setLabels[k] = v
+		}
+	}
+
+	add, remove := diffMounts(vm.mounts, info.Mounts)
+	if len(add) > 0 || len(remove) > 0 {
+		c.Drift = append(c.Drift, "mounts")
+		if info.State == "stopped" {
+			c.mountsAdd, c.mountsRemove = add, remove
+		} else {
+			c.Notes = append(c.Notes, fmt.Sprintf("mounts change only while stopped: run 'nido stop %s' and up again", info.Name))
+		}
+	}
+}
+
+// matchPorts pairs declared forwards with the VM's, keeping the host port
+// already assigned to an auto-assigned forward. same is false when the
+// sets differ; fw is then the list to apply.
+func matchPorts(declared, actual []provider.PortForward) (fw []provider.PortForward, same bool) {
+	used := make([]bool, len(actual))
+	fw = make([]provider.PortForward, 0, len(declared))
+	same = len(declared) == len(actual)
+	for _, d := range declared {
+		matched := false
+		for i, a := range actual {
+			if used[i] || a.GuestPort != d.GuestPort || a.Protocol != d.Protocol || (d.HostPort != 0 && d.HostPort != a.HostPort) || (d.Label != "" && d.Label != a.Label) {
+				continue
+			}
+			used[i], matched = true, true
+			d.HostPort = a.HostPort
+			break
+		}
+		if !matched {
+			same = false
+		}
+		fw = append(fw, d)
+	}
+	return fw, same
+}
+
+// diffMounts returns the declared mounts the VM lacks and the guest paths
+// of the VM mounts that are not declared.
+func diffMounts(declared, actual []provider.Mount) (add []provider.Mount, remove []string) {
+	key := func(m provider.Mount) provider.Mount {
+		m.GuestPath = path.Clean(m.GuestPath)
+		return m
+	}
+	have := map[provider.Mount]bool{}
+	for _, m := range actual {
+		have[key(m)] = true
+	}
+	want := map[provider.Mount]bool{}
+	for _, m := range declared {
+		want[key(m)] = true
+		if !have[key(m)] {
+			add = append(add, m)
+		}
+	}
+	for _, m := range actual {
+		if !want[key(m)] {
+			remove = append(remove, m.GuestPath)
+		}
+	}
+	return add, remove
+}
+
+// Up applies a plan from Plan: it creates missing VMs (which also starts
+// them), updates drifted ones and starts stopped ones. A failing VM does
+// not stop the others.
+func Up(f *File, p provider.VMProvider, changes []Change, resolve ImageResolver) []Result {
+	images := map[string]provider.VMOptions{}
+	results := make([]Result, 0, len(changes))
+	for _, c := range changes {
+		r := Result{VM: c.VM, Actions: []string{}}
+		if err := c.apply(f.VMs[c.VM], p, resolve, images, &r); err != nil {
+			r.Error = err.Error()
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+func (c Change) apply(vm VM, p provider.VMProvider, resolve ImageResolver, images map[string]provider.VMOptions, r *Result) error {
+	for _, action := range c.Actions {
+		switch action {
+		case ActionCreate:
+			opts := vm.options()
+			if vm.Image != "" {
+				img, ok := images[vm.Image]
+				if !ok {
+					var err error
+					if img, err = resolve(vm.Image); err != nil {
+						return fmt.Errorf("image %s: %w", vm.Image, err)
+					}
+					images[vm.Image] = img
+				}
+				opts.DiskPath, opts.SSHUser, opts.SSHPassword, opts.SeedFiles, opts.Cmdline = img.DiskPath, img.SSHUser, img.SSHPassword, img.SeedFiles, img.Cmdline
+			}
+			if err := p.Spawn(c.VM, opts); err != nil {
+				return err
+			}
+		case ActionUpdate:
+			if c.updates != nil {
+				mode, err := p.UpdateConfig(c.VM, *c.updates)
+				if err != nil {
+					return err
+				}
+				r.Applied = mode
+			}
+			if c.setLabels != nil {
+				if _, err := p.SetLabels(c.VM, c.setLabels, nil); err != nil {
+					return err
+				}
+			}
+			for _, guestPath := range c.mountsRemove {
+				if err := p.MountRemove(c.VM, guestPath); err != nil {
+					return err
+				}
+			}
+			for _, m := range c.mountsAdd {
+				if err := p.MountAdd(c.VM, m); err != nil {
+					return err
+				}
+			}
+		case ActionStart:
+			if err := p.Start(c.VM, provider.VMOptions{}); err != nil {
+				return err
+			}
+		}
+		r.Actions = append(r.Actions, action)
+	}
+	return nil
+}
+
+// Down deletes the declared VMs that exist. A failing VM does not stop the
+// others.
+func Down(f *File, p provider.VMProvider) ([]Result, error) {
+	vms, err := p.List()
+	if err != nil {
+		return nil, err
+	}
+	exists := map[string]bool{}
+	for _, vm := range vms {
+		exists[vm.Name] = true
+	}
+	results := make([]Result, 0, len(f.VMs))
+	for _, name := range f.Names() {
+		r := Result{VM: name, Actions: []string{}}
+		if exists[name] {
+			if err := p.Delete(name); err != nil {
+				r.Error = err.Error()
+			} else {
+				r.Actions = append(r.Actions, ActionDelete)
+			}
+		}
+		results = append(results, r)
+	}
+	return results, nil
+}
@@ -1,6 +1,7 @@
 package sysutil
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -101,6 +102,90 @@ func WriteFile(filename string, data []byte, perm os.FileMode) error {
 	return FixPermissions(filename)
 }
 
+// WriteFileAtomic writes data to a temporary file next to filename and
+// renames it into place, so readers see either the old or the new content,
+// never a partial write.
+func WriteFileAtomic(filename string, data []byte, perm os.FileMode) error {
+	dir, base := filepath.Split(filename)
+	if dir == "" {
+		dir = "."
+	}
+	tmp, err := os.CreateTemp(dir, "."+base+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	if err := FixPermissions(tmp.Name()); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
+
+// ErrLocked is returned by TryLockFile when another holder has the lock.
+var ErrLocked = errors.New("file is locked")
+
+// LockFile takes an exclusive advisory lock on path, creating the file if
+// needed, and blocks until it is free. Locks conflict between processes
+// and between separate LockFile calls in one process. The returned func
+// releases the lock.
+func LockFile(path string) (func(), error) {
+	return lockPath(path, true)
+}
+
+// TryLockFile is LockFile without waiting: it returns ErrLocked when the
+// lock is held elsewhere.
+func TryLockFile(path string) (func(), error) {
+	return lockPath(path, false)
+}
+
+func lockPath(path string, wait bool) (func(), error) {
+	for {
+		f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+		if err != nil {
+			return nil, err
+		}
+		_ = FixPermissions(path)
+		if err := lockFile(f, wait); err != nil {
+			f.Close()
+			return nil, err
+		}
+		// The previous holder may have removed the file while we waited;
+		// the lock only counts if path still names the file we hold.
+		held, err := f.Stat()
+		if err != nil {
+			unlockFile(f)
+			f.Close()
+			return nil, err
+		}
+		if current, err := os.Stat(path); err == nil && os.SameFile(held, current) {
+			return func() {
+				unlockFile(f)
+				f.Close()
+			}, nil
+		} else if err != nil && !os.IsNotExist(err) {
+			unlockFile(f)
+			f.Close()
+			return nil, err
+		}
+		unlockFile(f)
+		f.Close()
+	}
+}
+
 // ProvisionFile wraps a file creation operation (like an external command)
 // and ensures the resulting file has the correct ownership.
 func ProvisionFile(path string, generator func() error) error {
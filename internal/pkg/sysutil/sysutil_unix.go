@@ -5,6 +5,7 @@ package sysutil
 import (
 	"os"
 	"strconv"
+	"syscall"
 )
 
 // GetTargetUIDGID returns the UID and GID of the SUDO_USER,
@@ -38,3 +39,23 @@ func FixPermissions(path string) error {
 
 	return os.Chown(path, uid, gid)
 }
+
+func lockFile(f *os.File, wait bool) error {
+	how := syscall.LOCK_EX
+	if !wait {
+		how |= syscall.LOCK_NB
+	}
+	for {
+		err := syscall.Flock(int(f.Fd()), how)
+		if err == syscall.EWOULDBLOCK {
+			return ErrLocked
+		}
+		if err != syscall.EINTR {
+			return err
+		}
+	}
+}
+
+func unlockFile(f *os.File) {
+	_ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
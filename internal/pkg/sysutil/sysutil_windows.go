@@ -2,6 +2,12 @@
 
 package sysutil
 
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
 // GetTargetUIDGID on Windows returns 0,0 (root/admin effectively) or similar,
 // but since ownership isn't mapped the same way, we just return nil error and dummy values.
 // We could return -1, -1 but 0, 0 is safer default if used blindly.
@@ -13,3 +19,21 @@ func GetTargetUIDGID() (int, int, error) {
 func FixPermissions(path string) error {
 	return nil
 }
+
+func lockFile(f *os.File, wait bool) error {
+	flags := uint32(windows.LOCKFILE_EXCLUSIVE_LOCK)
+	if !wait {
+		flags |= windows.LOCKFILE_FAIL_IMMEDIATELY
+	}
+	var ol windows.Overlapped
+	err := windows.LockFileEx(windows.Handle(f.Fd()), flags, 0, 1, 0, &ol)
+	if err == windows.ERROR_LOCK_VIOLATION {
+		return ErrLocked
+	}
+	return err
+}
+
+func unlockFile(f *os.File) {
+	var ol windows.Overlapped
+	_ = windows.UnlockFileEx(windows.Handle(f.Fd()), 0, 1, 0, &ol)
+}
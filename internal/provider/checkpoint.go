@@ -0,0 +1,109 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// checkpointTimeout bounds savevm/loadvm, which stream the whole guest RAM.
+const checkpointTimeout = 5 * time.Minute
+
+// Checkpoint saves RAM, device and disk state into the VM disk with savevm.
+// The guest is paused while its memory is written and continues afterwards.
+func (p *QemuProvider) Checkpoint(vmName, name string) (Snapshot, error) {
+	if name == "" {
+		name = "ckpt-" + time.Now().Format("20060102-150405")
+	}
+	if err := ValidateSnapshotName(name); err != nil {
+		return Snapshot{}, err
+	}
+	if _, err := p.vmDiskPath(vmName); err != nil {
+		return Snapshot{}, err
+	}
+	if !p.vmAlive(vmName) {
+		return Snapshot{}, fmt.Errorf("VM '%s' is not running; start it before taking a checkpoint", vmName)
+	}
+	if _, err := p.findSnapshot(vmName, name); err == nil {
+		return Snapshot{}, fmt.Errorf("snapshot '%s' already exists on VM '%s'", name, vmName)
+	}
+
+	if err := p.monitorCommand(vmName, "savevm "+name); err != nil {
+		return Snapshot{}, fmt.Errorf("checkpoint failed: %w", err)
+	}
+	return p.findSnapshot(vmName, name)
+}
+
+// Resume restores a checkpoint. A running VM is rewound with loadvm; a
+// stopped one is launched with -loadvm so the guest skips boot entirely.
+func (p *QemuProvider) Resume(vmName, checkpoint string) (Snapshot, error) {
+	if _, err := p.vmDiskPath(vmName); err != nil {
+		return Snapshot{}, err
+	}
+	snapshots, err := p.SnapshotList(vmName)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	snap, err := pickCheckpoint(vmName, snapshots, checkpoint)
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	if p.vmAlive(vmName) {
+		if err := p.monitorCommand(vmName, "loadvm "+snap.Name); err != nil {
+			return Snapshot{}, fmt.Errorf("resume failed: %w", err)
+		}
+		return snap, nil
+	}
+	return snap, p.start(vmName, VMOptions{}, snap.Name)
+}
+
+// pickCheckpoint selects the named checkpoint, or the newest one when name is
+// empty. Disk-only snapshots cannot be resumed.
+func pickCheckpoint(vmName string, snapshots []Snapshot, name string) (Snapshot, error) {
+	if name != "" {
+		for _, s := range snapshots {
+			if s.Name != name {
+				continue
+			}
+			if !s.IsCheckpoint() {
+				return Snapshot{}, fmt.Errorf("snapshot '%s' holds disk state only; use snapshot restore instead", name)
+			}
+			return s, nil
+		}
+		return Snapshot{}, fmt.Errorf("checkpoint '%s' not found on VM '%s'", name, vmName)
+	}
+
+	var latest Snapshot
+	for _, s := range snapshots {
+		if s.IsCheckpoint() && (latest.Name == "" || s.CreatedAt.After(latest.CreatedAt)) {
+			latest = s
+		}
+	}
+	if latest.Name == "" {
+		return Snapshot{}, fmt.Errorf("checkpoint not found: VM '%s' has no checkpoints", vmName)
+	}
+	return latest, nil
+}
+
+// monitorCommand runs an HMP command that prints nothing on success, such
+// as savevm and loadvm, and turns any output into an error.
+func (p *QemuProvider) monitorCommand(vmName, line string) error {
+	client, err := p.dialQMP(vmName, time.Second)
+	if err != nil {
+		return fmt.Errorf("monitor unavailable: %w", err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), checkpointTimeout)
+	defer cancel()
+	out, err := client.HumanMonitorCommand(ctx, line)
+	if err != nil {
+		return err
+	}
+	if msg := strings.TrimSpace(out); msg != "" {
+		return fmt.Errorf("%s", msg)
+	}
+	return nil
+}
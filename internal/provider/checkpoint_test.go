@@ -0,0 +1,29 @@
+package provider
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPickCheckpoint(t *testing.T) {
+	base := time.Unix(1700000000, 0)
+	snapshots := []Snapshot{
+		{Name: "disk-only", CreatedAt: base.Add(3 * time.Hour)},
+		{Name: "warm", CreatedAt: base, VMStateSize: 512 << 20},
+		{Name: "warmer", CreatedAt: base.Add(time.Hour), VMStateSize: 512 << 20},
+	}
+
+	if got, err := pickCheckpoint("vm1", snapshots, ""); err != nil || got.Name != "warmer" {
+		t.Fatalf("latest = %q, %v; want warmer", got.Name, err)
+	}
+	if got, err := pickCheckpoint("vm1", snapshots, "warm"); err != nil || got.Name != "warm" {
+		t.Fatalf("named = %q, %v; want warm", got.Name, err)
+	}
+	if _, err := pickCheckpoint("vm1", snapshots, "disk-only"); err == nil || !strings.Contains(err.Error(), "disk state only") {
+		t.Fatalf("disk-only snapshot: err = %v", err)
+	}
+	if _, err := pickCheckpoint("vm1", snapshots[:1], ""); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("no checkpoints: err = %v", err)
+	}
+}
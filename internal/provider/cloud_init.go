@@ -131,14 +131,52 @@ func (c *CloudInit) buildCloudConfigUserData() string {
 		userData += fmt.Sprintf("    %s:nido\n", c.User)
 		userData += "  expire: false\n"
 	}
+	// qemu-guest-agent answers on the virtio-serial channel from buildQemuArgs.
+	userData += "packages:\n"
+	userData += "  - qemu-guest-agent\n"
+	// growpart and resize_rootfs run on every boot, picking up disks grown
+	// with nido disk resize.
+	userData += "growpart:\n"
+	userData += "  mode: auto\n"
+	userData += "  devices: ['/']\n"
+	userData += "resize_rootfs: true\n"
+	// nido-mounts mounts the 9p shares from mountArgs on every boot, so
+	// shares added after first boot need no new cloud-init run.
+	userData += "write_files:\n"
+	userData += "  - path: /usr/local/sbin/nido-mounts\n"
+	userData += "    permissions: '0755'\n"
+	userData += "    content: |\n"
+	userData += indentLines(nidoMountsScript, "      ")
+	userData += "  - path: /etc/systemd/system/nido-mounts.service\n"
+	userData += "    content: |\n"
+	userData += indentLines(nidoMountsUnit, "      ")
 	userData += "\n"
 	userData += "runcmd:\n"
 	userData += "  - if [ -f /etc/default/grub ]; then sed -i 's/GRUB_TIMEOUT=[0-9]*/GRUB_TIMEOUT=0/' /etc/default/grub && (update-grub || grub-mkconfig -o /boot/grub/grub.cfg); fi\n"
 	userData += "  - if [ -f /boot/extlinux.conf ]; then sed -i 's/^TIMEOUT [0-9]*/TIMEOUT 0/' /boot/extlinux.conf; fi\n"
+	userData += "  - if command -v systemctl >/dev/null 2>&1; then systemctl enable --now qemu-guest-agent; elif command -v rc-update >/dev/null 2>&1; then rc-update add qemu-guest-agent default && rc-service qemu-guest-agent start; fi\n"
+	userData += "  - if command -v systemctl >/dev/null 2>&1; then systemctl daemon-reload; systemctl enable --now nido-mounts.service; else mkdir -p /etc/local.d && ln -sf /usr/local/sbin/nido-mounts /etc/local.d/nido-mounts.start && /usr/local/sbin/nido-mounts; fi\n"
 	userData += fmt.Sprintf("  - if [ -x /usr/bin/doas ]; then mkdir -p /etc/doas.d && echo \"permit nopass %s as root\" > /etc/doas.d/nido.conf && chmod 0400 /etc/doas.d/nido.conf; fi\n", c.User)
 	return userData
 }
 
+func indentLines(text, prefix string) string {
+	var b strings.Builder
+	for _, line := range strings.SplitAfter(text, "\n") {
+		if line == "" {
+			continue
+		}
+		b.WriteString(prefix)
+		b.WriteString(line)
+	}
+	return b.String()
+}
+
+// cloudConfigMergeType makes cloud-init append the lists and add the keys of
+// a later cloud-config part instead of replacing them, so custom runcmd,
+// write_files or packages do not drop the ones nido needs.
+const cloudConfigMergeType = "list(append)+dict(no_replace,recurse_list)+str()"
+
 func buildMultipartUserData(baseCloudConfig, custom string) string {
 	const boundary = "===============NIDO_USER_DATA_BOUNDARY=="
 
@@ -152,13 +190,18 @@ func buildMultipartUserData(baseCloudConfig, custom string) string {
 	b.WriteString("MIME-Version: 1.0\n")
 	b.WriteString(fmt.Sprintf("Content-Type: multipart/mixed; boundary=\"%s\"\n\n", boundary))
 	b.WriteString(fmt.Sprintf("--%s\n", boundary))
-	b.WriteString("Content-Type: text/cloud-config; charset=\"us-ascii\"\n\n")
+	b.WriteString("Content-Type: text/cloud-config; charset=\"us-ascii\"\n")
+	b.WriteString(fmt.Sprintf("Merge-Type: %s\n\n", cloudConfigMergeType))
 	b.WriteString(baseCloudConfig)
 	if !strings.HasSuffix(baseCloudConfig, "\n") {
 		b.WriteString("\n")
 	}
 	b.WriteString(fmt.Sprintf("\n--%s\n", boundary))
-	b.WriteString(fmt.Sprintf("Content-Type: %s; charset=\"us-ascii\"\n\n", contentType))
+	b.WriteString(fmt.Sprintf("Content-Type: %s; charset=\"us-ascii\"\n", contentType))
+	if contentType == "text/cloud-config" {
+		b.WriteString(fmt.Sprintf("Merge-Type: %s\n", cloudConfigMergeType))
+	}
+	b.WriteString("\n")
 	b.WriteString(custom)
 	if !strings.HasSuffix(custom, "\n") {
 		b.WriteString("\n")
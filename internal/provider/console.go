@@ -0,0 +1,163 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/Josepavese/nido/internal/serial"
+)
+
+// serialLogMaxBytes caps each serial log file; one rotated copy is kept.
+const serialLogMaxBytes = 1 << 20
+
+var errConsoleUnavailable = errors.New("serial console is not available on this host")
+
+// serialArgs wires the first serial port. On Unix it is a socket owned by
+// the serial relay; Windows QEMU writes straight to the log file.
+func serialArgs(runDir, name string) []string {
+	if runtime.GOOS == "windows" {
+		return []string{"-serial", "file:" + filepath.Join(runDir, name+".serial.log")}
+	}
+	return []string{
+		"-chardev", "socket,id=serial0,path=" + filepath.Join(runDir, name+".serial") + ",server=on,wait=off",
+		"-serial", "chardev:serial0",
+	}
+}
+
+func (p *QemuProvider) serialSocketPath(name string) string {
+	return filepath.Join(p.RootDir, "run", name+".serial")
+}
+
+func (p *QemuProvider) consoleSocketPath(name string) string {
+	return filepath.Join(p.RootDir, "run", name+".console")
+}
+
+func (p *QemuProvider) serialLogPath(name string) string {
+	return filepath.Join(p.RootDir, "run", name+".serial.log")
+}
+
+// RunSerialRelay holds the VM's serial port until QEMU exits, logging its
+// output and serving console clients. It is the body of the detached
+// 'nido serial-relay' process started with the VM.
+func (p *QemuProvider) RunSerialRelay(name string) error {
+	if runtime.GOOS == "windows" {
+		return errConsoleUnavailable
+	}
+	log, err := serial.NewLogWriter(p.serialLogPath(name), serialLogMaxBytes)
+	if err != nil {
+		return err
+	}
+	defer log.Close()
+	relay := &serial.Relay{
+		SerialSocket:  p.serialSocketPath(name),
+		ConsoleSocket: p.consoleSocketPath(name),
+		Log:           log,
+	}
+	return relay.Run(10 * time.Second)
+}
+
+// startSerialRelay launches the relay in the background, detached from the
+// calling CLI so it lives as long as the VM.
+func (p *QemuProvider) startSerialRelay(name string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(exe, "serial-relay", name)
+	cmd.SysProcAttr = daemonSysProcAttr()
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go func() { _ = cmd.Wait() }()
+	return nil
+}
+
+func consoleListening(path string) bool {
+	c, err := net.DialTimeout("unix", path, time.Second)
+	if err != nil {
+		return false
+	}
+	c.Close()
+	return true
+}
+
+// ConsoleSocket returns the console socket of a running VM, restarting the
+// relay if it is gone (e.g. the VM was started by an older nido).
+func (p *QemuProvider) ConsoleSocket(name string) (string, error) {
+	if runtime.GOOS == "windows" {
+		return "", errConsoleUnavailable
+	}
+	if _, err := p.loadState(name); err != nil {
+		return "", err
+	}
+	if !p.vmAlive(name) {
+		return "", fmt.Errorf("VM '%s' is not running", name)
+	}
+	path := p.consoleSocketPath(name)
+	if consoleListening(path) {
+		return path, nil
+	}
+	if _, err := os.Stat(p.serialSocketPath(name)); err != nil {
+		return "", fmt.Errorf("VM '%s' was started without a serial socket; restart it to use the console", name)
+	}
+	if err := p.startSerialRelay(name); err != nil {
+		return "", fmt.Errorf("failed to start serial relay: %w", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !consoleListening(path) {
+		if time.Now().After(deadline) {
+			return "", fmt.Errorf("serial console of VM '%s' did not come up", name)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return path, nil
+}
+
+// ParseSince reads a log lower bound given as a duration ago (10m) or an
+// RFC3339 time. Empty means no bound.
+func ParseSince(raw string, now time.Time) (time.Time, error) {
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(raw); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("%q is neither a duration like 10m nor an RFC3339 time", raw)
+}
+
+// Logs emits the serial log of a VM. With opts.Follow it keeps emitting new
+// lines until the VM stops.
+func (p *QemuProvider) Logs(name string, opts LogOptions, emit func(LogLine)) error {
+	if _, err := p.loadState(name); err != nil {
+		return err
+	}
+	path := p.serialLogPath(name)
+	offset := serial.Size(path)
+	lines, err := serial.ReadLog(path, opts.Since)
+	if err != nil {
+		return err
+	}
+	if opts.Tail > 0 && len(lines) > opts.Tail {
+		lines = lines[len(lines)-opts.Tail:]
+	}
+	for _, l := range lines {
+		emit(LogLine{Time: l.Time, Text: l.Text})
+	}
+	if !opts.Follow {
+		return nil
+	}
+	alive := func() bool { return p.vmAlive(name) }
+	return serial.Follow(context.Background(), path, offset, alive, func(l serial.Line) {
+		emit(LogLine{Time: l.Time, Text: l.Text})
+	})
+}
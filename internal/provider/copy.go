@@ -0,0 +1,335 @@
+package provider
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrCopyTooLarge is returned when a copy exceeds CopyOptions.MaxBytes.
+var ErrCopyTooLarge = errors.New("copy exceeds the size limit")
+
+// Upload copies a host file or directory tree into the VM. Like cp, an
+// existing guest directory receives the source under its own name; any
+// other guest path becomes the copy itself. Permissions and mtimes are kept.
+func (p *QemuProvider) Upload(name, hostPath, guestPath string, opts CopyOptions) (CopyResult, error) {
+	start := time.Now()
+	srcInfo, err := os.Stat(hostPath)
+	if err != nil {
+		return CopyResult{}, err
+	}
+	if guestPath == "" {
+		return CopyResult{}, fmt.Errorf("guest path cannot be empty")
+	}
+
+	target := guestPath
+	if !opts.NoTargetDirectory {
+		if _, err := p.sshRun(context.Background(), name, "test -d "+shellQuote(guestPath), nil, io.Discard); err == nil {
+			target = path.Join(guestPath, filepath.Base(hostPath))
+		}
+	}
+	parent, base := path.Dir(target), path.Base(target)
+
+	var total int64
+	if srcInfo.IsDir() {
+		_ = filepath.WalkDir(hostPath, func(_ string, d fs.DirEntry, err error) error {
+			if err == nil && d.Type().IsRegular() {
+				if info, err := d.Info(); err == nil {
+					total += info.Size()
+				}
+			}
+			return nil
+		})
+	} else {
+		total = srcInfo.Size()
+	}
+
+	pr, pw := io.Pipe()
+	counter := &copyCounter{total: total, onProgress: opts.OnProgress}
+	type archiveResult struct {
+		files int
+		err   error
+	}
+	done := make(chan archiveResult, 1)
+	go func() {
+		files, err := writeTar(pw, hostPath, base, counter)
+		pw.CloseWithError(err)
+		done <- archiveResult{files, err}
+	}()
+
+	remote := "mkdir -p " + shellQuote(parent) + " && tar -xpf - -C " + shellQuote(parent)
+	_, sshErr := p.sshRun(context.Background(), name, remote, pr, io.Discard)
+	// Unblock the archiver if the remote side stopped reading early.
+	pr.Close()
+	out := <-done
+	if sshErr != nil {
+		return CopyResult{}, fmt.Errorf("upload to VM '%s' failed: %w", name, sshErr)
+	}
+	if out.err != nil && !errors.Is(out.err, io.ErrClosedPipe) {
+		return CopyResult{}, fmt.Errorf("upload to VM '%s' failed: %w", name, out.err)
+	}
+	return CopyResult{Target: target, Files: out.files, Bytes: counter.current, DurationMS: time.Since(start).Milliseconds()}, nil
+}
+
+// Download copies a guest file or directory tree to the host, with the same
+// cp-style target rules as Upload.
+func (p *QemuProvider) Download(name, guestPath, hostPath string, opts CopyOptions) (CopyResult, error) {
+	start := time.Now()
+	if guestPath == "" || hostPath == "" {
+		return CopyResult{}, fmt.Errorf("source and destination paths are required")
+	}
+	guestPath = path.Clean(guestPath)
+
+	target := hostPath
+	if info, err := os.Stat(hostPath); err == nil && info.IsDir() && !opts.NoTargetDirectory {
+		target = filepath.Join(hostPath, path.Base(guestPath))
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return CopyResult{}, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pr, pw := io.Pipe()
+	type extractResult struct {
+		files int
+		bytes int64
+		err   error
+	}
+	done := make(chan extractResult, 1)
+	go func() {
+		counter := &copyCounter{limit: opts.MaxBytes, onProgress: opts.OnProgress}
+		files, err := extractTar(pr, filepath.Dir(target), path.Base(guestPath), filepath.Base(target), counter)
+		if errors.Is(err, ErrCopyTooLarge) {
+			// Stop the transfer rather than pulling the rest over ssh.
+			cancel()
+		}
+		// Drain so ssh never blocks on a reader that gave up.
+		_, _ = io.Copy(io.Discard, pr)
+		done <- extractResult{files, counter.current, err}
+	}()
+
+	remote := "tar -cpf - -C " + shellQuote(path.Dir(guestPath)) + " " + shellQuote(path.Base(guestPath))
+	_, sshErr := p.sshRun(ctx, name, remote, nil, pw)
+	pw.CloseWithError(sshErr)
+	out := <-done
+	if errors.Is(out.err, ErrCopyTooLarge) {
+		return CopyResult{}, fmt.Errorf("download from VM '%s' failed: %s: %w", name, guestPath, out.err)
+	}
+	if sshErr != nil {
+		return CopyResult{}, fmt.Errorf("download from VM '%s' failed: %w", name, sshErr)
+	}
+	if out.err != nil {
+		return CopyResult{}, fmt.Errorf("download from VM '%s' failed: %w", name, out.err)
+	}
+	return CopyResult{Target: target, Files: out.files, Bytes: out.bytes, DurationMS: time.Since(start).Milliseconds()}, nil
+}
+
+// sshRun runs a remote shell line on the VM, streaming stdin and stdout.
+// stderr is returned, and folded into the error when the command fails.
+func (p *QemuProvider) sshRun(ctx context.Context, name, remote string, stdin io.Reader, stdout io.Writer) (string, error) {
+	sshArgs, err := p.sshArgs(name)
+	if err != nil {
+		return "", err
+	}
+	args := []string{"-T", "-o", "BatchMode=yes", "-o", "LogLevel=ERROR", "-o", "ConnectTimeout=5"}
+	args = append(args, sshArgs[1:]...)
+	args = append(args, remote)
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, sshArgs[0], args...)
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			return "", err
+		}
+		return msg, fmt.Errorf("%v: %s", err, msg)
+	}
+	return stderr.String(), nil
+}
+
+// copyCounter tracks file payload bytes for progress reporting and, when
+// limit is positive, for CopyOptions.MaxBytes.
+type copyCounter struct {
+	current    int64
+	total      int64
+	limit      int64
+	onProgress func(current, total int64)
+}
+
+func (c *copyCounter) add(n int64) {
+	c.current += n
+	if c.onProgress != nil {
+		c.onProgress(c.current, c.total)
+	}
+}
+
+func (c *copyCounter) Write(b []byte) (int, error) {
+	c.add(int64(len(b)))
+	return len(b), nil
+}
+
+// writeTar archives src as base (and base/... for directories).
+func writeTar(w io.Writer, src, base string, counter *copyCounter) (int, error) {
+	tw := tar.NewWriter(w)
+	files := 0
+	err := filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = path.Join(base, filepath.ToSlash(rel))
+		if info.IsDir() {
+			hdr.Name += "/"
+		}
+		// Ownership is the guest user's; host uids mean nothing there.
+		hdr.Uid, hdr.Gid, hdr.Uname, hdr.Gname = 0, 0, "", ""
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if _, err := io.Copy(io.MultiWriter(tw, counter), f); err != nil {
+			return err
+		}
+		files++
+		return nil
+	})
+	if err != nil {
+		return files, err
+	}
+	return files, tw.Close()
+}
+
+// extractTar unpacks a stream whose entries live under srcBase into dir,
+// renaming that top-level entry to dstBase. Entries escaping dir, or
+// reaching through a symlink, are rejected.
+func extractTar(r io.Reader, dir, srcBase, dstBase string, counter *copyCounter) (int, error) {
+	tr := tar.NewReader(r)
+	files := 0
+	// Directory modes and times are applied last: a read-only directory
+	// must still receive its children, and each child bumps its mtime.
+	var dirs []*tar.Header
+	var dirPaths []string
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			for i := len(dirs) - 1; i >= 0; i-- {
+				_ = os.Chmod(dirPaths[i], os.FileMode(dirs[i].Mode).Perm())
+				_ = os.Chtimes(dirPaths[i], dirs[i].ModTime, dirs[i].ModTime)
+			}
+			return files, nil
+		}
+		if err != nil {
+			return files, err
+		}
+
+		name := path.Clean(strings.TrimPrefix(hdr.Name, "./"))
+		if name != srcBase && !strings.HasPrefix(name, srcBase+"/") {
+			return files, fmt.Errorf("unexpected archive entry %q", hdr.Name)
+		}
+		rel := strings.TrimPrefix(strings.TrimPrefix(name, srcBase), "/")
+		if rel == ".." || strings.HasPrefix(rel, "../") {
+			return files, fmt.Errorf("archive entry %q escapes the destination", hdr.Name)
+		}
+		dest := filepath.Join(dir, dstBase, filepath.FromSlash(rel))
+		if err := ensureNoSymlinkParents(dir, dest); err != nil {
+			return files, err
+		}
+
+		mode := os.FileMode(hdr.Mode).Perm()
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(dest, 0755); err != nil {
+				return files, err
+			}
+			dirs = append(dirs, hdr)
+			dirPaths = append(dirPaths, dest)
+		case tar.TypeReg:
+			if counter.limit > 0 && counter.current+hdr.Size > counter.limit {
+				return files, ErrCopyTooLarge
+			}
+			// Never write through a symlink an earlier entry planted.
+			if info, err := os.Lstat(dest); err == nil && info.Mode()&os.ModeSymlink != 0 {
+				_ = os.Remove(dest)
+			}
+			f, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+			if err != nil {
+				return files, err
+			}
+			_, err = io.Copy(io.MultiWriter(f, counter), tr)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				return files, err
+			}
+			_ = os.Chmod(dest, mode)
+			_ = os.Chtimes(dest, hdr.ModTime, hdr.ModTime)
+			files++
+		case tar.TypeSymlink:
+			_ = os.Remove(dest)
+			if err := os.Symlink(hdr.Linkname, dest); err != nil {
+				return files, err
+			}
+		default:
+			// Devices, fifos and hard links have no portable host equivalent.
+		}
+	}
+}
+
+// ensureNoSymlinkParents refuses to write through a symlink placed by an
+// earlier archive entry.
+func ensureNoSymlinkParents(root, dest string) error {
+	rel, err := filepath.Rel(root, filepath.Dir(dest))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+		return fmt.Errorf("archive entry %q escapes the destination", dest)
+	}
+	cur := root
+	for _, part := range strings.Split(rel, string(os.PathSeparator)) {
+		if part == "." || part == "" {
+			continue
+		}
+		cur = filepath.Join(cur, part)
+		if info, err := os.Lstat(cur); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("archive entry %q traverses symlink %s", dest, cur)
+		}
+	}
+	return nil
+}
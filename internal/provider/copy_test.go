@@ -0,0 +1,107 @@
+package provider
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestTarRoundTripRenamesAndKeepsModes(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "repo")
+	if err := os.MkdirAll(filepath.Join(src, "bin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "README"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "bin", "run.sh"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	files, err := writeTar(&buf, src, "repo", &copyCounter{})
+	if err != nil || files != 2 {
+		t.Fatalf("writeTar = %d, %v; want 2 files", files, err)
+	}
+
+	dst := t.TempDir()
+	counter := &copyCounter{}
+	files, err = extractTar(&buf, dst, "repo", "work", counter)
+	if err != nil || files != 2 {
+		t.Fatalf("extractTar = %d, %v; want 2 files", files, err)
+	}
+	if counter.current != int64(len("hello")+len("#!/bin/sh\n")) {
+		t.Fatalf("counted %d bytes", counter.current)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dst, "work", "README")); string(data) != "hello" {
+		t.Fatalf("README = %q", data)
+	}
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(filepath.Join(dst, "work", "bin", "run.sh"))
+		if err != nil || info.Mode().Perm() != 0755 {
+			t.Fatalf("run.sh mode = %v, %v; want 0755", info, err)
+		}
+	}
+}
+
+func TestExtractTarStopsAtLimit(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "big.log")
+	if err := os.WriteFile(src, []byte("0123456789"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err := writeTar(&buf, src, "big.log", &copyCounter{}); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := t.TempDir()
+	_, err := extractTar(&buf, dst, "big.log", "big.log", &copyCounter{limit: 4})
+	if !errors.Is(err, ErrCopyTooLarge) {
+		t.Fatalf("extractTar err = %v, want ErrCopyTooLarge", err)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "big.log")); !os.IsNotExist(err) {
+		t.Fatalf("oversized file was written: %v", err)
+	}
+}
+
+func TestExtractTarRejectsEscapes(t *testing.T) {
+	cases := map[string][]tar.Header{
+		"foreign root": {{Name: "other/file", Typeflag: tar.TypeReg}},
+		"dot-dot":      {{Name: "data/../../evil", Typeflag: tar.TypeReg}},
+		"via symlink": {
+			{Name: "data/", Typeflag: tar.TypeDir, Mode: 0755},
+			{Name: "data/link", Typeflag: tar.TypeSymlink, Linkname: "/tmp"},
+			{Name: "data/link/evil", Typeflag: tar.TypeReg},
+		},
+	}
+	for name, entries := range cases {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			tw := tar.NewWriter(&buf)
+			for _, hdr := range entries {
+				hdr := hdr
+				if err := tw.WriteHeader(&hdr); err != nil {
+					t.Fatal(err)
+				}
+			}
+			tw.Close()
+
+			dst := t.TempDir()
+			_, err := extractTar(&buf, dst, "data", "data", &copyCounter{})
+			if err == nil {
+				t.Fatal("expected extraction to be rejected")
+			}
+			if _, statErr := os.Stat(filepath.Join(filepath.Dir(dst), "evil")); statErr == nil {
+				t.Fatal("entry escaped the destination")
+			}
+			if !strings.Contains(err.Error(), "archive entry") {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
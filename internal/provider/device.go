@@ -0,0 +1,391 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Josepavese/nido/internal/qmp"
+)
+
+// usbControllerID is the xHCI controller usb-storage devices plug into. It is
+// only added to VMs that have USB devices.
+const usbControllerID = "nido-xhci"
+
+// deviceUnplugTimeout bounds how long DeviceRemove waits for the guest to
+// release a device before leaving the removal to the next boot.
+var deviceUnplugTimeout = 10 * time.Second
+
+// deviceIDPrefix names auto-assigned device IDs.
+var deviceIDPrefix = map[string]string{
+	DeviceDisk:       "disk",
+	DeviceNIC:        "nic",
+	DeviceUSBStorage: "usb",
+}
+
+// ValidateDevice checks the device type, its ID (when set) and that disk and
+// USB devices point at an existing image file.
+func ValidateDevice(d Device) error {
+	if _, ok := deviceIDPrefix[d.Type]; !ok {
+		return fmt.Errorf("unknown device type %q: use disk, nic or usb-storage", d.Type)
+	}
+	if d.ID != "" {
+		if len(d.ID) > 32 || !isASCIILetter(d.ID[0]) {
+			return fmt.Errorf("invalid device id %q: start with a letter, up to 32 characters", d.ID)
+		}
+		for _, r := range d.ID {
+			if !((r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '-' || r == '_') {
+				return fmt.Errorf("invalid device id %q: only alphanumeric, hyphens and underscores allowed", d.ID)
+			}
+		}
+	}
+	if d.Type == DeviceNIC {
+		if d.Source != "" {
+			return fmt.Errorf("nic devices take no image")
+		}
+		return nil
+	}
+	if d.Source == "" {
+		return fmt.Errorf("%s devices need an image file", d.Type)
+	}
+	info, err := os.Stat(d.Source)
+	if err != nil {
+		return fmt.Errorf("device image %s: %w", d.Source, err)
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("device image %s is not a regular file", d.Source)
+	}
+	return nil
+}
+
+func isASCIILetter(b byte) bool {
+	return (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z')
+}
+
+// QEMU object names derived from a device ID. Each lives in its own
+// namespace, the prefix keeps them clear of the IDs Nido uses elsewhere.
+func deviceQemuID(id string) string   { return "nido-" + id }
+func deviceNodeName(id string) string { return "nido-" + id + "-blk" }
+func deviceNetdevID(id string) string { return "nido-" + id + "-net" }
+
+// deviceImageFormat picks the block driver from the image extension.
+func deviceImageFormat(source string) string {
+	if strings.EqualFold(filepath.Ext(source), ".qcow2") {
+		return "qcow2"
+	}
+	return "raw"
+}
+
+// deviceFrontend returns the -device properties for d, as used both on the
+// command line and by device_add.
+func deviceFrontend(d Device) map[string]interface{} {
+	props := map[string]interface{}{"id": deviceQemuID(d.ID)}
+	switch d.Type {
+	case DeviceDisk:
+		props["driver"] = "virtio-blk-pci"
+		props["drive"] = deviceNodeName(d.ID)
+	case DeviceUSBStorage:
+		props["driver"] = "usb-storage"
+		props["bus"] = usbControllerID + ".0"
+		props["drive"] = deviceNodeName(d.ID)
+	case DeviceNIC:
+		props["driver"] = "virtio-net-pci"
+		props["netdev"] = deviceNetdevID(d.ID)
+	}
+	return props
+}
+
+// deviceArgs recreates persisted devices at boot with the same IDs a live
+// hotplug would use, so DeviceRemove works either way.
+func deviceArgs(devices []Device) []string {
+	var args []string
+	for _, d := range devices {
+		if d.Type == DeviceUSBStorage {
+			args = append(args, "-device", "qemu-xhci,id="+usbControllerID)
+			break
+		}
+	}
+	for _, d := range devices {
+		front := deviceFrontend(d)
+		switch d.Type {
+		case DeviceDisk, DeviceUSBStorage:
+			node := fmt.Sprintf("driver=%s,node-name=%s,file.driver=file,file.filename=%s", deviceImageFormat(d.Source), deviceNodeName(d.ID), qemuOptEscape(d.Source))
+			if d.ReadOnly {
+				node += ",read-only=on"
+			}
+			args = append(args, "-blockdev", node)
+			if d.Type == DeviceDisk {
+				args = append(args, "-device", fmt.Sprintf("virtio-blk-pci,drive=%s,id=%s", front["drive"], front["id"]))
+			} else {
+				args = append(args, "-device", fmt.Sprintf("usb-storage,bus=%s,drive=%s,id=%s", front["bus"], front["drive"], front["id"]))
+			}
+		case DeviceNIC:
+			args = append(args,
+				"-netdev", "user,id="+deviceNetdevID(d.ID),
+				"-device", fmt.Sprintf("virtio-net-pci,netdev=%s,id=%s", front["netdev"], front["id"]),
+			)
+		}
+	}
+	return args
+}
+
+// nextDeviceID returns the first free "<prefix>N" ID.
+func nextDeviceID(devices []Device, typ string) string {
+	used := map[string]bool{}
+	for _, d := range devices {
+		used[d.ID] = true
+	}
+	for i := 0; ; i++ {
+		id := fmt.Sprintf("%s%d", deviceIDPrefix[typ], i)
+		if !used[id] {
+			return id
+		}
+	}
+}
+
+// checkDeviceImage refuses an image QEMU would otherwise open a second time
+// with a writer: a volume, the root disk of another VM, or a device of
+// another VM unless both sides are read-only. The caller holds the lock of
+// VM name, so other VMs are read with readState.
+func (p *QemuProvider) checkDeviceImage(name string, d Device) error {
+	if d.Source == "" {
+		return nil
+	}
+	src, err := os.Stat(d.Source)
+	if err != nil {
+		return fmt.Errorf("device image %s: %w", d.Source, err)
+	}
+	same := func(path string) bool {
+		info, err := os.Stat(path)
+		return err == nil && os.SameFile(src, info)
+	}
+	volumes, _ := filepath.Glob(filepath.Join(p.volumesDir(), "*.qcow2"))
+	for _, path := range volumes {
+		if same(path) {
+			return fmt.Errorf("%s is volume '%s'; attach it with 'nido volume attach'", d.Source, strings.TrimSuffix(filepath.Base(path), ".qcow2"))
+		}
+	}
+	for _, other := range p.vmNames() {
+		if other == name {
+			continue
+		}
+		if same(filepath.Join(p.RootDir, "vms", other+".qcow2")) {
+			return fmt.Errorf("%s is the root disk of VM '%s'", d.Source, other)
+		}
+		state, err := p.readState(other)
+		if err != nil {
+			continue
+		}
+		for _, od := range state.Devices {
+			if od.Source != "" && same(od.Source) && !(d.ReadOnly && od.ReadOnly) {
+				return fmt.Errorf("%s is already attached to VM '%s' as device '%s'", d.Source, other, od.ID)
+			}
+		}
+	}
+	return nil
+}
+
+// bootDevices drops the devices whose unplug never completed; a fresh QEMU
+// process does not have them.
+func bootDevices(devices []Device) []Device {
+	var out []Device
+	for _, d := range devices {
+		if !d.Removing {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// DeviceAdd plugs a device into the VM. Running VMs get it through QMP
+// first; the state is only written once the hotplug succeeded.
+func (p *QemuProvider) DeviceAdd(name string, d Device) (Device, ApplyMode, error) {
+	if d.Source != "" {
+		abs, err := filepath.Abs(d.Source)
+		if err != nil {
+			return Device{}, "", err
+		}
+		d.Source = abs
+	}
+	if err := ValidateDevice(d); err != nil {
+		return Device{}, "", err
+	}
+	diskPath, err := p.vmDiskPath(name)
+	if err != nil {
+		return Device{}, "", err
+	}
+	if d.Source == diskPath {
+		return Device{}, "", fmt.Errorf("the root disk of VM '%s' cannot be added as a device", name)
+	}
+	// The VM lock is held across the hotplug so concurrent adds cannot
+	// pick the same ID.
+	mode := AppliedNextBoot
+	_, err = p.updateState(name, func(state *VMState) error {
+		if d.ID == "" {
+			d.ID = nextDeviceID(state.Devices, d.Type)
+		}
+		for _, existing := range state.Devices {
+			if existing.ID == d.ID {
+				return fmt.Errorf("device '%s' already exists on VM '%s'", d.ID, name)
+			}
+		}
+		if err := p.checkDeviceImage(name, d); err != nil {
+			return err
+		}
+
+		if p.vmAlive(name) {
+			client, err := p.dialQMP(name, time.Second)
+			if err != nil {
+				return fmt.Errorf("VM '%s' is running but its monitor is unavailable: %w", name, err)
+			}
+			defer client.Close()
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			if err := hotplugDevice(ctx, client, d); err != nil {
+				return fmt.Errorf("failed to hot-add device '%s' to VM '%s': %w", d.ID, name, err)
+			}
+			mode = AppliedLive
+		}
+
+		state.Devices = append(state.Devices, d)
+		return nil
+	})
+	if err != nil {
+		return Device{}, "", err
+	}
+	return d, mode, nil
+}
+
+// DeviceRemove unplugs a device. If the guest does not release it within
+// deviceUnplugTimeout the device stays in the state marked Removing, since
+// QEMU still holds it and its ID, and disappears on the next boot instead.
+// Removing it again retries the unplug.
+func (p *QemuProvider) DeviceRemove(name, id string) (ApplyMode, error) {
+	if _, err := p.vmDiskPath(name); err != nil {
+		return "", err
+	}
+	mode := AppliedNextBoot
+	_, err := p.updateState(name, func(state *VMState) error {
+		idx := -1
+		for i, d := range state.Devices {
+			if d.ID == id {
+				idx = i
+				break
+			}
+		}
+		if idx < 0 {
+			return fmt.Errorf("device '%s' not found on VM '%s'", id, name)
+		}
+		d := state.Devices[idx]
+
+		if p.vmAlive(name) {
+			client, err := p.dialQMP(name, time.Second)
+			if err != nil {
+				return fmt.Errorf("VM '%s' is running but its monitor is unavailable: %w", name, err)
+			}
+			defer client.Close()
+			ctx, cancel := context.WithTimeout(context.Background(), deviceUnplugTimeout+5*time.Second)
+			defer cancel()
+			live, err := unplugDevice(ctx, client, d)
+			if err != nil {
+				return fmt.Errorf("failed to remove device '%s' from VM '%s': %w", id, name, err)
+			}
+			if !live {
+				state.Devices[idx].Removing = true
+				return nil
+			}
+			mode = AppliedLive
+		}
+
+		state.Devices = append(state.Devices[:idx], state.Devices[idx+1:]...)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return mode, nil
+}
+
+// hotplugDevice creates the backend and then the guest-visible device,
+// rolling the backend back if device_add fails.
+func hotplugDevice(ctx context.Context, client *qmp.Client, d Device) error {
+	var rollback func()
+	switch d.Type {
+	case DeviceDisk, DeviceUSBStorage:
+		if d.Type == DeviceUSBStorage {
+			err := client.DeviceAdd(ctx, map[string]interface{}{"driver": "qemu-xhci", "id": usbControllerID})
+			var qerr *qmp.Error
+			if err != nil && !(errors.As(err, &qerr) && strings.Contains(qerr.Desc, "Duplicate")) {
+				return err
+			}
+		}
+		err := client.BlockdevAdd(ctx, map[string]interface{}{
+			"driver":    deviceImageFormat(d.Source),
+			"node-name": deviceNodeName(d.ID),
+			"read-only": d.ReadOnly,
+			"file":      map[string]interface{}{"driver": "file", "filename": d.Source},
+		})
+		if err != nil {
+			return err
+		}
+		rollback = func() { _ = client.BlockdevDel(ctx, deviceNodeName(d.ID)) }
+	case DeviceNIC:
+		if err := client.NetdevAdd(ctx, map[string]interface{}{"type": "user", "id": deviceNetdevID(d.ID)}); err != nil {
+			return err
+		}
+		rollback = func() { _ = client.NetdevDel(ctx, deviceNetdevID(d.ID)) }
+	}
+	if err := client.DeviceAdd(ctx, deviceFrontend(d)); err != nil {
+		rollback()
+		return err
+	}
+	return nil
+}
+
+// unplugDevice removes the device and, once the guest released it, its
+// backend. It reports false when the guest did not answer in time.
+func unplugDevice(ctx context.Context, client *qmp.Client, d Device) (bool, error) {
+	qid := deviceQemuID(d.ID)
+	if err := client.DeviceDel(ctx, qid); err != nil {
+		var qerr *qmp.Error
+		// The running VM no longer has the device (the guest ejected it,
+		// or released it after an earlier unplug timed out); only the
+		// backend may be left.
+		if !(errors.As(err, &qerr) && strings.Contains(qerr.Desc, "not found")) {
+			return false, err
+		}
+	} else if !waitDeviceDeleted(ctx, client, qid) {
+		return false, nil
+	}
+	switch d.Type {
+	case DeviceDisk, DeviceUSBStorage:
+		_ = client.BlockdevDel(ctx, deviceNodeName(d.ID))
+	case DeviceNIC:
+		_ = client.NetdevDel(ctx, deviceNetdevID(d.ID))
+	}
+	return true, nil
+}
+
+// waitDeviceDeleted waits up to deviceUnplugTimeout for the guest to release
+// the device with the given qdev id.
+func waitDeviceDeleted(ctx context.Context, client *qmp.Client, qid string) bool {
+	ctx, cancel := context.WithTimeout(ctx, deviceUnplugTimeout)
+	defer cancel()
+	for {
+		ev, err := client.WaitEvent(ctx, qmp.EventDeviceDeleted)
+		if err != nil {
+			return false
+		}
+		var data struct {
+			Device string `json:"device"`
+		}
+		if json.Unmarshal(ev.Data, &data) == nil && data.Device == qid {
+			return true
+		}
+	}
+}
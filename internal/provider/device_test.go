@@ -0,0 +1,132 @@
+package provider
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Josepavese/nido/internal/config"
+)
+
+func TestDeviceArgs(t *testing.T) {
+	args := strings.Join(deviceArgs([]Device{
+		{ID: "disk0", Type: DeviceDisk, Source: "/img/a,b.qcow2"},
+		{ID: "stick", Type: DeviceUSBStorage, Source: "/img/stick.img", ReadOnly: true},
+		{ID: "nic0", Type: DeviceNIC},
+	}), " ")
+
+	for _, want := range []string{
+		"-device qemu-xhci,id=nido-xhci ",
+		"-blockdev driver=qcow2,node-name=nido-disk0-blk,file.driver=file,file.filename=/img/a,,b.qcow2 ",
+		"-device virtio-blk-pci,drive=nido-disk0-blk,id=nido-disk0",
+		"-blockdev driver=raw,node-name=nido-stick-blk,file.driver=file,file.filename=/img/stick.img,read-only=on ",
+		"-device usb-storage,bus=nido-xhci.0,drive=nido-stick-blk,id=nido-stick",
+		"-netdev user,id=nido-nic0-net -device virtio-net-pci,netdev=nido-nic0-net,id=nido-nic0",
+	} {
+		if !strings.Contains(args, want) {
+			t.Fatalf("device args missing %q:\n%s", want, args)
+		}
+	}
+	if len(deviceArgs([]Device{{ID: "nic0", Type: DeviceNIC}})) != 4 {
+		t.Fatal("USB controller added to a VM without USB devices")
+	}
+}
+
+func TestDeviceAddRemoveStoppedPersistsState(t *testing.T) {
+	root := t.TempDir()
+	p := &QemuProvider{RootDir: root, Config: &config.Config{}}
+	for _, f := range []string{"vms/vm.qcow2", "run/vm.json", "img/scratch.qcow2"} {
+		path := filepath.Join(root, f)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte("{}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	image := filepath.Join(root, "img", "scratch.qcow2")
+
+	for _, bad := range []Device{
+		{Type: "floppy"},
+		{Type: DeviceDisk},
+		{Type: DeviceNIC, Source: image},
+		{Type: DeviceDisk, Source: filepath.Join(root, "vms", "vm.qcow2")},
+		{ID: "0bad", Type: DeviceNIC},
+	} {
+		if _, _, err := p.DeviceAdd("vm", bad); err == nil {
+			t.Fatalf("DeviceAdd accepted %+v", bad)
+		}
+	}
+
+	dev, applied, err := p.DeviceAdd("vm", Device{Type: DeviceDisk, Source: image})
+	if err != nil || dev.ID != "disk0" || applied != AppliedNextBoot {
+		t.Fatalf("DeviceAdd = %+v, %s, %v", dev, applied, err)
+	}
+	if dev, _, _ := p.DeviceAdd("vm", Device{Type: DeviceDisk, Source: image, ReadOnly: true}); dev.ID != "disk1" {
+		t.Fatalf("second disk id = %q, want disk1", dev.ID)
+	}
+	if _, _, err := p.DeviceAdd("vm", Device{ID: "disk1", Type: DeviceNIC}); err == nil {
+		t.Fatal("DeviceAdd accepted a duplicate id")
+	}
+	if state, _ := p.loadState("vm"); len(state.Devices) != 2 || state.Devices[0].Source != image {
+		t.Fatalf("state after add = %+v", state.Devices)
+	}
+
+	if applied, err := p.DeviceRemove("vm", "disk0"); err != nil || applied != AppliedNextBoot {
+		t.Fatalf("DeviceRemove = %s, %v", applied, err)
+	}
+	if _, err := p.DeviceRemove("vm", "disk0"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("DeviceRemove of a missing device = %v", err)
+	}
+	if state, _ := p.loadState("vm"); len(state.Devices) != 1 || state.Devices[0].ID != "disk1" {
+		t.Fatalf("state after remove = %+v", state.Devices)
+	}
+}
+
+func TestDeviceAddRefusesImagesInUse(t *testing.T) {
+	root := t.TempDir()
+	p := &QemuProvider{RootDir: root, Config: &config.Config{}}
+	for _, f := range []string{"vms/vm.qcow2", "vms/other.qcow2", "volumes/data.qcow2", "img/shared.img"} {
+		path := filepath.Join(root, f)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	shared := filepath.Join(root, "img", "shared.img")
+	if err := p.writeState(VMState{Name: "vm"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.writeState(VMState{Name: "other", Devices: []Device{{ID: "disk0", Type: DeviceDisk, Source: shared, ReadOnly: true}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	for image, want := range map[string]string{
+		filepath.Join(root, "vms", "other.qcow2"):    "root disk of VM 'other'",
+		filepath.Join(root, "volumes", "data.qcow2"): "volume 'data'",
+		shared: "attached to VM 'other'",
+	} {
+		if _, _, err := p.DeviceAdd("vm", Device{Type: DeviceDisk, Source: image}); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("DeviceAdd(%s) = %v, want %q", image, err, want)
+		}
+	}
+	if _, _, err := p.DeviceAdd("vm", Device{Type: DeviceDisk, Source: shared, ReadOnly: true}); err != nil {
+		t.Fatalf("read-only share refused: %v", err)
+	}
+}
+
+func TestStartDropsDevicesPendingRemoval(t *testing.T) {
+	p := &QemuProvider{RootDir: t.TempDir(), Config: &config.Config{}}
+	if err := p.writeState(VMState{Name: "vm", Devices: []Device{{ID: "nic0", Type: DeviceNIC, Removing: true}, {ID: "nic1", Type: DeviceNIC}}}); err != nil {
+		t.Fatal(err)
+	}
+	state, err := p.prepareStart("vm", VMOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Devices) != 1 || state.Devices[0].ID != "nic1" {
+		t.Fatalf("devices at boot = %+v", state.Devices)
+	}
+	if saved, _ := p.loadState("vm"); len(saved.Devices) != 1 {
+		t.Fatalf("saved devices = %+v", saved.Devices)
+	}
+}
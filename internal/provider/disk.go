@@ -0,0 +1,119 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// diskSizeUnits are the binary multiples qemu-img accepts as size suffixes.
+var diskSizeUnits = map[byte]int64{
+	'K': 1 << 10,
+	'M': 1 << 20,
+	'G': 1 << 30,
+	'T': 1 << 40,
+}
+
+// ParseDiskSize resolves a disk size spec against the current virtual size.
+// "+20G" grows the disk by 20 GiB, "60G" sets it to 60 GiB; a bare number is
+// bytes. The result is rounded up to a 512-byte sector. Shrinking is left to
+// the caller to reject.
+func ParseDiskSize(spec string, current int64) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(spec))
+	relative := strings.HasPrefix(s, "+")
+	s = strings.TrimPrefix(s, "+")
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "B"), "I")
+
+	mult := int64(1)
+	if s != "" {
+		if m, ok := diskSizeUnits[s[len(s)-1]]; ok {
+			mult = m
+			s = s[:len(s)-1]
+		}
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || !(n > 0) || math.IsInf(n, 1) {
+		return 0, fmt.Errorf("invalid disk size %q: want a size like 40G or +20G", spec)
+	}
+	size := int64(n * float64(mult))
+	if relative {
+		size += current
+	}
+	return (size + 511) &^ 511, nil
+}
+
+// ValidateDiskSize checks the syntax of a disk size spec.
+func ValidateDiskSize(spec string) error {
+	_, err := ParseDiskSize(spec, 0)
+	return err
+}
+
+// diskResizeTarget resolves spec and refuses to shrink: qcow2 shrinking
+// would cut off guest partitions. ok is false when the disk already has the
+// requested size.
+func diskResizeTarget(spec string, current int64) (target int64, ok bool, err error) {
+	target, err = ParseDiskSize(spec, current)
+	if err != nil {
+		return 0, false, err
+	}
+	if target < current {
+		return 0, false, fmt.Errorf("shrinking disks is not supported (disk is %d bytes, requested %d)", current, target)
+	}
+	return target, target != current, nil
+}
+
+// resizeDisk grows the VM root disk. A running VM is resized through QMP
+// block_resize, since QEMU holds the image lock; otherwise qemu-img resizes
+// the file. The guest grows its partition and filesystem on next boot.
+func (p *QemuProvider) resizeDisk(name, spec string) error {
+	diskPath, err := p.vmDiskPath(name)
+	if err != nil {
+		return err
+	}
+
+	if p.vmAlive(name) {
+		client, err := p.dialQMP(name, time.Second)
+		if err != nil {
+			return fmt.Errorf("VM '%s' is running but its monitor is unavailable: %w", name, err)
+		}
+		defer client.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		block, err := rootBlock(ctx, client, diskPath)
+		if err != nil {
+			return err
+		}
+		target, ok, err := diskResizeTarget(spec, block.Inserted.Image.VirtualSize)
+		if err != nil || !ok {
+			return err
+		}
+		if err := client.BlockResize(ctx, block.Device, block.Inserted.NodeName, target); err != nil {
+			return fmt.Errorf("failed to resize disk of VM '%s': %w", name, err)
+		}
+		return nil
+	}
+
+	out, err := runQemuImg("info", "-U", "--output=json", diskPath)
+	if err != nil {
+		return err
+	}
+	var info struct {
+		VirtualSize int64 `json:"virtual-size"`
+	}
+	if err := json.Unmarshal(out, &info); err != nil || info.VirtualSize == 0 {
+		return fmt.Errorf("failed to read disk size of VM '%s'", name)
+	}
+	target, ok, err := diskResizeTarget(spec, info.VirtualSize)
+	if err != nil || !ok {
+		return err
+	}
+	if _, err := runQemuImg("resize", "-f", "qcow2", diskPath, strconv.FormatInt(target, 10)); err != nil {
+		return fmt.Errorf("failed to resize disk of VM '%s': %w", name, err)
+	}
+	return nil
+}
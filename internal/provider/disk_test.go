@@ -0,0 +1,54 @@
+package provider
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseDiskSize(t *testing.T) {
+	const gib = int64(1 << 30)
+	cases := []struct {
+		spec    string
+		current int64
+		want    int64
+	}{
+		{"+20G", 20 * gib, 40 * gib},
+		{"60G", 20 * gib, 60 * gib},
+		{"60GiB", 0, 60 * gib},
+		{"1.5T", 0, 1536 * gib},
+		{"+512m", gib, gib + 512<<20},
+		{"1000", 0, 1024},
+	}
+	for _, tc := range cases {
+		got, err := ParseDiskSize(tc.spec, tc.current)
+		if err != nil || got != tc.want {
+			t.Fatalf("ParseDiskSize(%q, %d) = %d, %v; want %d", tc.spec, tc.current, got, err, tc.want)
+		}
+	}
+
+	for _, bad := range []string{"", "+", "G", "-5G", "0", "20X", "nan", "inf"} {
+		if _, err := ParseDiskSize(bad, gib); err == nil {
+			t.Fatalf("ParseDiskSize(%q) accepted an invalid size", bad)
+		}
+	}
+}
+
+func TestDiskResizeTargetRejectsShrink(t *testing.T) {
+	const gib = int64(1 << 30)
+	if _, _, err := diskResizeTarget("10G", 20*gib); err == nil {
+		t.Fatal("expected shrinking to be rejected")
+	}
+	if _, ok, err := diskResizeTarget("20G", 20*gib); err != nil || ok {
+		t.Fatalf("same size: ok = %v, err = %v; want a no-op", ok, err)
+	}
+	if target, ok, err := diskResizeTarget("+1G", 20*gib); err != nil || !ok || target != 21*gib {
+		t.Fatalf("grow: target = %d, ok = %v, err = %v", target, ok, err)
+	}
+}
+
+func TestCloudInitGrowsRootPartition(t *testing.T) {
+	userData := (&CloudInit{User: "vmuser"}).buildUserData()
+	if !strings.Contains(userData, "growpart:\n  mode: auto\n  devices: ['/']\nresize_rootfs: true\n") {
+		t.Fatalf("cloud-config does not grow the root partition:\n%s", userData)
+	}
+}
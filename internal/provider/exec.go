@@ -0,0 +1,146 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// execTimeoutExitCode mirrors coreutils timeout(1) for commands we abort.
+const execTimeoutExitCode = 124
+
+// Exec runs command over SSH without a shell or TTY: arguments reach the
+// guest verbatim, so pipelines need an explicit `sh -c`. On timeout the
+// local ssh is killed; the guest process may outlive it.
+func (p *QemuProvider) Exec(name string, command []string, opts ExecOptions) (ExecResult, error) {
+	remote, err := buildRemoteCommand(command, opts)
+	if err != nil {
+		return ExecResult{}, err
+	}
+	sshArgs, err := p.sshArgs(name)
+	if err != nil {
+		return ExecResult{}, err
+	}
+	args := []string{
+		"-T",
+		"-o", "BatchMode=yes",
+		"-o", "NumberOfPasswordPrompts=0",
+		"-o", "LogLevel=ERROR",
+		"-o", "ConnectTimeout=5",
+	}
+	args = append(args, sshArgs[1:]...)
+	args = append(args, remote)
+
+	ctx := context.Background()
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, sshArgs[0], args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	start := time.Now()
+	runErr := cmd.Run()
+	res := ExecResult{
+		Stdout:     stdout.String(),
+		Stderr:     stderr.String(),
+		DurationMS: time.Since(start).Milliseconds(),
+	}
+
+	if ctx.Err() == context.DeadlineExceeded {
+		res.TimedOut = true
+		res.ExitCode = execTimeoutExitCode
+		return res, nil
+	}
+	var exitErr *exec.ExitError
+	switch {
+	case runErr == nil:
+	case errors.As(runErr, &exitErr):
+		res.ExitCode = exitErr.ExitCode()
+		// ssh reserves 255 for its own failures; a guest command can exit
+		// 255 too, so only ssh's own messages count as connection errors.
+		if res.ExitCode == 255 && sshConnectionFailure(res.Stderr) {
+			return res, fmt.Errorf("ssh connection to VM '%s' failed: %s", name, strings.TrimSpace(res.Stderr))
+		}
+	default:
+		return res, fmt.Errorf("failed to run ssh: %w", runErr)
+	}
+	return res, nil
+}
+
+// sshConnectionMessages are the stderr fragments ssh prints when it never
+// got a session: auth and host key rejections, dropped transports.
+var sshConnectionMessages = []string{
+	"Permission denied (",
+	"Host key verification failed",
+	"Connection closed by",
+	"Connection reset by",
+}
+
+// sshConnectionFailure reports whether stderr carries one of ssh's own
+// connection errors rather than output from the guest command.
+func sshConnectionFailure(stderr string) bool {
+	for _, line := range strings.Split(stderr, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "ssh:") {
+			return true
+		}
+		for _, msg := range sshConnectionMessages {
+			if strings.Contains(line, msg) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// buildRemoteCommand renders command for the remote login shell, quoting
+// every word so nothing is expanded.
+func buildRemoteCommand(command []string, opts ExecOptions) (string, error) {
+	if len(command) == 0 {
+		return "", fmt.Errorf("no command given")
+	}
+	var words []string
+	if len(opts.Env) > 0 {
+		words = append(words, "env")
+		for _, kv := range opts.Env {
+			key, _, ok := strings.Cut(kv, "=")
+			if !ok || !validEnvKey(key) {
+				return "", fmt.Errorf("invalid environment entry %q: want KEY=VALUE", kv)
+			}
+			words = append(words, shellQuote(kv))
+		}
+	}
+	for _, w := range command {
+		words = append(words, shellQuote(w))
+	}
+	line := strings.Join(words, " ")
+	if opts.Workdir != "" {
+		line = "cd " + shellQuote(opts.Workdir) + " && " + line
+	}
+	return line, nil
+}
+
+func validEnvKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for i, r := range key {
+		if !(r == '_' || (r >= 'A' && r <= 'Z') || (r >= 'a' && r <= 'z') || (i > 0 && r >= '0' && r <= '9')) {
+			return false
+		}
+	}
+	return true
+}
+
+// shellQuote wraps s in single quotes for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
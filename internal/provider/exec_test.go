@@ -0,0 +1,75 @@
+package provider
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/Josepavese/nido/internal/config"
+)
+
+func TestBuildRemoteCommand(t *testing.T) {
+	got, err := buildRemoteCommand([]string{"echo", "it's $HOME"}, ExecOptions{
+		Env:     []string{"MODE=fast lane"},
+		Workdir: "/srv/app",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `cd '/srv/app' && env 'MODE=fast lane' 'echo' 'it'\''s $HOME'`
+	if got != want {
+		t.Fatalf("buildRemoteCommand =\n%s\nwant\n%s", got, want)
+	}
+
+	if _, err := buildRemoteCommand(nil, ExecOptions{}); err == nil {
+		t.Fatal("expected error for empty command")
+	}
+	if _, err := buildRemoteCommand([]string{"true"}, ExecOptions{Env: []string{"1BAD=x"}}); err == nil {
+		t.Fatal("expected error for invalid env key")
+	}
+}
+
+// fakeSSH puts an ssh on PATH that prints stderr and exits with code.
+func fakeSSH(t *testing.T, stderr string, code int) {
+	t.Helper()
+	dir := t.TempDir()
+	script := "#!/bin/sh\nprintf '%s\\n' \"" + stderr + "\" >&2\nexit " + fmt.Sprint(code) + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "ssh"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir)
+}
+
+func TestExecClassifiesSSHFailures(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ssh is a shell script")
+	}
+	p := &QemuProvider{RootDir: t.TempDir(), Config: &config.Config{}}
+	if err := p.writeState(VMState{Name: "vm1", PID: os.Getpid(), SSHPort: 2222, SSHUser: "vmuser"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, stderr := range []string{
+		"vmuser@127.0.0.1: Permission denied (publickey).",
+		"Host key verification failed.",
+		"Connection closed by 127.0.0.1 port 2222",
+		"kex_exchange_identification: read: Connection reset by peer",
+		"ssh: connect to host 127.0.0.1 port 2222: Connection refused",
+	} {
+		fakeSSH(t, stderr, 255)
+		if _, err := p.Exec("vm1", []string{"true"}, ExecOptions{}); err == nil {
+			t.Errorf("Exec with ssh stderr %q: expected connection error", stderr)
+		}
+	}
+
+	fakeSSH(t, "app: giving up", 255)
+	res, err := p.Exec("vm1", []string{"app"}, ExecOptions{})
+	if err != nil {
+		t.Fatalf("guest exit 255 reported as ssh failure: %v", err)
+	}
+	if res.ExitCode != 255 || res.Stderr != "app: giving up\n" {
+		t.Fatalf("Exec result = %+v", res)
+	}
+}
@@ -0,0 +1,233 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Josepavese/nido/internal/pkg/sysutil"
+	"github.com/Josepavese/nido/internal/qmp"
+)
+
+// forkBasesDir holds the read-only disk layers shared by forked VMs.
+func (p *QemuProvider) forkBasesDir() string {
+	return filepath.Join(p.RootDir, "vms", "bases")
+}
+
+// Fork freezes the VM disk into a shared base layer and spawns count linked
+// clones on top of it. The source keeps running on a fresh overlay; clones
+// boot from the frozen disk with their own ports, hostname and instance-id.
+// The base is crash-consistent: guest RAM is not copied.
+func (p *QemuProvider) Fork(vmName string, count int, prefix string) ([]string, error) {
+	if count < 1 {
+		return nil, fmt.Errorf("fork count must be at least 1")
+	}
+	diskPath, err := p.vmDiskPath(vmName)
+	if err != nil {
+		return nil, err
+	}
+	state, err := p.loadState(vmName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load state for VM '%s': %w", vmName, err)
+	}
+	if prefix == "" {
+		prefix = vmName + "-"
+	}
+	names := forkCloneNames(prefix, count)
+	for _, n := range names {
+		if _, err := os.Stat(filepath.Join(p.RootDir, "vms", n+".qcow2")); err == nil {
+			return nil, fmt.Errorf("VM '%s' already exists", n)
+		}
+	}
+
+	base, err := p.freezeDisk(vmName, diskPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Spawn copies kernel/initrd found next to its template.
+	vmsDir := filepath.Join(p.RootDir, "vms")
+	baseStem := strings.TrimSuffix(base, ".qcow2")
+	for _, ext := range []string{".kernel", ".initrd"} {
+		if _, err := os.Stat(filepath.Join(vmsDir, vmName+ext)); err == nil {
+			sysutil.CopyFile(filepath.Join(vmsDir, vmName+ext), baseStem+ext)
+		}
+	}
+
+	created := make([]string, 0, count)
+	for _, n := range names {
+		if err := p.Spawn(n, forkOptions(state, base)); err != nil {
+			return created, fmt.Errorf("failed to spawn fork %s: %w", n, err)
+		}
+		created = append(created, n)
+	}
+	return created, nil
+}
+
+// forkOptions spawns a clone from base with the source's settings. Host
+// ports are re-allocated per clone; passthrough devices cannot be shared,
+// so accelerators stay with the source.
+func forkOptions(state VMState, base string) VMOptions {
+	fw := make([]PortForward, len(state.Forwarding))
+	for i, f := range state.Forwarding {
+		f.HostPort = 0
+		fw[i] = f
+	}
+	return VMOptions{
+		DiskPath:      base,
+		SSHUser:       state.SSHUser,
+		Gui:           state.Gui,
+		Forwarding:    fw,
+		Cmdline:       state.Cmdline,
+		MemoryMB:      state.MemoryMB,
+		VCPUs:         state.VCPUs,
+		MaxMemoryMB:   state.MaxMemoryMB,
+		MaxVCPUs:      state.MaxVCPUs,
+		RawQemuArgs:   state.RawQemuArgs,
+		Mounts:        state.Mounts,
+		Limits:        state.Limits,
+		RestartPolicy: state.RestartPolicy,
+		Labels:        state.Labels,
+	}
+}
+
+// forkCloneNames numbers clones from 1: trial-1, trial-2, ...
+func forkCloneNames(prefix string, count int) []string {
+	names := make([]string, count)
+	for i := range names {
+		names[i] = fmt.Sprintf("%s%d", prefix, i+1)
+	}
+	return names
+}
+
+// freezeDisk moves the VM disk into the bases directory and puts a new
+// overlay in its place. A running VM is paused while QEMU switches to the
+// overlay with an external snapshot, so no write lands in the base.
+func (p *QemuProvider) freezeDisk(vmName, diskPath string) (string, error) {
+	if err := os.MkdirAll(p.forkBasesDir(), 0755); err != nil {
+		return "", err
+	}
+	base := filepath.Join(p.forkBasesDir(), fmt.Sprintf("%s-%s.qcow2", vmName, time.Now().Format("20060102-150405")))
+
+	if !p.vmAlive(vmName) {
+		if err := os.Rename(diskPath, base); err != nil {
+			return "", err
+		}
+		if _, err := runQemuImg("create", "-f", "qcow2", "-b", base, "-F", "qcow2", diskPath); err != nil {
+			_ = os.Rename(base, diskPath)
+			return "", err
+		}
+		return base, nil
+	}
+
+	// The base stays locked by QEMU, so size the overlay up front and create
+	// it without opening the backing file.
+	out, err := runQemuImg("info", "-U", "--output=json", diskPath)
+	if err != nil {
+		return "", err
+	}
+	var info struct {
+		VirtualSize int64 `json:"virtual-size"`
+	}
+	if err := json.Unmarshal(out, &info); err != nil || info.VirtualSize == 0 {
+		return "", fmt.Errorf("failed to read disk size of VM '%s'", vmName)
+	}
+
+	client, err := p.dialQMP(vmName, time.Second)
+	if err != nil {
+		return "", fmt.Errorf("VM '%s' is running but its monitor is unavailable: %w", vmName, err)
+	}
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	device, err := rootBlockDevice(ctx, client, diskPath)
+	if err != nil {
+		return "", err
+	}
+	status, err := client.QueryStatus(ctx)
+	if err != nil {
+		return "", err
+	}
+	if status.Status != qmp.StatusPaused {
+		if err := client.Stop(ctx); err != nil {
+			return "", fmt.Errorf("failed to pause VM '%s': %w", vmName, err)
+		}
+		defer client.Cont(ctx)
+	}
+
+	// QEMU keeps its open descriptor across the rename and a paused guest
+	// issues no writes; the overlay then takes over the canonical disk path.
+	if err := os.Rename(diskPath, base); err != nil {
+		return "", err
+	}
+	rollback := func(cause error) (string, error) {
+		_ = os.Remove(diskPath)
+		_ = os.Rename(base, diskPath)
+		return "", cause
+	}
+	if _, err := runQemuImg("create", "-f", "qcow2", "-u", "-b", base, "-F", "qcow2", diskPath, fmt.Sprintf("%d", info.VirtualSize)); err != nil {
+		return rollback(err)
+	}
+	err = client.Execute(ctx, "blockdev-snapshot-sync", map[string]string{
+		"device":        device,
+		"snapshot-file": diskPath,
+		"format":        "qcow2",
+		"mode":          "existing",
+	}, nil)
+	if err != nil {
+		return rollback(fmt.Errorf("external snapshot failed: %w", err))
+	}
+	return base, nil
+}
+
+// pruneForkBases removes base layers that no VM disk or other base depends
+// on anymore, walking up the chain as dependents disappear. Any disk whose
+// backing file cannot be read aborts the sweep rather than risk a live base.
+func (p *QemuProvider) pruneForkBases() {
+	vmsDir := filepath.Join(p.RootDir, "vms")
+	for {
+		bases, _ := filepath.Glob(filepath.Join(p.forkBasesDir(), "*.qcow2"))
+		if len(bases) == 0 {
+			return
+		}
+		disks, _ := filepath.Glob(filepath.Join(vmsDir, "*.qcow2"))
+		inUse := make(map[string]bool)
+		for _, d := range append(disks, bases...) {
+			out, err := runQemuImg("info", "-U", "--output=json", d)
+			if err != nil {
+				return
+			}
+			var info struct {
+				Backing string `json:"full-backing-filename"`
+			}
+			if err := json.Unmarshal(out, &info); err != nil {
+				return
+			}
+			if info.Backing != "" {
+				if abs, err := filepath.Abs(info.Backing); err == nil {
+					inUse[abs] = true
+				}
+			}
+		}
+
+		removed := false
+		for _, b := range bases {
+			if abs, err := filepath.Abs(b); err == nil && !inUse[abs] {
+				stem := strings.TrimSuffix(b, ".qcow2")
+				_ = safeRemove(stem + ".kernel")
+				_ = safeRemove(stem + ".initrd")
+				if safeRemove(b) == nil {
+					removed = true
+				}
+			}
+		}
+		if !removed {
+			return
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package provider
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Josepavese/nido/internal/config"
+)
+
+func TestForkCloneNames(t *testing.T) {
+	got := forkCloneNames("trial-", 3)
+	want := []string{"trial-1", "trial-2", "trial-3"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("forkCloneNames = %v, want %v", got, want)
+	}
+}
+
+func TestForkOptionsKeepSourceSettings(t *testing.T) {
+	limits := &ResourceLimits{CPUs: 1.5, MemoryMaxMB: 3072}
+	state := VMState{
+		Name: "src", SSHUser: "ubuntu", MemoryMB: 1024, VCPUs: 2, MaxMemoryMB: 4096, MaxVCPUs: 4,
+		Limits: limits, RestartPolicy: RestartAlways, Accelerators: []string{"0000:01:00.0"},
+		Forwarding: []PortForward{{GuestPort: 80, HostPort: 30080, Protocol: "tcp"}},
+	}
+	opts := forkOptions(state, "/bases/src.qcow2")
+	if opts.DiskPath != "/bases/src.qcow2" || opts.MaxMemoryMB != 4096 || opts.MaxVCPUs != 4 || opts.Limits != limits || opts.RestartPolicy != RestartAlways {
+		t.Fatalf("fork options = %+v", opts)
+	}
+	if len(opts.Accelerators) != 0 || opts.Forwarding[0].HostPort != 0 || state.Forwarding[0].HostPort != 30080 {
+		t.Fatalf("fork options share host resources: %+v", opts)
+	}
+}
+
+func TestForkRejectsExistingCloneBeforeFreezing(t *testing.T) {
+	root := t.TempDir()
+	p := &QemuProvider{RootDir: root, Config: &config.Config{}}
+	for _, f := range []string{"vms/src.qcow2", "vms/trial-2.qcow2", "run/src.json"} {
+		path := filepath.Join(root, f)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte("{}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err := p.Fork("src", 3, "trial-")
+	if err == nil || !strings.Contains(err.Error(), "trial-2") {
+		t.Fatalf("Fork err = %v, want conflict on trial-2", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "vms", "src.qcow2")); err != nil {
+		t.Fatalf("source disk moved despite conflict: %v", err)
+	}
+	if _, err := os.Stat(p.forkBasesDir()); !os.IsNotExist(err) {
+		t.Fatalf("bases dir created despite conflict: %v", err)
+	}
+}
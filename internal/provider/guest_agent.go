@@ -0,0 +1,193 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/Josepavese/nido/internal/qga"
+)
+
+const (
+	// agentProbeTimeout bounds the sync handshake. A guest without a running
+	// qemu-ga never answers, so this is also the cost of finding out.
+	agentProbeTimeout = 2 * time.Second
+	// agentQueryTimeout bounds a full GuestInfo round; fsinfo can be slow.
+	agentQueryTimeout = 10 * time.Second
+)
+
+// errAgentUnavailable is returned on hosts where the agent channel has no
+// stable address.
+var errAgentUnavailable = errors.New("guest agent channel is not available on this host")
+
+// agentAddress resolves the guest agent socket configured by buildQemuArgs.
+func (p *QemuProvider) agentAddress(name string) (string, string, error) {
+	if runtime.GOOS == "windows" {
+		return "", "", errAgentUnavailable
+	}
+	return "unix", filepath.Join(p.RootDir, "run", name+".qga"), nil
+}
+
+// agentChardevID names the guest agent chardev configured by buildQemuArgs.
+const agentChardevID = "qga0"
+
+// agentConnected asks the monitor whether a program in the guest holds the
+// agent port open. Without qemu-guest-agent the sync handshake would only
+// fail after agentProbeTimeout. It reports true when the monitor cannot
+// tell, leaving the decision to the handshake.
+func (p *QemuProvider) agentConnected(name string) bool {
+	client, err := p.dialQMP(name, qmpProbeTimeout)
+	if err != nil {
+		return true
+	}
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), qmpProbeTimeout)
+	defer cancel()
+	devs, err := client.QueryChardev(ctx)
+	if err != nil {
+		return true
+	}
+	for _, dev := range devs {
+		if dev.Label == agentChardevID {
+			return dev.FrontendOpen
+		}
+	}
+	return true
+}
+
+// dialAgent opens a synchronized session with the VM's guest agent.
+func (p *QemuProvider) dialAgent(name string) (*qga.Client, error) {
+	if !p.vmAlive(name) {
+		return nil, fmt.Errorf("VM '%s' is not running", name)
+	}
+	network, address, err := p.agentAddress(name)
+	if err != nil {
+		return nil, err
+	}
+	if !p.agentConnected(name) {
+		return nil, fmt.Errorf("guest agent of VM '%s' is not connected (is qemu-guest-agent installed and running?)", name)
+	}
+	client, err := qga.Dial(network, address, agentProbeTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("guest agent of VM '%s' is not responding (is qemu-guest-agent installed and running?): %w", name, err)
+	}
+	return client, nil
+}
+
+// GuestInfo asks the guest agent for hostname, OS, addresses and filesystem
+// usage. Queries the agent does not support are left empty.
+func (p *QemuProvider) GuestInfo(name string) (GuestInfo, error) {
+	if _, err := p.vmDiskPath(name); err != nil {
+		return GuestInfo{}, err
+	}
+	client, err := p.dialAgent(name)
+	if err != nil {
+		return GuestInfo{}, err
+	}
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), agentQueryTimeout)
+	defer cancel()
+
+	var info GuestInfo
+	if host, err := client.HostName(ctx); err == nil {
+		info.Hostname = host
+	}
+	if osInfo, err := client.OSInfo(ctx); err == nil {
+		info.OS = osInfo.PrettyName
+		if info.OS == "" {
+			info.OS = osInfo.Name
+		}
+		info.OSVersion = osInfo.VersionID
+		info.Kernel = osInfo.KernelRelease
+	}
+	if ifaces, err := client.NetworkInterfaces(ctx); err == nil {
+		info.IPs = guestAddresses(ifaces)
+	}
+	if fsList, err := client.FSInfo(ctx); err == nil {
+		for _, fs := range fsList {
+			entry := GuestFilesystem{Mountpoint: fs.Mountpoint, Type: fs.Type, Device: fs.Name}
+			if fs.UsedBytes != nil {
+				entry.UsedBytes = *fs.UsedBytes
+			}
+			if fs.TotalBytes != nil {
+				entry.TotalBytes = *fs.TotalBytes
+			}
+			info.Filesystems = append(info.Filesystems, entry)
+		}
+	}
+	return info, nil
+}
+
+// guestAddresses flattens interface addresses to CIDR strings, leaving out
+// loopback and link-local ones that mean nothing outside the guest.
+func guestAddresses(ifaces []qga.NetworkInterface) []string {
+	var out []string
+	for _, iface := range ifaces {
+		for _, addr := range iface.IPAddresses {
+			ip := net.ParseIP(addr.Address)
+			if ip == nil || ip.IsLoopback() || ip.IsLinkLocalUnicast() {
+				continue
+			}
+			out = append(out, fmt.Sprintf("%s/%d", addr.Address, addr.Prefix))
+		}
+	}
+	return out
+}
+
+// FreezeFilesystems flushes and freezes guest filesystems so a disk
+// snapshot is application-consistent. Always pair it with ThawFilesystems.
+func (p *QemuProvider) FreezeFilesystems(name string) (int, error) {
+	client, err := p.dialAgent(name)
+	if err != nil {
+		return 0, err
+	}
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), agentQueryTimeout)
+	defer cancel()
+	return client.FSFreeze(ctx)
+}
+
+// ThawFilesystems resumes writes after FreezeFilesystems.
+func (p *QemuProvider) ThawFilesystems(name string) (int, error) {
+	client, err := p.dialAgent(name)
+	if err != nil {
+		return 0, err
+	}
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), agentQueryTimeout)
+	defer cancel()
+	return client.FSThaw(ctx)
+}
+
+// withFrozenGuest runs fn with guest filesystems frozen when the agent is
+// available, and unfrozen (crash-consistent) otherwise.
+func (p *QemuProvider) withFrozenGuest(name string, fn func() error) error {
+	if _, err := p.FreezeFilesystems(name); err != nil {
+		return fn()
+	}
+	defer p.ThawFilesystems(name)
+	return fn()
+}
+
+// agentShutdown asks the guest OS to power off through the agent and waits
+// for QEMU to exit. It returns false when there is no agent to ask or the
+// guest did not go down in time.
+func (p *QemuProvider) agentShutdown(name string, pid int) bool {
+	client, err := p.dialAgent(name)
+	if err != nil {
+		return false
+	}
+	defer client.Close()
+	if err := client.Shutdown(context.Background(), qga.ShutdownPowerdown); err != nil {
+		return false
+	}
+	deadline := time.Now().Add(acpiShutdownTimeout)
+	for processAlive(pid) && time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+	}
+	return !processAlive(pid)
+}
@@ -0,0 +1,24 @@
+package provider
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Josepavese/nido/internal/qga"
+)
+
+func TestGuestAddressesSkipsLoopbackAndLinkLocal(t *testing.T) {
+	ifaces := []qga.NetworkInterface{
+		{Name: "lo", IPAddresses: []qga.IPAddress{{Type: "ipv4", Address: "127.0.0.1", Prefix: 8}, {Type: "ipv6", Address: "::1", Prefix: 128}}},
+		{Name: "eth0", IPAddresses: []qga.IPAddress{
+			{Type: "ipv4", Address: "10.0.2.15", Prefix: 24},
+			{Type: "ipv6", Address: "fe80::5054:ff:fe12:3456", Prefix: 64},
+			{Type: "ipv6", Address: "fec0::5054:ff:fe12:3456", Prefix: 64},
+		}},
+	}
+	got := guestAddresses(ifaces)
+	want := []string{"10.0.2.15/24", "fec0::5054:ff:fe12:3456/64"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("guestAddresses = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,222 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Josepavese/nido/internal/qmp"
+)
+
+// tabletID is the absolute pointer GUI VMs get, so clicks land on the pixel
+// seen in a screenshot. It sits on its own UHCI bus, apart from the xHCI
+// controller of usb-storage devices.
+const tabletID = "nido-tablet"
+
+func tabletArgs() []string {
+	return []string{
+		"-device", "piix3-usb-uhci,id=nido-uhci",
+		"-device", "usb-tablet,bus=nido-uhci.0,id=" + tabletID,
+	}
+}
+
+// typedKeys maps printable characters to QEMU qcodes on a US layout.
+// shiftedKeys need shift held.
+var (
+	typedKeys = map[rune]string{
+		' ': "spc", '\n': "ret", '\t': "tab",
+		'-': "minus", '=': "equal", '[': "bracket_left", ']': "bracket_right",
+		'\\': "backslash", ';': "semicolon", '\'': "apostrophe", '`': "grave_accent",
+		',': "comma", '.': "dot", '/': "slash",
+	}
+	shiftedKeys = map[rune]string{
+		'!': "1", '@': "2", '#': "3", '$': "4", '%': "5", '^': "6", '&': "7", '*': "8", '(': "9", ')': "0",
+		'_': "minus", '+': "equal", '{': "bracket_left", '}': "bracket_right", '|': "backslash",
+		':': "semicolon", '"': "apostrophe", '~': "grave_accent", '<': "comma", '>': "dot", '?': "slash",
+	}
+	// keyAliases accepts common key names next to raw qcodes.
+	keyAliases = map[string]string{
+		"enter": "ret", "return": "ret", "escape": "esc", "space": "spc",
+		"del": "delete", "pageup": "pgup", "pagedown": "pgdn",
+		"win": "meta_l", "super": "meta_l", "meta": "meta_l", "cmd": "meta_l",
+		"control": "ctrl", "altgr": "alt_r",
+	}
+	qcodePattern = regexp.MustCompile(`^[a-z0-9_]+$`)
+)
+
+// charKeys returns the chord that types r.
+func charKeys(r rune) ([]string, error) {
+	switch {
+	case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+		return []string{string(r)}, nil
+	case r >= 'A' && r <= 'Z':
+		return []string{"shift", string(r - 'A' + 'a')}, nil
+	}
+	if k, ok := typedKeys[r]; ok {
+		return []string{k}, nil
+	}
+	if k, ok := shiftedKeys[r]; ok {
+		return []string{"shift", k}, nil
+	}
+	return nil, fmt.Errorf("cannot type %q: only US-keyboard ASCII is supported", r)
+}
+
+// parseChord splits "ctrl+alt+t" into qcodes. Single characters use the
+// typing table, so "ctrl+/" and "shift+1" work too.
+func parseChord(chord string) ([]string, error) {
+	var keys []string
+	for _, part := range strings.Split(strings.ToLower(chord), "+") {
+		part = strings.TrimSpace(part)
+		if alias, ok := keyAliases[part]; ok {
+			part = alias
+		}
+		if r := []rune(part); len(r) == 1 {
+			k, err := charKeys(r[0])
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, k...)
+			continue
+		}
+		if !qcodePattern.MatchString(part) {
+			return nil, fmt.Errorf("invalid key %q in %q", part, chord)
+		}
+		keys = append(keys, part)
+	}
+	return keys, nil
+}
+
+func sendKeys(ctx context.Context, client *qmp.Client, keys []string) error {
+	values := make([]qmp.KeyValue, len(keys))
+	for i, k := range keys {
+		values[i] = qmp.QCode(k)
+	}
+	return client.SendKey(ctx, values...)
+}
+
+// sendChord presses one chord, e.g. "enter" or "ctrl+alt+t".
+func sendChord(ctx context.Context, client *qmp.Client, chord string) error {
+	keys, err := parseChord(chord)
+	if err != nil {
+		return err
+	}
+	return sendKeys(ctx, client, keys)
+}
+
+// ValidateInput checks an input action before any key reaches the guest,
+// so a bad character does not leave text half-typed.
+func ValidateInput(in InputAction) error {
+	switch in.Action {
+	case InputType:
+		if in.Text == "" {
+			return fmt.Errorf("nothing to type")
+		}
+		for _, r := range in.Text {
+			if _, err := charKeys(r); err != nil {
+				return err
+			}
+		}
+	case InputKey:
+		if len(in.Keys) == 0 {
+			return fmt.Errorf("no keys given (e.g. ctrl+alt+t)")
+		}
+		for _, chord := range in.Keys {
+			if _, err := parseChord(chord); err != nil {
+				return err
+			}
+		}
+	case InputClick, InputMove:
+		if in.X < 0 || in.Y < 0 {
+			return fmt.Errorf("coordinates must not be negative")
+		}
+		switch in.Button {
+		case "", "left", "right", "middle":
+		default:
+			return fmt.Errorf("unknown button %q (use left, right or middle)", in.Button)
+		}
+	default:
+		return fmt.Errorf("unknown input action %q (use type, key, click or move)", in.Action)
+	}
+	return nil
+}
+
+// absCoord scales a pixel coordinate to the 0..AbsMax pointer range.
+func absCoord(pixel, size int) int {
+	if size <= 1 {
+		return 0
+	}
+	if pixel >= size {
+		pixel = size - 1
+	}
+	return pixel * qmp.AbsMax / (size - 1)
+}
+
+// SendInput types text, presses key chords, or moves and clicks the tablet
+// of a running VM. Keys go through send-key, whose queue keeps them in order
+// with the default hold time.
+func (p *QemuProvider) SendInput(name string, in InputAction) error {
+	if err := ValidateInput(in); err != nil {
+		return err
+	}
+	state, err := p.loadState(name)
+	if err != nil {
+		return err
+	}
+	if !p.vmAlive(name) {
+		return fmt.Errorf("VM '%s' is not running", name)
+	}
+	if (in.Action == InputClick || in.Action == InputMove) && state.VNCPort == 0 {
+		return fmt.Errorf("VM '%s' has no display pointer; pointer input needs a GUI VM (spawn --gui)", name)
+	}
+	client, err := p.dialQMP(name, time.Second)
+	if err != nil {
+		return fmt.Errorf("VM '%s' is running but its monitor is unavailable: %w", name, err)
+	}
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	switch in.Action {
+	case InputType:
+		for _, r := range in.Text {
+			keys, _ := charKeys(r)
+			if err := sendKeys(ctx, client, keys); err != nil {
+				return err
+			}
+		}
+	case InputKey:
+		for _, chord := range in.Keys {
+			if err := sendChord(ctx, client, chord); err != nil {
+				return err
+			}
+		}
+	case InputClick, InputMove:
+		width, height, err := p.screenSize(ctx, client, name)
+		if err != nil {
+			return err
+		}
+		if in.X >= width || in.Y >= height {
+			return fmt.Errorf("(%d, %d) is outside the %dx%d display", in.X, in.Y, width, height)
+		}
+		events := []qmp.InputEvent{
+			qmp.AbsEvent("x", absCoord(in.X, width)),
+			qmp.AbsEvent("y", absCoord(in.Y, height)),
+		}
+		if err := client.InputSendEvent(ctx, events...); err != nil {
+			return err
+		}
+		if in.Action == InputClick {
+			button := in.Button
+			if button == "" {
+				button = "left"
+			}
+			if err := client.InputSendEvent(ctx, qmp.BtnEvent(button, true)); err != nil {
+				return err
+			}
+			return client.InputSendEvent(ctx, qmp.BtnEvent(button, false))
+		}
+	}
+	return nil
+}
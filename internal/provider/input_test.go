@@ -0,0 +1,78 @@
+package provider
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseChord(t *testing.T) {
+	cases := map[string][]string{
+		"enter":        {"ret"},
+		"ctrl+alt+t":   {"ctrl", "alt", "t"},
+		"Ctrl+Shift+T": {"ctrl", "shift", "t"},
+		"win":          {"meta_l"},
+		"ctrl+/":       {"ctrl", "slash"},
+		"shift+1":      {"shift", "1"},
+		"f5":           {"f5"},
+		"kp_enter":     {"kp_enter"},
+	}
+	for chord, want := range cases {
+		got, err := parseChord(chord)
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("parseChord(%q) = %v, %v; want %v", chord, got, err, want)
+		}
+	}
+	for _, bad := range []string{"ctrl+", "ctrl+é", "alt+F 4"} {
+		if _, err := parseChord(bad); err == nil {
+			t.Errorf("parseChord(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestCharKeysTypesUSLayout(t *testing.T) {
+	var got []string
+	for _, r := range "Hi!\n" {
+		keys, err := charKeys(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, strings.Join(keys, "+"))
+	}
+	if want := "shift+h,i,shift+1,ret"; strings.Join(got, ",") != want {
+		t.Fatalf("keys = %v, want %s", got, want)
+	}
+}
+
+func TestValidateInput(t *testing.T) {
+	valid := []InputAction{
+		{Action: InputType, Text: "ls -la\n"},
+		{Action: InputKey, Keys: []string{"ctrl+alt+t", "enter"}},
+		{Action: InputClick, X: 1, Y: 2, Button: "middle"},
+		{Action: InputMove},
+	}
+	for _, in := range valid {
+		if err := ValidateInput(in); err != nil {
+			t.Errorf("ValidateInput(%+v) = %v", in, err)
+		}
+	}
+	invalid := []InputAction{
+		{Action: InputType},
+		{Action: InputType, Text: "naïve"},
+		{Action: InputKey},
+		{Action: InputClick, X: -1},
+		{Action: InputClick, Button: "back"},
+		{Action: "scroll"},
+	}
+	for _, in := range invalid {
+		if err := ValidateInput(in); err == nil {
+			t.Errorf("ValidateInput(%+v) succeeded, want error", in)
+		}
+	}
+}
+
+func TestAbsCoordSpansDisplay(t *testing.T) {
+	if absCoord(0, 1024) != 0 || absCoord(1023, 1024) != 0x7fff || absCoord(5000, 1024) != 0x7fff {
+		t.Fatal("absCoord should map 0..size-1 onto 0..0x7fff")
+	}
+}
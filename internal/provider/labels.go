@@ -0,0 +1,176 @@
+package provider
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// maxLabelLen bounds label keys and values.
+const maxLabelLen = 63
+
+// validLabelText reports whether s only holds letters, digits, '.', '_' and '-'.
+func validLabelText(s string) bool {
+	for _, r := range s {
+		if !((r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '.' || r == '_' || r == '-') {
+			return false
+		}
+	}
+	return len(s) <= maxLabelLen
+}
+
+// ValidateLabel checks one label: a non-empty key and a possibly empty
+// value, both up to 63 letters, digits, '.', '_' or '-'.
+func ValidateLabel(key, value string) error {
+	if key == "" || !validLabelText(key) {
+		return fmt.Errorf("invalid label key %q: use up to %d letters, digits, '.', '_' or '-'", key, maxLabelLen)
+	}
+	if !validLabelText(value) {
+		return fmt.Errorf("invalid value %q for label %s: use up to %d letters, digits, '.', '_' or '-'", value, key, maxLabelLen)
+	}
+	return nil
+}
+
+// ParseLabels parses key=value specs such as team=search.
+func ParseLabels(specs []string) (map[string]string, error) {
+	labels := map[string]string{}
+	for _, spec := range specs {
+		key, value, ok := strings.Cut(spec, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid label %q: use key=value", spec)
+		}
+		if err := ValidateLabel(key, value); err != nil {
+			return nil, err
+		}
+		labels[key] = value
+	}
+	return labels, nil
+}
+
+// FormatLabels renders labels as sorted key=value pairs joined by commas.
+func FormatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// Selector matches VMs by their labels. Every term must hold.
+type Selector []selectorTerm
+
+type selectorTerm struct {
+	key, value string
+	// op is "=", "!=", "exists" or "!exists".
+	op string
+}
+
+// ParseSelector parses comma-separated terms: key=value, key!=value, key
+// (label present) and !key (label absent). A selector needs at least one
+// term and no empty ones, since a selector that matches every VM would turn
+// a bulk delete into deleting the nest; callers treat an absent selector
+// as "all VMs" themselves.
+func ParseSelector(raw string) (Selector, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, fmt.Errorf("empty selector: give at least one term such as team=search")
+	}
+	var sel Selector
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			return nil, fmt.Errorf("invalid selector %q: empty term", raw)
+		}
+		var t selectorTerm
+		switch {
+		case strings.Contains(part, "!="):
+			t.key, t.value, _ = strings.Cut(part, "!=")
+			t.op = "!="
+		case strings.Contains(part, "="):
+			t.key, t.value, _ = strings.Cut(part, "=")
+			t.op = "="
+		case strings.HasPrefix(part, "!"):
+			t.key, t.op = part[1:], "!exists"
+		default:
+			t.key, t.op = part, "exists"
+		}
+		t.key, t.value = strings.TrimSpace(t.key), strings.TrimSpace(t.value)
+		if err := ValidateLabel(t.key, t.value); err != nil {
+			return nil, fmt.Errorf("invalid selector %q: %w", raw, err)
+		}
+		sel = append(sel, t)
+	}
+	return sel, nil
+}
+
+// Matches reports whether labels satisfy every term of the selector.
+func (s Selector) Matches(labels map[string]string) bool {
+	for _, t := range s {
+		v, ok := labels[t.key]
+		switch t.op {
+		case "=":
+			if !ok || v != t.value {
+				return false
+			}
+		case "!=":
+			if ok && v == t.value {
+				return false
+			}
+		case "exists":
+			if !ok {
+				return false
+			}
+		case "!exists":
+			if ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// FilterVMs keeps the VMs whose labels match sel.
+func FilterVMs(vms []VMStatus, sel Selector) []VMStatus {
+	kept := make([]VMStatus, 0, len(vms))
+	for _, vm := range vms {
+		if sel.Matches(vm.Labels) {
+			kept = append(kept, vm)
+		}
+	}
+	return kept
+}
+
+// SetLabels adds or overwrites the labels in set and drops those in remove,
+// returning the VM's labels afterwards.
+func (p *QemuProvider) SetLabels(name string, set map[string]string, remove []string) (map[string]string, error) {
+	if _, err := p.vmDiskPath(name); err != nil {
+		return nil, err
+	}
+	for k, v := range set {
+		if err := ValidateLabel(k, v); err != nil {
+			return nil, err
+		}
+	}
+	state, err := p.updateState(name, func(state *VMState) error {
+		if state.Labels == nil {
+			state.Labels = map[string]string{}
+		}
+		for _, k := range remove {
+			delete(state.Labels, k)
+		}
+		for k, v := range set {
+			state.Labels[k] = v
+		}
+		if len(state.Labels) == 0 {
+			state.Labels = nil
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if state.Labels == nil {
+		return map[string]string{}, nil
+	}
+	return state.Labels, nil
+}
@@ -0,0 +1,84 @@
+package provider
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Josepavese/nido/internal/config"
+)
+
+func TestSelectorMatches(t *testing.T) {
+	labels := map[string]string{"team": "search", "purpose": "eval"}
+	if !Selector(nil).Matches(labels) {
+		t.Fatal("no selector must match every VM")
+	}
+	for raw, want := range map[string]bool{
+		"team=search":               true,
+		"team=search,purpose=eval":  true,
+		"team=search, purpose=prod": false,
+		"team!=ads":                 true,
+		"team!=search":              false,
+		"purpose":                   true,
+		"owner":                     false,
+		"!owner":                    true,
+		"!team":                     false,
+	} {
+		sel, err := ParseSelector(raw)
+		if err != nil {
+			t.Fatalf("ParseSelector(%q) failed: %v", raw, err)
+		}
+		if got := sel.Matches(labels); got != want {
+			t.Fatalf("%q matches = %v, want %v", raw, got, want)
+		}
+	}
+	for _, raw := range []string{"=x", "team=a b", "!", "team==search", "", ",", " ", "a=1,", "a=1,,b=2"} {
+		if _, err := ParseSelector(raw); err == nil {
+			t.Fatalf("ParseSelector(%q) succeeded", raw)
+		}
+	}
+}
+
+func TestParseLabels(t *testing.T) {
+	labels, err := ParseLabels([]string{"team=search", "empty="})
+	if err != nil || labels["team"] != "search" || labels["empty"] != "" || len(labels) != 2 {
+		t.Fatalf("ParseLabels = %v, %v", labels, err)
+	}
+	for _, spec := range []string{"team", "=x", "team=a/b"} {
+		if _, err := ParseLabels([]string{spec}); err == nil {
+			t.Fatalf("ParseLabels(%q) succeeded", spec)
+		}
+	}
+	if got := FormatLabels(map[string]string{"b": "2", "a": "1"}); got != "a=1,b=2" {
+		t.Fatalf("FormatLabels = %q", got)
+	}
+}
+
+func TestSetLabels(t *testing.T) {
+	p := &QemuProvider{RootDir: t.TempDir(), Config: &config.Config{}}
+	for _, dir := range []string{"vms", "run"} {
+		if err := os.MkdirAll(filepath.Join(p.RootDir, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(p.RootDir, "vms", "vm1.qcow2"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.writeState(VMState{Name: "vm1", Labels: map[string]string{"team": "ads", "purpose": "eval"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	labels, err := p.SetLabels("vm1", map[string]string{"team": "search"}, []string{"purpose"})
+	if err != nil || len(labels) != 1 || labels["team"] != "search" {
+		t.Fatalf("SetLabels = %v, %v", labels, err)
+	}
+	if _, err := p.SetLabels("vm1", map[string]string{"bad key": "x"}, nil); err == nil {
+		t.Fatal("SetLabels accepted an invalid key")
+	}
+	if labels, err = p.SetLabels("vm1", nil, []string{"team"}); err != nil || len(labels) != 0 {
+		t.Fatalf("removing the last label = %v, %v", labels, err)
+	}
+	if state, _ := p.loadState("vm1"); state.Labels != nil {
+		t.Fatalf("stored labels = %v", state.Labels)
+	}
+}
@@ -0,0 +1,151 @@
+package provider
+
+import (
+	"fmt"
+	"regexp"
+	"runtime"
+	"time"
+
+	"github.com/Josepavese/nido/internal/cgroup"
+)
+
+// qemuMemoryOverheadMB is the headroom a memory limit needs above guest RAM
+// for QEMU itself (device emulation, page tables, buffers).
+const qemuMemoryOverheadMB = 128
+
+// minPidsLimit leaves room for QEMU's main, vCPU and IO threads.
+const minPidsLimit = 32
+
+// ValidateLimits checks l for a VM whose guest RAM can reach ceilingMB.
+func ValidateLimits(l ResourceLimits, ceilingMB int) error {
+	if l.CPUs < 0 || (l.CPUs > 0 && l.CPUs < 0.01) {
+		return fmt.Errorf("cpu limit must be at least 0.01 cores")
+	}
+	if l.MemoryMaxMB < 0 {
+		return fmt.Errorf("memory limit cannot be negative")
+	}
+	if l.MemoryMaxMB > 0 && l.MemoryMaxMB < ceilingMB+qemuMemoryOverheadMB {
+		return fmt.Errorf("memory limit (%d MB) must cover guest RAM (%d MB) plus %d MB for QEMU", l.MemoryMaxMB, ceilingMB, qemuMemoryOverheadMB)
+	}
+	if l.IOWeight < 0 || l.IOWeight > 10000 {
+		return fmt.Errorf("io weight must be between 1 and 10000")
+	}
+	if l.PidsMax < 0 || (l.PidsMax > 0 && l.PidsMax < minPidsLimit) {
+		return fmt.Errorf("pids limit must be at least %d", minPidsLimit)
+	}
+	return nil
+}
+
+func (l ResourceLimits) cgroupLimits() cgroup.Limits {
+	return cgroup.Limits{
+		CPUs:      l.CPUs,
+		MemoryMax: int64(l.MemoryMaxMB) << 20,
+		IOWeight:  l.IOWeight,
+		PidsMax:   l.PidsMax,
+	}
+}
+
+// limitPlan is how Start confines a VM: a cgroup directory to move QEMU
+// into, a systemd-run prefix to launch it with, or the reason neither is
+// possible.
+type limitPlan struct {
+	dir     string
+	wrapper []string
+	reason  string
+}
+
+var unitNameUnsafe = regexp.MustCompile(`[^a-zA-Z0-9_.-]`)
+
+// planLimits picks how to enforce l. Direct cgroupfs placement wins when
+// the caller's cgroup is delegated; otherwise a systemd user scope is used.
+func (p *QemuProvider) planLimits(name string, l *ResourceLimits) limitPlan {
+	if l == nil || l.IsZero() {
+		return limitPlan{}
+	}
+	if runtime.GOOS != "linux" {
+		return limitPlan{reason: "resource limits need Linux cgroup v2"}
+	}
+	base, err := cgroup.Delegated()
+	if err == nil {
+		dir := base + "/nido-" + unitNameUnsafe.ReplaceAllString(name, "_")
+		if err = cgroup.Create(dir, l.cgroupLimits()); err == nil {
+			return limitPlan{dir: dir}
+		}
+	}
+	if cgroup.SystemdScopeAvailable() {
+		unit := fmt.Sprintf("nido-%s-%d.scope", unitNameUnsafe.ReplaceAllString(name, "_"), time.Now().UnixNano())
+		return limitPlan{wrapper: cgroup.SystemdRunArgs(unit, l.cgroupLimits())}
+	}
+	return limitPlan{reason: fmt.Sprintf("cgroup delegation unavailable: %v", err)}
+}
+
+// attachLimits finishes a plan once QEMU runs as pid and returns the cgroup
+// it ended up in, or why limits are not enforced.
+func attachLimits(plan limitPlan, pid int) (string, string) {
+	switch {
+	case plan.dir != "":
+		if pid <= 0 {
+			return "", "QEMU PID unknown; limits not applied"
+		}
+		if err := cgroup.Move(plan.dir, pid); err != nil {
+			return "", fmt.Sprintf("failed to move QEMU into %s: %v", plan.dir, err)
+		}
+		return plan.dir, ""
+	case len(plan.wrapper) > 0:
+		dir, err := cgroup.Of(pid)
+		if err != nil {
+			return "", fmt.Sprintf("failed to find the QEMU scope: %v", err)
+		}
+		return dir, ""
+	}
+	return "", plan.reason
+}
+
+// cgroupStatus reports enforcement and live usage for a running VM.
+func cgroupStatus(state VMState) *CgroupStatus {
+	if state.Cgroup == "" {
+		return &CgroupStatus{Reason: state.CgroupError}
+	}
+	usage, err := cgroup.ReadUsage(state.Cgroup)
+	if err != nil {
+		return &CgroupStatus{Path: state.Cgroup, Reason: fmt.Sprintf("cgroup unreadable: %v", err)}
+	}
+	return &CgroupStatus{
+		Enforced:     true,
+		Path:         state.Cgroup,
+		MemoryBytes:  usage.MemoryBytes,
+		CPUUsec:      usage.CPUUsec,
+		Pids:         usage.Pids,
+		IOReadBytes:  usage.IOReadBytes,
+		IOWriteBytes: usage.IOWriteBytes,
+	}
+}
+
+// applyLimitUpdates merges the limit fields of updates into state and
+// reports whether any changed.
+func applyLimitUpdates(state *VMState, updates VMConfigUpdates) bool {
+	if updates.CPULimit == nil && updates.MemoryLimitMB == nil && updates.IOWeight == nil && updates.PidsLimit == nil {
+		return false
+	}
+	var l ResourceLimits
+	if state.Limits != nil {
+		l = *state.Limits
+	}
+	if updates.CPULimit != nil {
+		l.CPUs = *updates.CPULimit
+	}
+	if updates.MemoryLimitMB != nil {
+		l.MemoryMaxMB = *updates.MemoryLimitMB
+	}
+	if updates.IOWeight != nil {
+		l.IOWeight = *updates.IOWeight
+	}
+	if updates.PidsLimit != nil {
+		l.PidsMax = *updates.PidsLimit
+	}
+	state.Limits = &l
+	if l.IsZero() {
+		state.Limits = nil
+	}
+	return true
+}
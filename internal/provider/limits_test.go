@@ -0,0 +1,111 @@
+package provider
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Josepavese/nido/internal/cgroup"
+	"github.com/Josepavese/nido/internal/config"
+)
+
+func TestValidateLimits(t *testing.T) {
+	for _, tc := range []struct {
+		limits ResourceLimits
+		want   string
+	}{
+		{ResourceLimits{CPUs: 1.5, MemoryMaxMB: 2048 + qemuMemoryOverheadMB, IOWeight: 500, PidsMax: 64}, ""},
+		{ResourceLimits{CPUs: 0.001}, "at least 0.01 cores"},
+		{ResourceLimits{MemoryMaxMB: 2048}, "must cover guest RAM (2048 MB)"},
+		{ResourceLimits{IOWeight: 20000}, "between 1 and 10000"},
+		{ResourceLimits{PidsMax: 4}, "at least 32"},
+	} {
+		err := ValidateLimits(tc.limits, 2048)
+		if tc.want == "" && err != nil || tc.want != "" && (err == nil || !strings.Contains(err.Error(), tc.want)) {
+			t.Fatalf("ValidateLimits(%+v) = %v, want %q", tc.limits, err, tc.want)
+		}
+	}
+}
+
+func TestApplyLimitUpdatesMergesAndClears(t *testing.T) {
+	state := VMState{Limits: &ResourceLimits{CPUs: 2, PidsMax: 100}}
+	if applyLimitUpdates(&state, VMConfigUpdates{}) {
+		t.Fatal("no limit fields reported a change")
+	}
+	mem := 4096
+	applyLimitUpdates(&state, VMConfigUpdates{MemoryLimitMB: &mem})
+	if *state.Limits != (ResourceLimits{CPUs: 2, MemoryMaxMB: 4096, PidsMax: 100}) {
+		t.Fatalf("merged limits = %+v", *state.Limits)
+	}
+	zero, none := 0, 0.0
+	applyLimitUpdates(&state, VMConfigUpdates{CPULimit: &none, MemoryLimitMB: &zero, PidsLimit: &zero})
+	if state.Limits != nil {
+		t.Fatalf("limits after removing all = %+v", *state.Limits)
+	}
+}
+
+func TestPlanLimitsFallsBackWithoutCgroupV2(t *testing.T) {
+	old := cgroup.Root
+	cgroup.Root = t.TempDir()
+	t.Cleanup(func() { cgroup.Root = old })
+	t.Setenv("PATH", t.TempDir())
+
+	p := &QemuProvider{RootDir: t.TempDir()}
+	if plan := p.planLimits("vm1", nil); plan.dir != "" || plan.wrapper != nil || plan.reason != "" {
+		t.Fatalf("plan without limits = %+v", plan)
+	}
+	plan := p.planLimits("vm1", &ResourceLimits{CPUs: 1})
+	if plan.dir != "" || plan.wrapper != nil || !strings.Contains(plan.reason, "not mounted") {
+		t.Fatalf("plan = %+v", plan)
+	}
+	if dir, reason := attachLimits(plan, os.Getpid()); dir != "" || reason != plan.reason {
+		t.Fatalf("attachLimits = %q, %q", dir, reason)
+	}
+}
+
+func TestUpdateConfigSetsLimitsLiveOnEnforcedGroup(t *testing.T) {
+	p := &QemuProvider{RootDir: t.TempDir(), Config: &config.Config{}}
+	disk := filepath.Join(p.RootDir, "vms", "vm1.qcow2")
+	os.MkdirAll(filepath.Dir(disk), 0755)
+	os.MkdirAll(filepath.Join(p.RootDir, "run"), 0755)
+	if err := os.WriteFile(disk, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	group := t.TempDir()
+	for _, f := range []string{"cpu.max", "memory.max", "pids.max"} {
+		if err := os.WriteFile(filepath.Join(group, f), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.writeState(VMState{Name: "vm1", PID: os.Getpid(), MemoryMB: 1024, Limits: &ResourceLimits{PidsMax: 64}, Cgroup: group}); err != nil {
+		t.Fatal(err)
+	}
+
+	cpus := 0.5
+	applied, err := p.UpdateConfig("vm1", VMConfigUpdates{CPULimit: &cpus})
+	if err != nil || applied != AppliedLive {
+		t.Fatalf("UpdateConfig = %s, %v", applied, err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(group, "cpu.max")); string(data) != "50000 100000" {
+		t.Fatalf("cpu.max = %q", data)
+	}
+	if data, _ := os.ReadFile(filepath.Join(group, "pids.max")); string(data) != "64" {
+		t.Fatalf("pids.max = %q", data)
+	}
+
+	low := 512
+	if _, err := p.UpdateConfig("vm1", VMConfigUpdates{MemoryLimitMB: &low}); err == nil || !strings.Contains(err.Error(), "must cover guest RAM") {
+		t.Fatalf("UpdateConfig below guest RAM = %v", err)
+	}
+
+	// I/O is not delegated to this group, so the weight waits for a restart.
+	weight := 300
+	if applied, err := p.UpdateConfig("vm1", VMConfigUpdates{IOWeight: &weight}); err != nil || applied != AppliedNextBoot {
+		t.Fatalf("UpdateConfig io weight = %s, %v", applied, err)
+	}
+	state, _ := p.loadState("vm1")
+	if *state.Limits != (ResourceLimits{CPUs: 0.5, IOWeight: 300, PidsMax: 64}) {
+		t.Fatalf("stored limits = %+v", *state.Limits)
+	}
+}
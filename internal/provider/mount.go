@@ -0,0 +1,184 @@
+package provider
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// mountFWCfgName is the fw_cfg entry the guest-side nido-mounts script reads.
+const mountFWCfgName = "opt/nido/mounts"
+
+// nidoMountsScript is installed in the guest by cloud-init. It reads the
+// table written by mountArgs and mounts each 9p tag at its guest path.
+const nidoMountsScript = `#!/bin/sh
+table=/sys/firmware/qemu_fw_cfg/by_name/opt/nido/mounts/raw
+[ -r "$table" ] || modprobe qemu_fw_cfg 2>/dev/null
+[ -r "$table" ] || exit 0
+IFS=';'
+for entry in $(cat "$table"); do
+  tag=${entry%%=*}
+  target=${entry#*=}
+  opts=trans=virtio,version=9p2000.L,msize=262144
+  case "$target" in
+    *:ro) target=${target%:ro}; opts=$opts,ro ;;
+  esac
+  mkdir -p "$target"
+  mountpoint -q "$target" || mount -t 9p -o "$opts" "$tag" "$target"
+done
+`
+
+// nidoMountsUnit runs nidoMountsScript at boot on systemd guests.
+const nidoMountsUnit = `[Unit]
+Description=Mount Nido shared folders
+After=local-fs.target
+
+[Service]
+Type=oneshot
+ExecStart=/usr/local/sbin/nido-mounts
+RemainAfterExit=yes
+
+[Install]
+WantedBy=multi-user.target
+`
+
+// ParseMount parses "host:guest[:ro|:rw]" as given to --mount. Relative host
+// paths are resolved against the current directory; a Windows drive prefix
+// (C:\data) is kept with the host side.
+func ParseMount(spec string) (Mount, error) {
+	rest := spec
+	m := Mount{}
+	if strings.HasSuffix(rest, ":ro") {
+		m.ReadOnly = true
+		rest = strings.TrimSuffix(rest, ":ro")
+	} else {
+		rest = strings.TrimSuffix(rest, ":rw")
+	}
+	idx := strings.LastIndex(rest, ":")
+	if idx <= 0 || idx == len(rest)-1 {
+		return Mount{}, fmt.Errorf("invalid mount %q: want <host-dir>:<guest-path>[:ro]", spec)
+	}
+	hostPath, err := filepath.Abs(rest[:idx])
+	if err != nil {
+		return Mount{}, fmt.Errorf("invalid mount %q: %w", spec, err)
+	}
+	m.HostPath = hostPath
+	m.GuestPath = rest[idx+1:]
+	return m, ValidateMount(m)
+}
+
+// ValidateMount checks that the host side is an existing directory and the
+// guest side an absolute path that the fw_cfg table can carry.
+func ValidateMount(m Mount) error {
+	if runtime.GOOS == "windows" {
+		return fmt.Errorf("shared folders are not supported on Windows hosts")
+	}
+	info, err := os.Stat(m.HostPath)
+	if err != nil {
+		return fmt.Errorf("mount host path %s: %w", m.HostPath, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("mount host path %s is not a directory", m.HostPath)
+	}
+	if !path.IsAbs(m.GuestPath) || path.Clean(m.GuestPath) == "/" {
+		return fmt.Errorf("mount guest path %q must be an absolute path other than /", m.GuestPath)
+	}
+	if strings.ContainsAny(m.GuestPath, ";=,: \t\n") {
+		return fmt.Errorf("mount guest path %q must not contain spaces or any of ;=,:", m.GuestPath)
+	}
+	return nil
+}
+
+// mountTag is the 9p mount_tag of the i-th mount.
+func mountTag(i int) string {
+	return fmt.Sprintf("nido%d", i)
+}
+
+// mountArgs shares each mount over virtio-9p and publishes the
+// "tag=/path[:ro];..." table to the guest through fw_cfg.
+// security_model=none keeps host ownership visible to the guest.
+func mountArgs(mounts []Mount) []string {
+	var args []string
+	table := make([]string, 0, len(mounts))
+	for i, m := range mounts {
+		tag := mountTag(i)
+		fsdev := fmt.Sprintf("local,id=fs%d,path=%s,security_model=none", i, qemuOptEscape(m.HostPath))
+		entry := tag + "=" + path.Clean(m.GuestPath)
+		if m.ReadOnly {
+			fsdev += ",readonly=on"
+			entry += ":ro"
+		}
+		args = append(args,
+			"-fsdev", fsdev,
+			"-device", fmt.Sprintf("virtio-9p-pci,fsdev=fs%d,mount_tag=%s", i, tag),
+		)
+		table = append(table, entry)
+	}
+	return append(args, "-fw_cfg", "name="+mountFWCfgName+",string="+qemuOptEscape(strings.Join(table, ";")))
+}
+
+// qemuOptEscape doubles commas, QEMU's escape inside -opt key=value lists.
+func qemuOptEscape(s string) string {
+	return strings.ReplaceAll(s, ",", ",,")
+}
+
+// MountAdd shares a host folder with a stopped VM. The 9p devices are part
+// of the machine layout, so changes wait for the next boot.
+func (p *QemuProvider) MountAdd(name string, m Mount) error {
+	if err := ValidateMount(m); err != nil {
+		return err
+	}
+	m.GuestPath = path.Clean(m.GuestPath)
+	return p.updateStopped(name, "changing mounts", func(state *VMState) error {
+		for _, existing := range state.Mounts {
+			if existing.GuestPath == m.GuestPath {
+				return fmt.Errorf("guest path %s already has a mount on VM '%s'", m.GuestPath, name)
+			}
+		}
+		state.Mounts = append(state.Mounts, m)
+		return nil
+	})
+}
+
+// MountRemove drops the shared folder mounted at guestPath on a stopped VM.
+func (p *QemuProvider) MountRemove(name, guestPath string) error {
+	guestPath = path.Clean(guestPath)
+	return p.updateStopped(name, "changing mounts", func(state *VMState) error {
+		for i, m := range state.Mounts {
+			if m.GuestPath == guestPath {
+				state.Mounts = append(state.Mounts[:i], state.Mounts[i+1:]...)
+				return nil
+			}
+		}
+		return fmt.Errorf("mount %s not found on VM '%s'", guestPath, name)
+	})
+}
+
+// updateStopped applies fn to the state of an existing, stopped VM for
+// changes that alter its machine layout. action completes "stop it
+// before ...".
+func (p *QemuProvider) updateStopped(name, action string, fn func(state *VMState) error) error {
+	return p.editStopped(name, action, false, fn)
+}
+
+// updateStoppedNest is updateStopped for changes checked against other
+// VMs: fn also runs under the nest lock.
+func (p *QemuProvider) updateStoppedNest(name, action string, fn func(state *VMState) error) error {
+	return p.editStopped(name, action, true, fn)
+}
+
+func (p *QemuProvider) editStopped(name, action string, nest bool, fn func(state *VMState) error) error {
+	if _, err := p.vmDiskPath(name); err != nil {
+		return err
+	}
+	_, err := p.editState(name, nest, func(state *VMState) error {
+		if processAlive(p.livePID(name, *state)) {
+			return fmt.Errorf("VM '%s' is running; stop it before %s", name, action)
+		}
+		return fn(state)
+	})
+	return err
+}
@@ -0,0 +1,114 @@
+package provider
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/Josepavese/nido/internal/config"
+)
+
+func TestParseMount(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shared folders are not supported on Windows hosts")
+	}
+	host := t.TempDir()
+
+	m, err := ParseMount(host + ":/work:ro")
+	if err != nil {
+		t.Fatalf("ParseMount: %v", err)
+	}
+	if m.HostPath != host || m.GuestPath != "/work" || !m.ReadOnly {
+		t.Fatalf("ParseMount = %+v", m)
+	}
+	if m, err := ParseMount(host + ":/data:rw"); err != nil || m.ReadOnly || m.GuestPath != "/data" {
+		t.Fatalf("ParseMount rw = %+v, %v", m, err)
+	}
+
+	for _, bad := range []string{
+		host,
+		host + ":work",
+		host + ":/",
+		host + ":/my dir",
+		host + ":/a;b",
+		filepath.Join(host, "missing") + ":/work",
+	} {
+		if _, err := ParseMount(bad); err == nil {
+			t.Fatalf("ParseMount(%q) accepted an invalid mount", bad)
+		}
+	}
+}
+
+func TestMountArgs(t *testing.T) {
+	args := strings.Join(mountArgs([]Mount{
+		{HostPath: "/src/a,b", GuestPath: "/work"},
+		{HostPath: "/srv/data", GuestPath: "/data/", ReadOnly: true},
+	}), " ")
+
+	for _, want := range []string{
+		"-fsdev local,id=fs0,path=/src/a,,b,security_model=none ",
+		"-device virtio-9p-pci,fsdev=fs0,mount_tag=nido0",
+		"-fsdev local,id=fs1,path=/srv/data,security_model=none,readonly=on ",
+		"-device virtio-9p-pci,fsdev=fs1,mount_tag=nido1",
+		"-fw_cfg name=opt/nido/mounts,string=nido0=/work;nido1=/data:ro",
+	} {
+		if !strings.Contains(args, want) {
+			t.Fatalf("mount args missing %q:\n%s", want, args)
+		}
+	}
+}
+
+func TestMountAddRemovePersistsState(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shared folders are not supported on Windows hosts")
+	}
+	root := t.TempDir()
+	p := &QemuProvider{RootDir: root, Config: &config.Config{}}
+	for _, f := range []string{"vms/vm.qcow2", "run/vm.json"} {
+		path := filepath.Join(root, f)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte("{}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	host := t.TempDir()
+
+	if err := p.MountAdd("vm", Mount{HostPath: host, GuestPath: "/work/"}); err != nil {
+		t.Fatalf("MountAdd: %v", err)
+	}
+	if err := p.MountAdd("vm", Mount{HostPath: host, GuestPath: "/work"}); err == nil {
+		t.Fatal("MountAdd accepted a duplicate guest path")
+	}
+	state, err := p.loadState("vm")
+	if err != nil || len(state.Mounts) != 1 || state.Mounts[0].GuestPath != "/work" {
+		t.Fatalf("state after add = %+v, %v", state.Mounts, err)
+	}
+
+	if err := p.MountRemove("vm", "/work"); err != nil {
+		t.Fatalf("MountRemove: %v", err)
+	}
+	if err := p.MountRemove("vm", "/work"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("MountRemove of a missing mount = %v", err)
+	}
+	if state, _ := p.loadState("vm"); len(state.Mounts) != 0 {
+		t.Fatalf("state after remove = %+v", state.Mounts)
+	}
+}
+
+func TestCloudInitInstallsMountHelper(t *testing.T) {
+	ci := CloudInit{User: "vmuser", SSHKey: "ssh-ed25519 AAAATEST nido-test"}
+	userData := ci.buildUserData()
+
+	for _, want := range []string{
+		"  - path: /usr/local/sbin/nido-mounts\n",
+		"      table=/sys/firmware/qemu_fw_cfg/by_name/opt/nido/mounts/raw\n",
+		"      ExecStart=/usr/local/sbin/nido-mounts\n",
+		"systemctl enable --now nido-mounts.service",
+	} {
+		if !strings.Contains(userData, want) {
+			t.Fatalf("cloud-config missing %q:\n%s", want, userData)
+		}
+	}
+}
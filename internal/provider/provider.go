@@ -5,6 +5,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Josepavese/nido/internal/config"
 )
@@ -75,6 +76,9 @@ type VMStatus struct {
 	SSHUser    string
 	Cmdline    string
 	Forwarding []PortForward
+	// ExpiresAt is when the reaper removes the VM, nil for no TTL.
+	ExpiresAt *time.Time        `json:"expires_at,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
 }
 
 // PortForward represents a specific Guest to Host port mapping.
@@ -95,8 +99,13 @@ type NetworkConfig struct {
 
 // VMOptions defines parameters for creating/starting a VM.
 type VMOptions struct {
-	MemoryMB     int
-	VCPUs        int
+	MemoryMB int
+	VCPUs    int
+	// MaxMemoryMB is the ceiling for live memory changes through the balloon
+	// (0 means MemoryMB).
+	MaxMemoryMB int
+	// MaxVCPUs enables vCPU hotplug up to this count (0 disables it).
+	MaxVCPUs     int
 	DiskPath     string
 	UserDataPath string
 	Gui          bool
@@ -112,6 +121,78 @@ type VMOptions struct {
 	RawQemuArgs []string
 	// Accelerators defines the PCI devices (e.g., "0000:01:00.0") to auto-bind and pass through.
 	Accelerators []string
+	// Mounts shares host directories with the guest (spawn only).
+	Mounts []Mount
+	// Limits confines the QEMU process through cgroup v2 (nil for none).
+	Limits *ResourceLimits
+	// RestartPolicy tells the supervisor daemon what to do when QEMU exits
+	// on its own: RestartNo (default), RestartOnFailure or RestartAlways.
+	RestartPolicy string
+	// TTL expires the VM this long after spawn (0 for never); OnExpiry is
+	// ExpiryDelete (default) or ExpiryStop.
+	TTL      time.Duration
+	OnExpiry string
+	// Labels tag the VM for selectors such as team=search.
+	Labels map[string]string
+}
+
+// Restart policies applied by 'nido daemon'.
+const (
+	RestartNo        = "no"
+	RestartOnFailure = "on-failure"
+	RestartAlways    = "always"
+)
+
+// ExitRecord is why a VM's QEMU process last exited without 'nido stop'.
+type ExitRecord struct {
+	Time   time.Time `json:"time"`
+	Reason string    `json:"reason"`
+	// Failure is false for clean exits such as a guest power-off.
+	Failure bool `json:"failure"`
+	// Console holds the last serial console lines of a failed VM.
+	Console []string `json:"console,omitempty"`
+	// RestartAt is when the supervisor restarts the VM; nil when it stays down.
+	RestartAt *time.Time `json:"restart_at,omitempty"`
+}
+
+// SupervisorEvent is one thing the supervisor daemon did or saw.
+type SupervisorEvent struct {
+	Time    time.Time `json:"time"`
+	VM      string    `json:"vm,omitempty"`
+	Message string    `json:"message"`
+}
+
+// ResourceLimits caps the host resources of a VM's QEMU process through
+// cgroup v2. Zero fields are unlimited.
+type ResourceLimits struct {
+	// CPUs is the CPU time quota in cores (1.5 = one and a half cores).
+	CPUs float64 `json:"cpus,omitempty"`
+	// MemoryMaxMB caps guest RAM plus QEMU's own overhead.
+	MemoryMaxMB int `json:"memory_max_mb,omitempty"`
+	// IOWeight is the relative block IO weight, 1-10000 (100 is the default).
+	IOWeight int `json:"io_weight,omitempty"`
+	// PidsMax caps QEMU's processes and threads.
+	PidsMax int `json:"pids_max,omitempty"`
+}
+
+// IsZero reports whether no limit is set.
+func (l ResourceLimits) IsZero() bool {
+	return l == ResourceLimits{}
+}
+
+// CgroupStatus tells whether a running VM's limits are enforced and what it
+// currently uses.
+type CgroupStatus struct {
+	Enforced bool `json:"enforced"`
+	// Path is the cgroup directory of the QEMU process.
+	Path string `json:"path,omitempty"`
+	// Reason explains why limits are not enforced.
+	Reason       string `json:"reason,omitempty"`
+	MemoryBytes  int64  `json:"memory_bytes,omitempty"`
+	CPUUsec      int64  `json:"cpu_usec,omitempty"`
+	Pids         int    `json:"pids,omitempty"`
+	IOReadBytes  int64  `json:"io_read_bytes,omitempty"`
+	IOWriteBytes int64  `json:"io_write_bytes,omitempty"`
 }
 
 // VMDetail contains comprehensive data about a VM.
@@ -123,16 +204,25 @@ type VMDetail struct {
 	SSHUser  string
 	SSHPort  int
 	VNCPort  int
-	MemoryMB int    `json:"memory_mb,omitempty"`
-	VCPUs    int    `json:"vcpus,omitempty"`
-	Gui      bool   `json:"gui,omitempty"`
-	Cmdline  string `json:"cmdline,omitempty"`
+	MemoryMB int `json:"memory_mb,omitempty"`
+	VCPUs    int `json:"vcpus,omitempty"`
+	// Ceilings for live memory and vCPU changes.
+	MaxMemoryMB int    `json:"max_memory_mb,omitempty"`
+	MaxVCPUs    int    `json:"max_vcpus,omitempty"`
+	Gui         bool   `json:"gui,omitempty"`
+	Cmdline     string `json:"cmdline,omitempty"`
 	// Active port forwardings
 	Forwarding []PortForward
 	// Raw arguments active
 	RawQemuArgs []string `json:"raw_qemu_args,omitempty"`
 	// Accelerators active
 	Accelerators []string `json:"accelerators,omitempty"`
+	// Mounts are the shared host folders.
+	Mounts []Mount `json:"mounts,omitempty"`
+	// Volumes are the attached data volumes.
+	Volumes []VolumeAttachment `json:"volumes,omitempty"`
+	// Devices are the hot-pluggable devices added with DeviceAdd.
+	Devices []Device `json:"devices,omitempty"`
 	// DiskPath is the absolute path to the VM disk image.
 	DiskPath string
 	// DiskMissing indicates the disk file is missing on disk.
@@ -141,6 +231,23 @@ type VMDetail struct {
 	BackingPath string
 	// BackingMissing indicates the backing file is missing on disk.
 	BackingMissing bool
+	// DiskSizeBytes is the virtual size of the disk image, 0 if unknown.
+	DiskSizeBytes int64 `json:"disk_size_bytes,omitempty"`
+	// Limits are the configured cgroup limits.
+	Limits *ResourceLimits `json:"limits,omitempty"`
+	// Cgroup is set for running VMs with limits.
+	Cgroup *CgroupStatus `json:"cgroup,omitempty"`
+	// RestartPolicy is applied by the supervisor daemon.
+	RestartPolicy string `json:"restart_policy,omitempty"`
+	// Restarts counts supervisor restarts since the VM last ran stably.
+	Restarts int `json:"restarts,omitempty"`
+	// LastExit is the last exit the supervisor saw, nil if none.
+	LastExit *ExitRecord `json:"last_exit,omitempty"`
+	// ExpiresAt is when the reaper deletes (or stops, per OnExpiry) the VM.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	OnExpiry  string     `json:"on_expiry,omitempty"`
+	// Labels are the VM's key=value tags.
+	Labels map[string]string `json:"labels,omitempty"`
 }
 
 // CachedImage represents a cached cloud image.
@@ -156,6 +263,212 @@ type CacheInfoResult struct {
 	TotalSize string
 }
 
+// Snapshot is an internal qcow2 snapshot stored inside a VM disk.
+type Snapshot struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	// VMStateSize is non-zero when the snapshot also holds RAM/device state.
+	VMStateSize int64 `json:"vm_state_size"`
+}
+
+// IsCheckpoint reports whether the snapshot can resume a VM without booting.
+func (s Snapshot) IsCheckpoint() bool {
+	return s.VMStateSize > 0
+}
+
+// ValidateSnapshotName applies the VM naming rules to snapshot names and
+// rejects purely numeric names, which qemu-img would treat as snapshot IDs.
+func ValidateSnapshotName(name string) error {
+	if name == "" {
+		return fmt.Errorf("snapshot name cannot be empty")
+	}
+	numeric := true
+	for _, r := range name {
+		if !((r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '-' || r == '_' || r == '.') {
+			return fmt.Errorf("invalid snapshot name %q: only alphanumeric characters, dashes, underscores, and dots are allowed", name)
+		}
+		if r < '0' || r > '9' {
+			numeric = false
+		}
+	}
+	if numeric {
+		return fmt.Errorf("invalid snapshot name %q: must contain at least one non-digit", name)
+	}
+	return nil
+}
+
+// ExecOptions tunes a command run with Exec.
+type ExecOptions struct {
+	// Env entries in KEY=VALUE form, set for the command only.
+	Env []string
+	// Workdir is the guest directory the command runs in.
+	Workdir string
+	// Timeout aborts the command when exceeded; zero means no limit.
+	Timeout time.Duration
+}
+
+// ExecResult is the outcome of a command run with Exec.
+type ExecResult struct {
+	ExitCode   int    `json:"exit_code"`
+	Stdout     string `json:"stdout"`
+	Stderr     string `json:"stderr"`
+	DurationMS int64  `json:"duration_ms"`
+	TimedOut   bool   `json:"timed_out"`
+}
+
+// Mount shares a host directory with the guest. The guest mounts it at
+// GuestPath on every boot.
+type Mount struct {
+	HostPath  string `json:"host_path"`
+	GuestPath string `json:"guest_path"`
+	ReadOnly  bool   `json:"read_only,omitempty"`
+}
+
+// Device types accepted by DeviceAdd.
+const (
+	DeviceDisk       = "disk"
+	DeviceNIC        = "nic"
+	DeviceUSBStorage = "usb-storage"
+)
+
+// Device is an extra disk, NIC or USB stick plugged into a VM. Devices are
+// hot-plugged into running VMs and recreated from VMState on every start.
+type Device struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Source   string `json:"source,omitempty"`
+	ReadOnly bool   `json:"read_only,omitempty"`
+	// Removing marks a device the guest has not released yet. QEMU still
+	// holds it until DEVICE_DELETED or the next boot.
+	Removing bool `json:"removing,omitempty"`
+}
+
+// Volume is a named data disk stored outside any VM. It survives Delete and
+// can be attached to one VM read-write or to several read-only.
+type Volume struct {
+	Name        string             `json:"name"`
+	Path        string             `json:"path"`
+	SizeBytes   int64              `json:"size_bytes"`
+	Attachments []VolumeAttachment `json:"attachments"`
+}
+
+// VolumeAttachment links a volume to a VM. VMState records it by Volume,
+// Volume.Attachments by VM.
+type VolumeAttachment struct {
+	VM       string `json:"vm,omitempty"`
+	Volume   string `json:"volume,omitempty"`
+	ReadOnly bool   `json:"read_only,omitempty"`
+}
+
+// CopyOptions tunes Upload and Download.
+type CopyOptions struct {
+	// OnProgress, when set, receives the file bytes copied so far and the
+	// total (0 when unknown, as for downloads).
+	OnProgress func(current, total int64)
+	// MaxBytes, when positive, aborts a Download with ErrCopyTooLarge as
+	// soon as the file payload would exceed it.
+	MaxBytes int64
+	// NoTargetDirectory copies to exactly the destination path, like
+	// cp -T, instead of into it when it is an existing directory.
+	NoTargetDirectory bool
+}
+
+// CopyResult summarizes a finished Upload or Download.
+type CopyResult struct {
+	// Target is the path the source was copied to.
+	Target     string `json:"target"`
+	Files      int    `json:"files"`
+	Bytes      int64  `json:"bytes"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// WaitOptions selects what Wait blocks on.
+type WaitOptions struct {
+	// For lists readiness conditions, checked in order: "ssh", "cloud-init",
+	// "port:N" (guest port listening) or "file:/path". Empty means ssh.
+	For []string
+	// Timeout bounds the whole wait; zero uses a 5 minute default.
+	Timeout time.Duration
+	// OnStage, when set, is called as each stage is reached.
+	OnStage func(WaitStage)
+}
+
+// WaitStage records one readiness stage and how long it took after the
+// previous one.
+type WaitStage struct {
+	Stage      string `json:"stage"`
+	Reached    bool   `json:"reached"`
+	DurationMS int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// WaitResult summarizes a Wait call; Stages is filled even on failure.
+type WaitResult struct {
+	Ready      bool        `json:"ready"`
+	Stages     []WaitStage `json:"stages"`
+	DurationMS int64       `json:"duration_ms"`
+}
+
+// GuestInfo is what the QEMU guest agent reports from inside a running VM.
+type GuestInfo struct {
+	Hostname    string            `json:"hostname,omitempty"`
+	OS          string            `json:"os,omitempty"`
+	OSVersion   string            `json:"os_version,omitempty"`
+	Kernel      string            `json:"kernel,omitempty"`
+	IPs         []string          `json:"ips,omitempty"`
+	Filesystems []GuestFilesystem `json:"filesystems,omitempty"`
+}
+
+// GuestFilesystem is one mounted guest filesystem; sizes are zero when the
+// agent does not report usage.
+type GuestFilesystem struct {
+	Mountpoint string `json:"mountpoint"`
+	Type       string `json:"type"`
+	Device     string `json:"device"`
+	UsedBytes  uint64 `json:"used_bytes"`
+	TotalBytes uint64 `json:"total_bytes"`
+}
+
+// LogLine is one line of a VM's serial console log. Time is when the line
+// started; it is zero for logs written without timestamps.
+type LogLine struct {
+	Time time.Time `json:"time"`
+	Text string    `json:"text"`
+}
+
+// LogOptions selects serial log lines.
+type LogOptions struct {
+	// Since drops lines older than this time (zero keeps all).
+	Since time.Time
+	// Tail keeps only the last Tail lines (0 keeps all).
+	Tail int
+	// Follow keeps emitting new lines until the VM stops.
+	Follow bool
+}
+
+// Input actions accepted by SendInput.
+const (
+	InputType  = "type"
+	InputKey   = "key"
+	InputClick = "click"
+	InputMove  = "move"
+)
+
+// InputAction is one keyboard or pointer action for a running VM.
+// Coordinates are display pixels, as in Screenshot.
+type InputAction struct {
+	Action string `json:"action"`
+	// Text is typed for InputType (US layout).
+	Text string `json:"text,omitempty"`
+	// Keys are chords like "ctrl+alt+t" pressed in order for InputKey.
+	Keys []string `json:"keys,omitempty"`
+	X    int      `json:"x,omitempty"`
+	Y    int      `json:"y,omitempty"`
+	// Button is left (default), right or middle for InputClick.
+	Button string `json:"button,omitempty"`
+}
+
 // VMProvider defines the contract for OS-specific hypervisor management.
 // Implementations handle VM lifecycle, storage, and connectivity operations.
 type VMProvider interface {
@@ -165,6 +478,11 @@ type VMProvider interface {
 	// If opts.DiskPath is empty, uses the default template from config.
 	Spawn(name string, opts VMOptions) error
 
+	// SpawnBatch spawns one VM per name from the same options, up to
+	// parallel at a time, waiting on each when wait is set. A failed VM
+	// does not stop the others; each has its own result.
+	SpawnBatch(names []string, opts VMOptions, parallel int, wait *WaitOptions) ([]SpawnResult, error)
+
 	// Start boots up a stopped VM. Returns nil if already running.
 	// If gui is true, enables the graphical interface.
 	Start(name string, opts VMOptions) error
@@ -215,6 +533,21 @@ type VMProvider interface {
 	// Returns the count of VMs deleted.
 	Prune() (int, error)
 
+	// SetTTL sets, extends or clears a VM's time-to-live (TTLSet, TTLExtend,
+	// TTLClear) and returns the new expiry, nil when cleared.
+	SetTTL(name, action string, d time.Duration) (*time.Time, error)
+
+	// ReapExpired deletes or stops the VMs whose TTL ran out.
+	ReapExpired() ([]ExpiredVM, error)
+
+	// SetLabels adds or overwrites labels and removes the given keys,
+	// returning the resulting labels.
+	SetLabels(name string, set map[string]string, remove []string) (map[string]string, error)
+
+	// MigrateStates upgrades the state files written by an older nido to
+	// StateSchemaVersion, one report per outdated VM. dryRun only reports.
+	MigrateStates(dryRun bool) ([]StateMigration, error)
+
 	// Cache operations
 
 	// ListCachedImages returns all cached cloud images.
@@ -230,12 +563,99 @@ type VMProvider interface {
 	// CacheRemove removes a specific cached image by name and version.
 	CacheRemove(name, version string) error
 
+	// Snapshots
+
+	// SnapshotCreate records the current disk contents under name. Running
+	// VMs are snapshotted live through the monitor.
+	SnapshotCreate(vmName, name string) error
+
+	// SnapshotList returns the snapshots stored in the VM disk.
+	SnapshotList(vmName string) ([]Snapshot, error)
+
+	// SnapshotRestore reverts the disk to a snapshot. The VM must be stopped.
+	SnapshotRestore(vmName, name string) error
+
+	// SnapshotDelete removes a snapshot from the VM disk.
+	SnapshotDelete(vmName, name string) error
+
+	// Checkpoint saves the RAM, device and disk state of a running VM as a
+	// snapshot. An empty name is replaced by a timestamped one.
+	Checkpoint(vmName, name string) (Snapshot, error)
+
+	// Resume brings a VM back to a checkpoint without booting. A running VM
+	// is rewound in place. An empty checkpoint selects the most recent one.
+	Resume(vmName, checkpoint string) (Snapshot, error)
+
+	// Fork freezes the VM disk into a shared base and spawns count linked
+	// clones named prefix1..prefixN. A running source is paused only while
+	// the base is taken. It returns the clones created before any failure.
+	Fork(vmName string, count int, prefix string) ([]string, error)
+
 	// Connectivity
 
 	// SSHCommand generates the SSH connection string for a VM.
 	// Format: "ssh -p <port> <user>@<ip>"
 	SSHCommand(name string) (string, error)
 
+	// Exec runs a command inside a running VM and captures its exit code,
+	// stdout and stderr. A non-zero exit code is not an error.
+	Exec(name string, command []string, opts ExecOptions) (ExecResult, error)
+
+	// Upload copies a host file or directory into a running VM, cp-style:
+	// an existing guest directory receives the source under its own name.
+	Upload(name, hostPath, guestPath string, opts CopyOptions) (CopyResult, error)
+
+	// Download copies a guest file or directory to the host, cp-style.
+	Download(name, guestPath, hostPath string, opts CopyOptions) (CopyResult, error)
+
+	// Wait blocks until a running VM meets the readiness conditions in opts.
+	Wait(name string, opts WaitOptions) (WaitResult, error)
+
+	// GuestInfo queries the guest agent of a running VM for hostname, OS,
+	// addresses and filesystem usage.
+	GuestInfo(name string) (GuestInfo, error)
+
+	// MountAdd shares a host folder with a stopped VM from its next boot.
+	MountAdd(name string, m Mount) error
+
+	// MountRemove drops the shared folder mounted at guestPath.
+	MountRemove(name, guestPath string) error
+
+	// VolumeCreate makes an empty data volume of the given size (e.g. "50G").
+	VolumeCreate(name, size string) (Volume, error)
+
+	// VolumeList returns all volumes with the VMs they are attached to.
+	VolumeList() ([]Volume, error)
+
+	// VolumeDelete removes a volume that no VM uses.
+	VolumeDelete(name string) error
+
+	// VolumeAttach adds a volume to a stopped VM.
+	VolumeAttach(vmName, volume string, readOnly bool) error
+
+	// VolumeDetach removes a volume from a stopped VM.
+	VolumeDetach(vmName, volume string) error
+
+	// ConsoleSocket returns the socket of the running VM's serial console,
+	// starting the console relay if needed.
+	ConsoleSocket(name string) (string, error)
+
+	// Logs emits the VM's serial console log, oldest line first.
+	Logs(name string, opts LogOptions, emit func(LogLine)) error
+
+	// Screenshot returns the display of a running VM as PNG.
+	Screenshot(name string) ([]byte, error)
+
+	// SendInput injects keyboard or pointer input into a running VM.
+	SendInput(name string, in InputAction) error
+
+	// DeviceAdd plugs a device into the VM, live when it is running. An
+	// empty ID is assigned from the device type (disk0, nic1, usb0, ...).
+	DeviceAdd(name string, dev Device) (Device, ApplyMode, error)
+
+	// DeviceRemove unplugs the device with the given ID (live when possible).
+	DeviceRemove(name, id string) (ApplyMode, error)
+
 	// Health checks
 
 	// Doctor runs system diagnostics and returns a report of checks performed.
@@ -243,11 +663,12 @@ type VMProvider interface {
 	// Port management
 
 	// PortForward adds a new port mapping to the VM.
-	// If hostPort is 0, one is automatically assigned.
-	PortForward(name string, pf PortForward) (PortForward, error)
+	// If hostPort is 0, one is automatically assigned. Running VMs pick the
+	// mapping up immediately when possible; the returned ApplyMode says which.
+	PortForward(name string, pf PortForward) (PortForward, ApplyMode, error)
 
-	// PortUnforward removes an existing port mapping.
-	PortUnforward(name string, guestPort int, protocol string) error
+	// PortUnforward removes an existing port mapping (live when possible).
+	PortUnforward(name string, guestPort int, protocol string) (ApplyMode, error)
 
 	// PortList returns all active port mappings for the VM.
 	PortList(name string) ([]PortForward, error)
@@ -255,17 +676,31 @@ type VMProvider interface {
 	// Config operations
 
 	// UpdateConfig modifies the persistent configuration of a VM.
-	// Updates are applied to the SSOT (VMState JSON) and take effect on next boot.
-	UpdateConfig(name string, updates VMConfigUpdates) error
+	// Updates are applied to the SSOT (VMState JSON). Port forwarding changes
+	// reach a running VM immediately, memory and vCPUs too when Live is set;
+	// everything else takes effect on next boot.
+	UpdateConfig(name string, updates VMConfigUpdates) (ApplyMode, error)
 
 	Doctor() []string
 }
 
+// ApplyMode reports when a configuration change takes effect.
+type ApplyMode string
+
+const (
+	// AppliedLive means the running VM already reflects the change.
+	AppliedLive ApplyMode = "live"
+	// AppliedNextBoot means the change is persisted and used on next start.
+	AppliedNextBoot ApplyMode = "next_boot"
+)
+
 // VMConfigUpdates holds pointer fields for partial updates to VM configuration.
 // A nil pointer means "do not update".
 type VMConfigUpdates struct {
 	MemoryMB     *int
 	VCPUs        *int
+	MaxMemoryMB  *int
+	MaxVCPUs     *int
 	Gui          *bool
 	Cmdline      *string
 	SSHPort      *int
@@ -274,6 +709,22 @@ type VMConfigUpdates struct {
 	Forwarding   *[]PortForward
 	RawQemuArgs  *[]string
 	Accelerators *[]string
+	// DiskSize grows the root disk: "+20G" relative or "60G" absolute.
+	// Shrinking is rejected.
+	DiskSize *string
+	// Live applies MemoryMB and VCPUs to the running VM (balloon and vCPU
+	// hotplug) and fails instead of deferring them to the next boot.
+	Live bool
+	// Cgroup limits, field by field; 0 removes a limit. Running VMs whose
+	// limits are enforced pick them up live.
+	CPULimit      *float64
+	MemoryLimitMB *int
+	IOWeight      *int
+	PidsLimit     *int
+	// RestartPolicy for the supervisor daemon; takes effect at once.
+	RestartPolicy *string
+	// OnExpiry is what the reaper does once the TTL runs out.
+	OnExpiry *string
 }
 
 // ParsePortForward parses strings like "web:80:32080/tcp" or "80".
@@ -2,11 +2,13 @@ package provider
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"runtime"
 	"sort"
@@ -16,8 +18,10 @@ import (
 	nidonet "github.com/Josepavese/nido/internal/net"
 	"github.com/Josepavese/nido/internal/pkg/sysutil"
 
+	"github.com/Josepavese/nido/internal/cgroup"
 	"github.com/Josepavese/nido/internal/config"
 	"github.com/Josepavese/nido/internal/image"
+	"github.com/Josepavese/nido/internal/qmp"
 )
 
 // QemuProvider implements VMProvider using raw QEMU.
@@ -46,11 +50,48 @@ func (p *QemuProvider) Spawn(name string, opts VMOptions) error {
 	if err := ValidateAccelerators(opts.Accelerators); err != nil {
 		return err
 	}
+	if opts.MaxMemoryMB > 0 && opts.MaxMemoryMB < opts.MemoryMB {
+		return fmt.Errorf("max memory (%d MB) is below memory (%d MB)", opts.MaxMemoryMB, opts.MemoryMB)
+	}
+	if opts.MaxVCPUs > 0 && opts.MaxVCPUs < opts.VCPUs {
+		return fmt.Errorf("max vCPUs (%d) is below vCPUs (%d)", opts.MaxVCPUs, opts.VCPUs)
+	}
+	if opts.Limits != nil {
+		mem := opts.MemoryMB
+		if mem == 0 {
+			mem = sysutil.DefaultMemory()
+		}
+		if err := ValidateLimits(*opts.Limits, memoryCeilingMB(mem, opts.MaxMemoryMB)); err != nil {
+			return err
+		}
+	}
+	if err := ValidateRestartPolicy(opts.RestartPolicy); err != nil {
+		return err
+	}
+	if err := ValidateOnExpiry(opts.OnExpiry); err != nil {
+		return err
+	}
+	for k, v := range opts.Labels {
+		if err := ValidateLabel(k, v); err != nil {
+			return err
+		}
+	}
 	for _, pf := range opts.Forwarding {
 		if err := ValidatePortForward(pf); err != nil {
 			return err
 		}
 	}
+	seenMounts := map[string]bool{}
+	for i, m := range opts.Mounts {
+		if err := ValidateMount(m); err != nil {
+			return err
+		}
+		opts.Mounts[i].GuestPath = path.Clean(m.GuestPath)
+		if seenMounts[opts.Mounts[i].GuestPath] {
+			return fmt.Errorf("guest path %s is mounted more than once", opts.Mounts[i].GuestPath)
+		}
+		seenMounts[opts.Mounts[i].GuestPath] = true
+	}
 	// Only allow alphanumeric, hyphens, underscores, and dots. Rejects spaces.
 	// (Unless it's an absolute path, which we handle separately)
 	if !filepath.IsAbs(name) {
@@ -183,6 +224,17 @@ func (p *QemuProvider) Spawn(name string, opts VMOptions) error {
 	}
 
 	// 5. Port Assignment (at spawn time, not start time)
+	// The nest lock is held until the initial state records the ports, so
+	// concurrent spawns, in this process or another, do not pick the same ones.
+	unlockVM, err := p.lockVM(name)
+	if err != nil {
+		return err
+	}
+	unlockNest, err := p.lockNest()
+	if err != nil {
+		unlockVM()
+		return err
+	}
 	reserved := p.getReservedPorts()
 	sshPort := p.findAvailablePort(50022, reserved)
 	vncPort := 0
@@ -219,6 +271,8 @@ func (p *QemuProvider) Spawn(name string, opts VMOptions) error {
 			// Use internal nidonet package for scanning
 			hp, err := nidonet.FindAvailablePort(pRangeStart, pRangeEnd, reserved)
 			if err != nil {
+				unlockNest()
+				unlockVM()
 				return fmt.Errorf("failed to allocate host port for %s: %w", opts.Forwarding[i].Label, err)
 			}
 			opts.Forwarding[i].HostPort = hp
@@ -240,7 +294,42 @@ func (p *QemuProvider) Spawn(name string, opts VMOptions) error {
 		cpu = sysutil.DefaultVCPUs()
 	}
 
-	if err := p.saveState(name, 0, sshPort, vncPort, opts.Gui, sshUser, opts.Forwarding, opts.Cmdline, mem, cpu, opts.RawQemuArgs, opts.Accelerators); err != nil {
+	initial := VMState{
+		Name:         name,
+		SSHPort:      sshPort,
+		VNCPort:      vncPort,
+		Gui:          opts.Gui,
+		SSHUser:      sshUser,
+		Forwarding:   opts.Forwarding,
+		Cmdline:      opts.Cmdline,
+		MemoryMB:     mem,
+		VCPUs:        cpu,
+		MaxMemoryMB:  opts.MaxMemoryMB,
+		MaxVCPUs:     opts.MaxVCPUs,
+		RawQemuArgs:  opts.RawQemuArgs,
+		Accelerators: opts.Accelerators,
+		Mounts:       opts.Mounts,
+	}
+	if opts.Limits != nil && !opts.Limits.IsZero() {
+		initial.Limits = opts.Limits
+	}
+	if opts.RestartPolicy != RestartNo {
+		initial.RestartPolicy = opts.RestartPolicy
+	}
+	if opts.TTL > 0 {
+		expiresAt := time.Now().UTC().Add(opts.TTL)
+		initial.ExpiresAt = &expiresAt
+	}
+	if opts.OnExpiry == ExpiryStop {
+		initial.OnExpiry = ExpiryStop
+	}
+	if len(opts.Labels) > 0 {
+		initial.Labels = opts.Labels
+	}
+	err = p.saveState(initial)
+	unlockNest()
+	unlockVM()
+	if err != nil {
 		return fmt.Errorf("failed to save initial state: %w", err)
 	}
 
@@ -270,8 +359,17 @@ func (p *QemuProvider) Spawn(name string, opts VMOptions) error {
 // Start revives a VM from its deep sleep. It handles port allocation,
 // builds platform-specific QEMU arguments, and launches the process.
 func (p *QemuProvider) Start(name string, opts VMOptions) error {
-	// 0. Check if already running
-	if status, err := p.Info(name); err == nil && status.State == "running" {
+	return p.start(name, opts, "")
+}
+
+// start launches QEMU for a stopped VM. A non-empty checkpoint restores that
+// memory snapshot with -loadvm instead of cold-booting the guest.
+func (p *QemuProvider) start(name string, opts VMOptions, checkpoint string) error {
+	// 0. Check if already alive; a paused guest is simply resumed.
+	if status, err := p.Info(name); err == nil && status.State != "stopped" {
+		if status.State == qmp.StatusPaused {
+			return p.resumeVM(name)
+		}
 		return nil // Already running
 	}
 
@@ -288,71 +386,9 @@ func (p *QemuProvider) Start(name string, opts VMOptions) error {
 	}
 
 	// 2. Port Management
-	state, err := p.loadState(name)
+	state, err := p.prepareStart(name, opts)
 	if err != nil {
-		// Fallback for direct 'start' without 'spawn' (e.g. legacy)
-		state = VMState{
-			Name:    name,
-			Gui:     opts.Gui,
-			SSHUser: p.Config.SSHUser,
-		}
-	}
-
-	// We honor the requested GUI flag even if the previously saved state
-	// had it disabled. Evolution in action.
-	if opts.Gui && !state.Gui {
-		state.Gui = true
-	}
-
-	// Legacy fallback: assign ports if missing (for VMs created before this fix)
-	updated := false
-	if state.SSHPort == 0 {
-		reserved := p.getReservedPorts()
-		state.SSHPort = p.findAvailablePort(50022, reserved)
-		updated = true
-	}
-	if state.Gui && state.VNCPort == 0 {
-		reserved := p.getReservedPorts()
-		state.VNCPort = p.findAvailablePort(59000, reserved)
-		updated = true
-	}
-	// If opts.Cmdline is provided, override the state's cmdline
-	if opts.Cmdline != "" {
-		state.Cmdline = opts.Cmdline
-		updated = true
-	}
-	if opts.MemoryMB > 0 {
-		state.MemoryMB = opts.MemoryMB
-		updated = true
-	}
-	if opts.VCPUs > 0 {
-		state.VCPUs = opts.VCPUs
-		updated = true
-	}
-
-	if len(opts.RawQemuArgs) > 0 {
-		state.RawQemuArgs = opts.RawQemuArgs
-		updated = true
-	}
-
-	if len(opts.Accelerators) > 0 {
-		if err := ValidateAccelerators(opts.Accelerators); err != nil {
-			return err
-		}
-		state.Accelerators = opts.Accelerators
-		updated = true
-	}
-
-	// Ensure defaults for legacy states (Dynamic resolution for retro-compatibility via sysutil SSOT)
-	if state.MemoryMB == 0 {
-		state.MemoryMB = sysutil.DefaultMemory()
-	}
-	if state.VCPUs == 0 {
-		state.VCPUs = sysutil.DefaultVCPUs()
-	}
-
-	if updated {
-		p.saveState(name, 0, state.SSHPort, state.VNCPort, state.Gui, state.SSHUser, state.Forwarding, state.Cmdline, state.MemoryMB, state.VCPUs, state.RawQemuArgs, state.Accelerators)
+		return err
 	}
 
 	// 2.5 Prepare Accelerators (Zero-Config)
@@ -365,21 +401,44 @@ func (p *QemuProvider) Start(name string, opts VMOptions) error {
 	}
 
 	// 3. Build Arguments (cross-platform)
-	args := p.buildQemuArgs(name, diskPath, state.SSHPort, state.VNCPort, state.Forwarding, runDir, state.Cmdline, state.MemoryMB, state.VCPUs, state.RawQemuArgs, state.Accelerators)
+	args := p.buildQemuArgs(state, diskPath, runDir)
+	if checkpoint != "" {
+		args = append(args, "-loadvm", checkpoint)
+	}
 
-	launchedPID, err := p.launchQEMU(args)
+	plan := p.planLimits(name, state.Limits)
+	launchedPID, err := p.launchQEMU(plan.wrapper, args)
+	if err != nil && len(plan.wrapper) > 0 {
+		// The scope could not be created; run unconfined rather than not at all.
+		plan = limitPlan{reason: fmt.Sprintf("systemd-run failed: %v", err)}
+		launchedPID, err = p.launchQEMU(nil, args)
+	}
 	if err != nil && runtime.GOOS == "windows" {
 		fallbackArgs := windowsTCGFallbackArgs(args)
 		if !sameStringSlice(args, fallbackArgs) {
-			launchedPID, err = p.launchQEMU(fallbackArgs)
+			launchedPID, err = p.launchQEMU(nil, fallbackArgs)
 		}
 	}
 	if err != nil {
 		return err
 	}
+	// The relay owns the serial socket from the start so boot output lands
+	// in the log. A failure only costs the console; ConsoleSocket retries.
+	if runtime.GOOS != "windows" {
+		_ = p.startSerialRelay(name)
+	}
 
-	// 4. Skip Bootloader (Background)
-	go p.skipBootloader(name)
+	// 4. Wait for the monitor to report running vCPUs, then skip the
+	// bootloader in the background. A resumed guest is already past boot
+	// and would receive the keystrokes on its console.
+	_ = p.waitReady(name)
+	if memoryCeilingMB(state.MemoryMB, state.MaxMemoryMB) > state.MemoryMB {
+		// Booted at the ceiling; the guest driver picks the target up on load.
+		_ = p.setBalloon(name, state.MemoryMB)
+	}
+	if checkpoint == "" {
+		go p.skipBootloader(name)
+	}
 
 	// 5. Read daemon PID from QEMU pidfile on Unix; Windows has no -daemonize.
 	pid := launchedPID
@@ -397,18 +456,101 @@ func (p *QemuProvider) Start(name string, opts VMOptions) error {
 		}
 	}
 
-	// 6. Update State with PID (0 if unknown)
-	p.saveState(name, pid, state.SSHPort, state.VNCPort, state.Gui, state.SSHUser, state.Forwarding, state.Cmdline, state.MemoryMB, state.VCPUs, state.RawQemuArgs, state.Accelerators)
+	// 6. Update State with PID (0 if unknown) and where its limits landed
+	cg, cgErr := attachLimits(plan, pid)
+	startedAt := time.Now().UTC()
+	_, _ = p.updateState(name, func(state *VMState) error {
+		state.PID = pid
+		state.Cgroup, state.CgroupError = cg, cgErr
+		state.StartedAt = &startedAt
+		if state.LastExit != nil {
+			state.LastExit.RestartAt = nil
+		}
+		return nil
+	})
 
 	return nil
 }
 
-func (p *QemuProvider) launchQEMU(args []string) (int, error) {
+// prepareStart loads the state Start boots from, upgrading it if needed,
+// and records the options it was given.
+func (p *QemuProvider) prepareStart(name string, opts VMOptions) (VMState, error) {
+	unlock, err := p.lockVM(name)
+	if err != nil {
+		return VMState{}, err
+	}
+	defer unlock()
+
+	state, err := p.readState(name)
+	if os.IsNotExist(err) {
+		// A disk without state (e.g. copied into the nest by hand) starts
+		// from an empty state that the migrations fill in.
+		state, err = VMState{Name: name}, nil
+	}
+	if err != nil {
+		return VMState{}, fmt.Errorf("failed to load state for VM '%s': %w", name, err)
+	}
+	if err := checkStateVersion(state); err != nil {
+		return VMState{}, err
+	}
+
+	// We honor the requested GUI flag even if the previously saved state
+	// had it disabled. Evolution in action.
+	if opts.Gui && !state.Gui {
+		state.Gui = true
+	}
+
+	if state.SchemaVersion < StateSchemaVersion || (state.Gui && state.VNCPort == 0) {
+		unlockNest, err := p.lockNest()
+		if err != nil {
+			return VMState{}, err
+		}
+		defer unlockNest()
+		if _, err := p.upgradeState(&state, true); err != nil {
+			return VMState{}, err
+		}
+		// A VM switched to GUI gets its VNC port on its first GUI boot.
+		if state.Gui && state.VNCPort == 0 {
+			state.VNCPort = p.findAvailablePort(59000, p.getReservedPorts())
+		}
+	}
+
+	// If opts.Cmdline is provided, override the state's cmdline
+	if opts.Cmdline != "" {
+		state.Cmdline = opts.Cmdline
+	}
+	if opts.MemoryMB > 0 {
+		state.MemoryMB = opts.MemoryMB
+	}
+	if opts.VCPUs > 0 {
+		state.VCPUs = opts.VCPUs
+	}
+	if len(opts.RawQemuArgs) > 0 {
+		state.RawQemuArgs = opts.RawQemuArgs
+	}
+	if len(opts.Accelerators) > 0 {
+		if err := ValidateAccelerators(opts.Accelerators); err != nil {
+			return VMState{}, err
+		}
+		state.Accelerators = opts.Accelerators
+	}
+
+	state.PID = 0
+	state.Devices = bootDevices(state.Devices)
+	if err := p.saveState(state); err != nil {
+		return VMState{}, fmt.Errorf("failed to save state for VM '%s': %w", name, err)
+	}
+	return state, nil
+}
+
+// launchQEMU starts QEMU, behind wrapper (e.g. systemd-run) when given.
+func (p *QemuProvider) launchQEMU(wrapper, args []string) (int, error) {
 	qemuBin, err := sysutil.QemuSystemBinary()
 	if err != nil {
 		qemuBin = "qemu-system-x86_64"
 	}
-	cmd := exec.Command(qemuBin, args...)
+	argv := append(append(append([]string(nil), wrapper...), qemuBin), args...)
+	cmd := exec.Command(argv[0], argv[1:]...)
 	cmd.SysProcAttr = detachedQemuSysProcAttr()
 
 	var stderr bytes.Buffer
@@ -469,11 +611,14 @@ func sameStringSlice(a, b []string) bool {
 	return true
 }
 
-// buildQemuArgs constructs the heavy-duty command line arguments for QEMU.
-func (p *QemuProvider) buildQemuArgs(name, diskPath string, sshPort int, vncPort int, fw []PortForward, runDir string, cmdline string, memoryMB, vcpus int, rawArgs []string, accelerators []string) []string {
+// buildQemuArgs constructs the heavy-duty command line arguments for QEMU
+// from the VM's saved state.
+func (p *QemuProvider) buildQemuArgs(state VMState, diskPath, runDir string) []string {
+	name := state.Name
 	vmsDir := filepath.Join(p.RootDir, "vms")
 
 	// Safe minimums if 0 (for robustness, should be handled by Spawn)
+	memoryMB, vcpus := state.MemoryMB, state.VCPUs
 	if memoryMB == 0 {
 		memoryMB = 128
 	}
@@ -483,7 +628,7 @@ func (p *QemuProvider) buildQemuArgs(name, diskPath string, sshPort int, vncPort
 
 	args := []string{
 		"-name", name,
-		"-m", fmt.Sprintf("%d", memoryMB),
+		"-m", fmt.Sprintf("%d", memoryCeilingMB(memoryMB, state.MaxMemoryMB)),
 		"-machine", "pc",
 	}
 
@@ -511,7 +656,7 @@ func (p *QemuProvider) buildQemuArgs(name, diskPath string, sshPort int, vncPort
 
 	// Override CPU if user requested specific count or default
 	if vcpus > 0 {
-		args = append(args, "-smp", fmt.Sprintf("%d", vcpus))
+		args = append(args, "-smp", smpArg(vcpus, state.MaxVCPUs))
 	}
 
 	args = append(args, "-cpu", cpuArg)
@@ -523,7 +668,7 @@ func (p *QemuProvider) buildQemuArgs(name, diskPath string, sshPort int, vncPort
 		if _, err := os.Stat(initrdPath); err == nil {
 			args = append(args, "-initrd", initrdPath)
 		}
-		finalCmdline := cmdline
+		finalCmdline := state.Cmdline
 		// If cmdline is explicitly updated to empty string by user, this logic effectively prevents clearing it.
 		// However, in our system, empty usually means "use default".
 		if finalCmdline == "" {
@@ -538,6 +683,9 @@ func (p *QemuProvider) buildQemuArgs(name, diskPath string, sshPort int, vncPort
 	args = append(args,
 		"-drive", fmt.Sprintf("file=%s,format=qcow2,if=virtio", diskPath),
 	)
+	for _, v := range state.Volumes {
+		args = append(args, volumeDriveArgs(p.volumePath(v.Volume), v)...)
+	}
 	if runtime.GOOS != "windows" {
 		args = append(args,
 			"-daemonize",
@@ -545,12 +693,14 @@ func (p *QemuProvider) buildQemuArgs(name, diskPath string, sshPort int, vncPort
 		)
 	}
 	args = append(args,
-		"-netdev", p.BuildNetDevArgs(sshPort, fw),
+		"-netdev", p.BuildNetDevArgs(state.SSHPort, state.Forwarding),
 		"-device", "virtio-net-pci,netdev=net0",
 		"-boot", "menu=off,strict=on,splash-time=0", // Fast boot: skip menu, no splash timeout
-		"-serial", "file:"+filepath.Join(runDir, name+".serial.log"),
 		"-device", "virtio-rng-pci", // Passthrough entropy from host to avoid boot hangs
+		"-device", "virtio-balloon-pci,id=balloon0", // Lets UpdateConfig reclaim guest memory live
 	)
+	args = append(args, serialArgs(runDir, name)...)
+	args = append(args, eventsArgs(runDir, name)...)
 
 	// Attach Cloud-Init Seed if exists
 	seedPath := filepath.Join(p.RootDir, "vms", name+"-seed.iso")
@@ -565,20 +715,35 @@ func (p *QemuProvider) buildQemuArgs(name, diskPath string, sshPort int, vncPort
 	} else {
 		// Unix-like systems use Unix sockets
 		args = append(args, "-qmp", "unix:"+filepath.Join(runDir, name+".qmp")+",server,nowait")
+		// Guest agent channel; the socket stays quiet until qemu-ga runs.
+		args = append(args,
+			"-chardev", "socket,path="+filepath.Join(runDir, name+".qga")+",server=on,wait=off,id="+agentChardevID,
+			"-device", "virtio-serial",
+			"-device", "virtserialport,chardev="+agentChardevID+",name=org.qemu.guest_agent.0",
+		)
 	}
 
 	// VNC Support
-	if vncPort > 0 {
+	if state.VNCPort > 0 {
 		// QEMU uses display numbers (port - 5900)
-		display := vncPort - 5900
+		display := state.VNCPort - 5900
 		args = append(args, "-vnc", fmt.Sprintf("127.0.0.1:%d", display))
+		args = append(args, tabletArgs()...)
 	} else {
 		args = append(args, "-display", "none")
 	}
 
+	// Shared folders over 9p; the guest reads the tag table from fw_cfg.
+	if len(state.Mounts) > 0 && runtime.GOOS != "windows" {
+		args = append(args, mountArgs(state.Mounts)...)
+	}
+
+	// Devices added with DeviceAdd, recreated with the IDs used for hotplug.
+	args = append(args, deviceArgs(state.Devices)...)
+
 	// Inject Accelerators (VFIO or Virtual)
 	// Linux Only for VFIO, Cross-Platform for Virtual
-	for _, acc := range accelerators {
+	for _, acc := range state.Accelerators {
 		if acc == "virtual:gpu" {
 			// Best virtual GPU for the platform
 			switch runtime.GOOS {
@@ -604,8 +769,8 @@ func (p *QemuProvider) buildQemuArgs(name, diskPath string, sshPort int, vncPort
 	}
 
 	// Inject Raw Arguments at the very end to allow overriding or adding devices
-	if len(rawArgs) > 0 {
-		args = append(args, rawArgs...)
+	if len(state.RawQemuArgs) > 0 {
+		args = append(args, state.RawQemuArgs...)
 	}
 
 	return args
@@ -638,10 +803,7 @@ func (p *QemuProvider) List() ([]VMStatus, error) {
 				pid = vmState.PID
 			}
 
-			stateStr := "stopped"
-			if processAlive(pid) {
-				stateStr = "running"
-			}
+			stateStr := p.runState(name, pid)
 
 			results = append(results, VMStatus{
 				Name:       name,
@@ -651,6 +813,8 @@ func (p *QemuProvider) List() ([]VMStatus, error) {
 				SSHUser:    vmState.SSHUser,
 				VNCPort:    vmState.VNCPort,
 				Forwarding: vmState.Forwarding,
+				ExpiresAt:  vmState.ExpiresAt,
+				Labels:     vmState.Labels,
 			})
 		}
 	}
@@ -665,7 +829,7 @@ func (p *QemuProvider) Info(name string) (VMDetail, error) {
 		// If no state file, assume VM is stopped and has no active ports
 		diskPath := filepath.Join(p.RootDir, "vms", name+".qcow2")
 		_, statErr := os.Stat(diskPath)
-		backingPath, backingMissing := backingInfo(diskPath)
+		backingPath, backingMissing, diskSize := diskImageInfo(diskPath)
 		return VMDetail{
 			Name:           name,
 			State:          "stopped",
@@ -674,24 +838,22 @@ func (p *QemuProvider) Info(name string) (VMDetail, error) {
 			DiskMissing:    statErr != nil,
 			BackingPath:    backingPath,
 			BackingMissing: backingMissing,
+			DiskSizeBytes:  diskSize,
 		}, nil
 	}
 
 	// Check liveness for state string
-	liveness := "stopped"
 	pidData, _ := os.ReadFile(filepath.Join(p.RootDir, "run", name+".pid"))
 	pid := 0
 	fmt.Sscanf(string(pidData), "%d", &pid)
 	if pid == 0 {
 		pid = state.PID
 	}
-	if processAlive(pid) {
-		liveness = "running"
-	}
+	liveness := p.runState(name, pid)
 
 	diskPath := filepath.Join(p.RootDir, "vms", name+".qcow2")
 	_, statErr := os.Stat(diskPath)
-	backingPath, backingMissing := backingInfo(diskPath)
+	backingPath, backingMissing, diskSize := diskImageInfo(diskPath)
 
 	detail := VMDetail{
 		Name:           name,
@@ -703,15 +865,31 @@ func (p *QemuProvider) Info(name string) (VMDetail, error) {
 		VNCPort:        state.VNCPort,
 		MemoryMB:       state.MemoryMB,
 		VCPUs:          state.VCPUs,
+		MaxMemoryMB:    state.MaxMemoryMB,
+		MaxVCPUs:       state.MaxVCPUs,
 		Gui:            state.Gui,
 		Cmdline:        state.Cmdline,
 		Forwarding:     state.Forwarding,
 		RawQemuArgs:    state.RawQemuArgs,
 		Accelerators:   state.Accelerators,
+		Mounts:         state.Mounts,
+		Volumes:        state.Volumes,
+		Devices:        state.Devices,
 		DiskPath:       diskPath,
 		DiskMissing:    statErr != nil,
 		BackingPath:    backingPath,
 		BackingMissing: backingMissing,
+		DiskSizeBytes:  diskSize,
+		Limits:         state.Limits,
+		RestartPolicy:  state.RestartPolicy,
+		Restarts:       state.Restarts,
+		LastExit:       state.LastExit,
+		ExpiresAt:      state.ExpiresAt,
+		OnExpiry:       state.OnExpiry,
+		Labels:         state.Labels,
+	}
+	if state.Limits != nil && liveness == "running" {
+		detail.Cgroup = cgroupStatus(state)
 	}
 
 	return detail, nil
@@ -726,34 +904,38 @@ func safeRemove(path string) error {
 	return nil
 }
 
-// backingInfo returns backing filename and whether it's missing.
-func backingInfo(diskPath string) (string, bool) {
+// diskImageInfo returns the backing filename, whether it is missing, and the
+// virtual size of the image.
+func diskImageInfo(diskPath string) (backing string, backingMissing bool, virtualSize int64) {
 	if diskPath == "" {
-		return "", false
+		return "", false, 0
 	}
 	type info struct {
-		Backing string `json:"backing-filename"`
+		Backing     string `json:"backing-filename"`
+		VirtualSize int64  `json:"virtual-size"`
 	}
 	qemuImg, err := sysutil.QemuImgBinary()
 	if err != nil {
-		return "", false
+		return "", false, 0
 	}
 	out, err := exec.Command(qemuImg, "info", "-U", "--output=json", diskPath).Output()
 	if err != nil {
-		return "", false
+		return "", false, 0
 	}
 	var meta info
 	if json.Unmarshal(out, &meta) != nil || meta.Backing == "" {
-		return "", false
+		return "", false, meta.VirtualSize
 	}
 	if _, err := os.Stat(meta.Backing); err != nil {
-		return meta.Backing, true
+		return meta.Backing, true, meta.VirtualSize
 	}
-	return meta.Backing, false
+	return meta.Backing, false, meta.VirtualSize
 }
 
-// Stop gracefully asks the VM to go into deep sleep using an interrupt signal.
-// We clean up QMP and PID artifacts to keep the run directory tidy.
+// Stop asks the VM to go into deep sleep. Graceful stops ask the guest agent
+// to power off, then press the ACPI power button over QMP, then escalate to
+// an interrupt signal and finally a kill. We clean up QMP, agent and PID
+// artifacts to keep the run directory tidy.
 func (p *QemuProvider) Stop(name string, graceful bool) error {
 	runDir := filepath.Join(p.RootDir, "run")
 	pidFile := filepath.Join(runDir, name+".pid")
@@ -765,10 +947,20 @@ func (p *QemuProvider) Stop(name string, graceful bool) error {
 			pid = state.PID
 		}
 	}
+	// Clear the PID before signalling so the supervisor does not take this
+	// exit for a crash, and drop any restart it had scheduled.
+	_, _ = p.updateState(name, func(state *VMState) error {
+		state.PID = 0
+		state.Restarts = 0
+		if state.LastExit != nil {
+			state.LastExit.RestartAt = nil
+		}
+		return nil
+	})
 
 	if pid > 0 {
 		process, err := os.FindProcess(pid)
-		if err == nil && process != nil {
+		if err == nil && process != nil && !(graceful && (p.agentShutdown(name, pid) || p.acpiShutdown(name, pid))) {
 			_ = stopQemuProcess(process, graceful)
 			for i := 0; i < 50; i++ {
 				if !processAlive(pid) {
@@ -782,12 +974,7 @@ func (p *QemuProvider) Stop(name string, graceful bool) error {
 		}
 	}
 
-	os.Remove(pidFile)
-	os.Remove(filepath.Join(runDir, name+".qmp"))
-
-	if state, err := p.loadState(name); err == nil {
-		_ = p.saveState(name, 0, state.SSHPort, state.VNCPort, state.Gui, state.SSHUser, state.Forwarding, state.Cmdline, state.MemoryMB, state.VCPUs, state.RawQemuArgs, state.Accelerators)
-	}
+	p.removeRunArtifacts(name)
 
 	// RESTORE ACCELERATORS (Start of Double Fix)
 	// We must release any VFIO devices back to the host
@@ -808,12 +995,33 @@ func (p *QemuProvider) Delete(name string) error {
 	vmsDir := filepath.Join(p.RootDir, "vms")
 	diskPath := filepath.Join(vmsDir, name+".qcow2")
 
-	// We use safeRemove for all files to be idempotent
-	_ = safeRemove(filepath.Join(p.RootDir, "run", name+".json"))
+	// Groups created in the cgroup filesystem outlive QEMU; systemd
+	// scopes are collected on their own.
+	if state, err := p.loadState(name); err == nil && state.Cgroup != "" && !strings.HasSuffix(state.Cgroup, ".scope") {
+		_ = cgroup.Remove(state.Cgroup)
+	}
+
+	// We use safeRemove for all files to be idempotent. The state goes
+	// under its lock; waiters see the lock file gone and lock afresh.
+	unlock, lockErr := p.lockVM(name)
+	_ = safeRemove(p.statePath(name))
+	for v := 0; v < StateSchemaVersion; v++ {
+		_ = safeRemove(p.stateBackupPath(name, v))
+	}
+	if lockErr == nil {
+		_ = safeRemove(filepath.Join(p.RootDir, "run", name+".lock"))
+		unlock()
+	}
+	_ = safeRemove(p.serialLogPath(name))
+	_ = safeRemove(p.serialLogPath(name) + ".1")
 	_ = safeRemove(filepath.Join(vmsDir, name+"-seed.iso"))
 	_ = safeRemove(filepath.Join(vmsDir, name+".kernel"))
 	_ = safeRemove(filepath.Join(vmsDir, name+".initrd"))
-	return safeRemove(diskPath)
+	if err := safeRemove(diskPath); err != nil {
+		return err
+	}
+	p.pruneForkBases()
+	return nil
 }
 
 // CreateTemplate archives a VM into "cold storage" (a compressed qcow2).
@@ -975,6 +1183,29 @@ func (p *QemuProvider) getReservedPorts() map[int]bool {
 	return reserved
 }
 
+// forwardPortRange returns the configured host range for custom forwards.
+func (p *QemuProvider) forwardPortRange() (int, int) {
+	start, end := p.Config.PortRangeStart, p.Config.PortRangeEnd
+	if start == 0 {
+		start = 30000
+	}
+	if end == 0 {
+		end = 32767
+	}
+	return start, end
+}
+
+// livePID returns the QEMU PID from the pidfile, falling back to the state.
+func (p *QemuProvider) livePID(name string, state VMState) int {
+	pid := 0
+	pidData, _ := os.ReadFile(filepath.Join(p.RootDir, "run", name+".pid"))
+	fmt.Sscanf(string(pidData), "%d", &pid)
+	if pid == 0 {
+		pid = state.PID
+	}
+	return pid
+}
+
 func (p *QemuProvider) findAvailablePort(start int, reserved map[int]bool) int {
 	for port := start; port < start+100; port++ {
 		if reserved[port] {
@@ -990,109 +1221,202 @@ func (p *QemuProvider) findAvailablePort(start int, reserved map[int]bool) int {
 }
 
 type VMState struct {
-	Name         string        `json:"name"`
-	PID          int           `json:"pid"`
-	SSHPort      int           `json:"ssh_port"`
-	VNCPort      int           `json:"vnc_port,omitempty"`
-	Gui          bool          `json:"gui,omitempty"`
-	SSHUser      string        `json:"ssh_user,omitempty"`
-	Forwarding   []PortForward `json:"forwarding,omitempty"`
-	Cmdline      string        `json:"cmdline,omitempty"`
-	MemoryMB     int           `json:"memory_mb,omitempty"`
-	VCPUs        int           `json:"vcpus,omitempty"`
-	RawQemuArgs  []string      `json:"raw_qemu_args,omitempty"`
-	Accelerators []string      `json:"accelerators,omitempty"`
-}
-
-func (p *QemuProvider) saveState(name string, pid int, sshPort int, vncPort int, gui bool, sshUser string, fw []PortForward, cmdline string, memoryMB, vcpus int, rawArgs []string, accelerators []string) error {
-	state := VMState{
-		Name:         name,
-		PID:          pid,
-		SSHPort:      sshPort,
-		VNCPort:      vncPort,
-		Gui:          gui,
-		SSHUser:      sshUser,
-		Forwarding:   fw,
-		Cmdline:      cmdline,
-		MemoryMB:     memoryMB,
-		VCPUs:        vcpus,
-		RawQemuArgs:  rawArgs,
-		Accelerators: accelerators,
-	}
-	data, _ := json.MarshalIndent(state, "", "  ")
-	path := filepath.Join(p.RootDir, "run", name+".json")
-	return sysutil.WriteFile(path, data, 0600)
+	// SchemaVersion is the layout the file was written with; see
+	// StateSchemaVersion.
+	SchemaVersion int                `json:"schema_version"`
+	Name          string             `json:"name"`
+	PID           int                `json:"pid"`
+	SSHPort       int                `json:"ssh_port"`
+	VNCPort       int                `json:"vnc_port,omitempty"`
+	Gui           bool               `json:"gui,omitempty"`
+	SSHUser       string             `json:"ssh_user,omitempty"`
+	Forwarding    []PortForward      `json:"forwarding,omitempty"`
+	Cmdline       string             `json:"cmdline,omitempty"`
+	MemoryMB      int                `json:"memory_mb,omitempty"`
+	VCPUs         int                `json:"vcpus,omitempty"`
+	MaxMemoryMB   int                `json:"max_memory_mb,omitempty"`
+	MaxVCPUs      int                `json:"max_vcpus,omitempty"`
+	RawQemuArgs   []string           `json:"raw_qemu_args,omitempty"`
+	Accelerators  []string           `json:"accelerators,omitempty"`
+	Mounts        []Mount            `json:"mounts,omitempty"`
+	Volumes       []VolumeAttachment `json:"volumes,omitempty"`
+	Devices       []Device           `json:"devices,omitempty"`
+	Limits        *ResourceLimits    `json:"limits,omitempty"`
+	// Cgroup is where the running QEMU's limits are enforced; CgroupError
+	// says why they are not.
+	Cgroup      string `json:"cgroup,omitempty"`
+	CgroupError string `json:"cgroup_error,omitempty"`
+	// RestartPolicy, Restarts and LastExit belong to the supervisor daemon.
+	RestartPolicy string            `json:"restart_policy,omitempty"`
+	Restarts      int               `json:"restarts,omitempty"`
+	LastExit      *ExitRecord       `json:"last_exit,omitempty"`
+	StartedAt     *time.Time        `json:"started_at,omitempty"`
+	ExpiresAt     *time.Time        `json:"expires_at,omitempty"`
+	OnExpiry      string            `json:"on_expiry,omitempty"`
+	Labels        map[string]string `json:"labels,omitempty"`
 }
 
 // UpdateConfig safely modifies the persistent VMState using a read-modify-write cycle.
-func (p *QemuProvider) UpdateConfig(name string, updates VMConfigUpdates) error {
-	// 1. Load existing state
-	state, err := p.loadState(name)
-	if err != nil {
-		return fmt.Errorf("failed to load state for VM '%s': %w", name, err)
-	}
-
-	// 2. Apply updates
-	if updates.MemoryMB != nil {
-		if *updates.MemoryMB < 128 {
-			return fmt.Errorf("memory must be at least 128MB")
+// Forwarding changes are pushed to a running VM through the monitor; the
+// returned ApplyMode is AppliedLive only when nothing waits for a restart.
+func (p *QemuProvider) UpdateConfig(name string, updates VMConfigUpdates) (ApplyMode, error) {
+	// SSH user and forwarding never need a restart. A grown disk is usable
+	// by the guest once growpart runs at next boot. Live memory and vCPU
+	// changes go through the balloon and CPU hotplug.
+	live := updates.Live && (updates.MemoryMB != nil || updates.VCPUs != nil)
+	needsRestart := (!live && (updates.MemoryMB != nil || updates.VCPUs != nil)) || updates.Gui != nil ||
+		updates.Cmdline != nil || updates.SSHPort != nil || updates.VNCPort != nil ||
+		updates.Accelerators != nil || updates.DiskSize != nil ||
+		updates.MaxMemoryMB != nil || updates.MaxVCPUs != nil
+	if live && !p.vmAlive(name) {
+		return AppliedNextBoot, fmt.Errorf("VM '%s' is not running; live changes need a running VM", name)
+	}
+	// 1. Load, apply and persist under the VM lock. Auto-assigned forwards
+	// pick their host ports under the nest lock too.
+	update := p.updateState
+	if updates.Forwarding != nil {
+		update = p.updatePorts
+	}
+	var previous []PortForward
+	state, err := update(name, func(state *VMState) error {
+		previous = append([]PortForward(nil), state.Forwarding...)
+		if updates.MemoryMB != nil {
+			if *updates.MemoryMB < 128 {
+				return fmt.Errorf("memory must be at least 128MB")
+			}
+			state.MemoryMB = *updates.MemoryMB
 		}
-		state.MemoryMB = *updates.MemoryMB
-	}
-	if updates.VCPUs != nil {
-		if *updates.VCPUs < 1 {
-			return fmt.Errorf("vcpus must be at least 1")
+		if updates.VCPUs != nil {
+			if *updates.VCPUs < 1 {
+				return fmt.Errorf("vcpus must be at least 1")
+			}
+			state.VCPUs = *updates.VCPUs
 		}
-		state.VCPUs = *updates.VCPUs
-	}
-	if updates.Gui != nil {
-		state.Gui = *updates.Gui
-	}
-	if updates.Cmdline != nil {
-		state.Cmdline = *updates.Cmdline
-	}
-	if updates.SSHPort != nil {
-		if err := validatePort(*updates.SSHPort, false, "ssh port"); err != nil {
-			return err
+		if updates.MaxMemoryMB != nil {
+			if *updates.MaxMemoryMB < 0 {
+				return fmt.Errorf("max memory cannot be negative")
+			}
+			state.MaxMemoryMB = *updates.MaxMemoryMB
 		}
-		state.SSHPort = *updates.SSHPort
-	}
-	if updates.VNCPort != nil {
-		if err := validatePort(*updates.VNCPort, true, "vnc port"); err != nil {
-			return err
+		if updates.MaxVCPUs != nil {
+			if *updates.MaxVCPUs < 0 {
+				return fmt.Errorf("max vcpus cannot be negative")
+			}
+			state.MaxVCPUs = *updates.MaxVCPUs
 		}
-		state.VNCPort = *updates.VNCPort
-	}
-	if updates.SSHUser != nil {
-		state.SSHUser = *updates.SSHUser
-	}
-	if updates.Forwarding != nil {
-		for _, pf := range *updates.Forwarding {
-			if err := ValidatePortForward(pf); err != nil {
+		limitsChanged := applyLimitUpdates(state, updates)
+		if state.Limits != nil && (limitsChanged || updates.MemoryMB != nil || updates.MaxMemoryMB != nil) {
+			if err := ValidateLimits(*state.Limits, memoryCeilingMB(state.MemoryMB, state.MaxMemoryMB)); err != nil {
 				return err
 			}
 		}
-		state.Forwarding = *updates.Forwarding
-	}
-	if updates.Accelerators != nil {
-		if err := ValidateAccelerators(*updates.Accelerators); err != nil {
-			return err
+		if updates.Gui != nil {
+			state.Gui = *updates.Gui
+		}
+		if updates.Cmdline != nil {
+			state.Cmdline = *updates.Cmdline
+		}
+		if updates.RestartPolicy != nil {
+			if err := ValidateRestartPolicy(*updates.RestartPolicy); err != nil {
+				return err
+			}
+			state.RestartPolicy = *updates.RestartPolicy
+			if state.RestartPolicy == RestartNo {
+				state.RestartPolicy = ""
+			}
+			// A restart the new policy would not make is cancelled.
+			if state.LastExit != nil && !shouldRestart(state.RestartPolicy, state.LastExit.Failure) {
+				state.LastExit.RestartAt = nil
+			}
+		}
+		if updates.OnExpiry != nil {
+			if err := ValidateOnExpiry(*updates.OnExpiry); err != nil {
+				return err
+			}
+			state.OnExpiry = ""
+			if *updates.OnExpiry == ExpiryStop {
+				state.OnExpiry = ExpiryStop
+			}
+		}
+		if updates.SSHPort != nil {
+			if err := validatePort(*updates.SSHPort, false, "ssh port"); err != nil {
+				return err
+			}
+			state.SSHPort = *updates.SSHPort
+		}
+		if updates.VNCPort != nil {
+			if err := validatePort(*updates.VNCPort, true, "vnc port"); err != nil {
+				return err
+			}
+			state.VNCPort = *updates.VNCPort
+		}
+		if updates.SSHUser != nil {
+			state.SSHUser = *updates.SSHUser
+		}
+		if updates.Forwarding != nil {
+			fw := append([]PortForward(nil), *updates.Forwarding...)
+			reserved := p.getReservedPorts()
+			start, end := p.forwardPortRange()
+			for i := range fw {
+				if err := ValidatePortForward(fw[i]); err != nil {
+					return err
+				}
+				if fw[i].HostPort == 0 {
+					hp, err := nidonet.FindAvailablePort(start, end, reserved)
+					if err != nil {
+						return fmt.Errorf("failed to allocate host port for %s: %w", fw[i].Label, err)
+					}
+					fw[i].HostPort = hp
+					reserved[hp] = true
+				}
+			}
+			state.Forwarding = fw
+		}
+		if updates.Accelerators != nil {
+			if err := ValidateAccelerators(*updates.Accelerators); err != nil {
+				return err
+			}
+			state.Accelerators = *updates.Accelerators
+		}
+		if updates.DiskSize != nil {
+			if err := p.resizeDisk(name, *updates.DiskSize); err != nil {
+				return err
+			}
+		}
+		if live {
+			ceilingMB, err := p.resizeLive(name, updates.MemoryMB, updates.VCPUs)
+			if err != nil {
+				return err
+			}
+			// Keep the boot memory as the ceiling so the VM can balloon back up
+			// after a restart.
+			if state.MaxMemoryMB < ceilingMB {
+				state.MaxMemoryMB = ceilingMB
+			}
 		}
-		state.Accelerators = *updates.Accelerators
-	}
-
-	// 3. Persist
-	return p.saveState(state.Name, state.PID, state.SSHPort, state.VNCPort, state.Gui, state.SSHUser, state.Forwarding, state.Cmdline, state.MemoryMB, state.VCPUs, state.RawQemuArgs, state.Accelerators)
-}
 
-func (p *QemuProvider) loadState(name string) (VMState, error) {
-	var state VMState
-	data, err := os.ReadFile(filepath.Join(p.RootDir, "run", name+".json"))
+		if limitsChanged {
+			var l ResourceLimits
+			if state.Limits != nil {
+				l = *state.Limits
+			}
+			// Enforced groups take new limits live; others wait for the next start.
+			if state.Cgroup == "" || !p.vmAlive(name) || cgroup.Set(state.Cgroup, l.cgroupLimits()) != nil {
+				needsRestart = true
+			}
+		}
+		return nil
+	})
 	if err != nil {
-		return state, err
+		return AppliedNextBoot, err
 	}
-	err = json.Unmarshal(data, &state)
-	return state, err
+
+	// 2. Push what we can to the running VM
+	mode := p.syncForwarding(name, p.livePID(name, state), previous, state.Forwarding)
+	if needsRestart {
+		mode = AppliedNextBoot
+	}
+	return mode, nil
 }
 
 // BuildNetDevArgs translates state to QEMU runtime arguments.
@@ -1114,12 +1438,21 @@ func (p *QemuProvider) BuildNetDevArgs(sshPort int, fw []PortForward) string {
 }
 
 func (p *QemuProvider) SSHCommand(name string) (string, error) {
-	info, err := p.Info(name)
+	opts, err := p.sshArgs(name)
 	if err != nil {
 		return "", err
 	}
+	return strings.Join(opts, " "), nil
+}
+
+// sshArgs returns the ssh invocation for a running VM, binary first.
+func (p *QemuProvider) sshArgs(name string) ([]string, error) {
+	info, err := p.Info(name)
+	if err != nil {
+		return nil, err
+	}
 	if info.SSHPort == 0 || info.State != "running" {
-		return "", fmt.Errorf("VM '%s' is not running or has no network access", name)
+		return nil, fmt.Errorf("VM '%s' is not running or has no network access", name)
 	}
 	// Inject options to skip fingerprint check for ephemeral VMs.
 	opts := []string{"ssh", "-o", "StrictHostKeyChecking=no", "-o", "UserKnownHostsFile=/dev/null"}
@@ -1127,7 +1460,7 @@ func (p *QemuProvider) SSHCommand(name string) (string, error) {
 		opts = append(opts, "-i", keyPath)
 	}
 	opts = append(opts, "-p", fmt.Sprintf("%d", info.SSHPort), fmt.Sprintf("%s@%s", info.SSHUser, info.IP))
-	return strings.Join(opts, " "), nil
+	return opts, nil
 }
 
 func (p *QemuProvider) ListTemplates() ([]string, error) {
@@ -1266,24 +1599,26 @@ func (p *QemuProvider) GetUsedBackingFiles() ([]string, error) {
 		return nil, err
 	}
 
-	used := make(map[string]bool)
+	// Fork bases are layers too: whatever they sit on is in use.
+	var disks []string
 	for _, f := range files {
 		if !f.IsDir() && strings.HasSuffix(f.Name(), ".qcow2") {
-			diskPath := filepath.Join(vmsDir, f.Name())
-			backing, exists := backingInfo(diskPath)
-			if !exists && backing != "" {
-				// Backing file is set but might be missing, still record it
-				// backingInfo returns true if missing, false if present.
-				// Actually backingInfo returns (path, missing bool).
-				// We want the path regardless.
-			}
-			if backing != "" {
-				abs, err := filepath.Abs(backing)
-				if err == nil {
-					used[abs] = true
-				} else {
-					used[backing] = true
-				}
+			disks = append(disks, filepath.Join(vmsDir, f.Name()))
+		}
+	}
+	bases, _ := filepath.Glob(filepath.Join(p.forkBasesDir(), "*.qcow2"))
+	disks = append(disks, bases...)
+
+	used := make(map[string]bool)
+	for _, diskPath := range disks {
+		// The backing path is recorded whether or not the file still exists.
+		backing, _, _ := diskImageInfo(diskPath)
+		if backing != "" {
+			abs, err := filepath.Abs(backing)
+			if err == nil {
+				used[abs] = true
+			} else {
+				used[backing] = true
 			}
 		}
 	}
@@ -1299,45 +1634,24 @@ func (p *QemuProvider) GetUsedBackingFiles() ([]string, error) {
 // and mashes the "Enter" key while the VM is starting up to bypass
 // guest bootloader menus.
 func (p *QemuProvider) skipBootloader(name string) {
-	qmpPath := filepath.Join(p.RootDir, "run", name+".qmp")
-	if runtime.GOOS == "windows" {
-		return
-	}
-
 	// 1. Initial wait: Give BIOS/UEFI time to finish and reach bootloader (3s)
 	time.Sleep(3 * time.Second)
 
 	// 2. Connect to QMP
-	conn, err := net.DialTimeout("unix", qmpPath, 500*time.Millisecond)
+	client, err := p.dialQMP(name, 500*time.Millisecond)
 	if err != nil {
 		return
 	}
-	defer conn.Close()
-	conn.SetDeadline(time.Now().Add(5 * time.Second))
-
-	// 3. Handshake
-	decoder := json.NewDecoder(conn)
-	var greeting map[string]interface{}
-	_ = decoder.Decode(&greeting)
-	fmt.Fprintf(conn, `{"execute":"qmp_capabilities"}`+"\n")
-	_ = decoder.Decode(&greeting)
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 
-	// 4. Send "Return" exactly 3 times with 1s gap
+	// 3. Send "Return" exactly 3 times with 1s gap
 	// This covers potential UI lag or early bootloader states
 	for i := 0; i < 3; i++ {
-		cmd, _ := json.Marshal(map[string]interface{}{
-			"execute": "send-key",
-			"arguments": map[string]interface{}{
-				"keys": []map[string]interface{}{
-					{"type": "qcode", "data": "ret"},
-				},
-			},
-		})
-		fmt.Fprintf(conn, "%s\n", string(cmd))
-
-		var res map[string]interface{}
-		_ = decoder.Decode(&res)
-
+		if err := sendChord(ctx, client, "enter"); err != nil {
+			return
+		}
 		time.Sleep(1 * time.Second)
 	}
 }
@@ -1555,75 +1869,75 @@ func (p *QemuProvider) CacheRemove(name, version string) error {
 	return os.Remove(fullPath)
 }
 
-func (p *QemuProvider) PortForward(name string, pf PortForward) (PortForward, error) {
-	state, err := p.loadState(name)
-	if err != nil {
-		return pf, err
-	}
+func (p *QemuProvider) PortForward(name string, pf PortForward) (PortForward, ApplyMode, error) {
 	if err := ValidatePortForward(pf); err != nil {
-		return pf, err
+		return pf, AppliedNextBoot, err
 	}
-
-	// Allocate HostPort if 0
+	update := p.updateState
 	if pf.HostPort == 0 {
-		reserved := p.getReservedPorts()
-		pRangeStart := p.Config.PortRangeStart
-		pRangeEnd := p.Config.PortRangeEnd
-		if pRangeStart == 0 {
-			pRangeStart = 30000
-		}
-		if pRangeEnd == 0 {
-			pRangeEnd = 32767
-		}
+		update = p.updatePorts
+	}
 
-		hp, err := nidonet.FindAvailablePort(pRangeStart, pRangeEnd, reserved)
-		if err != nil {
-			return pf, err
+	var previous []PortForward
+	state, err := update(name, func(state *VMState) error {
+		// Allocate HostPort if 0
+		if pf.HostPort == 0 {
+			start, end := p.forwardPortRange()
+			hp, err := nidonet.FindAvailablePort(start, end, p.getReservedPorts())
+			if err != nil {
+				return err
+			}
+			pf.HostPort = hp
 		}
-		pf.HostPort = hp
-	}
 
-	// Check if GuestPort already forwarded for this protocol
-	for i, f := range state.Forwarding {
-		if f.GuestPort == pf.GuestPort && f.Protocol == pf.Protocol {
-			// Update existing rule
-			state.Forwarding[i] = pf
-			p.saveState(name, state.PID, state.SSHPort, state.VNCPort, state.Gui, state.SSHUser, state.Forwarding, state.Cmdline, state.MemoryMB, state.VCPUs, state.RawQemuArgs, state.Accelerators)
-			return pf, nil
+		previous = append([]PortForward(nil), state.Forwarding...)
+
+		// Check if GuestPort already forwarded for this protocol
+		for i, f := range state.Forwarding {
+			if f.GuestPort == pf.GuestPort && f.Protocol == pf.Protocol {
+				// Update existing rule
+				state.Forwarding[i] = pf
+				return nil
+			}
 		}
+		// Add new rule
+		state.Forwarding = append(state.Forwarding, pf)
+		return nil
+	})
+	if err != nil {
+		return pf, AppliedNextBoot, err
 	}
-
-	// Add new rule
-	state.Forwarding = append(state.Forwarding, pf)
-	err = p.saveState(name, state.PID, state.SSHPort, state.VNCPort, state.Gui, state.SSHUser, state.Forwarding, state.Cmdline, state.MemoryMB, state.VCPUs, state.RawQemuArgs, state.Accelerators)
-	return pf, err
+	return pf, p.syncForwarding(name, p.livePID(name, state), previous, state.Forwarding), nil
 }
 
-func (p *QemuProvider) PortUnforward(name string, guestPort int, protocol string) error {
+func (p *QemuProvider) PortUnforward(name string, guestPort int, protocol string) (ApplyMode, error) {
 	if err := validatePort(guestPort, false, "guest port"); err != nil {
-		return err
+		return AppliedNextBoot, err
 	}
 	protocol = strings.ToLower(strings.TrimSpace(protocol))
 	if protocol != "" && protocol != "tcp" && protocol != "udp" {
-		return fmt.Errorf("protocol must be tcp or udp")
-	}
-	state, err := p.loadState(name)
-	if err != nil {
-		return err
+		return AppliedNextBoot, fmt.Errorf("protocol must be tcp or udp")
 	}
 
-	for i, f := range state.Forwarding {
-		stateProtocol := strings.ToLower(strings.TrimSpace(f.Protocol))
-		if stateProtocol == "" {
-			stateProtocol = "tcp"
-		}
-		if f.GuestPort == guestPort && (stateProtocol == protocol || protocol == "") {
-			state.Forwarding = append(state.Forwarding[:i], state.Forwarding[i+1:]...)
-			return p.saveState(name, state.PID, state.SSHPort, state.VNCPort, state.Gui, state.SSHUser, state.Forwarding, state.Cmdline, state.MemoryMB, state.VCPUs, state.RawQemuArgs, state.Accelerators)
+	var previous []PortForward
+	state, err := p.updateState(name, func(state *VMState) error {
+		previous = append([]PortForward(nil), state.Forwarding...)
+		for i, f := range state.Forwarding {
+			stateProtocol := strings.ToLower(strings.TrimSpace(f.Protocol))
+			if stateProtocol == "" {
+				stateProtocol = "tcp"
+			}
+			if f.GuestPort == guestPort && (stateProtocol == protocol || protocol == "") {
+				state.Forwarding = append(state.Forwarding[:i], state.Forwarding[i+1:]...)
+				return nil
+			}
 		}
+		return fmt.Errorf("port mapping not found: %d/%s", guestPort, protocol)
+	})
+	if err != nil {
+		return AppliedNextBoot, err
 	}
-
-	return fmt.Errorf("port mapping not found: %d/%s", guestPort, protocol)
+	return p.syncForwarding(name, p.livePID(name, state), previous, state.Forwarding), nil
 }
 
 func (p *QemuProvider) PortList(name string) ([]PortForward, error) {
@@ -9,6 +9,12 @@ func detachedQemuSysProcAttr() *syscall.SysProcAttr {
 	return nil
 }
 
+// daemonSysProcAttr detaches helper processes from the caller's session so
+// they survive the CLI and its terminal.
+func daemonSysProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setsid: true}
+}
+
 func processAlive(pid int) bool {
 	if pid <= 0 {
 		return false
@@ -19,6 +19,11 @@ func detachedQemuSysProcAttr() *syscall.SysProcAttr {
 	}
 }
 
+// daemonSysProcAttr detaches helper processes from the caller's console.
+func daemonSysProcAttr() *syscall.SysProcAttr {
+	return detachedQemuSysProcAttr()
+}
+
 func processAlive(pid int) bool {
 	if pid <= 0 {
 		return false
@@ -0,0 +1,242 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/Josepavese/nido/internal/qmp"
+)
+
+const (
+	// qmpProbeTimeout keeps List/Info responsive when a monitor is busy
+	// (QEMU serves a single QMP client at a time).
+	qmpProbeTimeout = 300 * time.Millisecond
+	// qmpReadyTimeout bounds how long Start waits for the monitor to answer.
+	qmpReadyTimeout = 10 * time.Second
+	// acpiShutdownTimeout is how long Stop lets the guest honor the ACPI
+	// power button before escalating to signals.
+	acpiShutdownTimeout = 30 * time.Second
+)
+
+// errQMPUnavailable is returned on hosts where the monitor has no stable address.
+var errQMPUnavailable = errors.New("QMP monitor is not available on this host")
+
+// qmpAddress resolves the monitor endpoint configured by buildQemuArgs.
+func (p *QemuProvider) qmpAddress(name string) (string, string, error) {
+	if runtime.GOOS == "windows" {
+		// Windows binds QMP to an ephemeral TCP port we cannot rediscover.
+		return "", "", errQMPUnavailable
+	}
+	return "unix", filepath.Join(p.RootDir, "run", name+".qmp"), nil
+}
+
+// dialQMP opens a negotiated QMP session with the VM's monitor.
+func (p *QemuProvider) dialQMP(name string, timeout time.Duration) (*qmp.Client, error) {
+	network, address, err := p.qmpAddress(name)
+	if err != nil {
+		return nil, err
+	}
+	return qmp.Dial(network, address, timeout)
+}
+
+// waitQMP retries dialQMP until the monitor accepts a session or timeout
+// elapses. QEMU creates the socket slightly after the process starts.
+func (p *QemuProvider) waitQMP(name string, timeout time.Duration) (*qmp.Client, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		client, err := p.dialQMP(name, time.Second)
+		if err == nil || errors.Is(err, errQMPUnavailable) || time.Now().After(deadline) {
+			return client, err
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// runState reports the VM run state: "stopped" when the process is gone,
+// otherwise the QEMU status (running, paused, guest-panicked, ...). When the
+// monitor cannot be queried a live process is reported as "running".
+func (p *QemuProvider) runState(name string, pid int) string {
+	if !processAlive(pid) {
+		return "stopped"
+	}
+	client, err := p.dialQMP(name, qmpProbeTimeout)
+	if err != nil {
+		return "running"
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), qmpProbeTimeout)
+	defer cancel()
+	status, err := client.QueryStatus(ctx)
+	if err != nil || status.Status == "" {
+		return "running"
+	}
+	return status.Status
+}
+
+// waitReady blocks until the monitor reports running vCPUs. It is
+// event-driven: if the guest is not yet running we wait for RESUME rather
+// than polling. Errors are non-fatal for callers; readiness is best-effort.
+func (p *QemuProvider) waitReady(name string) error {
+	client, err := p.waitQMP(name, qmpReadyTimeout)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), qmpReadyTimeout)
+	defer cancel()
+	status, err := client.QueryStatus(ctx)
+	if err != nil {
+		return err
+	}
+	if status.Running {
+		return nil
+	}
+	_, err = client.WaitEvent(ctx, qmp.EventResume)
+	return err
+}
+
+// acpiShutdown presses the ACPI power button and waits for QEMU to report
+// SHUTDOWN (or to exit). It returns false if the guest ignored the request.
+func (p *QemuProvider) acpiShutdown(name string, pid int) bool {
+	client, err := p.dialQMP(name, time.Second)
+	if err != nil {
+		return false
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), acpiShutdownTimeout)
+	defer cancel()
+	if err := client.SystemPowerdown(ctx); err != nil {
+		return false
+	}
+	// QEMU exits right after SHUTDOWN, closing the monitor; either signal
+	// means the guest complied.
+	if _, err := client.WaitEvent(ctx, qmp.EventShutdown); err != nil && ctx.Err() != nil {
+		return false
+	}
+	for i := 0; i < 50 && processAlive(pid); i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	return !processAlive(pid)
+}
+
+// resumeVM continues a paused guest.
+func (p *QemuProvider) resumeVM(name string) error {
+	client, err := p.dialQMP(name, time.Second)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	return client.Cont(context.Background())
+}
+
+// syncForwarding reconciles the user-mode hostfwd rules of a running VM from
+// old to fw through the human monitor. The state file stays the source of
+// truth: when the VM is down, or any rule cannot be changed live, the result
+// is AppliedNextBoot and the next Start rebuilds the rules from state.
+func (p *QemuProvider) syncForwarding(name string, pid int, old, fw []PortForward) ApplyMode {
+	if !processAlive(pid) {
+		return AppliedNextBoot
+	}
+	removed, added := diffForwarding(old, fw)
+	if len(removed) == 0 && len(added) == 0 {
+		return AppliedLive
+	}
+	client, err := p.dialQMP(name, time.Second)
+	if err != nil {
+		return AppliedNextBoot
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), qmp.DefaultTimeout)
+	defer cancel()
+	mode := AppliedLive
+	for _, f := range removed {
+		out, err := client.HumanMonitorCommand(ctx, "hostfwd_remove net0 "+hostfwdRule(f, false))
+		// "not found" is fine: the rule is already gone.
+		if err != nil || !(strings.Contains(out, "removed") || strings.Contains(out, "not found")) {
+			mode = AppliedNextBoot
+		}
+	}
+	for _, f := range added {
+		// hostfwd_add is silent on success and prints the failure otherwise.
+		out, err := client.HumanMonitorCommand(ctx, "hostfwd_add net0 "+hostfwdRule(f, true))
+		if err != nil || strings.TrimSpace(out) != "" {
+			mode = AppliedNextBoot
+		}
+	}
+	return mode
+}
+
+// hostfwdRule renders a forward in HMP syntax, matching BuildNetDevArgs.
+func hostfwdRule(f PortForward, withGuest bool) string {
+	proto := strings.ToLower(strings.TrimSpace(f.Protocol))
+	if proto == "" {
+		proto = "tcp"
+	}
+	rule := fmt.Sprintf("%s:127.0.0.1:%d", proto, f.HostPort)
+	if withGuest {
+		rule += fmt.Sprintf("-:%d", f.GuestPort)
+	}
+	return rule
+}
+
+// diffForwarding lists the rules to drop and to install when moving from old
+// to fw. Forwards without a host port are never emitted, so they are ignored.
+func diffForwarding(old, fw []PortForward) (removed, added []PortForward) {
+	index := func(list []PortForward) map[string]PortForward {
+		m := make(map[string]PortForward, len(list))
+		for _, f := range list {
+			if f.HostPort > 0 {
+				m[hostfwdRule(f, true)] = f
+			}
+		}
+		return m
+	}
+	before, after := index(old), index(fw)
+	for _, f := range old {
+		if _, ok := after[hostfwdRule(f, true)]; !ok && f.HostPort > 0 {
+			removed = append(removed, f)
+		}
+	}
+	for _, f := range fw {
+		if _, ok := before[hostfwdRule(f, true)]; !ok && f.HostPort > 0 {
+			added = append(added, f)
+		}
+	}
+	return removed, added
+}
+
+// rootBlockDevice finds the block device backed by the VM root disk so
+// block-level commands target it regardless of how the drive was named.
+func rootBlockDevice(ctx context.Context, client *qmp.Client, diskPath string) (string, error) {
+	block, err := rootBlock(ctx, client, diskPath)
+	if err != nil {
+		return "", err
+	}
+	if block.Device != "" {
+		return block.Device, nil
+	}
+	return block.Inserted.NodeName, nil
+}
+
+// rootBlock returns the query-block entry of the VM root disk.
+func rootBlock(ctx context.Context, client *qmp.Client, diskPath string) (qmp.BlockInfo, error) {
+	blocks, err := client.QueryBlock(ctx)
+	if err != nil {
+		return qmp.BlockInfo{}, err
+	}
+	for _, b := range blocks {
+		if b.Inserted != nil && filepath.Clean(b.Inserted.File) == filepath.Clean(diskPath) {
+			return b, nil
+		}
+	}
+	return qmp.BlockInfo{}, fmt.Errorf("root disk %s is not attached to the running VM", diskPath)
+}
@@ -0,0 +1,483 @@
+//go:build !windows
+
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image/png"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Josepavese/nido/internal/config"
+)
+
+// fakeQMP serves a minimal monitor on run/<name>.qmp and records every
+// command it receives. reply builds the "return" payload for a command.
+type fakeQMP struct {
+	mu       sync.Mutex
+	commands []map[string]interface{}
+}
+
+func (f *fakeQMP) executed() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := make([]string, 0, len(f.commands))
+	for _, c := range f.commands {
+		out = append(out, c["execute"].(string))
+	}
+	return out
+}
+
+func serveFakeQMP(t *testing.T, p *QemuProvider, name string, reply func(cmd map[string]interface{}) interface{}) *fakeQMP {
+	t.Helper()
+	runDir := filepath.Join(p.RootDir, "run")
+	if err := os.MkdirAll(runDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("unix", filepath.Join(runDir, name+".qmp"))
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	f := &fakeQMP{}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				enc := json.NewEncoder(conn)
+				dec := json.NewDecoder(conn)
+				_ = enc.Encode(map[string]interface{}{"QMP": map[string]interface{}{"version": map[string]interface{}{}, "capabilities": []string{}}})
+				for {
+					var cmd map[string]interface{}
+					if err := dec.Decode(&cmd); err != nil {
+						return
+					}
+					var ret interface{} = map[string]interface{}{}
+					if cmd["execute"] != "qmp_capabilities" {
+						f.mu.Lock()
+						f.commands = append(f.commands, cmd)
+						f.mu.Unlock()
+						if r := reply(cmd); r != nil {
+							ret = r
+						}
+					}
+					_ = enc.Encode(map[string]interface{}{"return": ret, "id": cmd["id"]})
+				}
+			}(conn)
+		}
+	}()
+	return f
+}
+
+func shortTempRoot(t *testing.T) string {
+	t.Helper()
+	// Unix socket paths are limited to ~104 bytes; t.TempDir can exceed that.
+	dir, err := os.MkdirTemp("", "nido")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func TestRunStateUsesQueryStatus(t *testing.T) {
+	p := &QemuProvider{RootDir: shortTempRoot(t), Config: &config.Config{}}
+	serveFakeQMP(t, p, "vm1", func(cmd map[string]interface{}) interface{} {
+		return map[string]interface{}{"running": false, "status": "guest-panicked"}
+	})
+
+	if got := p.runState("vm1", os.Getpid()); got != "guest-panicked" {
+		t.Fatalf("runState = %q, want guest-panicked", got)
+	}
+	if got := p.runState("vm1", 0); got != "stopped" {
+		t.Fatalf("runState(dead pid) = %q, want stopped", got)
+	}
+}
+
+func TestRunStateFallsBackWithoutMonitor(t *testing.T) {
+	p := &QemuProvider{RootDir: shortTempRoot(t), Config: &config.Config{}}
+	if got := p.runState("ghost", os.Getpid()); got != "running" {
+		t.Fatalf("runState without monitor = %q, want running", got)
+	}
+}
+
+func TestSyncForwardingAppliesHostfwdLive(t *testing.T) {
+	p := &QemuProvider{RootDir: shortTempRoot(t), Config: &config.Config{}}
+	var lines []string
+	var mu sync.Mutex
+	serveFakeQMP(t, p, "vm1", func(cmd map[string]interface{}) interface{} {
+		args, _ := cmd["arguments"].(map[string]interface{})
+		line, _ := args["command-line"].(string)
+		mu.Lock()
+		lines = append(lines, line)
+		mu.Unlock()
+		if strings.HasPrefix(line, "hostfwd_remove") {
+			return "host forwarding rule for tcp:127.0.0.1:30080 removed\r\n"
+		}
+		return ""
+	})
+
+	old := []PortForward{{GuestPort: 80, HostPort: 30080, Protocol: "tcp"}}
+	fw := []PortForward{{GuestPort: 53, HostPort: 30053, Protocol: "udp"}}
+	if got := p.syncForwarding("vm1", os.Getpid(), old, fw); got != AppliedLive {
+		t.Fatalf("syncForwarding = %q, want live", got)
+	}
+	want := []string{"hostfwd_remove net0 tcp:127.0.0.1:30080", "hostfwd_add net0 udp:127.0.0.1:30053-:53"}
+	mu.Lock()
+	defer mu.Unlock()
+	if strings.Join(lines, "|") != strings.Join(want, "|") {
+		t.Fatalf("monitor commands = %v, want %v", lines, want)
+	}
+}
+
+func TestSyncForwardingReportsNextBoot(t *testing.T) {
+	p := &QemuProvider{RootDir: shortTempRoot(t), Config: &config.Config{}}
+	fw := []PortForward{{GuestPort: 80, HostPort: 30080, Protocol: "tcp"}}
+	if got := p.syncForwarding("vm1", 0, nil, fw); got != AppliedNextBoot {
+		t.Fatalf("stopped VM: syncForwarding = %q, want next_boot", got)
+	}
+
+	serveFakeQMP(t, p, "vm1", func(cmd map[string]interface{}) interface{} {
+		return "Could not set up host forwarding rule 'tcp:127.0.0.1:30080-:80'\r\n"
+	})
+	if got := p.syncForwarding("vm1", os.Getpid(), nil, fw); got != AppliedNextBoot {
+		t.Fatalf("failed hostfwd_add: syncForwarding = %q, want next_boot", got)
+	}
+}
+
+func TestRootBlockDeviceMatchesDiskPath(t *testing.T) {
+	p := &QemuProvider{RootDir: shortTempRoot(t), Config: &config.Config{}}
+	disk := filepath.Join(p.RootDir, "vms", "vm1.qcow2")
+	serveFakeQMP(t, p, "vm1", func(cmd map[string]interface{}) interface{} {
+		return []map[string]interface{}{
+			{"device": "ide1-cd0"},
+			{"device": "virtio0", "inserted": map[string]interface{}{"file": disk, "node-name": "#block123"}},
+		}
+	})
+	client, err := p.dialQMP("vm1", time.Second)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer client.Close()
+
+	device, err := rootBlockDevice(context.Background(), client, disk)
+	if err != nil || device != "virtio0" {
+		t.Fatalf("rootBlockDevice = %q, %v; want virtio0", device, err)
+	}
+	if _, err := rootBlockDevice(context.Background(), client, "/elsewhere.qcow2"); err == nil {
+		t.Fatal("expected error for a disk the VM does not use")
+	}
+}
+
+func TestMonitorCommandTreatsOutputAsError(t *testing.T) {
+	p := &QemuProvider{RootDir: shortTempRoot(t), Config: &config.Config{}}
+	serveFakeQMP(t, p, "vm1", func(cmd map[string]interface{}) interface{} {
+		args, _ := cmd["arguments"].(map[string]interface{})
+		if args["command-line"] == "savevm ok" {
+			return ""
+		}
+		return "Error: Device 'hostdev0' does not support snapshots\r\n"
+	})
+
+	if err := p.monitorCommand("vm1", "savevm ok"); err != nil {
+		t.Fatalf("silent savevm: %v", err)
+	}
+	err := p.monitorCommand("vm1", "savevm vfio")
+	if err == nil || !strings.Contains(err.Error(), "does not support snapshots") {
+		t.Fatalf("failing savevm: err = %v", err)
+	}
+}
+
+func TestResizeDiskLiveUsesBlockResize(t *testing.T) {
+	p := &QemuProvider{RootDir: shortTempRoot(t), Config: &config.Config{}}
+	disk := filepath.Join(p.RootDir, "vms", "vm1.qcow2")
+	os.MkdirAll(filepath.Dir(disk), 0755)
+	if err := os.WriteFile(disk, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	var size interface{}
+	f := serveFakeQMP(t, p, "vm1", func(cmd map[string]interface{}) interface{} {
+		switch cmd["execute"] {
+		case "query-block":
+			return []map[string]interface{}{
+				{"device": "virtio0", "inserted": map[string]interface{}{"file": disk, "image": map[string]interface{}{"virtual-size": 20 << 30}}},
+			}
+		case "block_resize":
+			size = cmd["arguments"].(map[string]interface{})["size"]
+		}
+		return nil
+	})
+	if err := p.writeState(VMState{Name: "vm1", PID: os.Getpid()}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.resizeDisk("vm1", "+10G"); err != nil {
+		t.Fatalf("resizeDisk: %v", err)
+	}
+	if got := strings.Join(f.executed(), ","); got != "query-block,block_resize" {
+		t.Fatalf("monitor commands = %s", got)
+	}
+	if size != float64(30<<30) {
+		t.Fatalf("block_resize size = %v, want %d", size, 30<<30)
+	}
+	if err := p.resizeDisk("vm1", "10G"); err == nil || !strings.Contains(err.Error(), "shrinking") {
+		t.Fatalf("shrinking resize err = %v", err)
+	}
+}
+
+func TestDeviceAddHotplugsRunningVM(t *testing.T) {
+	p := &QemuProvider{RootDir: shortTempRoot(t), Config: &config.Config{}}
+	disk := filepath.Join(p.RootDir, "vms", "vm1.qcow2")
+	os.MkdirAll(filepath.Dir(disk), 0755)
+	if err := os.WriteFile(disk, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	image := filepath.Join(p.RootDir, "stick.img")
+	if err := os.WriteFile(image, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	f := serveFakeQMP(t, p, "vm1", func(cmd map[string]interface{}) interface{} { return nil })
+	if err := p.writeState(VMState{Name: "vm1", PID: os.Getpid()}); err != nil {
+		t.Fatal(err)
+	}
+
+	dev, applied, err := p.DeviceAdd("vm1", Device{Type: DeviceUSBStorage, Source: image})
+	if err != nil || applied != AppliedLive {
+		t.Fatalf("DeviceAdd = %s, %v", applied, err)
+	}
+	if got := strings.Join(f.executed(), ","); got != "device_add,blockdev-add,device_add" {
+		t.Fatalf("monitor commands = %s", got)
+	}
+	if state, _ := p.loadState("vm1"); len(state.Devices) != 1 || state.Devices[0].ID != dev.ID {
+		t.Fatalf("state after hotplug = %+v", state.Devices)
+	}
+}
+
+func TestScreenshotConvertsScreendumpToPNG(t *testing.T) {
+	p := &QemuProvider{RootDir: shortTempRoot(t), Config: &config.Config{}}
+	serveFakeQMP(t, p, "vm1", func(cmd map[string]interface{}) interface{} {
+		if cmd["execute"] == "screendump" {
+			file := cmd["arguments"].(map[string]interface{})["filename"].(string)
+			_ = os.WriteFile(file, append([]byte("P6\n1 1\n255\n"), 1, 2, 3), 0644)
+		}
+		return nil
+	})
+	if err := p.writeState(VMState{Name: "vm1", PID: os.Getpid()}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := p.Screenshot("vm1")
+	if err != nil {
+		t.Fatalf("Screenshot() error = %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Screenshot() is not a PNG: %v", err)
+	}
+	if r, g, b, _ := img.At(0, 0).RGBA(); r>>8 != 1 || g>>8 != 2 || b>>8 != 3 {
+		t.Fatalf("pixel = %d,%d,%d, want 1,2,3", r>>8, g>>8, b>>8)
+	}
+	if dumps, _ := filepath.Glob(filepath.Join(p.RootDir, "run", "vm1.screen*")); len(dumps) != 0 {
+		t.Fatalf("screen dump left behind: %v", dumps)
+	}
+}
+
+func TestSendInputTypesAndClicks(t *testing.T) {
+	p := &QemuProvider{RootDir: shortTempRoot(t), Config: &config.Config{}}
+	f := serveFakeQMP(t, p, "vm1", func(cmd map[string]interface{}) interface{} {
+		if cmd["execute"] == "screendump" {
+			file := cmd["arguments"].(map[string]interface{})["filename"].(string)
+			_ = os.WriteFile(file, []byte("P6\n800 600\n255\n"), 0644)
+		}
+		return nil
+	})
+	if err := p.writeState(VMState{Name: "vm1", PID: os.Getpid(), VNCPort: 5901}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.SendInput("vm1", InputAction{Action: InputType, Text: "Ok"}); err != nil {
+		t.Fatalf("SendInput(type) error = %v", err)
+	}
+	if err := p.SendInput("vm1", InputAction{Action: InputClick, X: 799, Y: 0}); err != nil {
+		t.Fatalf("SendInput(click) error = %v", err)
+	}
+	if got := strings.Join(f.executed(), ","); got != "send-key,send-key,screendump,input-send-event,input-send-event,input-send-event" {
+		t.Fatalf("monitor commands = %s", got)
+	}
+	f.mu.Lock()
+	move, _ := json.Marshal(f.commands[3]["arguments"])
+	f.mu.Unlock()
+	if !strings.Contains(string(move), `"axis":"x","value":32767`) || !strings.Contains(string(move), `"axis":"y","value":0`) {
+		t.Fatalf("pointer move = %s", move)
+	}
+
+	if err := p.writeState(VMState{Name: "vm1", PID: os.Getpid()}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SendInput("vm1", InputAction{Action: InputMove, X: 1, Y: 1}); err == nil {
+		t.Fatal("pointer input on a headless VM succeeded, want error")
+	}
+}
+
+func TestUpdateConfigLiveBalloonsAndHotplugsCPUs(t *testing.T) {
+	p := &QemuProvider{RootDir: shortTempRoot(t), Config: &config.Config{}}
+	disk := filepath.Join(p.RootDir, "vms", "vm1.qcow2")
+	os.MkdirAll(filepath.Dir(disk), 0755)
+	if err := os.WriteFile(disk, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	slot := func(core int, plugged bool) map[string]interface{} {
+		s := map[string]interface{}{"type": "host-x86_64-cpu", "vcpus-count": 1, "props": map[string]interface{}{"socket-id": 0, "core-id": core, "thread-id": 0}}
+		if plugged {
+			s["qom-path"] = fmt.Sprintf("/machine/unattached/device[%d]", core)
+		}
+		return s
+	}
+	var balloon, cpuID interface{}
+	f := serveFakeQMP(t, p, "vm1", func(cmd map[string]interface{}) interface{} {
+		args, _ := cmd["arguments"].(map[string]interface{})
+		switch cmd["execute"] {
+		case "query-memory-size-summary":
+			return map[string]interface{}{"base-memory": 4096 << 20}
+		case "query-hotpluggable-cpus":
+			return []interface{}{slot(3, false), slot(2, false), slot(1, true), slot(0, true)}
+		case "balloon":
+			balloon = args["value"]
+		case "device_add":
+			cpuID = args["id"]
+		}
+		return nil
+	})
+	if err := p.writeState(VMState{Name: "vm1", PID: os.Getpid(), MemoryMB: 4096, VCPUs: 2, MaxVCPUs: 4}); err != nil {
+		t.Fatal(err)
+	}
+
+	mem, cpus := 1024, 3
+	applied, err := p.UpdateConfig("vm1", VMConfigUpdates{MemoryMB: &mem, VCPUs: &cpus, Live: true})
+	if err != nil || applied != AppliedLive {
+		t.Fatalf("UpdateConfig live = %s, %v", applied, err)
+	}
+	if got := strings.Join(f.executed(), ","); got != "query-memory-size-summary,balloon,query-hotpluggable-cpus,device_add" {
+		t.Fatalf("monitor commands = %s", got)
+	}
+	if balloon != float64(1024<<20) || cpuID != "nido-cpu-0-2-0" {
+		t.Fatalf("balloon = %v, cpu id = %v", balloon, cpuID)
+	}
+	state, _ := p.loadState("vm1")
+	if state.MemoryMB != 1024 || state.VCPUs != 3 || state.MaxMemoryMB != 4096 {
+		t.Fatalf("state after live resize = %+v", state)
+	}
+
+	big := 8192
+	if _, err := p.UpdateConfig("vm1", VMConfigUpdates{MemoryMB: &big, Live: true}); err == nil || !strings.Contains(err.Error(), "booted with 4096 MB") {
+		t.Fatalf("UpdateConfig above the ceiling = %v", err)
+	}
+}
+
+func TestGuestInfoSkipsDisconnectedAgent(t *testing.T) {
+	p := &QemuProvider{RootDir: shortTempRoot(t), Config: &config.Config{}}
+	disk := filepath.Join(p.RootDir, "vms", "vm1.qcow2")
+	os.MkdirAll(filepath.Dir(disk), 0755)
+	if err := os.WriteFile(disk, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	f := serveFakeQMP(t, p, "vm1", func(cmd map[string]interface{}) interface{} {
+		return []map[string]interface{}{{"label": agentChardevID, "filename": "unix:vm1.qga", "frontend-open": false}}
+	})
+	// The agent socket accepts but nothing in the guest ever answers.
+	ln, err := net.Listen("unix", filepath.Join(p.RootDir, "run", "vm1.qga"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	if err := p.writeState(VMState{Name: "vm1", PID: os.Getpid()}); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	if _, err := p.GuestInfo("vm1"); err == nil || !strings.Contains(err.Error(), "not connected") {
+		t.Fatalf("GuestInfo without an agent = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed >= agentProbeTimeout {
+		t.Fatalf("GuestInfo waited %s for a disconnected agent", elapsed)
+	}
+	if got := strings.Join(f.executed(), ","); got != "query-chardev" {
+		t.Fatalf("monitor commands = %s", got)
+	}
+}
+
+func TestDeviceRemoveKeepsUnreleasedDevice(t *testing.T) {
+	defer func(d time.Duration) { deviceUnplugTimeout = d }(deviceUnplugTimeout)
+	deviceUnplugTimeout = 100 * time.Millisecond
+	p := &QemuProvider{RootDir: shortTempRoot(t), Config: &config.Config{}}
+	disk := filepath.Join(p.RootDir, "vms", "vm1.qcow2")
+	os.MkdirAll(filepath.Dir(disk), 0755)
+	if err := os.WriteFile(disk, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	// The guest never answers device_del with DEVICE_DELETED.
+	f := serveFakeQMP(t, p, "vm1", func(cmd map[string]interface{}) interface{} { return nil })
+	if err := p.writeState(VMState{Name: "vm1", PID: os.Getpid(), Devices: []Device{{ID: "nic0", Type: DeviceNIC}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if applied, err := p.DeviceRemove("vm1", "nic0"); err != nil || applied != AppliedNextBoot {
+		t.Fatalf("DeviceRemove = %s, %v", applied, err)
+	}
+	if got := strings.Join(f.executed(), ","); got != "device_del" {
+		t.Fatalf("monitor commands = %s", got)
+	}
+	if state, _ := p.loadState("vm1"); len(state.Devices) != 1 || !state.Devices[0].Removing {
+		t.Fatalf("state after timed-out unplug = %+v", state.Devices)
+	}
+	if _, _, err := p.DeviceAdd("vm1", Device{ID: "nic0", Type: DeviceNIC}); err == nil {
+		t.Fatal("DeviceAdd reused the id of a device QEMU still holds")
+	}
+}
+
+func TestConcurrentScreenshotsUseSeparateDumps(t *testing.T) {
+	p := &QemuProvider{RootDir: shortTempRoot(t), Config: &config.Config{}}
+	var mu sync.Mutex
+	files := map[string]bool{}
+	serveFakeQMP(t, p, "vm1", func(cmd map[string]interface{}) interface{} {
+		if cmd["execute"] == "screendump" {
+			file := cmd["arguments"].(map[string]interface{})["filename"].(string)
+			mu.Lock()
+			files[file] = true
+			mu.Unlock()
+			_ = os.WriteFile(file, append([]byte("P6\n1 1\n255\n"), 1, 2, 3), 0644)
+		}
+		return nil
+	})
+	if err := p.writeState(VMState{Name: "vm1", PID: os.Getpid()}); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := p.Screenshot("vm1"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if len(files) != 4 {
+		t.Fatalf("4 screenshots dumped to %d files: %v", len(files), files)
+	}
+}
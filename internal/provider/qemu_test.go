@@ -60,7 +60,7 @@ func TestBuildQemuArgs_CrossPlatform(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			// pass accelerators from test case if present
-			args := p.buildQemuArgs("test-vm", filepath.Join(os.TempDir(), "test.qcow2"), 50022, 0, nil, filepath.Join(os.TempDir(), "run"), "", 2048, 0, nil, tt.opts.Accelerators)
+			args := p.buildQemuArgs(VMState{Name: "test-vm", SSHPort: 50022, MemoryMB: 2048, Accelerators: tt.opts.Accelerators}, filepath.Join(os.TempDir(), "test.qcow2"), filepath.Join(os.TempDir(), "run"))
 
 			// Verify common arguments are present
 			if !contains(args, "-name") {
@@ -129,7 +129,7 @@ func TestBuildQemuArgs_CommonArguments(t *testing.T) {
 		Config:  &config.Config{},
 	}
 
-	args := p.buildQemuArgs("test-vm", filepath.Join(os.TempDir(), "test.qcow2"), 50022, 0, nil, filepath.Join(os.TempDir(), "run"), "", 2048, 0, nil, nil)
+	args := p.buildQemuArgs(VMState{Name: "test-vm", SSHPort: 50022, MemoryMB: 2048}, filepath.Join(os.TempDir(), "test.qcow2"), filepath.Join(os.TempDir(), "run"))
 
 	requiredArgs := map[string]bool{
 		"-name":   false,
@@ -188,7 +188,7 @@ func TestBuildQemuArgs_DiskPath(t *testing.T) {
 	}
 
 	diskPath := "/path/to/vm.qcow2"
-	args := p.buildQemuArgs("test-vm", diskPath, 50022, 0, nil, filepath.Join(os.TempDir(), "run"), "", 2048, 0, nil, nil)
+	args := p.buildQemuArgs(VMState{Name: "test-vm", SSHPort: 50022, MemoryMB: 2048}, diskPath, filepath.Join(os.TempDir(), "run"))
 
 	found := false
 	for _, arg := range args {
@@ -211,7 +211,7 @@ func TestBuildQemuArgs_VNC(t *testing.T) {
 	}
 
 	// 1. Test with VNC enabled (port 5901)
-	args := p.buildQemuArgs("test-vm", filepath.Join(os.TempDir(), "test.qcow2"), 50022, 5901, nil, filepath.Join(os.TempDir(), "run"), "", 2048, 0, nil, nil)
+	args := p.buildQemuArgs(VMState{Name: "test-vm", SSHPort: 50022, VNCPort: 5901, MemoryMB: 2048}, filepath.Join(os.TempDir(), "test.qcow2"), filepath.Join(os.TempDir(), "run"))
 	if !contains(args, "-vnc") {
 		t.Error("Missing -vnc argument when port is provided")
 	}
@@ -221,7 +221,7 @@ func TestBuildQemuArgs_VNC(t *testing.T) {
 	}
 
 	// 2. Test with VNC disabled (port 0)
-	argsNoVNC := p.buildQemuArgs("test-vm", filepath.Join(os.TempDir(), "test.qcow2"), 50022, 0, nil, filepath.Join(os.TempDir(), "run"), "", 2048, 0, nil, nil)
+	argsNoVNC := p.buildQemuArgs(VMState{Name: "test-vm", SSHPort: 50022, MemoryMB: 2048}, filepath.Join(os.TempDir(), "test.qcow2"), filepath.Join(os.TempDir(), "run"))
 	if contains(argsNoVNC, "-vnc") {
 		t.Error("-vnc argument should not be present when port is 0")
 	}
@@ -318,6 +318,83 @@ func TestCloudInitKeepsAdminAndDisablesPasswordWhenKeyPresent(t *testing.T) {
 	}
 }
 
+func TestCloudInitInstallsGuestAgent(t *testing.T) {
+	ci := CloudInit{User: "vmuser", SSHKey: "ssh-ed25519 AAAATEST nido-test"}
+	userData := ci.buildUserData()
+
+	for _, want := range []string{"packages:\n  - qemu-guest-agent\n", "systemctl enable --now qemu-guest-agent"} {
+		if !strings.Contains(userData, want) {
+			t.Fatalf("cloud-config missing %q:\n%s", want, userData)
+		}
+	}
+}
+
+func TestBuildQemuArgs_GuestAgentChannel(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the guest agent channel is unix-socket based")
+	}
+	p := &QemuProvider{RootDir: filepath.Join(os.TempDir(), "nido-test"), Config: &config.Config{}}
+	runDir := filepath.Join(os.TempDir(), "run")
+	args := strings.Join(p.buildQemuArgs(VMState{Name: "test-vm", SSHPort: 50022, MemoryMB: 2048}, filepath.Join(os.TempDir(), "test.qcow2"), runDir), " ")
+
+	for _, want := range []string{
+		"socket,path=" + filepath.Join(runDir, "test-vm.qga") + ",server=on,wait=off,id=qga0",
+		"virtserialport,chardev=qga0,name=org.qemu.guest_agent.0",
+	} {
+		if !strings.Contains(args, want) {
+			t.Fatalf("qemu args missing %q: %s", want, args)
+		}
+	}
+}
+
+func TestBuildQemuArgs_SerialSocket(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("windows writes the serial port straight to a file")
+	}
+	p := &QemuProvider{RootDir: filepath.Join(os.TempDir(), "nido-test"), Config: &config.Config{}}
+	runDir := filepath.Join(os.TempDir(), "run")
+	args := strings.Join(p.buildQemuArgs(VMState{Name: "test-vm", SSHPort: 50022, MemoryMB: 2048}, filepath.Join(os.TempDir(), "test.qcow2"), runDir), " ")
+
+	for _, want := range []string{
+		"-chardev socket,id=serial0,path=" + filepath.Join(runDir, "test-vm.serial") + ",server=on,wait=off",
+		"-serial chardev:serial0",
+	} {
+		if !strings.Contains(args, want) {
+			t.Fatalf("qemu args missing %q: %s", want, args)
+		}
+	}
+}
+
+func TestBuildQemuArgs_TabletOnlyWithDisplay(t *testing.T) {
+	p := &QemuProvider{RootDir: filepath.Join(os.TempDir(), "nido-test"), Config: &config.Config{}}
+	runDir := filepath.Join(os.TempDir(), "run")
+	disk := filepath.Join(os.TempDir(), "test.qcow2")
+
+	headless := strings.Join(p.buildQemuArgs(VMState{Name: "test-vm", SSHPort: 50022, MemoryMB: 2048}, disk, runDir), " ")
+	if strings.Contains(headless, "usb-tablet") {
+		t.Fatalf("headless VM got a tablet: %s", headless)
+	}
+	gui := strings.Join(p.buildQemuArgs(VMState{Name: "test-vm", SSHPort: 50022, VNCPort: 5901, MemoryMB: 2048}, disk, runDir), " ")
+	if !strings.Contains(gui, "-device usb-tablet,bus=nido-uhci.0,id=nido-tablet") {
+		t.Fatalf("GUI VM is missing the tablet: %s", gui)
+	}
+}
+
+func TestBuildQemuArgs_BalloonAndCPUCeilings(t *testing.T) {
+	p := &QemuProvider{RootDir: filepath.Join(os.TempDir(), "nido-test"), Config: &config.Config{}}
+	args := strings.Join(p.buildQemuArgs(VMState{Name: "test-vm", SSHPort: 50022, MemoryMB: 2048, VCPUs: 2, MaxMemoryMB: 4096, MaxVCPUs: 4}, filepath.Join(os.TempDir(), "test.qcow2"), filepath.Join(os.TempDir(), "run")), " ")
+
+	for _, want := range []string{"-m 4096 ", "-smp 2,maxcpus=4 ", "-device virtio-balloon-pci,id=balloon0"} {
+		if !strings.Contains(args, want) {
+			t.Fatalf("qemu args missing %q: %s", want, args)
+		}
+	}
+	args = strings.Join(p.buildQemuArgs(VMState{Name: "test-vm", SSHPort: 50022, MemoryMB: 2048, VCPUs: 2}, filepath.Join(os.TempDir(), "test.qcow2"), filepath.Join(os.TempDir(), "run")), " ")
+	if !strings.Contains(args, "-m 2048 ") || !strings.Contains(args, "-smp 2 ") {
+		t.Fatalf("qemu args without ceilings: %s", args)
+	}
+}
+
 func TestCloudInitMergesCustomUserDataWithAdminAccess(t *testing.T) {
 	ci := CloudInit{
 		User:           "vmuser",
@@ -339,6 +416,24 @@ func TestCloudInitMergesCustomUserDataWithAdminAccess(t *testing.T) {
 	}
 }
 
+func TestCloudInitAppendsCustomCloudConfigLists(t *testing.T) {
+	ci := CloudInit{
+		User:           "vmuser",
+		CustomUserData: "#cloud-config\nruncmd:\n  - echo custom\nwrite_files:\n  - path: /etc/custom\n    content: x\n",
+	}
+	userData := ci.buildUserData()
+
+	header := "Merge-Type: " + cloudConfigMergeType
+	if n := strings.Count(userData, header); n != 2 {
+		t.Fatalf("user-data has %d merge headers, want one per cloud-config part:\n%s", n, userData)
+	}
+	for _, want := range []string{"qemu-guest-agent", "echo custom", "/etc/custom"} {
+		if !strings.Contains(userData, want) {
+			t.Fatalf("merged user-data missing %q:\n%s", want, userData)
+		}
+	}
+}
+
 func TestWriteSeedExtraFilesCreatesSupportFiles(t *testing.T) {
 	root := t.TempDir()
 	err := writeSeedExtraFiles(root, map[string]string{
@@ -0,0 +1,168 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Josepavese/nido/internal/qmp"
+)
+
+// cpuDevicePrefix marks vCPUs added live; only those can be unplugged.
+const cpuDevicePrefix = "nido-cpu"
+
+// memoryCeilingMB is the -m value: the configured maximum when it is above
+// the target, so the balloon has room to grow back.
+func memoryCeilingMB(memoryMB, maxMemoryMB int) int {
+	if maxMemoryMB > memoryMB {
+		return maxMemoryMB
+	}
+	return memoryMB
+}
+
+// smpArg renders -smp with a maxcpus ceiling when vCPU hotplug is enabled.
+func smpArg(vcpus, maxVCPUs int) string {
+	if maxVCPUs > vcpus {
+		return fmt.Sprintf("%d,maxcpus=%d", vcpus, maxVCPUs)
+	}
+	return fmt.Sprintf("%d", vcpus)
+}
+
+// setBalloon sets the balloon target of a running VM. Start uses it to shrink
+// a VM booted at its memory ceiling down to the configured memory.
+func (p *QemuProvider) setBalloon(name string, memoryMB int) error {
+	client, err := p.dialQMP(name, time.Second)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), qmp.DefaultTimeout)
+	defer cancel()
+	return client.Balloon(ctx, int64(memoryMB)<<20)
+}
+
+// resizeLive balloons memory and hot(un)plugs vCPUs on a running VM. It
+// returns the memory the VM booted with, which bounds the balloon.
+func (p *QemuProvider) resizeLive(name string, memoryMB, vcpus *int) (int, error) {
+	client, err := p.dialQMP(name, time.Second)
+	if err != nil {
+		return 0, fmt.Errorf("VM '%s' is running but its monitor is unavailable: %w", name, err)
+	}
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	summary, err := client.QueryMemorySizeSummary(ctx)
+	if err != nil {
+		return 0, err
+	}
+	ceilingMB := int(summary.BaseMemory >> 20)
+	if memoryMB != nil {
+		if *memoryMB > ceilingMB {
+			return 0, fmt.Errorf("VM '%s' booted with %d MB; raise its max memory and restart to go above that", name, ceilingMB)
+		}
+		if err := client.Balloon(ctx, int64(*memoryMB)<<20); err != nil {
+			return 0, fmt.Errorf("failed to balloon VM '%s' to %d MB: %w", name, *memoryMB, err)
+		}
+	}
+	if vcpus != nil {
+		if err := setVCPUs(ctx, client, *vcpus); err != nil {
+			return 0, fmt.Errorf("failed to set vCPUs of VM '%s' to %d: %w", name, *vcpus, err)
+		}
+	}
+	return ceilingMB, nil
+}
+
+// setVCPUs plugs CPUs into free slots, lowest first, or unplugs CPUs that
+// were added live, highest first, until want vCPUs are present.
+func setVCPUs(ctx context.Context, client *qmp.Client, want int) error {
+	slots, err := client.QueryHotpluggableCPUs(ctx)
+	if err != nil {
+		return err
+	}
+	sortCPUSlots(slots)
+	present := 0
+	for _, s := range slots {
+		if s.QOMPath != "" {
+			present += slotVCPUs(s)
+		}
+	}
+	if max := len(slots); want > max {
+		return fmt.Errorf("the VM allows at most %d vCPUs; raise its max vCPUs and restart", max)
+	}
+
+	for _, s := range slots {
+		if present >= want {
+			break
+		}
+		if s.QOMPath != "" {
+			continue
+		}
+		props := map[string]interface{}{"driver": s.Type, "id": cpuDeviceID(s.Props)}
+		for k, v := range s.Props {
+			props[k] = v
+		}
+		if err := client.DeviceAdd(ctx, props); err != nil {
+			return err
+		}
+		present += slotVCPUs(s)
+	}
+	for i := len(slots) - 1; i >= 0 && present > want; i-- {
+		s := slots[i]
+		id := strings.TrimPrefix(s.QOMPath, "/machine/peripheral/")
+		if !strings.HasPrefix(id, cpuDevicePrefix) {
+			continue
+		}
+		if err := client.DeviceDel(ctx, id); err != nil {
+			return err
+		}
+		if !waitDeviceDeleted(ctx, client, id) {
+			return fmt.Errorf("the guest did not release vCPU %s", id)
+		}
+		present -= slotVCPUs(s)
+	}
+	if present > want {
+		return fmt.Errorf("only vCPUs added live can be removed; %d remain", present)
+	}
+	return nil
+}
+
+func slotVCPUs(s qmp.HotpluggableCPU) int {
+	if s.VCPUsCount > 0 {
+		return s.VCPUsCount
+	}
+	return 1
+}
+
+// cpuTopologyKeys order slots the way QEMU numbers CPUs.
+var cpuTopologyKeys = []string{"node-id", "socket-id", "die-id", "cluster-id", "core-id", "thread-id"}
+
+func cpuSlotValue(props map[string]interface{}, key string) float64 {
+	v, _ := props[key].(float64)
+	return v
+}
+
+func sortCPUSlots(slots []qmp.HotpluggableCPU) {
+	sort.SliceStable(slots, func(i, j int) bool {
+		for _, k := range cpuTopologyKeys {
+			a, b := cpuSlotValue(slots[i].Props, k), cpuSlotValue(slots[j].Props, k)
+			if a != b {
+				return a < b
+			}
+		}
+		return false
+	})
+}
+
+// cpuDeviceID names a live-added vCPU after its topology slot.
+func cpuDeviceID(props map[string]interface{}) string {
+	id := cpuDevicePrefix
+	for _, k := range cpuTopologyKeys {
+		if _, ok := props[k]; ok {
+			id += fmt.Sprintf("-%d", int(cpuSlotValue(props, k)))
+		}
+	}
+	return id
+}
@@ -0,0 +1,173 @@
+package provider
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/Josepavese/nido/internal/qmp"
+)
+
+// Screenshot captures the display of a running VM as PNG. QEMU dumps the
+// screen as PPM into the run directory; it is converted here so the
+// result does not depend on QEMU's optional PNG support.
+func (p *QemuProvider) Screenshot(name string) ([]byte, error) {
+	if _, err := p.loadState(name); err != nil {
+		return nil, err
+	}
+	if !p.vmAlive(name) {
+		return nil, fmt.Errorf("VM '%s' is not running", name)
+	}
+	client, err := p.dialQMP(name, time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("VM '%s' is running but its monitor is unavailable: %w", name, err)
+	}
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), qmp.DefaultTimeout)
+	defer cancel()
+
+	var img image.Image
+	err = p.screendump(ctx, client, name, func(r *bufio.Reader) error {
+		var err error
+		img, err = decodePPM(r)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// screenSize returns the current display resolution, which maps screenshot
+// pixels to absolute pointer coordinates.
+func (p *QemuProvider) screenSize(ctx context.Context, client *qmp.Client, name string) (int, int, error) {
+	var width, height int
+	err := p.screendump(ctx, client, name, func(r *bufio.Reader) error {
+		var err error
+		width, height, _, err = readPPMHeader(r)
+		return err
+	})
+	return width, height, err
+}
+
+// screendump dumps the display into a file of its own in the run directory,
+// so concurrent captures do not overwrite each other, and hands the PPM to
+// read. The dump is removed afterwards.
+func (p *QemuProvider) screendump(ctx context.Context, client *qmp.Client, name string, read func(*bufio.Reader) error) error {
+	tmp, err := os.CreateTemp(filepath.Join(p.RootDir, "run"), name+".screen-*.ppm")
+	if err != nil {
+		return err
+	}
+	dump := tmp.Name()
+	tmp.Close()
+	defer os.Remove(dump)
+	if err := client.Screendump(ctx, dump); err != nil {
+		return fmt.Errorf("failed to capture the screen of VM '%s': %w", name, err)
+	}
+	f, err := os.Open(dump)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := read(bufio.NewReader(f)); err != nil {
+		return fmt.Errorf("failed to read the screen dump of VM '%s': %w", name, err)
+	}
+	return nil
+}
+
+// decodePPM reads a binary (P6) PPM image, the format of QEMU screendump.
+func decodePPM(r io.Reader) (image.Image, error) {
+	br := bufio.NewReader(r)
+	width, height, maxVal, err := readPPMHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	pix := make([]byte, width*height*3)
+	if _, err := io.ReadFull(br, pix); err != nil {
+		return nil, fmt.Errorf("truncated PPM pixel data: %w", err)
+	}
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for i := 0; i < width*height; i++ {
+		img.Pix[i*4+0] = scalePPM(pix[i*3+0], maxVal)
+		img.Pix[i*4+1] = scalePPM(pix[i*3+1], maxVal)
+		img.Pix[i*4+2] = scalePPM(pix[i*3+2], maxVal)
+		img.Pix[i*4+3] = 0xff
+	}
+	return img, nil
+}
+
+// readPPMHeader reads the P6 header up to the first pixel byte and returns
+// width, height and the maximum channel value.
+func readPPMHeader(br *bufio.Reader) (int, int, int, error) {
+	magic, err := ppmToken(br)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if magic != "P6" {
+		return 0, 0, 0, fmt.Errorf("unsupported image format %q (want P6 PPM)", magic)
+	}
+	var header [3]int
+	for i := range header {
+		tok, err := ppmToken(br)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		if header[i], err = strconv.Atoi(tok); err != nil || header[i] <= 0 {
+			return 0, 0, 0, fmt.Errorf("invalid PPM header value %q", tok)
+		}
+	}
+	if header[2] > 255 {
+		return 0, 0, 0, fmt.Errorf("16-bit PPM is not supported")
+	}
+	// A single whitespace byte separates the header from the pixels.
+	if _, err := br.ReadByte(); err != nil {
+		return 0, 0, 0, err
+	}
+	return header[0], header[1], header[2], nil
+}
+
+// ppmToken returns the next whitespace-separated header token, skipping
+// '#' comments.
+func ppmToken(br *bufio.Reader) (string, error) {
+	var tok []byte
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			if len(tok) > 0 && err == io.EOF {
+				return string(tok), nil
+			}
+			return "", fmt.Errorf("truncated PPM header: %w", err)
+		}
+		switch {
+		case b == '#' && len(tok) == 0:
+			if _, err := br.ReadString('\n'); err != nil {
+				return "", fmt.Errorf("truncated PPM header: %w", err)
+			}
+		case b == ' ' || b == '\t' || b == '\n' || b == '\r':
+			if len(tok) > 0 {
+				return string(tok), br.UnreadByte()
+			}
+		default:
+			tok = append(tok, b)
+		}
+	}
+}
+
+func scalePPM(v byte, maxVal int) byte {
+	if maxVal == 255 {
+		return v
+	}
+	return byte(int(v) * 255 / maxVal)
+}
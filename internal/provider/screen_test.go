@@ -0,0 +1,39 @@
+package provider
+
+import (
+	"bytes"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+func TestDecodePPM(t *testing.T) {
+	// 2x1 image: red, then half-intensity blue with maxval 127.
+	data := append([]byte("P6\n# QEMU screendump\n2 1\n127\n"), 127, 0, 0, 0, 0, 63)
+	img, err := decodePPM(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decodePPM() error = %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 2 || b.Dy() != 1 {
+		t.Fatalf("bounds = %v, want 2x1", b)
+	}
+	if got := color.RGBAModel.Convert(img.At(0, 0)).(color.RGBA); got != (color.RGBA{255, 0, 0, 255}) {
+		t.Fatalf("pixel 0 = %v, want opaque red", got)
+	}
+	if got := color.RGBAModel.Convert(img.At(1, 0)).(color.RGBA); got != (color.RGBA{0, 0, 126, 255}) {
+		t.Fatalf("pixel 1 = %v, want scaled blue", got)
+	}
+}
+
+func TestDecodePPMRejectsBadInput(t *testing.T) {
+	for name, in := range map[string]string{
+		"ascii ppm": "P3\n1 1\n255\n0 0 0\n",
+		"truncated": "P6\n2 2\n255\n\x00\x00\x00",
+		"bad size":  "P6\n0 1\n255\n",
+		"16-bit":    "P6\n1 1\n65535\n\x00\x00\x00\x00\x00\x00",
+	} {
+		if _, err := decodePPM(strings.NewReader(in)); err == nil {
+			t.Errorf("%s: decodePPM() succeeded, want error", name)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Josepavese/nido/internal/pkg/sysutil"
+	"github.com/Josepavese/nido/internal/qmp"
+)
+
+// qemuImgSnapshotInfo mirrors the "snapshots" array of `qemu-img info --output=json`.
+type qemuImgSnapshotInfo struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	VMStateSize int64  `json:"vm-state-size"`
+	DateSec     int64  `json:"date-sec"`
+	DateNsec    int64  `json:"date-nsec"`
+}
+
+// vmDiskPath returns the root disk of a VM, failing if it does not exist.
+func (p *QemuProvider) vmDiskPath(vmName string) (string, error) {
+	diskPath := filepath.Join(p.RootDir, "vms", vmName+".qcow2")
+	if _, err := os.Stat(diskPath); err != nil {
+		return "", fmt.Errorf("VM '%s' not found: %w", vmName, err)
+	}
+	return diskPath, nil
+}
+
+// runQemuImg runs qemu-img and folds its output into the error.
+func runQemuImg(args ...string) ([]byte, error) {
+	qemuImg, err := sysutil.QemuImgBinary()
+	if err != nil {
+		return nil, err
+	}
+	out, err := exec.Command(qemuImg, args...).CombinedOutput()
+	if err != nil {
+		return out, fmt.Errorf("qemu-img %s failed: %v (%s)", args[0], err, strings.TrimSpace(string(out)))
+	}
+	return out, nil
+}
+
+// SnapshotCreate stores an internal qcow2 snapshot of the VM disk. A running
+// VM holds a write lock on its disk, so we ask QEMU to take it live instead,
+// with guest filesystems frozen when the guest agent is available.
+func (p *QemuProvider) SnapshotCreate(vmName, name string) error {
+	if err := ValidateSnapshotName(name); err != nil {
+		return err
+	}
+	diskPath, err := p.vmDiskPath(vmName)
+	if err != nil {
+		return err
+	}
+	existing, err := p.SnapshotList(vmName)
+	if err != nil {
+		return err
+	}
+	for _, s := range existing {
+		if s.Name == name {
+			return fmt.Errorf("snapshot '%s' already exists on VM '%s'", name, vmName)
+		}
+	}
+
+	if p.vmAlive(vmName) {
+		return p.withFrozenGuest(vmName, func() error {
+			return p.withRootBlockDevice(vmName, diskPath, func(ctx context.Context, client *qmp.Client, device string) error {
+				return client.Execute(ctx, "blockdev-snapshot-internal-sync", map[string]string{"device": device, "name": name}, nil)
+			})
+		})
+	}
+	_, err = runQemuImg("snapshot", "-c", name, diskPath)
+	return err
+}
+
+// SnapshotList reads the snapshot table of the VM disk. -U lets us inspect
+// disks that a running QEMU has locked.
+func (p *QemuProvider) SnapshotList(vmName string) ([]Snapshot, error) {
+	diskPath, err := p.vmDiskPath(vmName)
+	if err != nil {
+		return nil, err
+	}
+	out, err := runQemuImg("info", "-U", "--output=json", diskPath)
+	if err != nil {
+		return nil, err
+	}
+	var info struct {
+		Snapshots []qemuImgSnapshotInfo `json:"snapshots"`
+	}
+	if err := json.Unmarshal(out, &info); err != nil {
+		return nil, fmt.Errorf("failed to parse qemu-img info: %w", err)
+	}
+	snapshots := make([]Snapshot, 0, len(info.Snapshots))
+	for _, s := range info.Snapshots {
+		snapshots = append(snapshots, Snapshot{
+			ID:          s.ID,
+			Name:        s.Name,
+			CreatedAt:   time.Unix(s.DateSec, s.DateNsec),
+			VMStateSize: s.VMStateSize,
+		})
+	}
+	return snapshots, nil
+}
+
+// SnapshotRestore reverts the VM disk to a snapshot. Reverting under a
+// running guest would corrupt its filesystem view, so the VM must be stopped.
+func (p *QemuProvider) SnapshotRestore(vmName, name string) error {
+	diskPath, err := p.vmDiskPath(vmName)
+	if err != nil {
+		return err
+	}
+	if p.vmAlive(vmName) {
+		return fmt.Errorf("VM '%s' is running; stop it before restoring a snapshot", vmName)
+	}
+	if err := p.requireSnapshot(vmName, name); err != nil {
+		return err
+	}
+	_, err = runQemuImg("snapshot", "-a", name, diskPath)
+	return err
+}
+
+// SnapshotDelete removes a snapshot, live through the monitor when running.
+func (p *QemuProvider) SnapshotDelete(vmName, name string) error {
+	diskPath, err := p.vmDiskPath(vmName)
+	if err != nil {
+		return err
+	}
+	if err := p.requireSnapshot(vmName, name); err != nil {
+		return err
+	}
+	if p.vmAlive(vmName) {
+		return p.withRootBlockDevice(vmName, diskPath, func(ctx context.Context, client *qmp.Client, device string) error {
+			return client.Execute(ctx, "blockdev-snapshot-delete-internal-sync", map[string]string{"device": device, "name": name}, nil)
+		})
+	}
+	_, err = runQemuImg("snapshot", "-d", name, diskPath)
+	return err
+}
+
+func (p *QemuProvider) requireSnapshot(vmName, name string) error {
+	_, err := p.findSnapshot(vmName, name)
+	return err
+}
+
+func (p *QemuProvider) findSnapshot(vmName, name string) (Snapshot, error) {
+	snapshots, err := p.SnapshotList(vmName)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	for _, s := range snapshots {
+		if s.Name == name {
+			return s, nil
+		}
+	}
+	return Snapshot{}, fmt.Errorf("snapshot '%s' not found on VM '%s'", name, vmName)
+}
+
+// vmAlive reports whether the VM's QEMU process is running.
+func (p *QemuProvider) vmAlive(vmName string) bool {
+	state, _ := p.loadState(vmName)
+	return processAlive(p.livePID(vmName, state))
+}
+
+// withRootBlockDevice opens a monitor session and resolves the root disk
+// device before calling fn.
+func (p *QemuProvider) withRootBlockDevice(vmName, diskPath string, fn func(ctx context.Context, client *qmp.Client, device string) error) error {
+	client, err := p.dialQMP(vmName, time.Second)
+	if err != nil {
+		return fmt.Errorf("VM '%s' is running but its monitor is unavailable: %w", vmName, err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	device, err := rootBlockDevice(ctx, client, diskPath)
+	if err != nil {
+		return err
+	}
+	return fn(ctx, client, device)
+}
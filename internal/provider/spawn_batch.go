@@ -0,0 +1,106 @@
+package provider
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// spawnIndex is the placeholder ExpandSpawnNames replaces with 1..count.
+const spawnIndex = "{i}"
+
+// SpawnResult is the outcome of one VM of a SpawnBatch. Result is
+// "spawned", "failed" (Error says why) or "not_ready" when the VM was
+// created but did not pass the wait.
+type SpawnResult struct {
+	Name    string      `json:"name"`
+	Result  string      `json:"result"`
+	SSHPort int         `json:"ssh_port,omitempty"`
+	Error   string      `json:"error,omitempty"`
+	Wait    *WaitResult `json:"wait,omitempty"`
+}
+
+// ExpandSpawnNames turns a name pattern such as worker-{i} into count VM
+// names, numbering from 1. A pattern without {i} only names a single VM.
+func ExpandSpawnNames(pattern string, count int) ([]string, error) {
+	if count < 1 {
+		return nil, fmt.Errorf("count must be at least 1")
+	}
+	if count > 1 && !strings.Contains(pattern, spawnIndex) {
+		return nil, fmt.Errorf("name %q needs a %s placeholder to create %d VMs (e.g. worker-%s)", pattern, spawnIndex, count, spawnIndex)
+	}
+	names := make([]string, count)
+	for i := range names {
+		names[i] = strings.ReplaceAll(pattern, spawnIndex, strconv.Itoa(i+1))
+	}
+	return names, nil
+}
+
+// SpawnBatch spawns one VM per name from the same options, running up to
+// parallel spawns at once. When wait is set each VM is also waited on.
+// Results follow the order of names; the error only reports a batch that
+// could not be started at all.
+func (p *QemuProvider) SpawnBatch(names []string, opts VMOptions, parallel int, wait *WaitOptions) ([]SpawnResult, error) {
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no VM names given")
+	}
+	seen := map[string]bool{}
+	for _, n := range names {
+		if seen[n] {
+			return nil, fmt.Errorf("VM name %s is given more than once", n)
+		}
+		seen[n] = true
+	}
+	if len(names) > 1 && len(opts.Accelerators) > 0 {
+		return nil, fmt.Errorf("passthrough accelerators cannot be shared by %d VMs", len(names))
+	}
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	results := make([]SpawnResult, len(names))
+	sem := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for i, n := range names {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, n string) {
+			defer func() { <-sem; wg.Done() }()
+			results[i] = p.spawnOne(n, opts, wait)
+		}(i, n)
+	}
+	wg.Wait()
+	return results, nil
+}
+
+// spawnOne spawns a single batch member from its own copy of the options,
+// since Spawn fills in host ports and mount paths in place.
+func (p *QemuProvider) spawnOne(name string, opts VMOptions, wait *WaitOptions) SpawnResult {
+	opts.Forwarding = append([]PortForward(nil), opts.Forwarding...)
+	opts.Mounts = append([]Mount(nil), opts.Mounts...)
+	if opts.Labels != nil {
+		labels := make(map[string]string, len(opts.Labels))
+		for k, v := range opts.Labels {
+			labels[k] = v
+		}
+		opts.Labels = labels
+	}
+
+	r := SpawnResult{Name: name, Result: "spawned"}
+	if err := p.Spawn(name, opts); err != nil {
+		r.Result, r.Error = "failed", err.Error()
+		return r
+	}
+	if state, err := p.loadState(name); err == nil {
+		r.SSHPort = state.SSHPort
+	}
+	if wait != nil {
+		res, err := p.Wait(name, *wait)
+		r.Wait = &res
+		if err != nil {
+			r.Result, r.Error = "not_ready", err.Error()
+		}
+	}
+	return r
+}
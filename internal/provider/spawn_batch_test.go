@@ -0,0 +1,58 @@
+package provider
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Josepavese/nido/internal/config"
+)
+
+func TestExpandSpawnNames(t *testing.T) {
+	names, err := ExpandSpawnNames("worker-{i}", 3)
+	if err != nil || strings.Join(names, ",") != "worker-1,worker-2,worker-3" {
+		t.Fatalf("ExpandSpawnNames = %v, %v", names, err)
+	}
+	if names, err = ExpandSpawnNames("solo", 1); err != nil || len(names) != 1 || names[0] != "solo" {
+		t.Fatalf("single name = %v, %v", names, err)
+	}
+	if _, err := ExpandSpawnNames("worker", 2); err == nil {
+		t.Fatal("pattern without {i} accepted for two VMs")
+	}
+	if _, err := ExpandSpawnNames("worker-{i}", 0); err == nil {
+		t.Fatal("zero count accepted")
+	}
+}
+
+func TestSpawnBatchReportsEachVM(t *testing.T) {
+	p := &QemuProvider{RootDir: t.TempDir(), Config: &config.Config{LinkedClones: true}}
+	if err := os.MkdirAll(filepath.Join(p.RootDir, "vms"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(p.RootDir, "vms", "taken.qcow2"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := p.SpawnBatch([]string{"a", "a"}, VMOptions{}, 2, nil); err == nil {
+		t.Fatal("duplicate names accepted")
+	}
+	if _, err := p.SpawnBatch([]string{"a", "b"}, VMOptions{Accelerators: []string{"0000:01:00.0"}}, 2, nil); err == nil {
+		t.Fatal("accelerators shared across VMs")
+	}
+
+	// The backing image does not exist, so every spawn fails on its own.
+	names := []string{"w-1", "taken", "w-3"}
+	results, err := p.SpawnBatch(names, VMOptions{DiskPath: filepath.Join(p.RootDir, "missing.qcow2")}, 2, nil)
+	if err != nil || len(results) != len(names) {
+		t.Fatalf("SpawnBatch = %v, %v", results, err)
+	}
+	for i, r := range results {
+		if r.Name != names[i] || r.Result != "failed" || r.Error == "" {
+			t.Fatalf("result %d = %+v", i, r)
+		}
+	}
+	if !strings.Contains(results[1].Error, "already exists") {
+		t.Fatalf("existing VM error = %q", results[1].Error)
+	}
+}
@@ -0,0 +1,299 @@
+package provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/Josepavese/nido/internal/pkg/sysutil"
+)
+
+// State store. Each VM's state lives in run/<name>.json and is guarded by
+// an advisory lock on run/<name>.lock, so the CLI, the TUI, MCP servers and
+// the supervisor can change the same VM at once. Writes go to a temporary
+// file renamed into place, which lets loadState read without the lock.
+// Choosing host ports reads every VM's state, so it happens under the nest
+// lock (run/nest.lock) until the chosen ports are written; attaching a
+// volume checks its other users under the same lock. The nest lock is
+// only ever taken while holding a VM lock, never the other way round, and
+// no VM lock is taken while holding the nest lock.
+//
+// State files carry a schema_version. Files from an older nido are upgraded
+// through stateMigrations the first time they are loaded or changed, after
+// a copy of the original is kept as run/<name>.json.v<version>.bak.
+
+// StateSchemaVersion is the VMState layout this nido writes.
+const StateSchemaVersion = 1
+
+// stateMigrations[v] upgrades a state from schema version v to v+1 and
+// describes what it changed. It runs under the VM and nest locks; reserved
+// holds the host ports in use across the nest.
+var stateMigrations = []func(p *QemuProvider, state *VMState, reserved map[int]bool) []string{
+	migrateStateV1,
+}
+
+// nestLockFile guards host port allocation and volume sharing across the
+// nest.
+const nestLockFile = "nest.lock"
+
+// StateMigration reports the upgrade of one VM's state file.
+type StateMigration struct {
+	Name    string   `json:"name"`
+	From    int      `json:"from"`
+	To      int      `json:"to"`
+	Changes []string `json:"changes"`
+	Backup  string   `json:"backup,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+func (p *QemuProvider) statePath(name string) string {
+	return filepath.Join(p.RootDir, "run", name+".json")
+}
+
+func (p *QemuProvider) stateBackupPath(name string, version int) string {
+	return fmt.Sprintf("%s.v%d.bak", p.statePath(name), version)
+}
+
+// lockVM blocks until this process holds the state lock of one VM.
+func (p *QemuProvider) lockVM(name string) (func(), error) {
+	return p.lockRunFile(name + ".lock")
+}
+
+// lockNest blocks until this process holds the nest-wide lock.
+func (p *QemuProvider) lockNest() (func(), error) {
+	return p.lockRunFile(nestLockFile)
+}
+
+func (p *QemuProvider) lockRunFile(file string) (func(), error) {
+	runDir := filepath.Join(p.RootDir, "run")
+	if err := os.MkdirAll(runDir, 0755); err != nil {
+		return nil, err
+	}
+	unlock, err := sysutil.LockFile(filepath.Join(runDir, file))
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock %s: %w", file, err)
+	}
+	return unlock, nil
+}
+
+// readState decodes the state file as it is on disk, without migrating it.
+func (p *QemuProvider) readState(name string) (VMState, error) {
+	var state VMState
+	data, err := os.ReadFile(p.statePath(name))
+	if err != nil {
+		return state, err
+	}
+	err = json.Unmarshal(data, &state)
+	if state.Name == "" {
+		state.Name = name
+	}
+	return state, err
+}
+
+// loadState returns the VM's state, upgrading a file from an older nido
+// first. Code holding a VM lock reads other VMs with readState instead.
+func (p *QemuProvider) loadState(name string) (VMState, error) {
+	state, err := p.readState(name)
+	if err != nil || state.SchemaVersion >= StateSchemaVersion {
+		return state, err
+	}
+	if _, err := p.migrateState(name); err != nil {
+		return state, err
+	}
+	return p.readState(name)
+}
+
+// writeState replaces the whole VMState. Changes to an existing VM go
+// through updateState so fields written meanwhile by others survive.
+func (p *QemuProvider) writeState(state VMState) error {
+	unlock, err := p.lockVM(state.Name)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return p.saveState(state)
+}
+
+// saveState writes the state atomically at the current schema version; the
+// caller holds the VM lock.
+func (p *QemuProvider) saveState(state VMState) error {
+	state.SchemaVersion = StateSchemaVersion
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return sysutil.WriteFileAtomic(p.statePath(state.Name), data, 0600)
+}
+
+// updateState loads the VM's state under its lock, lets fn change it and
+// writes it back. Nothing of fn's is written when it fails. fn must not
+// take the lock of any VM, so it reads other VMs with readState.
+func (p *QemuProvider) updateState(name string, fn func(state *VMState) error) (VMState, error) {
+	return p.editState(name, false, fn)
+}
+
+// updatePorts is updateState for changes that pick host ports: fn also
+// runs under the nest lock.
+func (p *QemuProvider) updatePorts(name string, fn func(state *VMState) error) (VMState, error) {
+	return p.editState(name, true, fn)
+}
+
+func (p *QemuProvider) editState(name string, ports bool, fn func(state *VMState) error) (VMState, error) {
+	unlock, err := p.lockVM(name)
+	if err != nil {
+		return VMState{}, err
+	}
+	defer unlock()
+	state, err := p.readState(name)
+	if err != nil {
+		return VMState{}, fmt.Errorf("failed to load state for VM '%s': %w", name, err)
+	}
+	if err := checkStateVersion(state); err != nil {
+		return VMState{}, err
+	}
+	if ports || state.SchemaVersion < StateSchemaVersion {
+		unlockNest, err := p.lockNest()
+		if err != nil {
+			return VMState{}, err
+		}
+		defer unlockNest()
+	}
+	// The upgrade is kept even if fn fails, and fn sees an up-to-date file
+	// if it reads the state again.
+	if state.SchemaVersion < StateSchemaVersion {
+		if _, err := p.upgradeState(&state, true); err != nil {
+			return VMState{}, err
+		}
+		if err := p.saveState(state); err != nil {
+			return VMState{}, err
+		}
+	}
+	if err := fn(&state); err != nil {
+		return VMState{}, err
+	}
+	return state, p.saveState(state)
+}
+
+// checkStateVersion refuses to rewrite state from a newer nido, which would
+// drop the fields this one does not know.
+func checkStateVersion(state VMState) error {
+	if state.SchemaVersion > StateSchemaVersion {
+		return fmt.Errorf("state of VM '%s' has schema version %d, newer than this nido supports (%d); upgrade nido", state.Name, state.SchemaVersion, StateSchemaVersion)
+	}
+	return nil
+}
+
+// upgradeState runs the migrations from the state's version to the current
+// one, in memory. With backup set it first copies the state file aside; the
+// caller holds the VM and nest locks. An up-to-date state is left alone.
+func (p *QemuProvider) upgradeState(state *VMState, backup bool) (StateMigration, error) {
+	m := StateMigration{Name: state.Name, From: state.SchemaVersion, To: StateSchemaVersion, Changes: []string{}}
+	if state.SchemaVersion >= StateSchemaVersion {
+		return m, nil
+	}
+	if backup {
+		if _, err := os.Stat(p.statePath(state.Name)); err == nil {
+			m.Backup = p.stateBackupPath(state.Name, state.SchemaVersion)
+			if err := sysutil.CopyFile(p.statePath(state.Name), m.Backup); err != nil {
+				return m, fmt.Errorf("failed to back up state of VM '%s': %w", state.Name, err)
+			}
+		}
+	}
+	reserved := p.getReservedPorts()
+	for v := state.SchemaVersion; v < StateSchemaVersion; v++ {
+		m.Changes = append(m.Changes, stateMigrations[v](p, state, reserved)...)
+	}
+	state.SchemaVersion = StateSchemaVersion
+	return m, nil
+}
+
+// migrateState upgrades one VM's state file in place.
+func (p *QemuProvider) migrateState(name string) (StateMigration, error) {
+	unlock, err := p.lockVM(name)
+	if err != nil {
+		return StateMigration{Name: name}, err
+	}
+	defer unlock()
+	state, err := p.readState(name)
+	if err != nil {
+		return StateMigration{Name: name}, fmt.Errorf("failed to load state for VM '%s': %w", name, err)
+	}
+	if err := checkStateVersion(state); err != nil || state.SchemaVersion == StateSchemaVersion {
+		return StateMigration{Name: name, From: state.SchemaVersion, To: state.SchemaVersion, Changes: []string{}}, err
+	}
+	unlockNest, err := p.lockNest()
+	if err != nil {
+		return StateMigration{Name: name}, err
+	}
+	defer unlockNest()
+	m, err := p.upgradeState(&state, true)
+	if err != nil {
+		return m, err
+	}
+	return m, p.saveState(state)
+}
+
+// MigrateStates upgrades every state file written by an older nido,
+// keeping a backup of each. A dry run reports the changes without writing;
+// ports it would assign are only picked for real by the migration itself.
+// Up-to-date VMs are not reported.
+func (p *QemuProvider) MigrateStates(dryRun bool) ([]StateMigration, error) {
+	out := []StateMigration{}
+	for _, name := range p.vmNames() {
+		state, err := p.readState(name)
+		if os.IsNotExist(err) || (err == nil && state.SchemaVersion == StateSchemaVersion) {
+			continue
+		}
+		m := StateMigration{Name: name, From: state.SchemaVersion, To: StateSchemaVersion, Changes: []string{}}
+		switch {
+		case err != nil:
+			err = fmt.Errorf("failed to load state for VM '%s': %w", name, err)
+		case dryRun:
+			if err = checkStateVersion(state); err == nil {
+				m, err = p.upgradeState(&state, false)
+			}
+		default:
+			m, err = p.migrateState(name)
+		}
+		if err != nil {
+			m.Error = err.Error()
+		}
+		out = append(out, m)
+	}
+	return out, nil
+}
+
+// migrateStateV1 fills in what nido started recording at spawn time: the
+// SSH and VNC ports, memory, vCPUs and SSH user. Start used to patch these
+// on every boot.
+func migrateStateV1(p *QemuProvider, state *VMState, reserved map[int]bool) []string {
+	var changes []string
+	if state.SSHPort == 0 {
+		if port := p.findAvailablePort(50022, reserved); port > 0 {
+			state.SSHPort = port
+			reserved[port] = true
+			changes = append(changes, fmt.Sprintf("ssh_port: assigned %d", port))
+		}
+	}
+	if state.Gui && state.VNCPort == 0 {
+		if port := p.findAvailablePort(59000, reserved); port > 0 {
+			state.VNCPort = port
+			reserved[port] = true
+			changes = append(changes, fmt.Sprintf("vnc_port: assigned %d", port))
+		}
+	}
+	if state.MemoryMB == 0 {
+		state.MemoryMB = sysutil.DefaultMemory()
+		changes = append(changes, fmt.Sprintf("memory_mb: default %d", state.MemoryMB))
+	}
+	if state.VCPUs == 0 {
+		state.VCPUs = sysutil.DefaultVCPUs()
+		changes = append(changes, fmt.Sprintf("vcpus: default %d", state.VCPUs))
+	}
+	if state.SSHUser == "" && p.Config.SSHUser != "" {
+		state.SSHUser = p.Config.SSHUser
+		changes = append(changes, fmt.Sprintf("ssh_user: default %s", state.SSHUser))
+	}
+	return changes
+}
@@ -0,0 +1,173 @@
+package provider
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Josepavese/nido/internal/config"
+	"github.com/Josepavese/nido/internal/pkg/sysutil"
+)
+
+func TestUpdateStateSerializesWriters(t *testing.T) {
+	p := &QemuProvider{RootDir: t.TempDir(), Config: &config.Config{}}
+	if err := p.writeState(VMState{Name: "vm1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Labels and the restart count are changed by different callers at
+	// once; none of their writes may be lost.
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := p.updateState("vm1", func(state *VMState) error {
+				state.Restarts++
+				if state.Labels == nil {
+					state.Labels = map[string]string{}
+				}
+				state.Labels[fmt.Sprintf("k%d", i)] = "v"
+				return nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	state, err := p.loadState("vm1")
+	if err != nil || state.Restarts != 20 || len(state.Labels) != 20 {
+		t.Fatalf("state after concurrent updates = %+v, %v", state, err)
+	}
+	if _, err := p.updateState("vm1", func(state *VMState) error {
+		state.Restarts = 0
+		return fmt.Errorf("rejected")
+	}); err == nil {
+		t.Fatal("updateState ignored the error of fn")
+	}
+	if state, _ := p.loadState("vm1"); state.Restarts != 20 {
+		t.Fatalf("failed update was written: restarts = %d", state.Restarts)
+	}
+	files, _ := os.ReadDir(filepath.Join(p.RootDir, "run"))
+	for _, f := range files {
+		if strings.HasSuffix(f.Name(), ".tmp") {
+			t.Fatalf("temporary file left behind: %s", f.Name())
+		}
+	}
+	if _, err := p.updateState("missing", func(*VMState) error { return nil }); err == nil {
+		t.Fatal("updateState created the state of a missing VM")
+	}
+}
+
+func TestConcurrentForwardsGetDistinctPorts(t *testing.T) {
+	p := &QemuProvider{RootDir: t.TempDir(), Config: &config.Config{PortRangeStart: 41000, PortRangeEnd: 41999}}
+	const vms = 8
+	for i := 0; i < vms; i++ {
+		if err := p.writeState(VMState{Name: fmt.Sprintf("vm%d", i), SSHPort: 50022 + i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ports := make([]int, vms)
+	var wg sync.WaitGroup
+	for i := 0; i < vms; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			pf, _, err := p.PortForward(fmt.Sprintf("vm%d", i), PortForward{GuestPort: 80, Protocol: "tcp"})
+			if err != nil {
+				t.Error(err)
+			}
+			ports[i] = pf.HostPort
+		}(i)
+	}
+	wg.Wait()
+
+	seen := map[int]bool{}
+	for i, port := range ports {
+		if port == 0 || seen[port] {
+			t.Fatalf("vm%d got host port %d; all ports: %v", i, port, ports)
+		}
+		seen[port] = true
+	}
+}
+
+func TestOldStateIsMigratedOnLoad(t *testing.T) {
+	if len(stateMigrations) != StateSchemaVersion {
+		t.Fatalf("%d migrations for schema version %d", len(stateMigrations), StateSchemaVersion)
+	}
+	p := &QemuProvider{RootDir: t.TempDir(), Config: &config.Config{SSHUser: "nido"}}
+	if err := os.MkdirAll(filepath.Join(p.RootDir, "run"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	old := []byte(`{"name": "vm1", "pid": 0, "ssh_port": 0, "gui": true, "labels": {"team": "search"}}`)
+	if err := os.WriteFile(p.statePath("vm1"), old, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := p.loadState("vm1")
+	if err != nil {
+		t.Fatalf("loadState failed: %v", err)
+	}
+	if state.SchemaVersion != StateSchemaVersion || state.SSHPort == 0 || state.VNCPort == 0 || state.MemoryMB == 0 || state.VCPUs == 0 || state.SSHUser != "nido" || state.Labels["team"] != "search" {
+		t.Fatalf("migrated state = %+v", state)
+	}
+	if onDisk, _ := p.readState("vm1"); onDisk.SchemaVersion != StateSchemaVersion || onDisk.SSHPort != state.SSHPort {
+		t.Fatalf("migration not written: %+v", onDisk)
+	}
+	if backup, err := os.ReadFile(p.stateBackupPath("vm1", 0)); err != nil || !bytes.Equal(backup, old) {
+		t.Fatalf("backup = %q, %v", backup, err)
+	}
+
+	if err := os.WriteFile(p.statePath("vm2"), []byte(`{"schema_version": 99, "name": "vm2"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.updateState("vm2", func(*VMState) error { return nil }); err == nil || !strings.Contains(err.Error(), "newer") {
+		t.Fatalf("state from a newer nido rewritten: %v", err)
+	}
+}
+
+func TestMigrateStates(t *testing.T) {
+	p := &QemuProvider{RootDir: t.TempDir(), Config: &config.Config{}}
+	for _, dir := range []string{"vms", "run"} {
+		if err := os.MkdirAll(filepath.Join(p.RootDir, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"old", "new", "bare"} {
+		if err := os.WriteFile(filepath.Join(p.RootDir, "vms", name+".qcow2"), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(p.statePath("old"), []byte(`{"name": "old", "ssh_port": 50100, "memory_mb": 1024}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.writeState(VMState{Name: "new", SSHPort: 50101, MemoryMB: 1024, VCPUs: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := p.MigrateStates(true)
+	if err != nil || len(plan) != 1 || plan[0].Name != "old" || plan[0].From != 0 || plan[0].Backup != "" || strings.Join(plan[0].Changes, ";") != fmt.Sprintf("vcpus: default %d", sysutil.DefaultVCPUs()) {
+		t.Fatalf("dry run = %+v, %v", plan, err)
+	}
+	if state, _ := p.readState("old"); state.SchemaVersion != 0 {
+		t.Fatal("dry run wrote the state")
+	}
+
+	done, err := p.MigrateStates(false)
+	if err != nil || len(done) != 1 || done[0].Error != "" || done[0].Backup != p.stateBackupPath("old", 0) {
+		t.Fatalf("migrate = %+v, %v", done, err)
+	}
+	if state, _ := p.readState("old"); state.SchemaVersion != StateSchemaVersion || state.SSHPort != 50100 || state.MemoryMB != 1024 {
+		t.Fatalf("migrated state = %+v", state)
+	}
+	if again, _ := p.MigrateStates(false); len(again) != 0 {
+		t.Fatalf("second migration = %+v", again)
+	}
+}
@@ -0,0 +1,441 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Josepavese/nido/internal/cgroup"
+	"github.com/Josepavese/nido/internal/pkg/sysutil"
+	"github.com/Josepavese/nido/internal/qmp"
+	"github.com/Josepavese/nido/internal/serial"
+)
+
+const (
+	// superviseInterval is how often the supervisor polls every VM.
+	superviseInterval = 2 * time.Second
+	// Restart delays double from restartBackoffBase up to restartBackoffMax.
+	restartBackoffBase = time.Second
+	restartBackoffMax  = 5 * time.Minute
+	// stableUptime resets the backoff: a VM that ran this long was healthy.
+	stableUptime = 10 * time.Minute
+	// exitConsoleLines of serial output are kept with a failed exit.
+	exitConsoleLines = 20
+)
+
+// ValidateRestartPolicy accepts no, on-failure and always ("" means no).
+func ValidateRestartPolicy(policy string) error {
+	switch policy {
+	case "", RestartNo, RestartOnFailure, RestartAlways:
+		return nil
+	}
+	return fmt.Errorf("invalid restart policy %q: use no, on-failure or always", policy)
+}
+
+// restartBackoff is the delay before restart number restarts+1.
+func restartBackoff(restarts int) time.Duration {
+	d := restartBackoffBase
+	for i := 0; i < restarts && d < restartBackoffMax; i++ {
+		d *= 2
+	}
+	if d > restartBackoffMax {
+		d = restartBackoffMax
+	}
+	return d
+}
+
+func shouldRestart(policy string, failure bool) bool {
+	return policy == RestartAlways || (policy == RestartOnFailure && failure)
+}
+
+// eventsArgs adds a second QMP monitor reserved for the supervisor, so
+// watching events never takes the single-client monitor from the CLI.
+func eventsArgs(runDir, name string) []string {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	return []string{
+		"-chardev", "socket,id=nido-events,path=" + filepath.Join(runDir, name+".events") + ",server=on,wait=off",
+		"-mon", "chardev=nido-events,mode=control",
+	}
+}
+
+func (p *QemuProvider) eventsSocketPath(name string) string {
+	return filepath.Join(p.RootDir, "run", name+".events")
+}
+
+// exitReason explains an exit from the last SHUTDOWN or GUEST_PANICKED
+// event QEMU sent (nil when none arrived) and the OOM kills in its cgroup.
+// The bool reports a failure, as opposed to a clean exit.
+func exitReason(ev *qmp.Event, oomKills int64) (string, bool) {
+	if ev != nil {
+		if ev.Name == "GUEST_PANICKED" {
+			return "guest kernel panicked", true
+		}
+		var data struct {
+			Reason string `json:"reason"`
+		}
+		_ = json.Unmarshal(ev.Data, &data)
+		switch data.Reason {
+		case "guest-shutdown":
+			return "guest powered off", false
+		case "guest-panic":
+			return "guest kernel panicked", true
+		case "host-signal":
+			return "QEMU was terminated by a signal", true
+		case "host-qmp-quit":
+			return "QEMU quit through its monitor", false
+		case "host-ui":
+			return "display window closed", false
+		}
+	}
+	if oomKills > 0 {
+		return "QEMU was killed by the OOM killer at its memory limit", true
+	}
+	return "QEMU exited unexpectedly", true
+}
+
+// exitWatch follows the supervisor monitor of one QEMU process and keeps
+// the last event that explains an exit.
+type exitWatch struct {
+	pid  int
+	done chan struct{}
+
+	mu   sync.Mutex
+	last *qmp.Event
+}
+
+func (p *QemuProvider) watchExit(name string, pid int) *exitWatch {
+	w := &exitWatch{pid: pid, done: make(chan struct{})}
+	go func() {
+		defer close(w.done)
+		if runtime.GOOS == "windows" {
+			return
+		}
+		client, err := qmp.Dial("unix", p.eventsSocketPath(name), time.Second)
+		if err != nil {
+			return
+		}
+		defer client.Close()
+		for {
+			select {
+			case ev := <-client.Events():
+				w.record(ev)
+			case <-client.Done():
+				for {
+					select {
+					case ev := <-client.Events():
+						w.record(ev)
+					default:
+						return
+					}
+				}
+			}
+		}
+	}()
+	return w
+}
+
+func (w *exitWatch) record(ev qmp.Event) {
+	if ev.Name != "SHUTDOWN" && ev.Name != "GUEST_PANICKED" {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.last = &ev
+}
+
+func (w *exitWatch) event() *qmp.Event {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.last
+}
+
+func (w *exitWatch) closed() bool {
+	select {
+	case <-w.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *QemuProvider) supervisorPIDPath() string {
+	return filepath.Join(p.RootDir, "daemon.pid")
+}
+
+// supervisorLockPath is held by the supervisor for its whole lifetime, so
+// only one runs per nest and a stale pidfile is told apart from a live one.
+func (p *QemuProvider) supervisorLockPath() string {
+	return filepath.Join(p.RootDir, "daemon.lock")
+}
+
+// SupervisorPID returns the PID of the running supervisor, 0 if none.
+func (p *QemuProvider) SupervisorPID() int {
+	unlock, err := sysutil.TryLockFile(p.supervisorLockPath())
+	if err == nil {
+		unlock()
+		return 0
+	}
+	if !errors.Is(err, sysutil.ErrLocked) {
+		return 0
+	}
+	// The supervisor writes its pidfile right after taking the lock.
+	for i := 0; i < 20; i++ {
+		data, _ := os.ReadFile(p.supervisorPIDPath())
+		if pid, _ := strconv.Atoi(strings.TrimSpace(string(data))); pid > 0 && processAlive(pid) {
+			return pid
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return 0
+}
+
+// StartSupervisor launches 'nido daemon' in the background, appending its
+// output to daemon.log in the nest, and returns its PID.
+func (p *QemuProvider) StartSupervisor() (int, error) {
+	if pid := p.SupervisorPID(); pid > 0 {
+		return 0, fmt.Errorf("the supervisor is already running (pid %d)", pid)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return 0, err
+	}
+	log, err := os.OpenFile(filepath.Join(p.RootDir, "daemon.log"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer log.Close()
+	cmd := exec.Command(exe, "daemon")
+	cmd.Stdout, cmd.Stderr = log, log
+	cmd.SysProcAttr = daemonSysProcAttr()
+	if err := cmd.Start(); err != nil {
+		return 0, err
+	}
+	go func() { _ = cmd.Wait() }()
+	return cmd.Process.Pid, nil
+}
+
+type supervisor struct {
+	p       *QemuProvider
+	emit    func(SupervisorEvent)
+	watches map[string]*exitWatch
+}
+
+// Supervise runs the supervisor until ctx ends. Every VM is polled; when
+// QEMU exits without 'nido stop' the reason is recorded in the VM state
+// and the VM is restarted per its restart policy, with exponential
+// backoff. Only one supervisor runs per nest.
+func (p *QemuProvider) Supervise(ctx context.Context, emit func(SupervisorEvent)) error {
+	if err := os.MkdirAll(p.RootDir, 0755); err != nil {
+		return err
+	}
+	unlock, err := sysutil.TryLockFile(p.supervisorLockPath())
+	if errors.Is(err, sysutil.ErrLocked) {
+		if pid := p.SupervisorPID(); pid > 0 {
+			return fmt.Errorf("the supervisor is already running (pid %d)", pid)
+		}
+		return fmt.Errorf("the supervisor is already running")
+	}
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := os.WriteFile(p.supervisorPIDPath(), []byte(strconv.Itoa(os.Getpid())), 0644); err != nil {
+		return err
+	}
+	defer os.Remove(p.supervisorPIDPath())
+
+	s := &supervisor{p: p, emit: emit, watches: map[string]*exitWatch{}}
+	s.emitf("", "supervising VMs in %s", p.RootDir)
+	ticker := time.NewTicker(superviseInterval)
+	defer ticker.Stop()
+	for {
+		s.tick(time.Now())
+		select {
+		case <-ctx.Done():
+			s.emitf("", "supervisor stopped")
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *supervisor) emitf(vm, format string, args ...interface{}) {
+	if s.emit != nil {
+		s.emit(SupervisorEvent{Time: time.Now().UTC(), VM: vm, Message: fmt.Sprintf(format, args...)})
+	}
+}
+
+// tick checks every VM once.
+func (s *supervisor) tick(now time.Time) {
+	for _, r := range s.p.reapExpired(now) {
+		if r.Error != "" {
+			s.emitf(r.Name, "TTL expired; %s failed: %s", expiryVerbs[r.Action], r.Error)
+			continue
+		}
+		s.emitf(r.Name, "TTL expired; %s", r.Action)
+	}
+	seen := map[string]bool{}
+	for _, name := range s.p.vmNames() {
+		seen[name] = true
+		state, err := s.p.loadState(name)
+		if err != nil {
+			continue
+		}
+		switch {
+		case state.PID > 0 && processAlive(state.PID):
+			s.watch(name, state, now)
+		case state.PID > 0:
+			s.recordExit(name, state, now)
+		case state.LastExit != nil && state.LastExit.RestartAt != nil && !now.Before(*state.LastExit.RestartAt):
+			s.restart(name, state)
+		}
+	}
+	for name := range s.watches {
+		if !seen[name] {
+			delete(s.watches, name)
+		}
+	}
+}
+
+// watch keeps an event watch on a running VM and ends guests that
+// panicked, which QEMU would otherwise leave paused forever.
+func (s *supervisor) watch(name string, state VMState, now time.Time) {
+	w := s.watches[name]
+	if w == nil || w.pid != state.PID || w.closed() {
+		w = s.p.watchExit(name, state.PID)
+		s.watches[name] = w
+	}
+	if ev := w.event(); ev != nil && ev.Name == "GUEST_PANICKED" && shouldRestart(state.RestartPolicy, true) {
+		if process, err := os.FindProcess(state.PID); err == nil {
+			_ = process.Kill()
+		}
+	}
+	if state.Restarts > 0 && state.StartedAt != nil && now.Sub(*state.StartedAt) >= stableUptime {
+		_, _ = s.p.updateState(name, func(current *VMState) error {
+			current.Restarts = 0
+			return nil
+		})
+	}
+}
+
+// recordExit stores why QEMU went away and schedules a restart if the
+// policy asks for one.
+func (s *supervisor) recordExit(name string, state VMState, now time.Time) {
+	var ev *qmp.Event
+	if w := s.watches[name]; w != nil && w.pid == state.PID {
+		select {
+		case <-w.done:
+		case <-time.After(time.Second):
+		}
+		ev = w.event()
+	}
+	delete(s.watches, name)
+	var oomKills int64
+	if state.Cgroup != "" {
+		oomKills = cgroup.OOMKills(state.Cgroup)
+	}
+	reason, failure := exitReason(ev, oomKills)
+
+	// 'nido stop' clears the PID before it signals QEMU; if it did so
+	// meanwhile, this exit was asked for.
+	msg := ""
+	_, err := s.p.updateState(name, func(current *VMState) error {
+		if current.PID != state.PID {
+			return nil
+		}
+		if current.StartedAt != nil && now.Sub(*current.StartedAt) >= stableUptime {
+			current.Restarts = 0
+		}
+		rec := &ExitRecord{Time: now.UTC(), Reason: reason, Failure: failure}
+		if failure {
+			rec.Console = s.p.consoleTail(name, exitConsoleLines)
+		}
+		msg = "exited: " + reason
+		if shouldRestart(current.RestartPolicy, failure) {
+			delay := restartBackoff(current.Restarts)
+			at := now.Add(delay).UTC()
+			rec.RestartAt = &at
+			msg += fmt.Sprintf("; restarting in %s", delay)
+		}
+		current.PID = 0
+		current.LastExit = rec
+		s.p.removeRunArtifacts(name)
+		return nil
+	})
+	switch {
+	case err != nil && !errors.Is(err, os.ErrNotExist):
+		s.emitf(name, "failed to record exit: %v", err)
+	case err == nil && msg != "":
+		s.emitf(name, "%s", msg)
+	}
+}
+
+// restart starts a VM whose restart is due. A failed start is retried
+// after a longer backoff.
+func (s *supervisor) restart(name string, state VMState) {
+	attempt := state.Restarts + 1
+	startErr := s.p.Start(name, VMOptions{})
+	delay := restartBackoff(attempt)
+	if _, err := s.p.updateState(name, func(current *VMState) error {
+		current.Restarts = attempt
+		if startErr != nil && current.LastExit != nil {
+			at := time.Now().Add(delay).UTC()
+			current.LastExit.RestartAt = &at
+		}
+		return nil
+	}); err != nil {
+		return
+	}
+	if startErr != nil {
+		s.emitf(name, "restart %d failed: %v; retrying in %s", attempt, startErr, delay)
+		return
+	}
+	s.emitf(name, "restarted (restart %d)", attempt)
+}
+
+// vmNames lists the VMs of the nest.
+func (p *QemuProvider) vmNames() []string {
+	files, _ := os.ReadDir(filepath.Join(p.RootDir, "vms"))
+	var names []string
+	for _, f := range files {
+		if filepath.Ext(f.Name()) == ".qcow2" && !strings.HasSuffix(f.Name(), ".compact.qcow2") {
+			names = append(names, strings.TrimSuffix(f.Name(), ".qcow2"))
+		}
+	}
+	return names
+}
+
+// consoleTail returns the last n lines of the VM's serial log.
+func (p *QemuProvider) consoleTail(name string, n int) []string {
+	lines, err := serial.ReadLog(p.serialLogPath(name), time.Time{})
+	if err != nil {
+		return nil
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	out := make([]string, 0, len(lines))
+	for _, l := range lines {
+		out = append(out, l.Text)
+	}
+	return out
+}
+
+// removeRunArtifacts deletes the pidfile and sockets QEMU leaves behind.
+func (p *QemuProvider) removeRunArtifacts(name string) {
+	runDir := filepath.Join(p.RootDir, "run")
+	for _, suffix := range []string{".pid", ".qmp", ".qga", ".events"} {
+		os.Remove(filepath.Join(runDir, name+suffix))
+	}
+}
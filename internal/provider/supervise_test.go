@@ -0,0 +1,231 @@
+//go:build !windows
+
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Josepavese/nido/internal/config"
+	"github.com/Josepavese/nido/internal/qmp"
+)
+
+func TestRestartBackoffDoublesUpToCap(t *testing.T) {
+	for restarts, want := range map[int]time.Duration{0: time.Second, 1: 2 * time.Second, 3: 8 * time.Second, 30: restartBackoffMax} {
+		if got := restartBackoff(restarts); got != want {
+			t.Fatalf("restartBackoff(%d) = %s, want %s", restarts, got, want)
+		}
+	}
+}
+
+func TestSupervisorRunsOncePerNest(t *testing.T) {
+	p := &QemuProvider{RootDir: t.TempDir(), Config: &config.Config{}}
+	// A pidfile naming a live process is stale without the daemon lock.
+	if err := os.WriteFile(p.supervisorPIDPath(), []byte(strconv.Itoa(os.Getpid())), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if pid := p.SupervisorPID(); pid != 0 {
+		t.Fatalf("SupervisorPID with a stale pidfile = %d", pid)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- p.Supervise(ctx, nil) }()
+	deadline := time.Now().Add(5 * time.Second)
+	for p.SupervisorPID() != os.Getpid() {
+		if time.Now().After(deadline) {
+			t.Fatal("supervisor did not start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := p.Supervise(context.Background(), nil); err == nil || !strings.Contains(err.Error(), "already running") {
+		t.Fatalf("second Supervise = %v", err)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Supervise = %v", err)
+	}
+	if pid := p.SupervisorPID(); pid != 0 {
+		t.Fatalf("SupervisorPID after stop = %d", pid)
+	}
+}
+
+func TestExitReason(t *testing.T) {
+	shutdown := func(reason string) *qmp.Event {
+		return &qmp.Event{Name: "SHUTDOWN", Data: json.RawMessage(`{"guest":true,"reason":"` + reason + `"}`)}
+	}
+	for _, tc := range []struct {
+		ev      *qmp.Event
+		oom     int64
+		reason  string
+		failure bool
+	}{
+		{shutdown("guest-shutdown"), 0, "guest powered off", false},
+		{shutdown("host-signal"), 0, "terminated by a signal", true},
+		{&qmp.Event{Name: "GUEST_PANICKED"}, 0, "kernel panicked", true},
+		{nil, 1, "OOM killer", true},
+		{nil, 0, "exited unexpectedly", true},
+	} {
+		reason, failure := exitReason(tc.ev, tc.oom)
+		if !strings.Contains(reason, tc.reason) || failure != tc.failure {
+			t.Fatalf("exitReason(%v, %d) = %q, %v", tc.ev, tc.oom, reason, failure)
+		}
+	}
+}
+
+// deadPID returns the PID of a process that has already exited.
+func deadPID(t *testing.T) int {
+	t.Helper()
+	cmd := exec.Command("sh", "-c", "exit 0")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	return cmd.Process.Pid
+}
+
+func supervisedVM(t *testing.T, state VMState) (*QemuProvider, *supervisor, *[]string) {
+	t.Helper()
+	p := &QemuProvider{RootDir: shortTempRoot(t), Config: &config.Config{}}
+	for _, dir := range []string{"vms", "run"} {
+		if err := os.MkdirAll(filepath.Join(p.RootDir, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(p.RootDir, "vms", state.Name+".qcow2"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.writeState(state); err != nil {
+		t.Fatal(err)
+	}
+	var messages []string
+	s := &supervisor{p: p, watches: map[string]*exitWatch{}, emit: func(ev SupervisorEvent) {
+		messages = append(messages, ev.VM+": "+ev.Message)
+	}}
+	return p, s, &messages
+}
+
+func TestSupervisorRecordsCrashAndBacksOffFailedRestarts(t *testing.T) {
+	pid := deadPID(t)
+	// No QEMU on PATH, so the restart itself fails.
+	t.Setenv("PATH", t.TempDir())
+	p, s, messages := supervisedVM(t, VMState{Name: "vm1", PID: pid, SSHPort: 50022, RestartPolicy: RestartOnFailure})
+	if err := os.WriteFile(p.serialLogPath("vm1"), []byte("2026-01-01T00:00:00Z\tKernel panic - not syncing\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	s.tick(now)
+	state, _ := p.loadState("vm1")
+	exit := state.LastExit
+	if state.PID != 0 || exit == nil || !exit.Failure || exit.Reason != "QEMU exited unexpectedly" {
+		t.Fatalf("state after crash = pid %d, last exit %+v", state.PID, exit)
+	}
+	if len(exit.Console) != 1 || exit.Console[0] != "Kernel panic - not syncing" {
+		t.Fatalf("console tail = %q", exit.Console)
+	}
+	if exit.RestartAt == nil || !exit.RestartAt.Equal(now.Add(time.Second).UTC()) {
+		t.Fatalf("restart at = %v", exit.RestartAt)
+	}
+
+	s.tick(now.Add(500 * time.Millisecond))
+	if state, _ := p.loadState("vm1"); state.Restarts != 0 {
+		t.Fatal("restarted before the backoff elapsed")
+	}
+	s.tick(now.Add(2 * time.Second))
+	state, _ = p.loadState("vm1")
+	if state.Restarts != 1 || state.LastExit.RestartAt == nil || !state.LastExit.RestartAt.After(now.Add(2*time.Second)) {
+		t.Fatalf("state after failed restart = restarts %d, last exit %+v", state.Restarts, state.LastExit)
+	}
+	if got := strings.Join(*messages, "\n"); !strings.Contains(got, "vm1: exited: QEMU exited unexpectedly; restarting in 1s") || !strings.Contains(got, "vm1: restart 1 failed") {
+		t.Fatalf("supervisor messages:\n%s", got)
+	}
+
+	// 'nido stop' cancels the pending restart.
+	if err := p.Stop("vm1", false); err != nil {
+		t.Fatal(err)
+	}
+	if state, _ := p.loadState("vm1"); state.LastExit.RestartAt != nil || state.Restarts != 0 {
+		t.Fatalf("state after stop = %+v", state)
+	}
+}
+
+// serveEvents plays a QEMU monitor that sends ev and then exits.
+func serveEvents(t *testing.T, path string, ev map[string]interface{}) {
+	t.Helper()
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		enc, dec := json.NewEncoder(conn), json.NewDecoder(conn)
+		_ = enc.Encode(map[string]interface{}{"QMP": map[string]interface{}{"version": map[string]interface{}{}, "capabilities": []string{}}})
+		var cmd map[string]interface{}
+		if dec.Decode(&cmd) != nil {
+			return
+		}
+		_ = enc.Encode(map[string]interface{}{"return": map[string]interface{}{}})
+		_ = enc.Encode(ev)
+	}()
+}
+
+func TestSupervisorLeavesCleanExitAloneUnderOnFailure(t *testing.T) {
+	pid := deadPID(t)
+	p, s, _ := supervisedVM(t, VMState{Name: "vm1", PID: pid, RestartPolicy: RestartOnFailure})
+	serveEvents(t, p.eventsSocketPath("vm1"), map[string]interface{}{
+		"event": "SHUTDOWN", "data": map[string]interface{}{"guest": true, "reason": "guest-shutdown"},
+	})
+	w := p.watchExit("vm1", pid)
+	<-w.done
+	s.watches["vm1"] = w
+
+	s.tick(time.Now())
+	state, _ := p.loadState("vm1")
+	if e := state.LastExit; e == nil || e.Failure || e.Reason != "guest powered off" || e.RestartAt != nil || e.Console != nil {
+		t.Fatalf("last exit = %+v", e)
+	}
+
+	// Switching to always schedules nothing retroactively but is stored.
+	always := RestartAlways
+	if _, err := p.UpdateConfig("vm1", VMConfigUpdates{RestartPolicy: &always}); err != nil {
+		t.Fatal(err)
+	}
+	bad := "sometimes"
+	if _, err := p.UpdateConfig("vm1", VMConfigUpdates{RestartPolicy: &bad}); err == nil {
+		t.Fatal("UpdateConfig accepted an invalid restart policy")
+	}
+	if state, _ := p.loadState("vm1"); state.RestartPolicy != RestartAlways {
+		t.Fatalf("restart policy = %q", state.RestartPolicy)
+	}
+}
+
+func TestSupervisorSkipsExitsStopAskedFor(t *testing.T) {
+	p, s, messages := supervisedVM(t, VMState{Name: "vm1", PID: 0, RestartPolicy: RestartAlways})
+	s.tick(time.Now())
+	if state, _ := p.loadState("vm1"); state.LastExit != nil || len(*messages) != 0 {
+		t.Fatalf("stopped VM was handled: %+v, %q", state.LastExit, *messages)
+	}
+}
+
+func TestBuildQemuArgs_SupervisorMonitor(t *testing.T) {
+	p := &QemuProvider{RootDir: t.TempDir(), Config: &config.Config{}}
+	runDir := filepath.Join(p.RootDir, "run")
+	args := strings.Join(p.buildQemuArgs(VMState{Name: "vm1", SSHPort: 50022, MemoryMB: 2048}, filepath.Join(p.RootDir, "vm1.qcow2"), runDir), " ")
+	want := "-chardev socket,id=nido-events,path=" + filepath.Join(runDir, "vm1.events") + ",server=on,wait=off -mon chardev=nido-events,mode=control"
+	if !strings.Contains(args, want) {
+		t.Fatalf("args missing supervisor monitor %q:\n%s", want, args)
+	}
+}
@@ -0,0 +1,129 @@
+package provider
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TTL changes accepted by SetTTL.
+const (
+	TTLSet    = "set"
+	TTLExtend = "extend"
+	TTLClear  = "clear"
+)
+
+// What the reaper does with a VM whose TTL ran out.
+const (
+	ExpiryDelete = "delete"
+	ExpiryStop   = "stop"
+)
+
+// expiryVerbs names the reaper action an ExpiredVM.Action reports, for
+// messages about it failing.
+var expiryVerbs = map[string]string{"deleted": "delete", "stopped": "stop"}
+
+// ExpiredVM is one VM handled by ReapExpired.
+type ExpiredVM struct {
+	Name      string    `json:"name"`
+	ExpiredAt time.Time `json:"expired_at"`
+	// Action is "deleted" or "stopped".
+	Action string `json:"action"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ParseTTL parses a positive duration such as 30m, 2h or 7d.
+func ParseTTL(raw string) (time.Duration, error) {
+	raw = strings.TrimSpace(raw)
+	var d time.Duration
+	var err error
+	if days, ok := strings.CutSuffix(raw, "d"); ok {
+		var n int
+		n, err = strconv.Atoi(days)
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		d, err = time.ParseDuration(raw)
+	}
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid TTL %q: use a positive duration like 30m, 2h or 7d", raw)
+	}
+	return d, nil
+}
+
+// ValidateOnExpiry accepts delete and stop ("" means delete).
+func ValidateOnExpiry(action string) error {
+	switch action {
+	case "", ExpiryDelete, ExpiryStop:
+		return nil
+	}
+	return fmt.Errorf("invalid expiry action %q: use delete or stop", action)
+}
+
+// SetTTL sets, extends or clears the expiry of a VM and returns the new
+// expiry (nil once cleared). Extending an unset or past expiry counts
+// from now.
+func (p *QemuProvider) SetTTL(name, action string, d time.Duration) (*time.Time, error) {
+	if _, err := p.vmDiskPath(name); err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	state, err := p.updateState(name, func(state *VMState) error {
+		switch action {
+		case TTLSet, TTLExtend:
+			if d <= 0 {
+				return fmt.Errorf("TTL must be positive")
+			}
+			base := now
+			if action == TTLExtend && state.ExpiresAt != nil && state.ExpiresAt.After(now) {
+				base = *state.ExpiresAt
+			}
+			at := base.Add(d)
+			state.ExpiresAt = &at
+		case TTLClear:
+			state.ExpiresAt = nil
+		default:
+			return fmt.Errorf("invalid TTL action %q: use set, extend or clear", action)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return state.ExpiresAt, nil
+}
+
+// ReapExpired deletes every VM whose TTL ran out, or stops it (clearing
+// the TTL) when its expiry action is stop. Failures are reported per VM.
+func (p *QemuProvider) ReapExpired() ([]ExpiredVM, error) {
+	return p.reapExpired(time.Now()), nil
+}
+
+func (p *QemuProvider) reapExpired(now time.Time) []ExpiredVM {
+	reaped := []ExpiredVM{}
+	for _, name := range p.vmNames() {
+		state, err := p.loadState(name)
+		if err != nil || state.ExpiresAt == nil || now.Before(*state.ExpiresAt) {
+			continue
+		}
+		r := ExpiredVM{Name: name, ExpiredAt: *state.ExpiresAt}
+		if state.OnExpiry == ExpiryStop {
+			r.Action = "stopped"
+			err = p.Stop(name, true)
+			if err == nil {
+				_, err = p.updateState(name, func(state *VMState) error {
+					state.ExpiresAt = nil
+					return nil
+				})
+			}
+		} else {
+			r.Action = "deleted"
+			err = p.Delete(name)
+		}
+		if err != nil {
+			r.Error = err.Error()
+		}
+		reaped = append(reaped, r)
+	}
+	return reaped
+}
@@ -0,0 +1,74 @@
+//go:build !windows
+
+package provider
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTTL(t *testing.T) {
+	for raw, want := range map[string]time.Duration{"30m": 30 * time.Minute, "2h": 2 * time.Hour, "7d": 7 * 24 * time.Hour, " 90s ": 90 * time.Second} {
+		if got, err := ParseTTL(raw); err != nil || got != want {
+			t.Fatalf("ParseTTL(%q) = %s, %v; want %s", raw, got, err, want)
+		}
+	}
+	for _, raw := range []string{"", "0", "-1h", "soon", "1.5d"} {
+		if _, err := ParseTTL(raw); err == nil {
+			t.Fatalf("ParseTTL(%q) succeeded", raw)
+		}
+	}
+}
+
+func TestSetTTLExtendsFromCurrentExpiry(t *testing.T) {
+	p, _, _ := supervisedVM(t, VMState{Name: "vm1"})
+	before := time.Now()
+	at, err := p.SetTTL("vm1", TTLExtend, time.Hour)
+	if err != nil || at == nil || at.Before(before.Add(time.Hour)) {
+		t.Fatalf("first extend = %v, %v", at, err)
+	}
+	first := *at
+	if at, err = p.SetTTL("vm1", TTLExtend, 30*time.Minute); err != nil || !at.Equal(first.Add(30*time.Minute)) {
+		t.Fatalf("second extend = %v, %v; want %v", at, err, first.Add(30*time.Minute))
+	}
+	if at, err = p.SetTTL("vm1", TTLClear, 0); err != nil || at != nil {
+		t.Fatalf("clear = %v, %v", at, err)
+	}
+	if state, _ := p.loadState("vm1"); state.ExpiresAt != nil {
+		t.Fatalf("expiry still stored: %v", state.ExpiresAt)
+	}
+	if _, err := p.SetTTL("nope", TTLSet, time.Hour); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("SetTTL on missing VM = %v", err)
+	}
+}
+
+func TestSupervisorReapsExpiredVMs(t *testing.T) {
+	past := time.Now().Add(-time.Minute).UTC()
+	p, s, messages := supervisedVM(t, VMState{Name: "gone", ExpiresAt: &past})
+	future := time.Now().Add(time.Hour).UTC()
+	for _, state := range []VMState{{Name: "kept", ExpiresAt: &past, OnExpiry: ExpiryStop}, {Name: "young", ExpiresAt: &future}} {
+		if err := os.WriteFile(filepath.Join(p.RootDir, "vms", state.Name+".qcow2"), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := p.writeState(state); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s.tick(time.Now())
+	if _, err := p.vmDiskPath("gone"); err == nil {
+		t.Fatal("expired VM was not deleted")
+	}
+	if state, err := p.loadState("kept"); err != nil || state.ExpiresAt != nil {
+		t.Fatalf("stopped VM state = %+v, %v", state, err)
+	}
+	if state, _ := p.loadState("young"); state.ExpiresAt == nil {
+		t.Fatal("unexpired VM lost its TTL")
+	}
+	if got := strings.Join(*messages, "\n"); !strings.Contains(got, "gone: TTL expired; deleted") || !strings.Contains(got, "kept: TTL expired; stopped") {
+		t.Fatalf("supervisor messages:\n%s", got)
+	}
+}
@@ -0,0 +1,175 @@
+package provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxVolumeNameLen keeps names within the 20-byte virtio-blk serial, which
+// the guest exposes as /dev/disk/by-id/virtio-<name>.
+const maxVolumeNameLen = 20
+
+// ValidateVolumeName checks that name is usable as a file name, a QEMU id
+// and a virtio serial.
+func ValidateVolumeName(name string) error {
+	if name == "" || len(name) > maxVolumeNameLen {
+		return fmt.Errorf("invalid volume name %q: use 1-%d characters", name, maxVolumeNameLen)
+	}
+	for _, r := range name {
+		if !((r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '-' || r == '_') {
+			return fmt.Errorf("invalid volume name %q: only alphanumeric, hyphens and underscores allowed", name)
+		}
+	}
+	return nil
+}
+
+func (p *QemuProvider) volumesDir() string {
+	return filepath.Join(p.RootDir, "volumes")
+}
+
+func (p *QemuProvider) volumePath(name string) string {
+	return filepath.Join(p.volumesDir(), name+".qcow2")
+}
+
+// volumeDriveArgs attaches a volume as a virtio disk whose serial is the
+// volume name, so guests can find it by id regardless of probe order.
+func volumeDriveArgs(path string, v VolumeAttachment) []string {
+	drive := fmt.Sprintf("file=%s,format=qcow2,if=none,id=vol-%s", qemuOptEscape(path), v.Volume)
+	if v.ReadOnly {
+		drive += ",readonly=on"
+	}
+	return []string{
+		"-drive", drive,
+		"-device", fmt.Sprintf("virtio-blk-pci,drive=vol-%s,serial=%s", v.Volume, v.Volume),
+	}
+}
+
+// VolumeCreate makes an empty qcow2 volume under <root>/volumes.
+func (p *QemuProvider) VolumeCreate(name, size string) (Volume, error) {
+	if err := ValidateVolumeName(name); err != nil {
+		return Volume{}, err
+	}
+	bytes, err := ParseDiskSize(size, 0)
+	if err != nil {
+		return Volume{}, err
+	}
+	path := p.volumePath(name)
+	if _, err := os.Stat(path); err == nil {
+		return Volume{}, fmt.Errorf("volume '%s' already exists", name)
+	}
+	if err := os.MkdirAll(p.volumesDir(), 0755); err != nil {
+		return Volume{}, err
+	}
+	if _, err := runQemuImg("create", "-f", "qcow2", path, strconv.FormatInt(bytes, 10)); err != nil {
+		return Volume{}, fmt.Errorf("failed to create volume '%s': %w", name, err)
+	}
+	return Volume{Name: name, Path: path, SizeBytes: bytes, Attachments: []VolumeAttachment{}}, nil
+}
+
+// VolumeList returns every volume, sorted by name, with its attachments.
+func (p *QemuProvider) VolumeList() ([]Volume, error) {
+	files, err := filepath.Glob(filepath.Join(p.volumesDir(), "*.qcow2"))
+	if err != nil {
+		return nil, err
+	}
+	attachments := p.volumeAttachments()
+	volumes := make([]Volume, 0, len(files))
+	for _, f := range files {
+		name := strings.TrimSuffix(filepath.Base(f), ".qcow2")
+		v := Volume{Name: name, Path: f, Attachments: attachments[name]}
+		if v.Attachments == nil {
+			v.Attachments = []VolumeAttachment{}
+		}
+		if out, err := runQemuImg("info", "-U", "--output=json", f); err == nil {
+			var info struct {
+				VirtualSize int64 `json:"virtual-size"`
+			}
+			if json.Unmarshal(out, &info) == nil {
+				v.SizeBytes = info.VirtualSize
+			}
+		}
+		volumes = append(volumes, v)
+	}
+	sort.Slice(volumes, func(i, j int) bool { return volumes[i].Name < volumes[j].Name })
+	return volumes, nil
+}
+
+// VolumeDelete removes a volume. Attached volumes are refused so a VM never
+// boots with a dangling drive.
+func (p *QemuProvider) VolumeDelete(name string) error {
+	if err := ValidateVolumeName(name); err != nil {
+		return err
+	}
+	path := p.volumePath(name)
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("volume '%s' not found", name)
+	}
+	if users := p.volumeAttachments()[name]; len(users) > 0 {
+		return fmt.Errorf("volume '%s' is attached to VM '%s'; detach it first", name, users[0].VM)
+	}
+	return os.Remove(path)
+}
+
+// VolumeAttach adds a volume to a stopped VM. A volume has one read-write
+// user or any number of read-only ones, matching QEMU's image locking; the
+// nest lock keeps two attaches from both passing that check.
+func (p *QemuProvider) VolumeAttach(vmName, volume string, readOnly bool) error {
+	if err := ValidateVolumeName(volume); err != nil {
+		return err
+	}
+	if _, err := os.Stat(p.volumePath(volume)); err != nil {
+		return fmt.Errorf("volume '%s' not found", volume)
+	}
+	return p.updateStoppedNest(vmName, "attaching volumes", func(state *VMState) error {
+		for _, v := range state.Volumes {
+			if v.Volume == volume {
+				return fmt.Errorf("volume '%s' is already attached to VM '%s'", volume, vmName)
+			}
+		}
+		for _, user := range p.volumeAttachments()[volume] {
+			if !readOnly || !user.ReadOnly {
+				return fmt.Errorf("volume '%s' is attached to VM '%s'; only read-only attachments can be shared", volume, user.VM)
+			}
+		}
+		state.Volumes = append(state.Volumes, VolumeAttachment{Volume: volume, ReadOnly: readOnly})
+		return nil
+	})
+}
+
+// VolumeDetach removes a volume from a stopped VM, leaving its data intact.
+func (p *QemuProvider) VolumeDetach(vmName, volume string) error {
+	return p.updateStopped(vmName, "detaching volumes", func(state *VMState) error {
+		for i, v := range state.Volumes {
+			if v.Volume == volume {
+				state.Volumes = append(state.Volumes[:i], state.Volumes[i+1:]...)
+				return nil
+			}
+		}
+		return fmt.Errorf("volume '%s' not found on VM '%s'", volume, vmName)
+	})
+}
+
+// volumeAttachments maps each volume name to the VMs that use it.
+func (p *QemuProvider) volumeAttachments() map[string][]VolumeAttachment {
+	out := map[string][]VolumeAttachment{}
+	disks, _ := filepath.Glob(filepath.Join(p.RootDir, "vms", "*.qcow2"))
+	for _, d := range disks {
+		if strings.HasSuffix(d, ".compact.qcow2") {
+			continue
+		}
+		vm := strings.TrimSuffix(filepath.Base(d), ".qcow2")
+		state, err := p.readState(vm)
+		if err != nil {
+			continue
+		}
+		for _, v := range state.Volumes {
+			out[v.Volume] = append(out[v.Volume], VolumeAttachment{VM: vm, ReadOnly: v.ReadOnly})
+		}
+	}
+	return out
+}
@@ -0,0 +1,133 @@
+package provider
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Josepavese/nido/internal/config"
+)
+
+func TestValidateVolumeName(t *testing.T) {
+	for _, ok := range []string{"data", "pg_data-01", "ABCDEFGHIJKLMNOPQRST"} {
+		if err := ValidateVolumeName(ok); err != nil {
+			t.Fatalf("ValidateVolumeName(%q) = %v", ok, err)
+		}
+	}
+	for _, bad := range []string{"", "my data", "a,b", "../x", "abcdefghijklmnopqrstu"} {
+		if err := ValidateVolumeName(bad); err == nil {
+			t.Fatalf("ValidateVolumeName(%q) accepted an invalid name", bad)
+		}
+	}
+}
+
+func TestVolumeDriveArgs(t *testing.T) {
+	args := strings.Join(volumeDriveArgs("/nido/volumes/data.qcow2", VolumeAttachment{Volume: "data", ReadOnly: true}), " ")
+	for _, want := range []string{
+		"-drive file=/nido/volumes/data.qcow2,format=qcow2,if=none,id=vol-data,readonly=on",
+		"-device virtio-blk-pci,drive=vol-data,serial=data",
+	} {
+		if !strings.Contains(args, want) {
+			t.Fatalf("volume args missing %q:\n%s", want, args)
+		}
+	}
+}
+
+func TestVolumeAttachRules(t *testing.T) {
+	root := t.TempDir()
+	p := &QemuProvider{RootDir: root, Config: &config.Config{}}
+	for _, f := range []string{"volumes/data.qcow2", "vms/a.qcow2", "run/a.json", "vms/b.qcow2", "run/b.json"} {
+		path := filepath.Join(root, f)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte("{}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := p.VolumeAttach("a", "missing", false); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("VolumeAttach of a missing volume = %v", err)
+	}
+	if err := p.VolumeAttach("a", "data", false); err != nil {
+		t.Fatalf("VolumeAttach: %v", err)
+	}
+	if err := p.VolumeAttach("a", "data", true); err == nil {
+		t.Fatal("VolumeAttach accepted the same volume twice")
+	}
+	if err := p.VolumeAttach("b", "data", true); err == nil {
+		t.Fatal("VolumeAttach shared a read-write volume")
+	}
+	if err := p.VolumeDelete("data"); err == nil || !strings.Contains(err.Error(), "attached") {
+		t.Fatalf("VolumeDelete of an attached volume = %v", err)
+	}
+
+	if err := p.VolumeDetach("a", "data"); err != nil {
+		t.Fatalf("VolumeDetach: %v", err)
+	}
+	if err := p.VolumeAttach("a", "data", true); err != nil {
+		t.Fatalf("VolumeAttach ro: %v", err)
+	}
+	if err := p.VolumeAttach("b", "data", true); err != nil {
+		t.Fatalf("VolumeAttach shared ro: %v", err)
+	}
+	if got := p.volumeAttachments()["data"]; len(got) != 2 {
+		t.Fatalf("attachments = %+v", got)
+	}
+
+	p.VolumeDetach("a", "data")
+	p.VolumeDetach("b", "data")
+	if err := p.VolumeDelete("data"); err != nil {
+		t.Fatalf("VolumeDelete: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "volumes", "data.qcow2")); !os.IsNotExist(err) {
+		t.Fatalf("volume file still present: %v", err)
+	}
+}
+
+func TestVolumeAttachConcurrentReadWrite(t *testing.T) {
+	root := t.TempDir()
+	p := &QemuProvider{RootDir: root, Config: &config.Config{}}
+	vms := []string{"a", "b", "c", "d", "e", "f"}
+	files := []string{"volumes/data.qcow2"}
+	for _, vm := range vms {
+		files = append(files, "vms/"+vm+".qcow2")
+	}
+	for _, f := range files {
+		path := filepath.Join(root, f)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Current-schema states, so no upgrade takes the nest lock for us.
+	for _, vm := range vms {
+		if err := p.writeState(VMState{Name: vm}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(vms))
+	for i, vm := range vms {
+		wg.Add(1)
+		go func(i int, vm string) {
+			defer wg.Done()
+			errs[i] = p.VolumeAttach(vm, "data", false)
+		}(i, vm)
+	}
+	wg.Wait()
+
+	attached := 0
+	for _, err := range errs {
+		if err == nil {
+			attached++
+		}
+	}
+	if attached != 1 {
+		t.Fatalf("%d VMs attached the volume read-write: %v", attached, errs)
+	}
+	if got := p.volumeAttachments()["data"]; len(got) != 1 {
+		t.Fatalf("attachments = %+v", got)
+	}
+}
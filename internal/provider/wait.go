@@ -0,0 +1,198 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultWaitTimeout applies when WaitOptions.Timeout is zero.
+	defaultWaitTimeout = 5 * time.Minute
+	waitPollInterval   = time.Second
+)
+
+// waitCondition is one parsed readiness stage.
+type waitCondition struct {
+	kind string // running, ssh, cloud-init, port, file
+	port int
+	path string
+}
+
+func (c waitCondition) String() string {
+	switch c.kind {
+	case "port":
+		return fmt.Sprintf("port:%d", c.port)
+	case "file":
+		return "file:" + c.path
+	}
+	return c.kind
+}
+
+// needsSSH reports whether the stage is probed with a guest command.
+func (c waitCondition) needsSSH() bool {
+	return c.kind == "cloud-init" || c.kind == "port" || c.kind == "file"
+}
+
+// ValidateWaitCondition checks a readiness condition string without waiting.
+func ValidateWaitCondition(s string) error {
+	_, err := parseWaitCondition(s)
+	return err
+}
+
+func parseWaitCondition(s string) (waitCondition, error) {
+	s = strings.TrimSpace(s)
+	switch {
+	case s == "ssh" || s == "cloud-init":
+		return waitCondition{kind: s}, nil
+	case strings.HasPrefix(s, "port:"):
+		port, err := strconv.Atoi(strings.TrimPrefix(s, "port:"))
+		if err != nil || port < 1 || port > 65535 {
+			return waitCondition{}, fmt.Errorf("invalid wait condition %q: port must be 1-65535", s)
+		}
+		return waitCondition{kind: "port", port: port}, nil
+	case strings.HasPrefix(s, "file:"):
+		path := strings.TrimPrefix(s, "file:")
+		if path == "" {
+			return waitCondition{}, fmt.Errorf("invalid wait condition %q: file path is empty", s)
+		}
+		return waitCondition{kind: "file", path: path}, nil
+	}
+	return waitCondition{}, fmt.Errorf("invalid wait condition %q: want ssh, cloud-init, port:N or file:/path", s)
+}
+
+// waitPlan expands the requested conditions into ordered stages: the VM
+// process first, then sshd before the first guest-side probe, then the
+// conditions themselves without duplicates.
+func waitPlan(conditions []string) ([]waitCondition, error) {
+	if len(conditions) == 0 {
+		conditions = []string{"ssh"}
+	}
+	plan := []waitCondition{{kind: "running"}}
+	seen := map[string]bool{"running": true}
+	for _, raw := range conditions {
+		c, err := parseWaitCondition(raw)
+		if err != nil {
+			return nil, err
+		}
+		if c.needsSSH() && !seen["ssh"] {
+			plan = append(plan, waitCondition{kind: "ssh"})
+			seen["ssh"] = true
+		}
+		if !seen[c.String()] {
+			plan = append(plan, c)
+			seen[c.String()] = true
+		}
+	}
+	return plan, nil
+}
+
+// Wait polls each readiness stage in turn until it holds, the VM process
+// exits, or the timeout expires. Guest-side probes run over SSH, so they
+// need key-based access.
+func (p *QemuProvider) Wait(name string, opts WaitOptions) (WaitResult, error) {
+	plan, err := waitPlan(opts.For)
+	if err != nil {
+		return WaitResult{}, err
+	}
+	if _, err := p.vmDiskPath(name); err != nil {
+		return WaitResult{}, err
+	}
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = defaultWaitTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	start := time.Now()
+	res := WaitResult{Stages: make([]WaitStage, 0, len(plan))}
+	for _, c := range plan {
+		stageStart := time.Now()
+		err := p.pollStage(ctx, name, c)
+		stage := WaitStage{Stage: c.String(), Reached: err == nil, DurationMS: time.Since(stageStart).Milliseconds()}
+		if err != nil {
+			if ctx.Err() != nil {
+				err = fmt.Errorf("timed out after %s waiting for %s on VM '%s'", timeout, c, name)
+			}
+			stage.Error = err.Error()
+		}
+		res.Stages = append(res.Stages, stage)
+		if opts.OnStage != nil {
+			opts.OnStage(stage)
+		}
+		if err != nil {
+			res.DurationMS = time.Since(start).Milliseconds()
+			return res, err
+		}
+	}
+	res.Ready = true
+	res.DurationMS = time.Since(start).Milliseconds()
+	return res, nil
+}
+
+// pollStage retries one probe until it succeeds or ctx ends. A stopped VM
+// never becomes ready, so a dead process fails the wait at once.
+func (p *QemuProvider) pollStage(ctx context.Context, name string, c waitCondition) error {
+	for {
+		if !p.vmAlive(name) {
+			return fmt.Errorf("VM '%s' is not running", name)
+		}
+		if p.probeStage(ctx, name, c) {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(waitPollInterval):
+		}
+	}
+}
+
+func (p *QemuProvider) probeStage(ctx context.Context, name string, c waitCondition) bool {
+	var remote string
+	switch c.kind {
+	case "running":
+		return true
+	case "ssh":
+		info, err := p.Info(name)
+		if err != nil || info.SSHPort == 0 {
+			return false
+		}
+		return sshBannerReady(ctx, net.JoinHostPort(info.IP, strconv.Itoa(info.SSHPort)))
+	case "cloud-init":
+		remote = "test -f /var/lib/cloud/instance/boot-finished"
+	case "file":
+		remote = "test -e " + shellQuote(c.path)
+	case "port":
+		// Probed from inside the guest: user-mode networking accepts host
+		// connections on forwarded ports even when nothing listens.
+		remote = fmt.Sprintf("nc -z 127.0.0.1 %d 2>/dev/null || bash -c 'exec 3<>/dev/tcp/127.0.0.1/%d' 2>/dev/null", c.port, c.port)
+	}
+	probeCtx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+	_, err := p.sshRun(probeCtx, name, remote, nil, io.Discard)
+	return err == nil
+}
+
+// sshBannerReady reports whether sshd answers on addr. Reading the banner
+// matters: the user-mode network stack accepts the TCP connection for the
+// forwarded port before the guest is listening.
+func sshBannerReady(ctx context.Context, addr string) bool {
+	dialer := net.Dialer{Timeout: 2 * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return false
+	}
+	return string(buf) == "SSH-"
+}
@@ -0,0 +1,66 @@
+package provider
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestWaitPlan(t *testing.T) {
+	cases := []struct {
+		in   []string
+		want []string
+	}{
+		{nil, []string{"running", "ssh"}},
+		{[]string{"cloud-init"}, []string{"running", "ssh", "cloud-init"}},
+		{[]string{"port:8080", "ssh", "file:/tmp/ready"}, []string{"running", "ssh", "port:8080", "file:/tmp/ready"}},
+		{[]string{"ssh", "ssh"}, []string{"running", "ssh"}},
+	}
+	for _, tc := range cases {
+		plan, err := waitPlan(tc.in)
+		if err != nil {
+			t.Fatalf("waitPlan(%v): %v", tc.in, err)
+		}
+		var got []string
+		for _, c := range plan {
+			got = append(got, c.String())
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Fatalf("waitPlan(%v) = %v, want %v", tc.in, got, tc.want)
+		}
+	}
+
+	for _, bad := range []string{"http", "port:0", "port:x", "file:"} {
+		if _, err := waitPlan([]string{bad}); err == nil {
+			t.Fatalf("waitPlan(%q) accepted an invalid condition", bad)
+		}
+	}
+}
+
+func TestSSHBannerReady(t *testing.T) {
+	serve := func(banner string) string {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { ln.Close() })
+		go func() {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write([]byte(banner))
+			conn.Close()
+		}()
+		return ln.Addr().String()
+	}
+
+	if !sshBannerReady(context.Background(), serve("SSH-2.0-OpenSSH_9.6\r\n")) {
+		t.Fatal("expected an SSH banner to count as ready")
+	}
+	// A forwarded port with nothing behind it accepts and closes at once.
+	if sshBannerReady(context.Background(), serve("")) {
+		t.Fatal("expected an empty connection to be not ready")
+	}
+}
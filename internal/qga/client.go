@@ -0,0 +1,213 @@
+// Package qga implements a small client for the QEMU guest agent (qemu-ga).
+//
+// The agent speaks QMP-style JSON over a virtio-serial channel, but without
+// a greeting or capabilities negotiation. The channel outlives client
+// sessions, so a Client first resynchronizes with guest-sync-delimited to
+// drop any reply a previous session left behind.
+package qga
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout bounds the sync handshake and each command when the caller
+// does not supply a context deadline.
+const DefaultTimeout = 3 * time.Second
+
+// syncDelimiter precedes the guest-sync-delimited reply and resets the
+// agent's JSON parser when sent.
+const syncDelimiter = 0xFF
+
+// ErrClosed is returned once the session has been closed or broken.
+var ErrClosed = errors.New("qga: connection closed")
+
+// Error is a failure reported by the agent in response to a command.
+type Error struct {
+	Class string `json:"class"`
+	Desc  string `json:"desc"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("qga: %s: %s", e.Class, e.Desc)
+}
+
+type request struct {
+	Execute   string      `json:"execute"`
+	Arguments interface{} `json:"arguments,omitempty"`
+}
+
+type reply struct {
+	Return json.RawMessage `json:"return"`
+	Error  *Error          `json:"error,omitempty"`
+}
+
+// Client is a synchronized guest agent session. Commands are serialized;
+// a command that fails mid-exchange closes the session, since its late
+// reply would otherwise be read as the answer to the next one.
+type Client struct {
+	conn    net.Conn
+	r       *bufio.Reader
+	timeout time.Duration
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// Dial connects to the agent chardev ("unix" socket path or "tcp"
+// host:port) and synchronizes within timeout. A missing or silent agent
+// surfaces as a timeout.
+func Dial(network, address string, timeout time.Duration) (*Client, error) {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	conn, err := net.DialTimeout(network, address, timeout)
+	if err != nil {
+		return nil, err
+	}
+	c, err := NewClient(conn, timeout)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// NewClient synchronizes a session over an existing connection.
+func NewClient(conn net.Conn, timeout time.Duration) (*Client, error) {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	c := &Client{conn: conn, r: bufio.NewReader(conn), timeout: timeout}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := c.sync(ctx); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Close terminates the session.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	return c.conn.Close()
+}
+
+// Execute runs command with optional arguments and decodes the "return"
+// payload into result (which may be nil).
+func (c *Client) Execute(ctx context.Context, command string, args interface{}, result interface{}) error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return ErrClosed
+	}
+	if err := c.write(ctx, nil, request{Execute: command, Arguments: args}); err != nil {
+		return c.fail(fmt.Errorf("qga: %s: %w", command, err))
+	}
+	for {
+		line, err := c.r.ReadBytes('\n')
+		if err != nil {
+			return c.fail(fmt.Errorf("qga: %s: %w", command, err))
+		}
+		var resp reply
+		if err := json.Unmarshal(line, &resp); err != nil {
+			continue // stray bytes on the channel
+		}
+		if resp.Error != nil {
+			return resp.Error
+		}
+		if result != nil && len(resp.Return) > 0 {
+			if err := json.Unmarshal(resp.Return, result); err != nil {
+				return fmt.Errorf("qga: %s: decode reply: %w", command, err)
+			}
+		}
+		return nil
+	}
+}
+
+// Send issues a command that produces no reply on success, such as
+// guest-shutdown. Only transport errors are reported.
+func (c *Client) Send(ctx context.Context, command string, args interface{}) error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return ErrClosed
+	}
+	if err := c.write(ctx, nil, request{Execute: command, Arguments: args}); err != nil {
+		return c.fail(fmt.Errorf("qga: %s: %w", command, err))
+	}
+	return nil
+}
+
+// sync discards whatever is queued on the channel and waits for the agent to
+// echo a fresh random id.
+func (c *Client) sync(ctx context.Context) error {
+	id := rand.Int63n(1 << 31)
+	req := request{Execute: "guest-sync-delimited", Arguments: map[string]int64{"id": id}}
+	if err := c.write(ctx, []byte{syncDelimiter}, req); err != nil {
+		return fmt.Errorf("qga: sync: %w", err)
+	}
+	for {
+		if _, err := c.r.ReadBytes(syncDelimiter); err != nil {
+			return fmt.Errorf("qga: sync: %w", err)
+		}
+		line, err := c.r.ReadBytes('\n')
+		if err != nil {
+			return fmt.Errorf("qga: sync: %w", err)
+		}
+		var resp struct {
+			Return int64 `json:"return"`
+		}
+		if json.Unmarshal(line, &resp) == nil && resp.Return == id {
+			return nil
+		}
+	}
+}
+
+func (c *Client) write(ctx context.Context, prefix []byte, req request) error {
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = c.conn.SetDeadline(deadline)
+	}
+	buf := append(append(prefix, payload...), '\n')
+	_, err = c.conn.Write(buf)
+	return err
+}
+
+func (c *Client) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if _, ok := ctx.Deadline(); ok {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, c.timeout)
+}
+
+// fail closes a session whose request/reply pairing can no longer be trusted.
+func (c *Client) fail(err error) error {
+	c.closed = true
+	c.conn.Close()
+	return err
+}
@@ -0,0 +1,115 @@
+package qga
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// fakeAgent speaks just enough of the guest agent protocol to exercise the
+// client. stale is written before anything else, as a previous session's
+// leftover reply would be. handle answers every non-sync command.
+func fakeAgent(t *testing.T, stale string, handle func(enc *json.Encoder, cmd map[string]interface{})) *Client {
+	t.Helper()
+	server, client := net.Pipe()
+	go func() {
+		defer server.Close()
+		r := bufio.NewReader(server)
+		for {
+			line, err := r.ReadBytes('\n')
+			if err != nil {
+				return
+			}
+			var cmd map[string]interface{}
+			if err := json.Unmarshal(bytes.TrimLeft(line, "\xff"), &cmd); err != nil {
+				continue
+			}
+			if cmd["execute"] == "guest-sync-delimited" {
+				id := cmd["arguments"].(map[string]interface{})["id"]
+				server.Write([]byte(stale))
+				server.Write([]byte{syncDelimiter})
+				_ = json.NewEncoder(server).Encode(map[string]interface{}{"return": id})
+				continue
+			}
+			handle(json.NewEncoder(server), cmd)
+		}
+	}()
+
+	c, err := NewClient(client, time.Second)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestClientSyncSkipsStaleReplies(t *testing.T) {
+	c := fakeAgent(t, "{\"return\": {\"host-name\": \"stale\"}}\n", func(enc *json.Encoder, cmd map[string]interface{}) {
+		if cmd["execute"] == "guest-get-host-name" {
+			_ = enc.Encode(map[string]interface{}{"return": map[string]string{"host-name": "web-1"}})
+		}
+	})
+
+	name, err := c.HostName(context.Background())
+	if err != nil {
+		t.Fatalf("HostName failed: %v", err)
+	}
+	if name != "web-1" {
+		t.Fatalf("HostName = %q, want web-1", name)
+	}
+}
+
+func TestClientDecodesGuestInfo(t *testing.T) {
+	c := fakeAgent(t, "", func(enc *json.Encoder, cmd map[string]interface{}) {
+		switch cmd["execute"] {
+		case "guest-network-get-interfaces":
+			_ = enc.Encode(map[string]interface{}{"return": []map[string]interface{}{{
+				"name":         "eth0",
+				"ip-addresses": []map[string]interface{}{{"ip-address-type": "ipv4", "ip-address": "10.0.2.15", "prefix": 24}},
+			}}})
+		case "guest-get-fsinfo":
+			_ = enc.Encode(map[string]interface{}{"return": []map[string]interface{}{{
+				"name": "vda1", "mountpoint": "/", "type": "ext4", "used-bytes": 1024, "total-bytes": 4096,
+			}}})
+		}
+	})
+
+	ifaces, err := c.NetworkInterfaces(context.Background())
+	if err != nil || len(ifaces) != 1 || ifaces[0].IPAddresses[0].Address != "10.0.2.15" {
+		t.Fatalf("NetworkInterfaces = %+v, %v", ifaces, err)
+	}
+	fs, err := c.FSInfo(context.Background())
+	if err != nil || len(fs) != 1 || fs[0].UsedBytes == nil || *fs[0].TotalBytes != 4096 {
+		t.Fatalf("FSInfo = %+v, %v", fs, err)
+	}
+}
+
+func TestClientReturnsAgentError(t *testing.T) {
+	c := fakeAgent(t, "", func(enc *json.Encoder, cmd map[string]interface{}) {
+		_ = enc.Encode(map[string]interface{}{"error": map[string]string{"class": "CommandNotFound", "desc": "disabled"}})
+	})
+
+	_, err := c.FSFreeze(context.Background())
+	var agentErr *Error
+	if !errors.As(err, &agentErr) || agentErr.Class != "CommandNotFound" {
+		t.Fatalf("expected agent error, got %v", err)
+	}
+}
+
+func TestClientClosesAfterTimeout(t *testing.T) {
+	c := fakeAgent(t, "", func(enc *json.Encoder, cmd map[string]interface{}) {})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := c.Ping(ctx); err == nil {
+		t.Fatal("expected Ping to time out")
+	}
+	if err := c.Ping(context.Background()); !errors.Is(err, ErrClosed) {
+		t.Fatalf("expected ErrClosed after a broken exchange, got %v", err)
+	}
+}
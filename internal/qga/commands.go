@@ -0,0 +1,101 @@
+package qga
+
+import "context"
+
+// IPAddress is one address of a guest network interface.
+type IPAddress struct {
+	Type    string `json:"ip-address-type"` // ipv4 or ipv6
+	Address string `json:"ip-address"`
+	Prefix  int    `json:"prefix"`
+}
+
+// NetworkInterface is an entry of guest-network-get-interfaces.
+type NetworkInterface struct {
+	Name            string      `json:"name"`
+	HardwareAddress string      `json:"hardware-address,omitempty"`
+	IPAddresses     []IPAddress `json:"ip-addresses,omitempty"`
+}
+
+// OSInfo is the reply of guest-get-osinfo. Fields the guest cannot
+// determine are left empty.
+type OSInfo struct {
+	ID            string `json:"id,omitempty"`
+	Name          string `json:"name,omitempty"`
+	PrettyName    string `json:"pretty-name,omitempty"`
+	Version       string `json:"version,omitempty"`
+	VersionID     string `json:"version-id,omitempty"`
+	KernelRelease string `json:"kernel-release,omitempty"`
+	Machine       string `json:"machine,omitempty"`
+}
+
+// FSInfo is an entry of guest-get-fsinfo. Usage is omitted by older agents.
+type FSInfo struct {
+	Name       string  `json:"name"`
+	Mountpoint string  `json:"mountpoint"`
+	Type       string  `json:"type"`
+	UsedBytes  *uint64 `json:"used-bytes,omitempty"`
+	TotalBytes *uint64 `json:"total-bytes,omitempty"`
+}
+
+// Shutdown modes accepted by guest-shutdown.
+const (
+	ShutdownPowerdown = "powerdown"
+	ShutdownReboot    = "reboot"
+	ShutdownHalt      = "halt"
+)
+
+// Ping checks that the agent is responsive.
+func (c *Client) Ping(ctx context.Context) error {
+	return c.Execute(ctx, "guest-ping", nil, nil)
+}
+
+// NetworkInterfaces lists guest interfaces and their addresses.
+func (c *Client) NetworkInterfaces(ctx context.Context) ([]NetworkInterface, error) {
+	var ifaces []NetworkInterface
+	err := c.Execute(ctx, "guest-network-get-interfaces", nil, &ifaces)
+	return ifaces, err
+}
+
+// OSInfo returns the guest operating system identification.
+func (c *Client) OSInfo(ctx context.Context) (OSInfo, error) {
+	var info OSInfo
+	err := c.Execute(ctx, "guest-get-osinfo", nil, &info)
+	return info, err
+}
+
+// HostName returns the guest hostname.
+func (c *Client) HostName(ctx context.Context) (string, error) {
+	var reply struct {
+		HostName string `json:"host-name"`
+	}
+	err := c.Execute(ctx, "guest-get-host-name", nil, &reply)
+	return reply.HostName, err
+}
+
+// FSInfo lists mounted guest filesystems.
+func (c *Client) FSInfo(ctx context.Context) ([]FSInfo, error) {
+	var fs []FSInfo
+	err := c.Execute(ctx, "guest-get-fsinfo", nil, &fs)
+	return fs, err
+}
+
+// FSFreeze flushes and freezes all guest filesystems, returning how many
+// were frozen. Writes block until FSThaw.
+func (c *Client) FSFreeze(ctx context.Context) (int, error) {
+	var n int
+	err := c.Execute(ctx, "guest-fsfreeze-freeze", nil, &n)
+	return n, err
+}
+
+// FSThaw unfreezes guest filesystems, returning how many were thawed.
+func (c *Client) FSThaw(ctx context.Context) (int, error) {
+	var n int
+	err := c.Execute(ctx, "guest-fsfreeze-thaw", nil, &n)
+	return n, err
+}
+
+// Shutdown asks the guest OS to power down, reboot or halt. The agent
+// sends no reply on success.
+func (c *Client) Shutdown(ctx context.Context, mode string) error {
+	return c.Send(ctx, "guest-shutdown", map[string]string{"mode": mode})
+}
@@ -0,0 +1,316 @@
+// Package qmp implements a small typed client for the QEMU Machine Protocol.
+//
+// A Client performs the greeting and capabilities negotiation on connect,
+// serializes command execution, and routes asynchronous events to a buffered
+// channel so callers can wait on lifecycle changes instead of polling.
+package qmp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout bounds the handshake and each command when the caller does
+// not supply a context deadline.
+const DefaultTimeout = 5 * time.Second
+
+// ErrClosed is returned when the connection to the monitor is gone.
+var ErrClosed = errors.New("qmp: connection closed")
+
+// Error is a failure reported by QEMU in response to a command.
+type Error struct {
+	Class string `json:"class"`
+	Desc  string `json:"desc"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("qmp: %s: %s", e.Class, e.Desc)
+}
+
+// Version is the QEMU version advertised in the greeting.
+type Version struct {
+	Major int `json:"major"`
+	Minor int `json:"minor"`
+	Micro int `json:"micro"`
+}
+
+// Greeting is the banner QEMU sends when a client connects.
+type Greeting struct {
+	Version      Version
+	Package      string
+	Capabilities []string
+}
+
+// Event is an asynchronous notification (SHUTDOWN, STOP, RESUME, ...).
+type Event struct {
+	Name      string          `json:"event"`
+	Data      json.RawMessage `json:"data,omitempty"`
+	Timestamp time.Time       `json:"-"`
+}
+
+// message is the union of everything QEMU writes on the wire.
+type message struct {
+	QMP *struct {
+		Version struct {
+			QEMU    Version `json:"qemu"`
+			Package string  `json:"package"`
+		} `json:"version"`
+		Capabilities []string `json:"capabilities"`
+	} `json:"QMP,omitempty"`
+	Event     string          `json:"event,omitempty"`
+	Data      json.RawMessage `json:"data,omitempty"`
+	Timestamp *struct {
+		Seconds      int64 `json:"seconds"`
+		Microseconds int64 `json:"microseconds"`
+	} `json:"timestamp,omitempty"`
+	Return json.RawMessage `json:"return,omitempty"`
+	Error  *Error          `json:"error,omitempty"`
+	ID     json.RawMessage `json:"id,omitempty"`
+}
+
+type request struct {
+	Execute   string      `json:"execute"`
+	Arguments interface{} `json:"arguments,omitempty"`
+	ID        uint64      `json:"id"`
+}
+
+// Client is a connected, negotiated QMP session.
+type Client struct {
+	conn     net.Conn
+	greeting Greeting
+	timeout  time.Duration
+
+	mu      sync.Mutex // serializes Execute; QMP answers in order
+	nextID  uint64
+	replies chan message
+
+	events    chan Event
+	closing   chan struct{}
+	closeOnce sync.Once
+	done      chan struct{}
+	readErr   error
+}
+
+// Dial connects to a QMP endpoint ("unix" socket path or "tcp" host:port)
+// and completes the capabilities handshake within timeout.
+func Dial(network, address string, timeout time.Duration) (*Client, error) {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	conn, err := net.DialTimeout(network, address, timeout)
+	if err != nil {
+		return nil, err
+	}
+	c, err := NewClient(conn, timeout)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// NewClient negotiates a QMP session over an existing connection.
+func NewClient(conn net.Conn, timeout time.Duration) (*Client, error) {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	c := &Client{
+		conn:    conn,
+		timeout: timeout,
+		replies: make(chan message, 1),
+		events:  make(chan Event, 64),
+		closing: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+	reader := bufio.NewReader(conn)
+	dec := json.NewDecoder(reader)
+
+	var hello message
+	if err := dec.Decode(&hello); err != nil {
+		return nil, fmt.Errorf("qmp: read greeting: %w", err)
+	}
+	if hello.QMP == nil {
+		return nil, fmt.Errorf("qmp: unexpected greeting")
+	}
+	c.greeting = Greeting{
+		Version:      hello.QMP.Version.QEMU,
+		Package:      hello.QMP.Version.Package,
+		Capabilities: hello.QMP.Capabilities,
+	}
+
+	if err := json.NewEncoder(conn).Encode(request{Execute: "qmp_capabilities"}); err != nil {
+		return nil, fmt.Errorf("qmp: negotiate capabilities: %w", err)
+	}
+	for {
+		var resp message
+		if err := dec.Decode(&resp); err != nil {
+			return nil, fmt.Errorf("qmp: negotiate capabilities: %w", err)
+		}
+		if resp.Event != "" {
+			continue // events may race the handshake reply
+		}
+		if resp.Error != nil {
+			return nil, resp.Error
+		}
+		break
+	}
+	_ = conn.SetDeadline(time.Time{})
+
+	go c.readLoop(dec)
+	return c, nil
+}
+
+// Greeting returns the banner received on connect.
+func (c *Client) Greeting() Greeting { return c.greeting }
+
+// Events delivers asynchronous events. The channel is buffered; when the
+// consumer falls behind, the oldest unread events are dropped.
+func (c *Client) Events() <-chan Event { return c.events }
+
+// Done is closed once the connection terminates.
+func (c *Client) Done() <-chan struct{} { return c.done }
+
+// Close terminates the session.
+func (c *Client) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.closing)
+		err = c.conn.Close()
+	})
+	<-c.done
+	return err
+}
+
+// Execute runs command with optional arguments and decodes the "return"
+// payload into result (which may be nil). When ctx carries no deadline the
+// client's default timeout applies.
+func (c *Client) Execute(ctx context.Context, command string, args interface{}, result interface{}) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return c.closedErr()
+	default:
+	}
+
+	c.nextID++
+	id := c.nextID
+	payload, err := json.Marshal(request{Execute: command, Arguments: args, ID: id})
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = c.conn.SetWriteDeadline(deadline)
+	}
+	if _, err := c.conn.Write(append(payload, '\n')); err != nil {
+		return fmt.Errorf("qmp: %s: %w", command, err)
+	}
+
+	want := fmt.Sprintf("%d", id)
+	for {
+		select {
+		case resp := <-c.replies:
+			if len(resp.ID) > 0 && string(resp.ID) != want {
+				continue // stale reply from a command that timed out earlier
+			}
+			if resp.Error != nil {
+				return resp.Error
+			}
+			if result != nil && len(resp.Return) > 0 {
+				if err := json.Unmarshal(resp.Return, result); err != nil {
+					return fmt.Errorf("qmp: %s: decode reply: %w", command, err)
+				}
+			}
+			return nil
+		case <-c.done:
+			return c.closedErr()
+		case <-ctx.Done():
+			return fmt.Errorf("qmp: %s: %w", command, ctx.Err())
+		}
+	}
+}
+
+// WaitEvent blocks until one of the named events arrives (any event when no
+// names are given), the connection closes, or ctx expires.
+func (c *Client) WaitEvent(ctx context.Context, names ...string) (Event, error) {
+	for {
+		select {
+		case ev := <-c.events:
+			if len(names) == 0 {
+				return ev, nil
+			}
+			for _, n := range names {
+				if ev.Name == n {
+					return ev, nil
+				}
+			}
+		case <-c.done:
+			return Event{}, c.closedErr()
+		case <-ctx.Done():
+			return Event{}, ctx.Err()
+		}
+	}
+}
+
+func (c *Client) readLoop(dec *json.Decoder) {
+	defer close(c.done)
+	for {
+		var msg message
+		if err := dec.Decode(&msg); err != nil {
+			c.readErr = err
+			return
+		}
+		if msg.Event != "" {
+			ev := Event{Name: msg.Event, Data: msg.Data}
+			if msg.Timestamp != nil {
+				ev.Timestamp = time.Unix(msg.Timestamp.Seconds, msg.Timestamp.Microseconds*1000)
+			}
+			c.pushEvent(ev)
+			continue
+		}
+		select {
+		case c.replies <- msg:
+		case <-c.closing:
+			return
+		}
+	}
+}
+
+func (c *Client) pushEvent(ev Event) {
+	for {
+		select {
+		case c.events <- ev:
+			return
+		default:
+		}
+		select {
+		case <-c.events:
+		default:
+		}
+	}
+}
+
+func (c *Client) closedErr() error {
+	if c.readErr != nil && !errors.Is(c.readErr, net.ErrClosed) {
+		return fmt.Errorf("%w: %v", ErrClosed, c.readErr)
+	}
+	return ErrClosed
+}
@@ -0,0 +1,131 @@
+package qmp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// fakeMonitor speaks just enough QMP to exercise the client. handle receives
+// each decoded command and writes whatever replies/events it wants.
+func fakeMonitor(t *testing.T, handle func(enc *json.Encoder, cmd map[string]interface{})) *Client {
+	t.Helper()
+	server, client := net.Pipe()
+	go func() {
+		defer server.Close()
+		enc := json.NewEncoder(server)
+		_ = enc.Encode(map[string]interface{}{
+			"QMP": map[string]interface{}{
+				"version":      map[string]interface{}{"qemu": map[string]int{"major": 8, "minor": 2, "micro": 0}, "package": ""},
+				"capabilities": []string{"oob"},
+			},
+		})
+		dec := json.NewDecoder(bufio.NewReader(server))
+		for {
+			var cmd map[string]interface{}
+			if err := dec.Decode(&cmd); err != nil {
+				return
+			}
+			if cmd["execute"] == "qmp_capabilities" {
+				_ = enc.Encode(map[string]interface{}{"return": map[string]interface{}{}})
+				continue
+			}
+			handle(enc, cmd)
+		}
+	}()
+
+	c, err := NewClient(client, time.Second)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestClientNegotiatesAndQueriesStatus(t *testing.T) {
+	c := fakeMonitor(t, func(enc *json.Encoder, cmd map[string]interface{}) {
+		if cmd["execute"] != "query-status" {
+			t.Errorf("unexpected command %v", cmd["execute"])
+			return
+		}
+		_ = enc.Encode(map[string]interface{}{
+			"return": map[string]interface{}{"running": false, "status": "paused"},
+			"id":     cmd["id"],
+		})
+	})
+
+	if got := c.Greeting().Version.Major; got != 8 {
+		t.Fatalf("greeting major = %d, want 8", got)
+	}
+	st, err := c.QueryStatus(context.Background())
+	if err != nil {
+		t.Fatalf("QueryStatus failed: %v", err)
+	}
+	if st.Status != StatusPaused || st.Running {
+		t.Fatalf("status = %+v, want paused", st)
+	}
+}
+
+func TestClientReturnsQMPError(t *testing.T) {
+	c := fakeMonitor(t, func(enc *json.Encoder, cmd map[string]interface{}) {
+		_ = enc.Encode(map[string]interface{}{
+			"error": map[string]string{"class": "CommandNotFound", "desc": "The command nope has not been found"},
+			"id":    cmd["id"],
+		})
+	})
+
+	err := c.Execute(context.Background(), "nope", nil, nil)
+	var qerr *Error
+	if !errors.As(err, &qerr) || qerr.Class != "CommandNotFound" {
+		t.Fatalf("expected CommandNotFound error, got %v", err)
+	}
+}
+
+func TestClientRoutesEventsAroundReplies(t *testing.T) {
+	c := fakeMonitor(t, func(enc *json.Encoder, cmd map[string]interface{}) {
+		_ = enc.Encode(map[string]interface{}{
+			"event":     EventPowerdown,
+			"timestamp": map[string]int64{"seconds": 1700000000, "microseconds": 5},
+		})
+		_ = enc.Encode(map[string]interface{}{"return": map[string]interface{}{}, "id": cmd["id"]})
+		_ = enc.Encode(map[string]interface{}{"event": EventShutdown, "data": map[string]interface{}{"guest": true}})
+	})
+
+	if err := c.SystemPowerdown(context.Background()); err != nil {
+		t.Fatalf("SystemPowerdown failed: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	ev, err := c.WaitEvent(ctx, EventShutdown)
+	if err != nil {
+		t.Fatalf("WaitEvent failed: %v", err)
+	}
+	if ev.Name != EventShutdown || len(ev.Data) == 0 {
+		t.Fatalf("unexpected event %+v", ev)
+	}
+}
+
+func TestClientExecuteTimesOut(t *testing.T) {
+	c := fakeMonitor(t, func(enc *json.Encoder, cmd map[string]interface{}) {
+		// Never answer.
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := c.Execute(ctx, "query-status", nil, nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline error, got %v", err)
+	}
+}
+
+func TestClientReportsClosedConnection(t *testing.T) {
+	c := fakeMonitor(t, func(enc *json.Encoder, cmd map[string]interface{}) {})
+	c.Close()
+	if err := c.Execute(context.Background(), "query-status", nil, nil); !errors.Is(err, ErrClosed) {
+		t.Fatalf("expected ErrClosed, got %v", err)
+	}
+}
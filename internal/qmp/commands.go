@@ -0,0 +1,244 @@
+package qmp
+
+import "context"
+
+// Run states reported by query-status that Nido surfaces to users.
+const (
+	StatusRunning       = "running"
+	StatusPaused        = "paused"
+	StatusGuestPanicked = "guest-panicked"
+	StatusShutdown      = "shutdown"
+	StatusSuspended     = "suspended"
+	StatusInternalError = "internal-error"
+	StatusIOError       = "io-error"
+)
+
+// Lifecycle events emitted by QEMU.
+const (
+	EventShutdown      = "SHUTDOWN"
+	EventPowerdown     = "POWERDOWN"
+	EventReset         = "RESET"
+	EventStop          = "STOP"
+	EventResume        = "RESUME"
+	EventGuestPanicked = "GUEST_PANICKED"
+	// EventDeviceDeleted reports that the guest released an unplugged device.
+	EventDeviceDeleted = "DEVICE_DELETED"
+)
+
+// StatusInfo is the reply of query-status.
+type StatusInfo struct {
+	Running    bool   `json:"running"`
+	Singlestep bool   `json:"singlestep,omitempty"`
+	Status     string `json:"status"`
+}
+
+// KeyValue identifies a key for send-key, either by QEMU qcode ("ret", "a",
+// "ctrl") or by raw scancode number.
+type KeyValue struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+}
+
+// QCode builds a KeyValue from a QEMU key name.
+func QCode(name string) KeyValue {
+	return KeyValue{Type: "qcode", Data: name}
+}
+
+// QueryStatus returns the current VM run state.
+func (c *Client) QueryStatus(ctx context.Context) (StatusInfo, error) {
+	var info StatusInfo
+	err := c.Execute(ctx, "query-status", nil, &info)
+	return info, err
+}
+
+// SystemPowerdown presses the virtual ACPI power button. The guest decides
+// whether and when to honor it.
+func (c *Client) SystemPowerdown(ctx context.Context) error {
+	return c.Execute(ctx, "system_powerdown", nil, nil)
+}
+
+// Quit terminates QEMU immediately without notifying the guest.
+func (c *Client) Quit(ctx context.Context) error {
+	return c.Execute(ctx, "quit", nil, nil)
+}
+
+// Stop pauses guest execution.
+func (c *Client) Stop(ctx context.Context) error {
+	return c.Execute(ctx, "stop", nil, nil)
+}
+
+// Cont resumes guest execution.
+func (c *Client) Cont(ctx context.Context) error {
+	return c.Execute(ctx, "cont", nil, nil)
+}
+
+// SendKey presses the given keys simultaneously (a chord) and releases them.
+func (c *Client) SendKey(ctx context.Context, keys ...KeyValue) error {
+	return c.Execute(ctx, "send-key", map[string]interface{}{"keys": keys}, nil)
+}
+
+// InputEvent is one event of input-send-event.
+type InputEvent struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+}
+
+// AbsMax is the largest absolute pointer coordinate; 0..AbsMax spans the
+// whole display on each axis.
+const AbsMax = 0x7fff
+
+// AbsEvent moves an absolute pointer (e.g. a USB tablet) on axis "x" or "y".
+func AbsEvent(axis string, value int) InputEvent {
+	return InputEvent{Type: "abs", Data: map[string]interface{}{"axis": axis, "value": value}}
+}
+
+// BtnEvent presses or releases a pointer button ("left", "right", "middle").
+func BtnEvent(button string, down bool) InputEvent {
+	return InputEvent{Type: "btn", Data: map[string]interface{}{"button": button, "down": down}}
+}
+
+// InputSendEvent injects pointer and keyboard events in order.
+func (c *Client) InputSendEvent(ctx context.Context, events ...InputEvent) error {
+	return c.Execute(ctx, "input-send-event", map[string]interface{}{"events": events}, nil)
+}
+
+// HumanMonitorCommand runs a legacy HMP command and returns its text output.
+func (c *Client) HumanMonitorCommand(ctx context.Context, commandLine string) (string, error) {
+	var out string
+	err := c.Execute(ctx, "human-monitor-command", map[string]interface{}{"command-line": commandLine}, &out)
+	return out, err
+}
+
+// BlockInfo is one entry of query-block.
+type BlockInfo struct {
+	Device   string `json:"device"`
+	QDev     string `json:"qdev,omitempty"`
+	Inserted *struct {
+		File     string `json:"file"`
+		NodeName string `json:"node-name"`
+		RO       bool   `json:"ro"`
+		Image    struct {
+			VirtualSize int64 `json:"virtual-size"`
+		} `json:"image"`
+	} `json:"inserted,omitempty"`
+}
+
+// QueryBlock lists the block devices attached to the VM.
+func (c *Client) QueryBlock(ctx context.Context) ([]BlockInfo, error) {
+	var blocks []BlockInfo
+	err := c.Execute(ctx, "query-block", nil, &blocks)
+	return blocks, err
+}
+
+// BlockResize grows the image behind a block device to size bytes. The
+// device is addressed by its name, or by nodeName when it has none.
+func (c *Client) BlockResize(ctx context.Context, device, nodeName string, size int64) error {
+	args := map[string]interface{}{"size": size}
+	if device != "" {
+		args["device"] = device
+	} else {
+		args["node-name"] = nodeName
+	}
+	return c.Execute(ctx, "block_resize", args, nil)
+}
+
+// DeviceAdd hot-plugs a device. props are the -device properties, including
+// "driver" and "id".
+func (c *Client) DeviceAdd(ctx context.Context, props map[string]interface{}) error {
+	return c.Execute(ctx, "device_add", props, nil)
+}
+
+// DeviceDel requests removal of a device. The guest must cooperate; QEMU
+// emits DEVICE_DELETED once the device is gone.
+func (c *Client) DeviceDel(ctx context.Context, id string) error {
+	return c.Execute(ctx, "device_del", map[string]interface{}{"id": id}, nil)
+}
+
+// BlockdevAdd creates a block node from blockdev options (driver, node-name,
+// file, ...).
+func (c *Client) BlockdevAdd(ctx context.Context, opts map[string]interface{}) error {
+	return c.Execute(ctx, "blockdev-add", opts, nil)
+}
+
+// BlockdevDel removes a block node that no device uses anymore.
+func (c *Client) BlockdevDel(ctx context.Context, nodeName string) error {
+	return c.Execute(ctx, "blockdev-del", map[string]interface{}{"node-name": nodeName}, nil)
+}
+
+// NetdevAdd creates a network backend from -netdev options (type, id, ...).
+func (c *Client) NetdevAdd(ctx context.Context, opts map[string]interface{}) error {
+	return c.Execute(ctx, "netdev_add", opts, nil)
+}
+
+// NetdevDel removes a network backend.
+func (c *Client) NetdevDel(ctx context.Context, id string) error {
+	return c.Execute(ctx, "netdev_del", map[string]interface{}{"id": id}, nil)
+}
+
+// Balloon asks the guest balloon driver to resize guest memory to bytes. It
+// cannot go above the memory QEMU was started with.
+func (c *Client) Balloon(ctx context.Context, bytes int64) error {
+	return c.Execute(ctx, "balloon", map[string]interface{}{"value": bytes}, nil)
+}
+
+// BalloonInfo is the reply of query-balloon.
+type BalloonInfo struct {
+	Actual int64 `json:"actual"`
+}
+
+// QueryBalloon returns the memory currently given to the guest.
+func (c *Client) QueryBalloon(ctx context.Context) (BalloonInfo, error) {
+	var info BalloonInfo
+	err := c.Execute(ctx, "query-balloon", nil, &info)
+	return info, err
+}
+
+// MemorySizeSummary is the reply of query-memory-size-summary.
+type MemorySizeSummary struct {
+	BaseMemory int64 `json:"base-memory"`
+}
+
+// QueryMemorySizeSummary returns the boot memory size.
+func (c *Client) QueryMemorySizeSummary(ctx context.Context) (MemorySizeSummary, error) {
+	var info MemorySizeSummary
+	err := c.Execute(ctx, "query-memory-size-summary", nil, &info)
+	return info, err
+}
+
+// HotpluggableCPU is one vCPU slot of query-hotpluggable-cpus. QOMPath is
+// empty for slots without a CPU plugged in.
+type HotpluggableCPU struct {
+	Type       string                 `json:"type"`
+	VCPUsCount int                    `json:"vcpus-count"`
+	Props      map[string]interface{} `json:"props"`
+	QOMPath    string                 `json:"qom-path,omitempty"`
+}
+
+// QueryHotpluggableCPUs lists the vCPU slots up to maxcpus.
+func (c *Client) QueryHotpluggableCPUs(ctx context.Context) ([]HotpluggableCPU, error) {
+	var cpus []HotpluggableCPU
+	err := c.Execute(ctx, "query-hotpluggable-cpus", nil, &cpus)
+	return cpus, err
+}
+
+// ChardevInfo is an entry of query-chardev. FrontendOpen reports whether
+// the device side is open, e.g. whether a guest program holds a
+// virtio-serial port.
+type ChardevInfo struct {
+	Label        string `json:"label"`
+	Filename     string `json:"filename"`
+	FrontendOpen bool   `json:"frontend-open"`
+}
+
+// QueryChardev lists the character devices of the VM.
+func (c *Client) QueryChardev(ctx context.Context) ([]ChardevInfo, error) {
+	var devs []ChardevInfo
+	err := c.Execute(ctx, "query-chardev", nil, &devs)
+	return devs, err
+}
+
+// Screendump writes the primary display to filename as a binary PPM. The
+// path is opened by QEMU, so it must be writable by the QEMU process.
+func (c *Client) Screendump(ctx context.Context, filename string) error {
+	return c.Execute(ctx, "screendump", map[string]interface{}{"filename": filename}, nil)
+}
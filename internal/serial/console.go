@@ -0,0 +1,49 @@
+package serial
+
+import (
+	"bytes"
+	"io"
+	"net"
+)
+
+// EscapeKey ends a console session: Ctrl-], as in telnet and virsh.
+const EscapeKey = 0x1d
+
+// Attach connects to a relay's console socket and copies in to the guest and
+// the guest's output to out until the escape key is read from in, in ends,
+// or the VM goes away. The caller puts the terminal in raw mode.
+func Attach(consoleSocket string, in io.Reader, out io.Writer) error {
+	conn, err := net.Dial("unix", consoleSocket)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		_, _ = io.Copy(out, conn)
+		done <- struct{}{}
+	}()
+	go func() {
+		buf := make([]byte, 256)
+		for {
+			n, err := in.Read(buf)
+			if n > 0 {
+				chunk := buf[:n]
+				i := bytes.IndexByte(chunk, EscapeKey)
+				if i >= 0 {
+					chunk = chunk[:i]
+				}
+				if _, werr := conn.Write(chunk); werr != nil || i >= 0 {
+					break
+				}
+			}
+			if err != nil {
+				break
+			}
+		}
+		done <- struct{}{}
+	}()
+	<-done
+	return nil
+}
@@ -0,0 +1,212 @@
+// Package serial shares a VM serial port between a rotating log and any
+// number of interactive consoles.
+//
+// QEMU exposes the port as a single-client socket. A Relay holds that
+// connection for the lifetime of the VM, writes every line to a size-capped
+// log with a timestamp, and serves console clients on a second socket.
+package serial
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Line is one line of serial output.
+type Line struct {
+	Time time.Time `json:"time"`
+	Text string    `json:"text"`
+}
+
+// LogWriter appends serial output to path, prefixing each line with the
+// time its first byte arrived. When the file exceeds MaxBytes it is moved
+// to path.1, so the log never holds more than about twice MaxBytes.
+type LogWriter struct {
+	Path     string
+	MaxBytes int64
+
+	mu          sync.Mutex
+	f           *os.File
+	size        int64
+	atLineStart bool
+	now         func() time.Time
+}
+
+// NewLogWriter opens (or continues) the log at path.
+func NewLogWriter(path string, maxBytes int64) (*LogWriter, error) {
+	w := &LogWriter{Path: path, MaxBytes: maxBytes, atLineStart: true, now: time.Now}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *LogWriter) open() error {
+	f, err := os.OpenFile(w.Path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	w.f, w.size, w.atLineStart = f, info.Size(), true
+	last := make([]byte, 1)
+	if w.size > 0 {
+		if _, err := f.ReadAt(last, w.size-1); err == nil && last[0] != '\n' {
+			// A previous relay stopped mid-line; end it so the next line
+			// gets its own timestamp.
+			n, _ := f.Write([]byte("\n"))
+			w.size += int64(n)
+		}
+	}
+	return nil
+}
+
+// Write logs p. Rotation only happens between lines.
+func (w *LogWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var buf bytes.Buffer
+	for _, b := range p {
+		if w.atLineStart {
+			buf.WriteString(w.now().UTC().Format(time.RFC3339Nano))
+			buf.WriteByte('\t')
+			w.atLineStart = false
+		}
+		buf.WriteByte(b)
+		if b == '\n' {
+			w.atLineStart = true
+			if w.size+int64(buf.Len()) >= w.MaxBytes {
+				if err := w.flush(&buf); err != nil {
+					return 0, err
+				}
+				if err := w.rotate(); err != nil {
+					return 0, err
+				}
+			}
+		}
+	}
+	if err := w.flush(&buf); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *LogWriter) flush(buf *bytes.Buffer) error {
+	n, err := w.f.Write(buf.Bytes())
+	w.size += int64(n)
+	buf.Reset()
+	return err
+}
+
+func (w *LogWriter) rotate() error {
+	w.f.Close()
+	if err := os.Rename(w.Path, w.Path+".1"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return w.open()
+}
+
+// Close closes the log file.
+func (w *LogWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.f.Close()
+}
+
+// parseLine splits a logged line into its timestamp and text. Lines without
+// a timestamp (e.g. a plain QEMU serial file) keep a zero Time.
+func parseLine(raw string) Line {
+	raw = strings.TrimRight(raw, "\r\n")
+	if i := strings.IndexByte(raw, '\t'); i > 0 {
+		if t, err := time.Parse(time.RFC3339Nano, raw[:i]); err == nil {
+			return Line{Time: t, Text: strings.TrimRight(raw[i+1:], "\r")}
+		}
+	}
+	return Line{Text: raw}
+}
+
+// ReadLog returns the complete lines of the rotated and current log at or
+// after since (zero for everything), oldest first. A missing log is empty.
+func ReadLog(path string, since time.Time) ([]Line, error) {
+	var lines []Line
+	for _, p := range []string{path + ".1", path} {
+		data, err := os.ReadFile(p)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, raw := range strings.SplitAfter(string(data), "\n") {
+			if !strings.HasSuffix(raw, "\n") {
+				continue
+			}
+			l := parseLine(raw)
+			if since.IsZero() || !l.Time.Before(since) {
+				lines = append(lines, l)
+			}
+		}
+	}
+	return lines, nil
+}
+
+// Follow calls emit for every complete line appended to the log at path
+// after offset, polling until ctx ends or alive reports false. A rotation
+// restarts reading at the beginning of the new file.
+func Follow(ctx context.Context, path string, offset int64, alive func() bool, emit func(Line)) error {
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+	var partial string
+	var last os.FileInfo
+	for {
+		f, err := os.Open(path)
+		if err == nil {
+			if info, err := f.Stat(); err == nil {
+				if last != nil && !os.SameFile(last, info) || info.Size() < offset {
+					offset, partial = 0, ""
+				}
+				last = info
+			}
+			if _, err := f.Seek(offset, io.SeekStart); err == nil {
+				r := bufio.NewReader(f)
+				for {
+					chunk, err := r.ReadString('\n')
+					offset += int64(len(chunk))
+					partial += chunk
+					if err != nil {
+						break
+					}
+					emit(parseLine(partial))
+					partial = ""
+				}
+			}
+			f.Close()
+		}
+		if !alive() {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Size returns the current size of the log at path, the offset Follow
+// starts from to skip what ReadLog already returned.
+func Size(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
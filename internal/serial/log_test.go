@@ -0,0 +1,119 @@
+package serial
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestWriter(t *testing.T, path string, maxBytes int64, clock *time.Time) *LogWriter {
+	t.Helper()
+	w, err := NewLogWriter(path, maxBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.now = func() time.Time { return *clock }
+	t.Cleanup(func() { w.Close() })
+	return w
+}
+
+func TestLogWriterTimestampsLinesAcrossWrites(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vm.serial.log")
+	clock := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	w := newTestWriter(t, path, 1<<20, &clock)
+
+	_, _ = w.Write([]byte("Booting "))
+	clock = clock.Add(time.Second)
+	_, _ = w.Write([]byte("kernel\r\nlogin: "))
+
+	lines, err := ReadLog(path, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 1 || lines[0].Text != "Booting kernel" || !lines[0].Time.Equal(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Fatalf("lines = %+v, want one timestamped line without the partial prompt", lines)
+	}
+}
+
+func TestLogWriterRotatesAtLineBoundary(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vm.serial.log")
+	clock := time.Now()
+	w := newTestWriter(t, path, 100, &clock)
+
+	for i := 0; i < 10; i++ {
+		_, _ = w.Write([]byte(strings.Repeat("x", 20) + "\n"))
+	}
+	for _, p := range []string{path, path + ".1"} {
+		info, err := os.Stat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() > 200 {
+			t.Fatalf("%s is %d bytes, want it capped near MaxBytes", p, info.Size())
+		}
+		data, _ := os.ReadFile(p)
+		if len(data) > 0 && data[len(data)-1] != '\n' {
+			t.Fatalf("%s ends mid-line", p)
+		}
+	}
+	lines, err := ReadLog(path, time.Time{})
+	if err != nil || len(lines) == 0 || len(lines) >= 10 {
+		t.Fatalf("ReadLog() = %d lines, %v; want a rotated subset", len(lines), err)
+	}
+}
+
+func TestNewLogWriterTerminatesPartialLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vm.serial.log")
+	if err := os.WriteFile(path, []byte("2026-01-02T03:04:05Z\tlogin: "), 0644); err != nil {
+		t.Fatal(err)
+	}
+	clock := time.Date(2026, 1, 2, 4, 0, 0, 0, time.UTC)
+	w := newTestWriter(t, path, 1<<20, &clock)
+	_, _ = w.Write([]byte("second boot\n"))
+
+	lines, _ := ReadLog(path, time.Time{})
+	if len(lines) != 2 || lines[0].Text != "login: " || lines[1].Text != "second boot" {
+		t.Fatalf("lines = %+v", lines)
+	}
+}
+
+func TestReadLogFiltersSinceAcrossRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vm.serial.log")
+	_ = os.WriteFile(path+".1", []byte("2026-01-02T03:00:00Z\told\n2026-01-02T03:10:00Z\tkept-rotated\n"), 0644)
+	_ = os.WriteFile(path, []byte("plain qemu line\n2026-01-02T03:20:00Z\tkept\n"), 0644)
+
+	lines, err := ReadLog(path, time.Date(2026, 1, 2, 3, 5, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, l := range lines {
+		got = append(got, l.Text)
+	}
+	if strings.Join(got, ",") != "kept-rotated,kept" {
+		t.Fatalf("lines = %v", got)
+	}
+}
+
+func TestFollowEmitsAppendedLinesUntilDead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vm.serial.log")
+	_ = os.WriteFile(path, []byte("2026-01-02T03:00:00Z\tseen\n"), 0644)
+	offset := Size(path)
+
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	_, _ = f.WriteString("2026-01-02T03:00:01Z\tnew\n2026-01-02T03:00:02Z\tpart")
+	f.Close()
+
+	var got []string
+	polls := 0
+	alive := func() bool { polls++; return polls < 2 }
+	if err := Follow(context.Background(), path, offset, alive, func(l Line) { got = append(got, l.Text) }); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(got, ",") != "new" {
+		t.Fatalf("Follow emitted %v, want only the new complete line", got)
+	}
+}
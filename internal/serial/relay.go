@@ -0,0 +1,124 @@
+package serial
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// clientWriteTimeout drops console clients that stop reading, so a stuck
+// terminal never stalls the log.
+const clientWriteTimeout = 2 * time.Second
+
+// Relay owns the QEMU end of a serial port. Output goes to Log and to every
+// connected console; console input goes back to the guest.
+type Relay struct {
+	// SerialSocket is the QEMU chardev socket (server=on).
+	SerialSocket string
+	// ConsoleSocket is where console clients connect.
+	ConsoleSocket string
+	Log           io.Writer
+
+	mu      sync.Mutex
+	clients map[net.Conn]struct{}
+}
+
+// Run connects to the serial socket, waiting up to dialTimeout for QEMU to
+// create it, and relays until QEMU closes the port.
+func (r *Relay) Run(dialTimeout time.Duration) error {
+	serialConn, err := dialRetry(r.SerialSocket, dialTimeout)
+	if err != nil {
+		return err
+	}
+	defer serialConn.Close()
+
+	_ = os.Remove(r.ConsoleSocket)
+	ln, err := net.Listen("unix", r.ConsoleSocket)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(r.ConsoleSocket)
+	defer ln.Close()
+
+	r.clients = map[net.Conn]struct{}{}
+	go r.accept(ln, serialConn)
+
+	buf := make([]byte, 4096)
+	for {
+		n, err := serialConn.Read(buf)
+		if n > 0 {
+			if r.Log != nil {
+				_, _ = r.Log.Write(buf[:n])
+			}
+			r.broadcast(buf[:n])
+		}
+		if err != nil {
+			r.closeClients()
+			if errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+func (r *Relay) accept(ln net.Listener, serialConn net.Conn) {
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		r.mu.Lock()
+		r.clients[c] = struct{}{}
+		r.mu.Unlock()
+		go func() {
+			_, _ = io.Copy(serialConn, c)
+			r.drop(c)
+		}()
+	}
+}
+
+func (r *Relay) broadcast(p []byte) {
+	r.mu.Lock()
+	clients := make([]net.Conn, 0, len(r.clients))
+	for c := range r.clients {
+		clients = append(clients, c)
+	}
+	r.mu.Unlock()
+	for _, c := range clients {
+		_ = c.SetWriteDeadline(time.Now().Add(clientWriteTimeout))
+		if _, err := c.Write(p); err != nil {
+			r.drop(c)
+		}
+	}
+}
+
+func (r *Relay) drop(c net.Conn) {
+	r.mu.Lock()
+	delete(r.clients, c)
+	r.mu.Unlock()
+	c.Close()
+}
+
+func (r *Relay) closeClients() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for c := range r.clients {
+		c.Close()
+		delete(r.clients, c)
+	}
+}
+
+func dialRetry(path string, timeout time.Duration) (net.Conn, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		c, err := net.DialTimeout("unix", path, time.Second)
+		if err == nil || time.Now().After(deadline) {
+			return c, err
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
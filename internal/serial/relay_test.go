@@ -0,0 +1,117 @@
+//go:build !windows
+
+package serial
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRelayTeesOutputAndForwardsConsoleInput(t *testing.T) {
+	// Unix socket paths are limited to ~104 bytes; t.TempDir can exceed that.
+	dir, err := os.MkdirTemp("", "nido")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	serialPath := filepath.Join(dir, "vm.serial")
+	ln, err := net.Listen("unix", serialPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	var log bytes.Buffer
+	relay := &Relay{SerialSocket: serialPath, ConsoleSocket: filepath.Join(dir, "vm.console"), Log: &log}
+	done := make(chan error, 1)
+	go func() { done <- relay.Run(5 * time.Second) }()
+
+	guest, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var console net.Conn
+	deadline := time.Now().Add(5 * time.Second)
+	for console == nil {
+		console, err = net.Dial("unix", relay.ConsoleSocket)
+		if err != nil && time.Now().After(deadline) {
+			t.Fatal(err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	defer console.Close()
+	time.Sleep(50 * time.Millisecond) // let the relay register the client
+
+	if _, err := guest.Write([]byte("login: ")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 7)
+	_ = console.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.ReadFull(console, buf); err != nil || string(buf) != "login: " {
+		t.Fatalf("console read %q, %v", buf, err)
+	}
+
+	if _, err := console.Write([]byte("root\n")); err != nil {
+		t.Fatal(err)
+	}
+	in := make([]byte, 5)
+	_ = guest.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.ReadFull(guest, in); err != nil || string(in) != "root\n" {
+		t.Fatalf("guest read %q, %v", in, err)
+	}
+
+	guest.Close()
+	if err := <-done; err != nil {
+		t.Fatalf("Run() = %v, want nil when QEMU closes the port", err)
+	}
+	if !strings.Contains(log.String(), "login: ") {
+		t.Fatalf("log = %q, want the guest output", log.String())
+	}
+	if _, err := os.Stat(relay.ConsoleSocket); !os.IsNotExist(err) {
+		t.Fatalf("console socket left behind: %v", err)
+	}
+}
+
+func TestAttachStopsAtEscapeKey(t *testing.T) {
+	dir, err := os.MkdirTemp("", "nido")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "vm.console")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		data, _ := io.ReadAll(c)
+		received <- string(data)
+	}()
+
+	in := strings.NewReader("ls\n" + string(rune(EscapeKey)) + "ignored")
+	if err := Attach(path, in, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-received:
+		if got != "ls\n" {
+			t.Fatalf("guest received %q, want input up to the escape key", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("console connection was not closed after the escape key")
+	}
+}
@@ -38,13 +38,15 @@ type VMItem struct {
 	SSHPort int
 	VNCPort int
 	SSHUser string
+	Labels  map[string]string
 }
 
 // VMDetailMsg contains detailed VM information.
 type VMDetailMsg struct {
-	Name   string
-	Detail provider.VMDetail
-	Err    error
+	Name      string
+	Detail    provider.VMDetail
+	Snapshots []provider.Snapshot
+	Err       error
 }
 
 // TemplateListMsg contains the list of existing templates.
@@ -124,6 +126,7 @@ func RefreshFleet(prov provider.VMProvider) tea.Cmd {
 				SSHPort: v.SSHPort,
 				VNCPort: v.VNCPort,
 				SSHUser: v.SSHUser,
+				Labels:  v.Labels,
 			})
 		}
 		return VMListMsg{Items: items}
@@ -134,7 +137,10 @@ func RefreshFleet(prov provider.VMProvider) tea.Cmd {
 func FetchVMInfo(prov provider.VMProvider, name string) tea.Cmd {
 	return func() tea.Msg {
 		detail, err := prov.Info(name)
-		return VMDetailMsg{Name: name, Detail: detail, Err: err}
+		// Snapshots are decorative in the detail view; a failing qemu-img
+		// must not hide the rest of the VM info.
+		snapshots, _ := prov.SnapshotList(name)
+		return VMDetailMsg{Name: name, Detail: detail, Snapshots: snapshots, Err: err}
 	}
 }
 
@@ -518,8 +524,24 @@ func FetchTemplatesList(prov provider.VMProvider) tea.Cmd {
 // UpdateVMConfig updates a VM's configuration.
 func UpdateVMConfig(prov provider.VMProvider, name string, updates provider.VMConfigUpdates) tea.Cmd {
 	return func() tea.Msg {
-		err := prov.UpdateConfig(name, updates)
-		return OpResultMsg{Op: "update-config", Err: err, Path: name}
+		applied, err := prov.UpdateConfig(name, updates)
+		return OpResultMsg{Op: "update-config", Err: err, Path: name, Data: applied}
+	}
+}
+
+// CreateSnapshot takes a disk snapshot of a VM.
+func CreateSnapshot(prov provider.VMProvider, name, snapshot string) tea.Cmd {
+	return func() tea.Msg {
+		err := prov.SnapshotCreate(name, snapshot)
+		return OpResultMsg{Op: "snapshot-create", Err: err, Path: name}
+	}
+}
+
+// RestoreSnapshot rewinds a stopped VM's disk to a snapshot.
+func RestoreSnapshot(prov provider.VMProvider, name, snapshot string) tea.Cmd {
+	return func() tea.Msg {
+		err := prov.SnapshotRestore(name, snapshot)
+		return OpResultMsg{Op: "snapshot-restore", Err: err, Path: name}
 	}
 }
 
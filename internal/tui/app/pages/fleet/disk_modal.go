@@ -0,0 +1,69 @@
+package fleet
+
+import (
+	"fmt"
+
+	"github.com/Josepavese/nido/internal/provider"
+	"github.com/Josepavese/nido/internal/tui/app/ops"
+	widget "github.com/Josepavese/nido/internal/tui/kit/widget"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// ResizeDiskModal asks for the new size of a VM root disk.
+type ResizeDiskModal struct {
+	VMName string
+
+	prov  provider.VMProvider
+	Modal *widget.FormModal
+}
+
+// NewResizeDiskModal creates the modal.
+func NewResizeDiskModal(prov provider.VMProvider) *ResizeDiskModal {
+	m := &ResizeDiskModal{prov: prov}
+
+	m.Modal = widget.NewFormModal(
+		"Grow Disk",
+		func(res map[string]string) tea.Cmd {
+			return m.HandleSubmit(res["size"])
+		},
+		nil,
+	)
+
+	m.Modal.AddRow(&widget.FormEntry{
+		Key:         "size",
+		Label:       "New Size",
+		Placeholder: "e.g. +20G or 60G",
+		Validator:   provider.ValidateDiskSize,
+		Width:       30,
+	})
+
+	return m
+}
+
+// HandleSubmit grows the disk through UpdateConfig.
+func (m *ResizeDiskModal) HandleSubmit(size string) tea.Cmd {
+	return ops.UpdateVMConfig(m.prov, m.VMName, provider.VMConfigUpdates{DiskSize: &size})
+}
+
+// Show opens the modal for the given VM.
+func (m *ResizeDiskModal) Show(vmName string) tea.Cmd {
+	m.VMName = vmName
+	m.Modal.Description = fmt.Sprintf("Grow the disk of '%s'. The guest filesystem grows on next boot.", vmName)
+	return m.Modal.Show()
+}
+
+// IsActive returns the state.
+func (m *ResizeDiskModal) IsActive() bool {
+	return m.Modal.IsActive()
+}
+
+// Update handles input events.
+func (m *ResizeDiskModal) Update(msg tea.Msg) tea.Cmd {
+	_, cmd := m.Modal.Update(msg)
+	return cmd
+}
+
+// View renders the modal overlay.
+func (m *ResizeDiskModal) View(parentWidth, parentHeight int) string {
+	return m.Modal.View(parentWidth, parentHeight)
+}
@@ -0,0 +1,70 @@
+package fleet
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Josepavese/nido/internal/provider"
+	widget "github.com/Josepavese/nido/internal/tui/kit/widget"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// FilterModal asks for the label selector that narrows the fleet sidebar.
+type FilterModal struct {
+	Modal *widget.FormModal
+}
+
+// NewFilterModal creates the modal; onApply receives the new selector,
+// empty to show every VM again.
+func NewFilterModal(onApply func(selector string) tea.Cmd) *FilterModal {
+	m := &FilterModal{}
+
+	m.Modal = widget.NewFormModal(
+		"Filter Fleet",
+		func(res map[string]string) tea.Cmd {
+			return onApply(res["selector"])
+		},
+		nil,
+	)
+
+	m.Modal.AddRow(&widget.FormEntry{
+		Key:         "selector",
+		Label:       "Label Selector",
+		Placeholder: "e.g. team=search,purpose!=eval",
+		Validator: func(s string) error {
+			if strings.TrimSpace(s) == "" {
+				return nil // clears the filter
+			}
+			_, err := provider.ParseSelector(s)
+			return err
+		},
+		Width: 30,
+	})
+
+	return m
+}
+
+// Show opens the modal, mentioning the selector currently applied.
+func (m *FilterModal) Show(current string) tea.Cmd {
+	m.Modal.Description = "Show only VMs whose labels match. Leave empty to show all."
+	if current != "" {
+		m.Modal.Description = fmt.Sprintf("Showing VMs matching '%s'. Enter a new selector, or leave empty to show all.", current)
+	}
+	return m.Modal.Show()
+}
+
+// IsActive returns the state.
+func (m *FilterModal) IsActive() bool {
+	return m.Modal.IsActive()
+}
+
+// Update handles input events.
+func (m *FilterModal) Update(msg tea.Msg) tea.Cmd {
+	_, cmd := m.Modal.Update(msg)
+	return cmd
+}
+
+// View renders the modal overlay.
+func (m *FilterModal) View(parentWidth, parentHeight int) string {
+	return m.Modal.View(parentWidth, parentHeight)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os/exec"
 	"strings"
+	"time"
 
 	"github.com/Josepavese/nido/internal/pkg/sysutil"
 	"github.com/Josepavese/nido/internal/provider"
@@ -66,6 +67,9 @@ type FleetDetail struct {
 	BackingMissing bool
 	Forwarding     []provider.PortForward
 	Accelerators   []string // New: Accelerators for PASSTHROUGH
+	Snapshots      []provider.Snapshot
+	DiskSizeBytes  int64
+	Labels         map[string]string
 }
 
 // Fleet implements the Viewlet interface using MasterDetail
@@ -93,6 +97,14 @@ type Fleet struct {
 	ErrorModal        *widget.Modal
 	ModalAccel        *widget.ListModal // Accelerator Selection
 	pendingAccelVM    string            // Track which VM we are editing
+	ModalSnapshot     *widget.ListModal // Snapshot to restore
+	DiskModal         *ResizeDiskModal
+	FilterModal       *FilterModal
+
+	// Label selector narrowing the sidebar; empty shows every VM.
+	selector    provider.Selector
+	selectorRaw string
+	header      *widget.Card
 }
 
 // NewFleet creates the viewlet
@@ -110,6 +122,7 @@ func NewFleet(prov provider.VMProvider) *Fleet {
 		transitioning: make(map[string]bool),
 		spinner:       s,
 		TemplateModal: NewCreateTemplateModal(),
+		DiskModal:     NewResizeDiskModal(prov),
 	}
 
 	// Modal for delete confirmation (Full-screen handled by Fleet.View)
@@ -128,6 +141,23 @@ func NewFleet(prov provider.VMProvider) *Fleet {
 	)
 	f.ConfirmDelete.SetLevel(widget.ModalLevelDanger)
 
+	f.FilterModal = NewFilterModal(func(raw string) tea.Cmd {
+		raw = strings.TrimSpace(raw)
+		var sel provider.Selector
+		if raw != "" {
+			var err error
+			if sel, err = provider.ParseSelector(raw); err != nil {
+				return nil
+			}
+		}
+		f.selector, f.selectorRaw = sel, raw
+		f.header.Subtitle = "Manager"
+		if raw != "" {
+			f.header.Subtitle = raw
+		}
+		return ops.RefreshFleet(f.provider)
+	})
+
 	// Error Modal (Single button)
 	f.ErrorModal = widget.NewAlertModal(
 		"Error",
@@ -165,6 +195,15 @@ func NewFleet(prov provider.VMProvider) *Fleet {
 		return ops.UpdateVMConfig(f.provider, f.pendingAccelVM, updates)
 	}, nil)
 
+	// Snapshot Restore Modal
+	f.ModalSnapshot = widget.NewListModal("Restore Snapshot", nil, 60, 20, func(item list.Item) tea.Cmd {
+		si, ok := item.(SnapshotItem)
+		if !ok || f.detail.Name == "" {
+			return nil
+		}
+		return ops.RestoreSnapshot(f.provider, f.detail.Name, si.Snap.Name)
+	}, nil)
+
 	// 1. Sidebar (Empty initially)
 	styles := widget.SidebarStyles{
 		Normal:   t.Styles.SidebarItem,
@@ -186,9 +225,10 @@ func NewFleet(prov provider.VMProvider) *Fleet {
 		Border(lipgloss.NormalBorder(), false, true, false, false).
 		BorderForeground(t.Palette.SurfaceSubtle)
 
+	f.header = widget.NewCard(theme.IconFleet, "Fleet", "Manager")
 	f.MasterDetail = widget.NewMasterDetail(
 		widget.NewBoxedSidebar(
-			widget.NewCard(theme.IconFleet, "Fleet", "Manager"),
+			f.header,
 			f.Sidebar,
 		),
 		f.Pages,
@@ -230,6 +270,33 @@ func (f *Fleet) OpenAcceleratorModal(vmName string) tea.Cmd {
 		return nil
 	}
 }
+
+// openSnapshotModal lists the selected VM's snapshots for restore. Restoring
+// rewrites the disk, so it is only offered for stopped VMs.
+func (f *Fleet) openSnapshotModal() tea.Cmd {
+	d := f.detail
+	if d.Name == "" {
+		return nil
+	}
+	if d.State != "stopped" && d.State != "shutoff" {
+		f.ErrorModal.Title = "Cannot Restore Snapshot"
+		f.ErrorModal.Message = fmt.Sprintf("VM '%s' must be stopped before restoring a snapshot.", d.Name)
+		f.ErrorModal.Show()
+		return nil
+	}
+	if len(d.Snapshots) == 0 {
+		return nil
+	}
+
+	items := make([]list.Item, 0, len(d.Snapshots))
+	for _, s := range d.Snapshots {
+		items = append(items, SnapshotItem{Snap: s})
+	}
+	f.ModalSnapshot.List.SetItems(items)
+	f.ModalSnapshot.Show()
+	return nil
+}
+
 func (f *Fleet) Update(msg tea.Msg) (view.Viewlet, tea.Cmd) {
 	var cmds []tea.Cmd
 
@@ -251,6 +318,16 @@ func (f *Fleet) Update(msg tea.Msg) (view.Viewlet, tea.Cmd) {
 		_, cmd := f.ModalAccel.Update(msg)
 		return f, cmd
 	}
+	if f.ModalSnapshot.IsActive() {
+		_, cmd := f.ModalSnapshot.Update(msg)
+		return f, cmd
+	}
+	if f.DiskModal.IsActive() {
+		return f, f.DiskModal.Update(msg)
+	}
+	if f.FilterModal.IsActive() {
+		return f, f.FilterModal.Update(msg)
+	}
 
 	switch msg := msg.(type) {
 	// Sidebar Selection
@@ -272,12 +349,18 @@ func (f *Fleet) Update(msg tea.Msg) (view.Viewlet, tea.Cmd) {
 				targetName = sel.Title()
 			}
 
-			// 2. Update list
-			newItems := make([]widget.SidebarItem, len(msg.Items))
-			f.items = make([]FleetItem, len(msg.Items))
+			// 2. Update list, keeping only VMs the label filter matches
+			vms := make([]ops.VMItem, 0, len(msg.Items))
+			for _, v := range msg.Items {
+				if f.selector.Matches(v.Labels) {
+					vms = append(vms, v)
+				}
+			}
+			newItems := make([]widget.SidebarItem, len(vms))
+			f.items = make([]FleetItem, len(vms))
 			targetIndex := 0 // Default to first
 
-			for i, v := range msg.Items {
+			for i, v := range vms {
 				// Spinner Logic:
 				// If this item is transitioning, use the current spinner frame
 				isTransitioning := f.transitioning[v.Name]
@@ -312,6 +395,10 @@ func (f *Fleet) Update(msg tea.Msg) (view.Viewlet, tea.Cmd) {
 						return ops.VMDetailRequestMsg{Name: selected.Name}
 					})
 				}
+			} else if f.selectorRaw != "" {
+				// Nothing matches the filter: drop the stale detail.
+				f.detail = FleetDetail{}
+				f.DetailView.UpdateDetail(f.detail)
 			}
 		}
 
@@ -333,6 +420,9 @@ func (f *Fleet) Update(msg tea.Msg) (view.Viewlet, tea.Cmd) {
 				BackingMissing: msg.Detail.BackingMissing,
 				Forwarding:     msg.Detail.Forwarding,
 				Accelerators:   msg.Detail.Accelerators,
+				Snapshots:      msg.Snapshots,
+				DiskSizeBytes:  msg.Detail.DiskSizeBytes,
+				Labels:         msg.Detail.Labels,
 			}
 			f.DetailView.UpdateDetail(f.detail)
 
@@ -477,6 +567,18 @@ func (f *Fleet) Update(msg tea.Msg) (view.Viewlet, tea.Cmd) {
 					}
 				}
 			}
+		case "p":
+			// Snapshot Shortcut: timestamped name, works live or stopped
+			if f.detail.Name != "" {
+				name := "snap-" + time.Now().Format("20060102-150405")
+				cmds = append(cmds, ops.CreateSnapshot(f.provider, f.detail.Name, name))
+			}
+		case "r":
+			// Rewind Shortcut - pick a snapshot to restore
+			cmds = append(cmds, f.openSnapshotModal())
+		case "l":
+			// Label filter for the sidebar
+			cmds = append(cmds, f.FilterModal.Show(f.selectorRaw))
 		case "backspace", "delete":
 			// Delete Shortcut - show confirmation modal
 			f.ConfirmDelete.Show()
@@ -505,6 +607,15 @@ func (f *Fleet) View() string {
 	if f.ModalAccel.IsActive() {
 		return f.ModalAccel.View(f.Width(), f.Height())
 	}
+	if f.ModalSnapshot.IsActive() {
+		return f.ModalSnapshot.View(f.Width(), f.Height())
+	}
+	if f.DiskModal.IsActive() {
+		return f.DiskModal.View(f.Width(), f.Height())
+	}
+	if f.FilterModal.IsActive() {
+		return f.FilterModal.View(f.Width(), f.Height())
+	}
 	return f.MasterDetail.View()
 }
 
@@ -527,6 +638,7 @@ func (f *Fleet) Shortcuts() []view.Shortcut {
 
 	shortcuts := []view.Shortcut{
 		{Key: "↑/↓", Label: "glide"},
+		{Key: "l", Label: "filter"},
 	}
 
 	if selectedItem := f.Sidebar.SelectedItem(); selectedItem != nil {
@@ -546,7 +658,11 @@ func (f *Fleet) Shortcuts() []view.Shortcut {
 			} else {
 				// Stopped specific
 				shortcuts = append(shortcuts, view.Shortcut{Key: "t", Label: "template"})
+				if len(f.detail.Snapshots) > 0 {
+					shortcuts = append(shortcuts, view.Shortcut{Key: "r", Label: "rewind"})
+				}
 			}
+			shortcuts = append(shortcuts, view.Shortcut{Key: "p", Label: "snapshot"})
 
 			// Delete Hint (always available)
 			shortcuts = append(shortcuts, view.Shortcut{Key: "backspace", Label: "evict"})
@@ -566,7 +682,7 @@ func (f *Fleet) HandleMouse(x, y int, msg tea.MouseMsg) (view.Viewlet, tea.Cmd,
 
 // IsModalActive allows the App to block global navigation (tabs) when the modal is open.
 func (f *Fleet) IsModalActive() bool {
-	return f.ConfirmDelete.IsActive() || f.ErrorModal.IsActive() || f.TemplateModal.IsActive() || f.ModalAccel.IsActive()
+	return f.ConfirmDelete.IsActive() || f.ErrorModal.IsActive() || f.TemplateModal.IsActive() || f.ModalAccel.IsActive() || f.ModalSnapshot.IsActive() || f.DiskModal.IsActive() || f.FilterModal.IsActive()
 }
 
 // --- Detail Component ---
@@ -588,7 +704,8 @@ type ComponentsDetail struct {
 	memInput *widget.Input
 	cpuInput *widget.Input
 
-	diskInput *widget.Input
+	diskInput   *widget.Input
+	labelsInput *widget.Input
 }
 
 func NewComponentsDetail(parent *Fleet) *ComponentsDetail {
@@ -623,6 +740,9 @@ func NewComponentsDetail(parent *Fleet) *ComponentsDetail {
 	c.diskInput = widget.NewInput("Disk", "", nil)
 	c.diskInput.Disabled = true
 
+	c.labelsInput = widget.NewInput("Labels", "", nil)
+	c.labelsInput.Disabled = true
+
 	// Build form with rows
 	c.rebuildForm()
 
@@ -644,8 +764,22 @@ func (c *ComponentsDetail) rebuildForm() {
 	// 4. Resources Row (2 cols)
 	elements = append(elements, widget.NewRow(c.memInput, c.cpuInput))
 
+	// 4b. Labels
+	elements = append(elements, c.labelsInput)
+
 	// 5. Disk
 	elements = append(elements, c.diskInput)
+	if d := c.Parent.detail; d.Name != "" && !d.DiskMissing {
+		size := "unknown"
+		if d.DiskSizeBytes > 0 {
+			size = fmt.Sprintf("%.1f GB", float64(d.DiskSizeBytes)/(1<<30))
+		}
+		btnDisk := widget.NewButton("Disk Size", size+" (Grow)", func() tea.Cmd {
+			return c.Parent.DiskModal.Show(c.Parent.detail.Name)
+		})
+		btnDisk.Centered = true
+		elements = append(elements, btnDisk)
+	}
 
 	// 5. Dynamic Ports
 	forwarding := c.Parent.detail.Forwarding
@@ -717,6 +851,29 @@ func (c *ComponentsDetail) rebuildForm() {
 		elements = append(elements, accInput)
 	}
 
+	// 7. Snapshots
+	snapshots := c.Parent.detail.Snapshots
+	if len(snapshots) > 0 {
+		for _, s := range snapshots {
+			btnName := widget.NewButton("Snapshot", s.Name, nil)
+			btnName.Disabled = true
+			btnName.Centered = true
+
+			btnCreated := widget.NewButton("Created", s.CreatedAt.Format("2006-01-02 15:04"), nil)
+			btnCreated.Disabled = true
+			btnCreated.Centered = true
+
+			elements = append(elements, widget.NewRowWithWeights(
+				[]widget.Element{btnName, btnCreated},
+				[]int{1, 1},
+			))
+		}
+	} else {
+		noSnaps := widget.NewInput("Snapshots", "None", nil)
+		noSnaps.Disabled = true
+		elements = append(elements, noSnaps)
+	}
+
 	c.Form = widget.NewForm(elements...)
 	c.Form.Spacing = 0
 }
@@ -731,6 +888,7 @@ func (c *ComponentsDetail) UpdateDetail(d FleetDetail) {
 		c.pidInput.SetValue("")
 		c.ipInput.SetValue("")
 		c.diskInput.SetValue("")
+		c.labelsInput.SetValue("")
 
 		return
 	}
@@ -753,6 +911,11 @@ func (c *ComponentsDetail) UpdateDetail(d FleetDetail) {
 	c.vncInput.SetValue(fmt.Sprintf("%d", d.VNCPort))
 	c.memInput.SetValue(fmt.Sprintf("%d MB", d.MemoryMB))
 	c.cpuInput.SetValue(fmt.Sprintf("%d", d.VCPUs))
+	labels := "None"
+	if len(d.Labels) > 0 {
+		labels = strings.ReplaceAll(provider.FormatLabels(d.Labels), ",", ", ")
+	}
+	c.labelsInput.SetValue(labels)
 
 	// Disk with error highlighting
 	c.diskInput.SetValue(d.DiskPath) // Always show the path cleanly
@@ -0,0 +1,26 @@
+package fleet
+
+import (
+	"fmt"
+
+	"github.com/Josepavese/nido/internal/provider"
+	"github.com/Josepavese/nido/internal/tui/kit/theme"
+)
+
+// SnapshotItem adapts provider.Snapshot to the List interface.
+type SnapshotItem struct {
+	Snap provider.Snapshot
+}
+
+func (i SnapshotItem) Title() string { return i.Snap.Name }
+func (i SnapshotItem) Description() string {
+	desc := i.Snap.CreatedAt.Format("2006-01-02 15:04")
+	if i.Snap.VMStateSize > 0 {
+		desc = fmt.Sprintf("%s | RAM %.0f MB", desc, float64(i.Snap.VMStateSize)/1024/1024)
+	}
+	return desc
+}
+func (i SnapshotItem) FilterValue() string { return i.Snap.Name }
+func (i SnapshotItem) String() string      { return i.Title() }
+func (i SnapshotItem) Icon() string        { return theme.IconCache }
+func (i SnapshotItem) IsAction() bool      { return false }